@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/e-commerce/platform/internal/common/config"
+	"github.com/e-commerce/platform/internal/common/db"
+)
+
+func main() {
+	drop := flag.Bool("drop", false, "drop all tables before migrating, deleting their data")
+	auto := flag.Bool("auto", false, "also run GORM AutoMigrate after the versioned migrations (development only)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-drop] [-auto] up\n       %s version\n", os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 || (flag.Arg(0) != "up" && flag.Arg(0) != "version") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Load configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// Initialize database connection
+	database, err := db.NewPostgresDB(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	if flag.Arg(0) == "version" {
+		version, err := database.SchemaVersion()
+		if err != nil {
+			log.Fatalf("Failed to read schema version: %v", err)
+		}
+		fmt.Println(version)
+		return
+	}
+
+	// Drop tables to recreate them from scratch
+	if *drop {
+		log.Println("Dropping all tables...")
+		if err := database.DropSchema(); err != nil {
+			log.Fatalf("Failed to drop tables: %v", err)
+		}
+	}
+
+	// Run versioned migrations
+	log.Println("Starting database migration...")
+	applied, err := database.Migrate()
+	if err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+
+	if *auto {
+		log.Println("Running AutoMigrate...")
+		if err := database.MigrateSchema(); err != nil {
+			log.Fatalf("AutoMigrate failed: %v", err)
+		}
+	}
+
+	version, err := database.SchemaVersion()
+	if err != nil {
+		log.Fatalf("Failed to read schema version: %v", err)
+	}
+	log.Printf("Migration completed successfully, applied %d migrations, schema version %d", len(applied), version)
+}
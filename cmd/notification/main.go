@@ -6,13 +6,18 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/e-commerce/platform/internal/common/config"
 	"github.com/e-commerce/platform/internal/common/db"
 	"github.com/e-commerce/platform/internal/common/messaging"
+	"github.com/e-commerce/platform/internal/common/tracing"
 	"github.com/e-commerce/platform/internal/notification"
 )
 
+// shutdownTimeout bounds the time in-flight work may take to finish on shutdown
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	// Create context that listens for termination signals
 	ctx, cancel := context.WithCancel(context.Background())
@@ -33,6 +38,19 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// Initialize tracing, spans are exported only when an OTLP endpoint is configured
+	shutdownTracing, err := tracing.Init(ctx, "notification", cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			log.Printf("Failed to flush traces: %v", err)
+		}
+	}()
+
 	// Initialize database connection
 	database, err := db.NewPostgresDB(&cfg.Database)
 	if err != nil {
@@ -50,6 +68,14 @@ func main() {
 		log.Fatalf("Failed to start notification service: %v", err)
 	}
 
+	// Start gRPC server for inter-service queries
+	grpcServer := notification.NewGRPCServer(cfg, notificationService)
+	go func() {
+		if err := grpcServer.Start(ctx); err != nil {
+			log.Fatalf("gRPC server error: %v", err)
+		}
+	}()
+
 	// Initialize API server
 	apiServer := notification.NewAPI(database, cfg, notificationService)
 
@@ -62,4 +88,18 @@ func main() {
 	// Wait for context cancellation
 	<-ctx.Done()
 	log.Println("Shutting down notification service...")
-}
\ No newline at end of file
+
+	// The API has stopped accepting and drained requests and consumers stop
+	// reading, so wait for in-flight work before closing its connections
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer stopCancel()
+	if err := notificationService.Stop(stopCtx); err != nil {
+		log.Printf("Failed to stop notification service: %v", err)
+	}
+	if err := kafkaClient.Close(); err != nil {
+		log.Printf("Failed to close Kafka client: %v", err)
+	}
+	if err := database.Close(); err != nil {
+		log.Printf("Failed to close database: %v", err)
+	}
+}
@@ -2,15 +2,25 @@ package analyzer
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
+	"github.com/e-commerce/platform/internal/common/adminauth"
 	"github.com/e-commerce/platform/internal/common/config"
+	"github.com/e-commerce/platform/internal/common/cors"
 	"github.com/e-commerce/platform/internal/common/db"
+	"github.com/e-commerce/platform/internal/common/dbtimeout"
+	"github.com/e-commerce/platform/internal/common/httperror"
 	"github.com/e-commerce/platform/internal/common/models"
+	"github.com/e-commerce/platform/internal/common/ratelimit"
+	"github.com/e-commerce/platform/internal/common/tracing"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/time/rate"
 	"gorm.io/gorm"
 )
 
@@ -25,11 +35,18 @@ type API struct {
 // NewAPI creates a new API server
 func NewAPI(db *db.Database, config *config.Config, service *Service) *API {
 	e := echo.New()
+	e.HTTPErrorHandler = httperror.Handler
 
 	// Middleware
+	e.Use(middleware.RequestID())
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
-	e.Use(middleware.CORS())
+	e.Use(tracing.Middleware())
+	e.Use(cors.New(config.Server.AllowedOrigins("analyzer")))
+	e.Use(middleware.GzipWithConfig(middleware.GzipConfig{
+		Level:     config.Server.GzipLevel,
+		MinLength: config.Server.GzipMinLength,
+	}))
 
 	api := &API{
 		echo:    e,
@@ -49,26 +66,65 @@ func (api *API) registerRoutes() {
 	// Health check
 	api.echo.GET("/health", api.healthCheck)
 
-	// API group
-	v1 := api.echo.Group("/api/v1/analyzer")
+	// Readiness and Prometheus metrics
+	api.echo.GET("/ready", api.readyCheck)
+	api.echo.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+
+	// API group, rate limited per client with stricter limits for expensive endpoints
+	// and with the database queries of each request bounded by the query timeout
+	limits := api.config.RateLimit
+	limiter := ratelimit.New(rate.Limit(limits.RequestsPerSecond), limits.Burst)
+	v1 := api.echo.Group("/api/v1/analyzer", limiter, dbtimeout.New(api.config.Database.QueryTimeout))
+	expensive := ratelimit.New(ratelimit.PerMinute(limits.ExpensiveRequestsPerMinute), limits.ExpensiveBurst)
+
+	// On-demand analysis runs every analysis query, so it isn't bound by the query timeout
+	api.echo.POST("/api/v1/analyzer/analyze", api.analyze, limiter, adminauth.New(api.config.AdminToken))
 
 	// Stats routes
 	v1.GET("/stats/products", api.getProductStats)
 	v1.GET("/stats/prices", api.getPriceStats)
 	v1.GET("/stats/favorites", api.getFavoriteStats)
 
+	// Deal routes
+	v1.GET("/deals", api.getDeals, expensive)
+
+	// Anomaly routes
+	v1.GET("/anomalies", api.getAnomalies)
+
+	// Watched product routes
+	v1.GET("/products/watched", api.getWatchedProducts)
+
+	// Forecast routes
+	v1.GET("/products/:id/forecast", api.getProductForecast)
+
+	// Change feed routes
+	v1.GET("/products/:id/changes", api.getProductChanges)
+
 	// Trend routes
 	v1.GET("/trends/prices", api.getPriceTrends)
 	v1.GET("/trends/stock", api.getStockTrends)
 
 	// History routes
 	v1.GET("/history/prices/:id", api.getPriceHistory)
+	v1.GET("/history/prices/:id/aggregated", api.getAggregatedPriceHistory, expensive)
+	v1.POST("/history/prices/compare", api.comparePriceHistory, expensive)
 	v1.GET("/history/stock/:id", api.getStockHistory)
+	v1.GET("/history/stock/:id/transitions", api.getStockTransitions)
+	v1.GET("/history/favorites/:id", api.getFavoriteHistory)
 
 	// Alert routes
 	v1.POST("/alerts/price", api.createPriceAlert)
+	v1.POST("/alerts/price/bulk", api.createPriceAlertsBulk, expensive)
+	v1.POST("/alerts/price/backtest", api.backtestPriceAlert, expensive)
 	v1.GET("/alerts/price/user/:id", api.getUserPriceAlerts)
 	v1.DELETE("/alerts/price/:id", api.deletePriceAlert)
+	v1.POST("/alerts/category", api.createCategoryAlert)
+	v1.GET("/alerts/category/user/:id", api.getUserCategoryAlerts)
+	v1.DELETE("/alerts/category/:id", api.deleteCategoryAlert)
+
+	// Admin routes
+	admin := v1.Group("/admin", adminauth.New(api.config.AdminToken))
+	admin.POST("/reload", api.reload)
 }
 
 // Start starts the API server
@@ -76,7 +132,8 @@ func (api *API) Start(ctx context.Context) error {
 	// Server
 	go func() {
 		address := ":" + strconv.Itoa(api.config.Services.AnalyzerServicePort)
-		if err := api.echo.Start(address); err != nil && err != http.ErrServerClosed {
+		srv := api.config.Server.HTTPServer(address, api.echo)
+		if err := api.echo.StartServer(srv); err != nil && err != http.ErrServerClosed {
 			api.echo.Logger.Fatal("shutting down the server")
 		}
 	}()
@@ -91,37 +148,69 @@ func (api *API) Start(ctx context.Context) error {
 	return api.echo.Shutdown(shutdownCtx)
 }
 
-// healthCheck is a health check endpoint
+// requestDB returns the database bound to the request context, so queries are
+// cancelled when the client disconnects or the request times out
+func (api *API) requestDB(c echo.Context) *gorm.DB {
+	return api.db.WithContext(c.Request().Context())
+}
+
+// replicaDB returns the database bound to the request's context for
+// analytics queries, read from the read replica when one is configured
+func (api *API) replicaDB(c echo.Context) *gorm.DB {
+	return api.db.Replica(c.Request().Context())
+}
+
+// healthCheck is a liveness check endpoint. Dependencies are checked by
+// readyCheck instead, as restarting the service doesn't fix them.
 func (api *API) healthCheck(c echo.Context) error {
-	return c.JSON(http.StatusOK, map[string]string{
+	return c.JSON(http.StatusOK, map[string]interface{}{
 		"status":  "ok",
 		"service": "analyzer",
 	})
 }
 
+// readyCheck reports the Kafka consumer failures and lag, responding 503 while
+// a consumer keeps failing or a partition lags more than the configured maximum
+func (api *API) readyCheck(c echo.Context) error {
+	status, code := "ready", http.StatusOK
+	if !api.service.kafka.CaughtUp() {
+		status, code = "lagging", http.StatusServiceUnavailable
+	}
+	if !api.service.kafka.Healthy() {
+		status, code = "degraded", http.StatusServiceUnavailable
+	}
+
+	return c.JSON(code, map[string]interface{}{
+		"status":                  status,
+		"service":                 "analyzer",
+		"kafka_consumer_failures": api.service.kafka.ConsumerFailures(),
+		"kafka_consumer_lag":      api.service.kafka.ConsumerLag(),
+	})
+}
+
 // getProductStats returns product statistics
 func (api *API) getProductStats(c echo.Context) error {
 	// Count total products
 	var totalProducts int64
-	if err := api.db.Model(&models.Product{}).Count(&totalProducts).Error; err != nil {
+	if err := api.replicaDB(c).Model(&models.Product{}).Count(&totalProducts).Error; err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to count products")
 	}
 
 	// Count active products
 	var activeProducts int64
-	if err := api.db.Model(&models.Product{}).Where("is_active = ?", true).Count(&activeProducts).Error; err != nil {
+	if err := api.replicaDB(c).Model(&models.Product{}).Where("is_active = ?", true).Count(&activeProducts).Error; err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to count active products")
 	}
 
 	// Count products added in the last 24 hours
 	var newProducts int64
-	if err := api.db.Model(&models.Product{}).Where("created_at > ?", time.Now().Add(-24*time.Hour)).Count(&newProducts).Error; err != nil {
+	if err := api.replicaDB(c).Model(&models.Product{}).Where("created_at > ?", time.Now().Add(-24*time.Hour)).Count(&newProducts).Error; err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to count new products")
 	}
 
 	// Count products updated in the last 24 hours
 	var updatedProducts int64
-	if err := api.db.Model(&models.Product{}).Where("updated_at > ? AND updated_at != created_at", time.Now().Add(-24*time.Hour)).Count(&updatedProducts).Error; err != nil {
+	if err := api.replicaDB(c).Model(&models.Product{}).Where("updated_at > ? AND updated_at != created_at", time.Now().Add(-24*time.Hour)).Count(&updatedProducts).Error; err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to count updated products")
 	}
 
@@ -139,19 +228,19 @@ func (api *API) getPriceStats(c echo.Context) error {
 	var avgPriceChange struct {
 		AvgChange float64 `json:"avg_change"`
 	}
-	if err := api.db.Model(&models.PriceHistory{}).Select("AVG(change_percent) as avg_change").Scan(&avgPriceChange).Error; err != nil {
+	if err := api.replicaDB(c).Model(&models.PriceHistory{}).Select("AVG(change_percent) as avg_change").Scan(&avgPriceChange).Error; err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to calculate average price change")
 	}
 
 	// Count price increases
 	var priceIncreases int64
-	if err := api.db.Model(&models.PriceHistory{}).Where("change_percent > 0").Count(&priceIncreases).Error; err != nil {
+	if err := api.replicaDB(c).Model(&models.PriceHistory{}).Where("change_percent > 0").Count(&priceIncreases).Error; err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to count price increases")
 	}
 
 	// Count price decreases
 	var priceDecreases int64
-	if err := api.db.Model(&models.PriceHistory{}).Where("change_percent < 0").Count(&priceDecreases).Error; err != nil {
+	if err := api.replicaDB(c).Model(&models.PriceHistory{}).Where("change_percent < 0").Count(&priceDecreases).Error; err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to count price decreases")
 	}
 
@@ -165,7 +254,7 @@ func (api *API) getPriceStats(c echo.Context) error {
 		ChangePercent float64 `json:"change_percent"`
 	}
 	var biggestDrops []PriceDrop
-	if err := api.db.Raw(`
+	if err := api.replicaDB(c).Raw(`
 		SELECT ph.product_id, p.name as product_name, ph.variant_id, ph.previous_price, ph.new_price, ph.change_percent
 		FROM price_histories ph
 		JOIN products p ON ph.product_id = p.id
@@ -189,13 +278,13 @@ func (api *API) getPriceStats(c echo.Context) error {
 func (api *API) getFavoriteStats(c echo.Context) error {
 	// Count total favorites
 	var totalFavorites int64
-	if err := api.db.Model(&models.UserFavorite{}).Count(&totalFavorites).Error; err != nil {
+	if err := api.replicaDB(c).Model(&models.UserFavorite{}).Count(&totalFavorites).Error; err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to count favorites")
 	}
 
 	// Count users with favorites
 	var usersWithFavorites int64
-	if err := api.db.Model(&models.UserFavorite{}).Distinct("user_id").Count(&usersWithFavorites).Error; err != nil {
+	if err := api.replicaDB(c).Model(&models.UserFavorite{}).Distinct("user_id").Count(&usersWithFavorites).Error; err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to count users with favorites")
 	}
 
@@ -206,7 +295,7 @@ func (api *API) getFavoriteStats(c echo.Context) error {
 		Count     int    `json:"count"`
 	}
 	var popularProducts []PopularProduct
-	if err := api.db.Raw(`
+	if err := api.replicaDB(c).Raw(`
 		SELECT p.id as product_id, p.name, COUNT(uf.id) as count
 		FROM products p
 		JOIN user_favorites uf ON p.id = uf.product_id
@@ -224,6 +313,149 @@ func (api *API) getFavoriteStats(c echo.Context) error {
 	})
 }
 
+// getDeals returns the products with the biggest price drops within a time window
+func (api *API) getDeals(c echo.Context) error {
+	// Window in hours
+	window, err := strconv.Atoi(c.QueryParam("window"))
+	if err != nil || window <= 0 {
+		window = 24 // Default to 24 hours
+	}
+
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	minDiscount := 0.0
+	if minDiscountStr := c.QueryParam("min_discount"); minDiscountStr != "" {
+		minDiscount, err = strconv.ParseFloat(minDiscountStr, 64)
+		if err != nil || minDiscount < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid min_discount")
+		}
+	}
+
+	// Build the filters
+	filters := ""
+	args := []interface{}{window, minDiscount}
+	if category := c.QueryParam("category"); category != "" {
+		categoryID, err := strconv.ParseUint(category, 10, 32)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid category")
+		}
+		filters += " AND p.category_id = ?"
+		args = append(args, categoryID)
+	}
+	args = append(args, limit)
+
+	// Biggest drop per product in the window, ordered by discount
+	type Deal struct {
+		ProductID       uint      `json:"product_id"`
+		ExternalID      string    `json:"external_id"`
+		ProductName     string    `json:"product_name"`
+		BrandName       string    `json:"brand_name"`
+		URL             string    `json:"url"`
+		VariantID       uint      `json:"variant_id"`
+		PreviousPrice   float64   `json:"previous_price"`
+		NewPrice        float64   `json:"new_price"`
+		CurrentPrice    *float64  `json:"current_price"`
+		DiscountPercent float64   `json:"discount_percent"`
+		DroppedAt       time.Time `json:"dropped_at"`
+	}
+	deals := make([]Deal, 0)
+	if err := api.replicaDB(c).Raw(`
+		SELECT * FROM (
+			SELECT DISTINCT ON (ph.product_id)
+				ph.product_id, p.external_id, p.name as product_name, b.name as brand_name, p.url,
+				ph.variant_id, ph.previous_price, ph.new_price,
+				(SELECT MIN(v.price) FROM variants v
+				 WHERE v.product_id = p.id AND v.is_active = true AND v.deleted_at IS NULL) as current_price,
+				-ph.change_percent as discount_percent,
+				ph.created_at as dropped_at
+			FROM price_histories ph
+			JOIN products p ON ph.product_id = p.id
+			LEFT JOIN brands b ON p.brand_id = b.id
+			WHERE ph.created_at > NOW() - ? * INTERVAL '1 hour'
+			AND ph.change_percent < 0
+			AND -ph.change_percent >= ?
+			AND ph.deleted_at IS NULL
+			AND p.deleted_at IS NULL`+filters+`
+			ORDER BY ph.product_id, ph.change_percent ASC
+		) deals
+		ORDER BY discount_percent DESC
+		LIMIT ?
+	`, args...).Scan(&deals).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to find deals")
+	}
+
+	return c.JSON(http.StatusOK, deals)
+}
+
+// getWatchedProducts returns the products users watch most, by their number
+// of price alerts plus user favorites, with their current lowest price
+func (api *API) getWatchedProducts(c echo.Context) error {
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	// Build the filters
+	filters := ""
+	var args []interface{}
+	if category := c.QueryParam("category"); category != "" {
+		categoryID, err := strconv.ParseUint(category, 10, 32)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid category")
+		}
+		filters += " AND p.category_id = ?"
+		args = append(args, categoryID)
+	}
+	args = append(args, limit)
+
+	type WatchedProduct struct {
+		ProductID     uint     `json:"product_id"`
+		ExternalID    string   `json:"external_id"`
+		ProductName   string   `json:"product_name"`
+		URL           string   `json:"url"`
+		CurrentPrice  *float64 `json:"current_price"`
+		Currency      *string  `json:"currency"`
+		AlertCount    int      `json:"alert_count"`
+		FavoriteCount int      `json:"favorite_count"`
+		WatchCount    int      `json:"watch_count"`
+	}
+	products := make([]WatchedProduct, 0)
+	if err := api.requestDB(c).Raw(`
+		SELECT
+			p.id as product_id, p.external_id, p.name as product_name, p.url,
+			cheapest.price as current_price, cheapest.currency,
+			COALESCE(a.alert_count, 0) as alert_count,
+			COALESCE(f.favorite_count, 0) as favorite_count,
+			COALESCE(a.alert_count, 0) + COALESCE(f.favorite_count, 0) as watch_count
+		FROM products p
+		LEFT JOIN (
+			SELECT product_id, COUNT(*) as alert_count FROM price_alerts
+			WHERE deleted_at IS NULL GROUP BY product_id
+		) a ON a.product_id = p.id
+		LEFT JOIN (
+			SELECT product_id, COUNT(*) as favorite_count FROM user_favorites
+			WHERE deleted_at IS NULL GROUP BY product_id
+		) f ON f.product_id = p.id
+		LEFT JOIN LATERAL (
+			SELECT v.price, v.currency FROM variants v
+			WHERE v.product_id = p.id AND v.is_active = true AND v.deleted_at IS NULL
+			ORDER BY v.price ASC
+			LIMIT 1
+		) cheapest ON true
+		WHERE p.deleted_at IS NULL
+		AND (a.alert_count > 0 OR f.favorite_count > 0)`+filters+`
+		ORDER BY watch_count DESC, p.id ASC
+		LIMIT ?
+	`, args...).Scan(&products).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to find watched products")
+	}
+
+	return c.JSON(http.StatusOK, products)
+}
+
 // getPriceTrends returns price trends
 func (api *API) getPriceTrends(c echo.Context) error {
 	// Get days parameter
@@ -242,7 +474,7 @@ func (api *API) getPriceTrends(c echo.Context) error {
 		TotalChanges int      `json:"total_changes"`
 	}
 	var trends []DailyPriceTrend
-	if err := api.db.Raw(`
+	if err := api.replicaDB(c).Raw(`
 		SELECT
 			DATE(created_at) as date,
 			AVG(change_percent) as avg_change,
@@ -279,7 +511,7 @@ func (api *API) getStockTrends(c echo.Context) error {
 		TotalChanges int      `json:"total_changes"`
 	}
 	var trends []DailyStockTrend
-	if err := api.db.Raw(`
+	if err := api.replicaDB(c).Raw(`
 		SELECT
 			DATE(created_at) as date,
 			AVG(change_quantity) as avg_change,
@@ -298,7 +530,141 @@ func (api *API) getStockTrends(c echo.Context) error {
 	return c.JSON(http.StatusOK, trends)
 }
 
-// getPriceHistory returns the price history for a product
+// getAnomalies returns detected anomalies within a time window, newest first
+func (api *API) getAnomalies(c echo.Context) error {
+	// Window in hours
+	window, err := strconv.Atoi(c.QueryParam("window"))
+	if err != nil || window <= 0 {
+		window = 24 // Default to 24 hours
+	}
+
+	// Pagination
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	if page <= 0 {
+		page = 1
+	}
+
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	offset := (page - 1) * limit
+
+	query := api.replicaDB(c).Model(&models.Anomaly{}).
+		Where("detected_at > ?", time.Now().Add(-time.Duration(window)*time.Hour))
+
+	// Apply filters
+	if anomalyType := c.QueryParam("type"); anomalyType != "" {
+		if anomalyType != models.AnomalyPriceDrop && anomalyType != models.AnomalyStockSpike {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid type")
+		}
+		query = query.Where("type = ?", anomalyType)
+	}
+
+	if severity := c.QueryParam("severity"); severity != "" {
+		if severity != severityLow && severity != severityMedium && severity != severityHigh {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid severity")
+		}
+		query = query.Where("severity = ?", severity)
+	}
+
+	if productIDStr := c.QueryParam("product_id"); productIDStr != "" {
+		productID, err := strconv.ParseUint(productIDStr, 10, 32)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid product ID")
+		}
+		query = query.Where("product_id = ?", productID)
+	}
+
+	// Count total
+	var total int64
+	query.Count(&total)
+
+	// Get paginated results
+	var anomalies []models.Anomaly
+	if err := query.Order("detected_at DESC").Limit(limit).Offset(offset).Find(&anomalies).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch anomalies")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"anomalies": anomalies,
+		"total":     total,
+		"page":      page,
+		"limit":     limit,
+	})
+}
+
+// defaultForecastPoints is the number of recent price points used for a forecast by default
+const defaultForecastPoints = 30
+
+// getProductForecast returns a price trend signal computed from a variant's
+// most recent price history, by default the most recently changed variant
+func (api *API) getProductForecast(c echo.Context) error {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid product ID")
+	}
+
+	points := defaultForecastPoints
+	if pointsStr := c.QueryParam("points"); pointsStr != "" {
+		points, err = strconv.Atoi(pointsStr)
+		if err != nil || points < minForecastPoints || points > 365 {
+			return echo.NewHTTPError(http.StatusBadRequest, "points must be between 3 and 365")
+		}
+	}
+
+	// Check if product exists
+	var product models.Product
+	if err := api.replicaDB(c).First(&product, productID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "Product not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch product")
+	}
+
+	// Variants are priced independently, so the forecast follows a single variant
+	var variantID uint
+	if variantIDStr := c.QueryParam("variant_id"); variantIDStr != "" {
+		id, err := strconv.ParseUint(variantIDStr, 10, 32)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid variant ID")
+		}
+		variantID = uint(id)
+	} else {
+		var latest models.PriceHistory
+		err := api.replicaDB(c).Where("product_id = ?", productID).Order("created_at DESC").First(&latest).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get price history")
+		}
+		variantID = latest.VariantID
+	}
+
+	var history []models.PriceHistory
+	if err := api.replicaDB(c).Where("product_id = ? AND variant_id = ?", productID, variantID).
+		Order("created_at DESC").
+		Limit(points).
+		Find(&history).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get price history")
+	}
+
+	// Fit the points in chronological order
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+
+	return c.JSON(http.StatusOK, struct {
+		ProductID uint `json:"product_id"`
+		VariantID uint `json:"variant_id"`
+		priceForecast
+	}{
+		ProductID:     product.ID,
+		VariantID:     variantID,
+		priceForecast: forecastPrices(history),
+	})
+}
+
+// getPriceHistory returns the price history for a product within a date range
 func (api *API) getPriceHistory(c echo.Context) error {
 	id := c.Param("id")
 	
@@ -308,17 +674,237 @@ func (api *API) getPriceHistory(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid product ID")
 	}
 
-	// Get price history
+	from, to, err := parseHistoryRange(c)
+	if err != nil {
+		return err
+	}
+
+	query := api.replicaDB(c).Where("product_id = ? AND created_at >= ? AND created_at <= ?", productID, from, to)
+
+	// Optional variant filter
+	if variantIDStr := c.QueryParam("variant_id"); variantIDStr != "" {
+		variantID, err := strconv.ParseUint(variantIDStr, 10, 32)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid variant ID")
+		}
+		query = query.Where("variant_id = ?", variantID)
+	}
+
+	limit, err := parseHistoryLimit(c)
+	if err != nil {
+		return err
+	}
+
+	// Get the most recent price history, one more row than the limit tells
+	// whether it was truncated, then put it in ascending order for charting
 	var priceHistory []models.PriceHistory
-	if err := api.db.Where("product_id = ?", productID).
-		Order("created_at DESC").
+	if err := query.Order("created_at DESC, id DESC").
+		Limit(limit + 1).
 		Find(&priceHistory).Error; err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get price history")
 	}
+	if len(priceHistory) > limit {
+		priceHistory = priceHistory[:limit]
+		c.Response().Header().Set(truncatedHeader, "true")
+	}
+	slices.Reverse(priceHistory)
 
 	return c.JSON(http.StatusOK, priceHistory)
 }
 
+// getAggregatedPriceHistory returns per-interval min/max/avg/last prices for a product
+func (api *API) getAggregatedPriceHistory(c echo.Context) error {
+	id := c.Param("id")
+
+	// Convert ID to uint
+	productID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid product ID")
+	}
+
+	// Validate interval against the supported date_trunc fields
+	interval := c.QueryParam("interval")
+	if interval == "" {
+		interval = "day"
+	}
+	if interval != "day" && interval != "week" && interval != "month" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Interval must be one of day, week or month")
+	}
+
+	from, to, err := parseHistoryRange(c)
+	if err != nil {
+		return err
+	}
+
+	// Build the filters
+	filters := ""
+	args := []interface{}{interval, productID, from, to}
+	if variantIDStr := c.QueryParam("variant_id"); variantIDStr != "" {
+		variantID, err := strconv.ParseUint(variantIDStr, 10, 32)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid variant ID")
+		}
+		filters += " AND variant_id = ?"
+		args = append(args, variantID)
+	}
+
+	type PriceBucket struct {
+		Bucket    time.Time `json:"bucket"`
+		MinPrice  float64   `json:"min_price"`
+		MaxPrice  float64   `json:"max_price"`
+		AvgPrice  float64   `json:"avg_price"`
+		LastPrice float64   `json:"last_price"`
+		Count     int       `json:"count"`
+	}
+	buckets := make([]PriceBucket, 0)
+	if err := api.replicaDB(c).Raw(`
+		SELECT
+			date_trunc(?, created_at) as bucket,
+			MIN(new_price) as min_price,
+			MAX(new_price) as max_price,
+			AVG(new_price) as avg_price,
+			(array_agg(new_price ORDER BY created_at DESC))[1] as last_price,
+			COUNT(*) as count
+		FROM price_histories
+		WHERE product_id = ?
+		AND created_at >= ? AND created_at <= ?
+		AND deleted_at IS NULL`+filters+`
+		GROUP BY bucket
+		ORDER BY bucket ASC
+	`, args...).Scan(&buckets).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get aggregated price history")
+	}
+
+	return c.JSON(http.StatusOK, buckets)
+}
+
+// comparePriceHistory returns the daily prices of several products aligned to
+// the same days, so they can be overlaid on one chart
+func (api *API) comparePriceHistory(c echo.Context) error {
+	var request struct {
+		ProductIDs []uint     `json:"product_ids"`
+		From       *time.Time `json:"from"`
+		To         *time.Time `json:"to"`
+	}
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if len(request.ProductIDs) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Product IDs are required")
+	}
+	if len(request.ProductIDs) > maxCompareProducts {
+		return echo.NewHTTPError(http.StatusBadRequest, "At most "+strconv.Itoa(maxCompareProducts)+" products can be compared")
+	}
+	seen := make(map[uint]bool, len(request.ProductIDs))
+	for _, productID := range request.ProductIDs {
+		if productID == 0 || seen[productID] {
+			return echo.NewHTTPError(http.StatusBadRequest, "Product IDs must be distinct and non-zero")
+		}
+		seen[productID] = true
+	}
+
+	to := time.Now()
+	if request.To != nil {
+		to = *request.To
+	}
+	from := to.Add(-defaultHistoryWindow)
+	if request.From != nil {
+		from = *request.From
+	}
+	if from.After(to) {
+		return echo.NewHTTPError(http.StatusBadRequest, "from must not be after to")
+	}
+	days := comparisonDays(from, to)
+	if len(days) > maxCompareDays {
+		return echo.NewHTTPError(http.StatusBadRequest, "The range must not exceed "+strconv.Itoa(maxCompareDays)+" days")
+	}
+
+	// Last price of each product per day, across its variants
+	prices := make([]dailyPrice, 0)
+	if err := api.replicaDB(c).Raw(`
+		SELECT
+			product_id,
+			date_trunc('day', created_at) as day,
+			(array_agg(new_price ORDER BY created_at DESC, id DESC))[1] as price
+		FROM price_histories
+		WHERE product_id IN ?
+		AND created_at >= ? AND created_at <= ?
+		AND deleted_at IS NULL
+		GROUP BY product_id, day
+		ORDER BY product_id, day ASC
+	`, request.ProductIDs, from, to).Scan(&prices).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get price history")
+	}
+
+	dates := make([]string, len(days))
+	for i, day := range days {
+		dates[i] = day.Format(time.DateOnly)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"from":     from,
+		"to":       to,
+		"days":     dates,
+		"products": alignDailyPrices(request.ProductIDs, days, prices),
+	})
+}
+
+// Number of history rows returned by default and at most
+const (
+	defaultHistoryLimit = 500
+	maxHistoryLimit     = 5000
+)
+
+// truncatedHeader is set on history responses cut off at their limit. They
+// keep the most recent rows, older ones can be fetched by moving the date
+// window back.
+const truncatedHeader = "X-Truncated"
+
+// parseHistoryLimit parses the limit query parameter of history endpoints
+func parseHistoryLimit(c echo.Context) (int, error) {
+	limitStr := c.QueryParam("limit")
+	if limitStr == "" {
+		return defaultHistoryLimit, nil
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit <= 0 || limit > maxHistoryLimit {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "Limit must be between 1 and "+strconv.Itoa(maxHistoryLimit))
+	}
+	return limit, nil
+}
+
+// defaultHistoryWindow is the history range used when no from/to is given
+const defaultHistoryWindow = 90 * 24 * time.Hour
+
+// parseHistoryRange parses the from and to RFC3339 query parameters,
+// defaulting to the last 90 days
+func parseHistoryRange(c echo.Context) (time.Time, time.Time, error) {
+	to := time.Now()
+	if toStr := c.QueryParam("to"); toStr != "" {
+		parsed, err := time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, echo.NewHTTPError(http.StatusBadRequest, "Invalid to date, expected RFC3339")
+		}
+		to = parsed
+	}
+
+	from := to.Add(-defaultHistoryWindow)
+	if fromStr := c.QueryParam("from"); fromStr != "" {
+		parsed, err := time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, echo.NewHTTPError(http.StatusBadRequest, "Invalid from date, expected RFC3339")
+		}
+		from = parsed
+	}
+
+	if from.After(to) {
+		return time.Time{}, time.Time{}, echo.NewHTTPError(http.StatusBadRequest, "from must not be after to")
+	}
+
+	return from, to, nil
+}
+
 // getStockHistory returns the stock history for a product
 func (api *API) getStockHistory(c echo.Context) error {
 	id := c.Param("id")
@@ -329,39 +915,266 @@ func (api *API) getStockHistory(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid product ID")
 	}
 
-	// Get stock history
+	query := api.replicaDB(c).Where("product_id = ?", productID)
+
+	// Optional date window, for paging through history past the limit
+	if c.QueryParam("from") != "" || c.QueryParam("to") != "" {
+		from, to, err := parseHistoryRange(c)
+		if err != nil {
+			return err
+		}
+		query = query.Where("created_at >= ? AND created_at <= ?", from, to)
+	}
+
+	limit, err := parseHistoryLimit(c)
+	if err != nil {
+		return err
+	}
+
+	// Get stock history, newest first, one more row than the limit tells
+	// whether it was truncated
 	var stockHistory []models.StockHistory
-	if err := api.db.Where("product_id = ?", productID).
-		Order("created_at DESC").
+	if err := query.Order("created_at DESC, id DESC").
+		Limit(limit + 1).
 		Find(&stockHistory).Error; err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get stock history")
 	}
+	if len(stockHistory) > limit {
+		stockHistory = stockHistory[:limit]
+		c.Response().Header().Set(truncatedHeader, "true")
+	}
 
 	return c.JSON(http.StatusOK, stockHistory)
 }
 
+// getFavoriteHistory returns the most recent favorite count changes of a
+// product within a date range, oldest first
+func (api *API) getFavoriteHistory(c echo.Context) error {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid product ID")
+	}
+
+	from, to, err := parseHistoryRange(c)
+	if err != nil {
+		return err
+	}
+
+	limit, err := parseHistoryLimit(c)
+	if err != nil {
+		return err
+	}
+
+	var favoriteHistory []models.FavoriteHistory
+	if err := api.replicaDB(c).
+		Where("product_id = ? AND created_at >= ? AND created_at <= ?", productID, from, to).
+		Order("created_at DESC, id DESC").
+		Limit(limit + 1).
+		Find(&favoriteHistory).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get favorite history")
+	}
+	if len(favoriteHistory) > limit {
+		favoriteHistory = favoriteHistory[:limit]
+		c.Response().Header().Set(truncatedHeader, "true")
+	}
+	slices.Reverse(favoriteHistory)
+
+	return c.JSON(http.StatusOK, favoriteHistory)
+}
+
+// getStockTransitions returns the most recent times a product's variants went
+// out of stock or came back in stock within a date range, oldest first
+func (api *API) getStockTransitions(c echo.Context) error {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid product ID")
+	}
+
+	from, to, err := parseHistoryRange(c)
+	if err != nil {
+		return err
+	}
+
+	limit, err := parseHistoryLimit(c)
+	if err != nil {
+		return err
+	}
+
+	// Optional variant filter
+	var variantID uint64
+	variantIDStr := c.QueryParam("variant_id")
+	if variantIDStr != "" {
+		variantID, err = strconv.ParseUint(variantIDStr, 10, 32)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid variant ID")
+		}
+	}
+
+	// Check if product exists, an unknown product would look like one that
+	// never ran out of stock
+	var product models.Product
+	if err := api.replicaDB(c).Select("id").First(&product, productID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "Product not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch product")
+	}
+
+	// Only the changes into or out of stock, so the limit counts transitions
+	query := api.replicaDB(c).
+		Where("product_id = ? AND created_at >= ? AND created_at <= ?", productID, from, to).
+		Where("(previous_stock > 0) <> (new_stock > 0)")
+
+	if variantIDStr != "" {
+		query = query.Where("variant_id = ?", variantID)
+	}
+
+	// Get the most recent transitions, one more row than the limit tells
+	// whether they were truncated, then put them in ascending order
+	var stockHistory []models.StockHistory
+	if err := query.Order("created_at DESC, id DESC").
+		Limit(limit + 1).
+		Find(&stockHistory).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get stock history")
+	}
+	if len(stockHistory) > limit {
+		stockHistory = stockHistory[:limit]
+		c.Response().Header().Set(truncatedHeader, "true")
+	}
+	slices.Reverse(stockHistory)
+
+	return c.JSON(http.StatusOK, stockTransitions(stockHistory))
+}
+
+// getProductChanges returns the timeline of changes of a product, optionally
+// filtered by field
+func (api *API) getProductChanges(c echo.Context) error {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid product ID")
+	}
+
+	from, to, err := parseHistoryRange(c)
+	if err != nil {
+		return err
+	}
+
+	limit, err := parseHistoryLimit(c)
+	if err != nil {
+		return err
+	}
+
+	query := api.replicaDB(c).Where("product_id = ? AND changed_at >= ? AND changed_at <= ?", productID, from, to)
+
+	// Optional field filter
+	if field := c.QueryParam("field"); field != "" {
+		query = query.Where("field = ?", field)
+	}
+
+	// Get the most recent changes, one more row than the limit tells whether
+	// they were truncated, then put them in ascending order
+	var changes []models.ProductChangeEvent
+	if err := query.Order("changed_at DESC, id DESC").
+		Limit(limit + 1).
+		Find(&changes).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get product changes")
+	}
+	if len(changes) > limit {
+		changes = changes[:limit]
+		c.Response().Header().Set(truncatedHeader, "true")
+	}
+	slices.Reverse(changes)
+
+	return c.JSON(http.StatusOK, changes)
+}
+
+// priceAlertRequest is the request body for creating a price alert
+type priceAlertRequest struct {
+	UserID          uint    `json:"user_id" validate:"required"`
+	ProductID       uint    `json:"product_id" validate:"required"`
+	VariantID       uint    `json:"variant_id"`
+	DiscountPercent float64  `json:"discount_percent"`
+	TargetPrice     *float64 `json:"target_price"`
+	StockThreshold  *int     `json:"stock_threshold"`
+	CooldownHours   *int     `json:"cooldown_hours"`
+}
+
+// maxAlertCooldownHours is the longest allowed cooldown between notifications of an alert
+const maxAlertCooldownHours = 24 * 30
+
+// validate returns a message describing why the request is invalid, or an empty string
+func (r priceAlertRequest) validate() string {
+	if r.StockThreshold != nil {
+		if r.DiscountPercent != 0 || r.TargetPrice != nil {
+			return "Only one of discount_percent, target_price and stock_threshold can be set"
+		}
+		if *r.StockThreshold <= 0 {
+			return "Stock threshold must be positive"
+		}
+		if r.VariantID == 0 {
+			return "Variant ID is required for stock alerts"
+		}
+	} else if r.TargetPrice != nil {
+		if r.DiscountPercent != 0 {
+			return "Only one of discount_percent and target_price can be set"
+		}
+		if *r.TargetPrice <= 0 {
+			return "Target price must be positive"
+		}
+	} else if r.DiscountPercent <= 0 {
+		return "Discount percentage must be positive"
+	}
+	if r.CooldownHours != nil && (*r.CooldownHours < 0 || *r.CooldownHours > maxAlertCooldownHours) {
+		return "Cooldown hours must be between 0 and " + strconv.Itoa(maxAlertCooldownHours)
+	}
+	return ""
+}
+
+// newAlert creates the price alert model for the request
+func (r priceAlertRequest) newAlert() models.PriceAlert {
+	cooldownHours := defaultAlertCooldownHours
+	if r.CooldownHours != nil {
+		cooldownHours = *r.CooldownHours
+	}
+
+	return models.PriceAlert{
+		UserID:          r.UserID,
+		ProductID:       r.ProductID,
+		VariantID:       r.VariantID,
+		DiscountPercent: r.DiscountPercent,
+		TargetPrice:     r.TargetPrice,
+		StockThreshold:  r.StockThreshold,
+		CooldownHours:   &cooldownHours,
+	}
+}
+
+// alertKey identifies the alerts a bulk request must not duplicate, as a
+// user can have one price drop and one low stock alert per variant
+func alertKey(userID, productID, variantID uint, stockThreshold *int) [4]uint {
+	var stock uint
+	if stockThreshold != nil {
+		stock = 1
+	}
+	return [4]uint{userID, productID, variantID, stock}
+}
+
 // createPriceAlert creates a new price alert
 func (api *API) createPriceAlert(c echo.Context) error {
 	// Parse request body
-	var request struct {
-		UserID          uint    `json:"user_id" validate:"required"`
-		ProductID       uint    `json:"product_id" validate:"required"`
-		VariantID       uint    `json:"variant_id"`
-		DiscountPercent float64 `json:"discount_percent" validate:"required"`
-	}
+	var request priceAlertRequest
 	
 	if err := c.Bind(&request); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
 	}
 	
 	// Validate request
-	if request.DiscountPercent <= 0 {
-		return echo.NewHTTPError(http.StatusBadRequest, "Discount percentage must be positive")
+	if message := request.validate(); message != "" {
+		return echo.NewHTTPError(http.StatusBadRequest, message)
 	}
 
 	// Check if product exists
 	var product models.Product
-	if err := api.db.First(&product, request.ProductID).Error; err != nil {
+	if err := api.requestDB(c).First(&product, request.ProductID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return echo.NewHTTPError(http.StatusNotFound, "Product not found")
 		}
@@ -370,7 +1183,7 @@ func (api *API) createPriceAlert(c echo.Context) error {
 
 	// Check if user exists
 	var user models.User
-	if err := api.db.First(&user, request.UserID).Error; err != nil {
+	if err := api.requestDB(c).First(&user, request.UserID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return echo.NewHTTPError(http.StatusNotFound, "User not found")
 		}
@@ -380,7 +1193,7 @@ func (api *API) createPriceAlert(c echo.Context) error {
 	// Check if variant exists if provided
 	if request.VariantID > 0 {
 		var variant models.Variant
-		if err := api.db.First(&variant, request.VariantID).Error; err != nil {
+		if err := api.requestDB(c).First(&variant, request.VariantID).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
 				return echo.NewHTTPError(http.StatusNotFound, "Variant not found")
 			}
@@ -389,25 +1202,23 @@ func (api *API) createPriceAlert(c echo.Context) error {
 	}
 
 	// Create a new price alert
-	alert := priceAlert{
-		UserID:          request.UserID,
-		ProductID:       request.ProductID,
-		VariantID:       request.VariantID,
-		DiscountPercent: request.DiscountPercent,
+	alert := request.newAlert()
+	if err := api.requestDB(c).Create(&alert).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create price alert")
 	}
 
 	// Add to the service's price alerts
-	api.service.priceAlerts[request.ProductID] = append(api.service.priceAlerts[request.ProductID], alert)
+	api.service.addPriceAlert(alert)
 
 	// Also create a user favorite if it doesn't exist
 	var favorite models.UserFavorite
-	result := api.db.Where("user_id = ? AND product_id = ?", request.UserID, request.ProductID).First(&favorite)
+	result := api.requestDB(c).Where("user_id = ? AND product_id = ?", request.UserID, request.ProductID).First(&favorite)
 	if result.Error == gorm.ErrRecordNotFound {
 		favorite = models.UserFavorite{
 			UserID:    request.UserID,
 			ProductID: request.ProductID,
 		}
-		if err := api.db.Create(&favorite).Error; err != nil {
+		if err := api.requestDB(c).Create(&favorite).Error; err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create user favorite")
 		}
 	}
@@ -416,15 +1227,249 @@ func (api *API) createPriceAlert(c echo.Context) error {
 		"success": true,
 		"message": "Price alert created successfully",
 		"alert": map[string]interface{}{
+			"id":               alert.ID,
 			"user_id":          alert.UserID,
 			"product_id":       alert.ProductID,
 			"variant_id":       alert.VariantID,
 			"discount_percent": alert.DiscountPercent,
+			"target_price":     alert.TargetPrice,
+			"stock_threshold":  alert.StockThreshold,
+			"cooldown_hours":   alert.CooldownHours,
 		},
 	})
 }
 
-// getUserPriceAlerts returns price alerts for a user
+// maxBulkAlerts is the maximum number of price alerts that can be created in one bulk request
+const maxBulkAlerts = 500
+
+// bulkAlertResult reports the outcome of one item of a bulk alert request
+type bulkAlertResult struct {
+	Index   int    `json:"index"`
+	Success bool   `json:"success"`
+	AlertID uint   `json:"alert_id,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// createPriceAlertsBulk creates many price alerts in one transaction. Invalid
+// and duplicate items are reported per item without failing the others.
+func (api *API) createPriceAlertsBulk(c echo.Context) error {
+	var requests []priceAlertRequest
+	if err := c.Bind(&requests); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	// Validate batch size
+	if len(requests) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "At least one alert is required")
+	}
+	if len(requests) > maxBulkAlerts {
+		return echo.NewHTTPError(http.StatusBadRequest, "Batch size must not exceed "+strconv.Itoa(maxBulkAlerts))
+	}
+
+	// Load the referenced products, users, variants and existing alerts up front
+	var productIDs, userIDs, variantIDs []uint
+	for _, request := range requests {
+		productIDs = append(productIDs, request.ProductID)
+		userIDs = append(userIDs, request.UserID)
+		if request.VariantID > 0 {
+			variantIDs = append(variantIDs, request.VariantID)
+		}
+	}
+
+	products, err := api.existingIDs(c.Request().Context(), &models.Product{}, productIDs)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch products")
+	}
+	users, err := api.existingIDs(c.Request().Context(), &models.User{}, userIDs)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch users")
+	}
+	variants, err := api.existingIDs(c.Request().Context(), &models.Variant{}, variantIDs)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch variants")
+	}
+
+	var existingAlerts []models.PriceAlert
+	if err := api.requestDB(c).Where("user_id IN ? AND product_id IN ?", userIDs, productIDs).
+		Find(&existingAlerts).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch price alerts")
+	}
+	seen := make(map[[4]uint]bool, len(existingAlerts)+len(requests))
+	for _, alert := range existingAlerts {
+		seen[alertKey(alert.UserID, alert.ProductID, alert.VariantID, alert.StockThreshold)] = true
+	}
+
+	results := make([]bulkAlertResult, len(requests))
+	var created []models.PriceAlert
+
+	err = api.requestDB(c).Transaction(func(tx *gorm.DB) error {
+		for i, request := range requests {
+			results[i].Index = i
+
+			// Validate the item
+			key := alertKey(request.UserID, request.ProductID, request.VariantID, request.StockThreshold)
+			results[i].Error = request.validate()
+			switch {
+			case results[i].Error != "":
+			case !products[request.ProductID]:
+				results[i].Error = "Product not found"
+			case !users[request.UserID]:
+				results[i].Error = "User not found"
+			case request.VariantID > 0 && !variants[request.VariantID]:
+				results[i].Error = "Variant not found"
+			case seen[key]:
+				results[i].Error = "Price alert already exists"
+			}
+			if results[i].Error != "" {
+				continue
+			}
+
+			// Roll back only this item if it fails
+			savepoint := "alert_" + strconv.Itoa(i)
+			if err := tx.SavePoint(savepoint).Error; err != nil {
+				return err
+			}
+
+			alert := request.newAlert()
+			if err := tx.Create(&alert).Error; err != nil {
+				tx.RollbackTo(savepoint)
+				results[i].Error = "Failed to create price alert"
+				continue
+			}
+
+			// Also create a user favorite if it doesn't exist
+			var favorite models.UserFavorite
+			result := tx.Where("user_id = ? AND product_id = ?", request.UserID, request.ProductID).First(&favorite)
+			if result.Error == gorm.ErrRecordNotFound {
+				favorite = models.UserFavorite{
+					UserID:    request.UserID,
+					ProductID: request.ProductID,
+				}
+				if err := tx.Create(&favorite).Error; err != nil {
+					tx.RollbackTo(savepoint)
+					results[i].Error = "Failed to create user favorite"
+					continue
+				}
+			}
+
+			seen[key] = true
+			created = append(created, alert)
+			results[i].Success = true
+			results[i].AlertID = alert.ID
+		}
+		return nil
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create price alerts")
+	}
+
+	// Add to the service's price alerts once committed
+	for _, alert := range created {
+		api.service.addPriceAlert(alert)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"created": len(created),
+		"failed":  len(requests) - len(created),
+		"results": results,
+	})
+}
+
+// existingIDs returns which of the given IDs exist for a model
+func (api *API) existingIDs(ctx context.Context, model interface{}, ids []uint) (map[uint]bool, error) {
+	existing := make(map[uint]bool, len(ids))
+	if len(ids) == 0 {
+		return existing, nil
+	}
+
+	var found []uint
+	if err := api.db.WithContext(ctx).Model(model).Where("id IN ?", ids).Pluck("id", &found).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range found {
+		existing[id] = true
+	}
+	return existing, nil
+}
+
+// backtestRequest is the request body for backtesting a price alert
+type backtestRequest struct {
+	ProductID       uint    `json:"product_id"`
+	VariantID       uint    `json:"variant_id"`
+	DiscountPercent float64 `json:"discount_percent"`
+	CooldownHours   *int    `json:"cooldown_hours"`
+	Days            int     `json:"days"`
+}
+
+// backtestPriceAlert returns the past price drops a discount alert would
+// have notified within the lookback window
+func (api *API) backtestPriceAlert(c echo.Context) error {
+	var request backtestRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if request.ProductID == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Product ID is required")
+	}
+	if request.DiscountPercent <= 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Discount percentage must be positive")
+	}
+	cooldownHours := defaultAlertCooldownHours
+	if request.CooldownHours != nil {
+		cooldownHours = *request.CooldownHours
+	}
+	if cooldownHours < 0 || cooldownHours > maxAlertCooldownHours {
+		return echo.NewHTTPError(http.StatusBadRequest, "Cooldown hours must be between 0 and "+strconv.Itoa(maxAlertCooldownHours))
+	}
+	if request.Days == 0 {
+		request.Days = defaultBacktestDays
+	}
+	if request.Days < 0 || request.Days > maxBacktestDays {
+		return echo.NewHTTPError(http.StatusBadRequest, "Days must be between 1 and "+strconv.Itoa(maxBacktestDays))
+	}
+
+	// Check if product exists
+	var product models.Product
+	if err := api.requestDB(c).First(&product, request.ProductID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "Product not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch product")
+	}
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -request.Days)
+	query := api.replicaDB(c).Where("product_id = ? AND created_at >= ?", product.ID, from)
+	if request.VariantID > 0 {
+		query = query.Where("variant_id = ?", request.VariantID)
+	}
+
+	var history []models.PriceHistory
+	if err := query.Order("created_at ASC, id ASC").Find(&history).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get price history")
+	}
+
+	hits := backtestAlert(priceAlert{
+		ProductID:       product.ID,
+		VariantID:       request.VariantID,
+		DiscountPercent: request.DiscountPercent,
+		Cooldown:        time.Duration(cooldownHours) * time.Hour,
+	}, history)
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"product_id":       product.ID,
+		"variant_id":       request.VariantID,
+		"discount_percent": request.DiscountPercent,
+		"cooldown_hours":   cooldownHours,
+		"from":             from,
+		"to":               to,
+		"count":            len(hits),
+		"hits":             hits,
+	})
+}
+
+// getUserPriceAlerts returns price alerts for a user with pagination
 func (api *API) getUserPriceAlerts(c echo.Context) error {
 	id := c.Param("id")
 	
@@ -434,28 +1479,58 @@ func (api *API) getUserPriceAlerts(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
 	}
 
-	// Get price alerts for the user
-	alerts := make([]map[string]interface{}, 0)
-	for productID, productAlerts := range api.service.priceAlerts {
-		for _, alert := range productAlerts {
-			if alert.UserID == uint(userID) {
-				// Get product name
-				var product models.Product
-				if err := api.db.Select("name").First(&product, productID).Error; err != nil {
-					continue
-				}
+	// Pagination
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	if page <= 0 {
+		page = 1
+	}
 
-				alerts = append(alerts, map[string]interface{}{
-					"user_id":          alert.UserID,
-					"product_id":       alert.ProductID,
-					"product_name":     product.Name,
-					"variant_id":       alert.VariantID,
-					"discount_percent": alert.DiscountPercent,
-				})
-			}
-		}
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
 	}
 
+	offset := (page - 1) * limit
+
+	// Fetch alerts joined with their product and current lowest price in one query
+	type UserPriceAlert struct {
+		ID              uint     `json:"id"`
+		UserID          uint     `json:"user_id"`
+		ProductID       uint     `json:"product_id"`
+		ProductName     string   `json:"product_name"`
+		VariantID       uint     `json:"variant_id"`
+		DiscountPercent float64  `json:"discount_percent"`
+		TargetPrice     *float64 `json:"target_price"`
+		StockThreshold  *int     `json:"stock_threshold"`
+		CooldownHours   int      `json:"cooldown_hours"`
+		CurrentPrice    *float64 `json:"current_price"`
+		Total           int64    `json:"-"`
+	}
+	alerts := make([]UserPriceAlert, 0)
+	if err := api.requestDB(c).Raw(`
+		SELECT pa.id, pa.user_id, pa.product_id, p.name as product_name, pa.variant_id, pa.discount_percent, pa.target_price,
+			pa.stock_threshold, COALESCE(pa.cooldown_hours, 24) as cooldown_hours,
+			(SELECT MIN(v.price) FROM variants v
+			 WHERE v.product_id = p.id AND v.is_active = true AND v.deleted_at IS NULL) as current_price,
+			COUNT(*) OVER() as total
+		FROM price_alerts pa
+		JOIN products p ON pa.product_id = p.id
+		WHERE pa.user_id = ?
+		AND pa.deleted_at IS NULL
+		AND p.deleted_at IS NULL
+		ORDER BY pa.created_at DESC
+		LIMIT ? OFFSET ?
+	`, userID, limit, offset).Scan(&alerts).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch price alerts")
+	}
+
+	var total int64
+	if len(alerts) > 0 {
+		total = alerts[0].Total
+	}
+
+	// Clients expect a bare array, so the total goes in a header
+	c.Response().Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
 	return c.JSON(http.StatusOK, alerts)
 }
 
@@ -465,40 +1540,183 @@ func (api *API) deletePriceAlert(c echo.Context) error {
 	id := c.Param("id")
 	
 	// Convert ID to uint
-	_, err := strconv.ParseUint(id, 10, 32)
+	alertID, err := strconv.ParseUint(id, 10, 32)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid alert ID")
 	}
 
-	// Parse request body
+	// Parse request body, only the user owning an alert may delete it
 	var request struct {
-		UserID    uint `json:"user_id" validate:"required"`
-		ProductID uint `json:"product_id" validate:"required"`
+		UserID uint `json:"user_id" validate:"required"`
 	}
-	
 	if err := c.Bind(&request); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
 	}
+	if request.UserID == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "User ID is required")
+	}
 
-	// Find and remove the alert
-	found := false
-	if alerts, exists := api.service.priceAlerts[request.ProductID]; exists {
-		for i, alert := range alerts {
-			if alert.UserID == request.UserID {
-				// Remove the alert
-				api.service.priceAlerts[request.ProductID] = append(alerts[:i], alerts[i+1:]...)
-				found = true
-				break
-			}
+	// Find the alert, alerts of other users are reported as not found
+	var alert models.PriceAlert
+	if err := api.requestDB(c).Where("user_id = ?", request.UserID).First(&alert, alertID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "Price alert not found")
 		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch price alert")
 	}
 
-	if !found {
-		return echo.NewHTTPError(http.StatusNotFound, "Price alert not found")
+	// Remove the alert
+	if err := api.requestDB(c).Delete(&alert).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete price alert")
 	}
+	api.service.removePriceAlert(alert.ProductID, alert.ID)
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"success": true,
 		"message": "Price alert deleted successfully",
 	})
-}
\ No newline at end of file
+}
+
+// categoryAlertRequest is the request body for creating a category alert
+type categoryAlertRequest struct {
+	UserID          uint    `json:"user_id"`
+	CategoryID      uint    `json:"category_id"`
+	DiscountPercent float64 `json:"discount_percent"`
+}
+
+// createCategoryAlert creates a price drop alert for a category and its subcategories
+func (api *API) createCategoryAlert(c echo.Context) error {
+	var request categoryAlertRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if request.UserID == 0 || request.CategoryID == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "User ID and category ID are required")
+	}
+	if request.DiscountPercent <= 0 || request.DiscountPercent >= 100 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Discount percentage must be between 0 and 100")
+	}
+
+	// Check if category exists
+	var category models.Category
+	if err := api.requestDB(c).First(&category, request.CategoryID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "Category not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch category")
+	}
+
+	// Check if user exists
+	var user models.User
+	if err := api.requestDB(c).First(&user, request.UserID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "User not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch user")
+	}
+
+	alert := models.CategoryAlert{
+		UserID:          request.UserID,
+		CategoryID:      request.CategoryID,
+		DiscountPercent: request.DiscountPercent,
+	}
+	if err := api.requestDB(c).Create(&alert).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create category alert")
+	}
+
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"message": "Category alert created successfully",
+		"alert":   alert,
+	})
+}
+
+// getUserCategoryAlerts returns the category alerts of a user
+func (api *API) getUserCategoryAlerts(c echo.Context) error {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	type UserCategoryAlert struct {
+		ID              uint      `json:"id"`
+		UserID          uint      `json:"user_id"`
+		CategoryID      uint      `json:"category_id"`
+		CategoryName    string    `json:"category_name"`
+		DiscountPercent float64   `json:"discount_percent"`
+		CreatedAt       time.Time `json:"created_at"`
+	}
+	alerts := make([]UserCategoryAlert, 0)
+	if err := api.requestDB(c).Raw(`
+		SELECT ca.id, ca.user_id, ca.category_id, c.name as category_name, ca.discount_percent, ca.created_at
+		FROM category_alerts ca
+		JOIN categories c ON ca.category_id = c.id
+		WHERE ca.user_id = ?
+		AND ca.deleted_at IS NULL
+		ORDER BY ca.created_at DESC
+	`, userID).Scan(&alerts).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch category alerts")
+	}
+
+	return c.JSON(http.StatusOK, alerts)
+}
+
+// deleteCategoryAlert deletes a category alert of the user in the request body
+func (api *API) deleteCategoryAlert(c echo.Context) error {
+	alertID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid alert ID")
+	}
+
+	// Parse request body, only the user owning an alert may delete it
+	var request struct {
+		UserID uint `json:"user_id" validate:"required"`
+	}
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if request.UserID == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "User ID is required")
+	}
+
+	// Alerts of other users are reported as not found
+	result := api.requestDB(c).Where("id = ? AND user_id = ?", alertID, request.UserID).Delete(&models.CategoryAlert{})
+	if result.Error != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete category alert")
+	}
+	if result.RowsAffected == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "Category alert not found")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "Category alert deleted successfully",
+	})
+}
+
+// analyze runs the periodic analysis now and returns its results, for
+// refreshing insights after a big crawl. Overlapping runs are rejected.
+func (api *API) analyze(c echo.Context) error {
+	result, err := api.service.runAnalysis(c.Request().Context())
+	if err != nil {
+		if errors.Is(err, errAnalysisRunning) {
+			return echo.NewHTTPError(http.StatusConflict, "Analysis is already running")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to run analysis").SetInternal(err)
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// reload reloads the in-memory price alerts from the database
+func (api *API) reload(c echo.Context) error {
+	count, err := api.service.loadPriceAlerts()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to reload price alerts").SetInternal(err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"price_alerts": count,
+	})
+}
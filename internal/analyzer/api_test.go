@@ -0,0 +1,224 @@
+package analyzer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/e-commerce/platform/internal/common/db/dbtest"
+	"github.com/e-commerce/platform/internal/common/models"
+	"github.com/labstack/echo/v4"
+)
+
+// newQueryContext returns an echo context for a GET request with a query string
+func newQueryContext(query string) echo.Context {
+	req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+	return echo.New().NewContext(req, httptest.NewRecorder())
+}
+
+func TestParseHistoryLimit(t *testing.T) {
+	tests := []struct {
+		query   string
+		limit   int
+		wantErr bool
+	}{
+		{"", defaultHistoryLimit, false},
+		{"limit=10", 10, false},
+		{"limit=5000", maxHistoryLimit, false},
+		{"limit=5001", 0, true},
+		{"limit=0", 0, true},
+		{"limit=-1", 0, true},
+		{"limit=ten", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			limit, err := parseHistoryLimit(newQueryContext(tt.query))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if limit != tt.limit {
+				t.Errorf("limit = %d, want %d", limit, tt.limit)
+			}
+		})
+	}
+}
+
+func TestParseHistoryRange(t *testing.T) {
+	tests := []struct {
+		query   string
+		window  bool
+		wantErr bool
+	}{
+		{"", true, false},
+		{"to=2024-03-01T00:00:00Z", true, false},
+		{"from=2024-01-01T00:00:00Z&to=2024-02-01T00:00:00Z", false, false},
+		{"from=yesterday", false, true},
+		{"to=2024-03-01", false, true},
+		{"from=2024-02-01T00:00:00Z&to=2024-01-01T00:00:00Z", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			from, to, err := parseHistoryRange(newQueryContext(tt.query))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if from.After(to) {
+				t.Errorf("from %v is after to %v", from, to)
+			}
+			if tt.window && to.Sub(from) != defaultHistoryWindow {
+				t.Errorf("window = %v, want %v", to.Sub(from), defaultHistoryWindow)
+			}
+		})
+	}
+}
+
+func TestDeleteAlertRequiresUser(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		body string
+	}{
+		{"invalid alert ID", "abc", `{"user_id": 1}`},
+		{"missing user", "1", `{}`},
+		{"invalid body", "1", `{"user_id": "one"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, handler := range map[string]func(*API, echo.Context) error{
+				"price":    (*API).deletePriceAlert,
+				"category": (*API).deleteCategoryAlert,
+			} {
+				// The body is read once, so each handler gets a fresh request
+				req := httptest.NewRequest(http.MethodDelete, "/api/v1/analyzer/alerts/"+name+"/"+tt.id, strings.NewReader(tt.body))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+				c := echo.New().NewContext(req, httptest.NewRecorder())
+				c.SetParamNames("id")
+				c.SetParamValues(tt.id)
+
+				err := handler(&API{}, c)
+				var httpErr *echo.HTTPError
+				if !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+					t.Errorf("%s: got %v, want a 400 error", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestGetStockTransitionsInvalidParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		id    string
+		query string
+	}{
+		{"invalid product ID", "abc", ""},
+		{"invalid variant ID", "1", "variant_id=abc"},
+		{"invalid limit", "1", "limit=0"},
+		{"invalid range", "1", "from=2024-02-01T00:00:00Z&to=2024-01-01T00:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newQueryContext(tt.query)
+			c.SetParamNames("id")
+			c.SetParamValues(tt.id)
+
+			err := (&API{}).getStockTransitions(c)
+			var httpErr *echo.HTTPError
+			if !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+				t.Errorf("got %v, want a 400 error", err)
+			}
+		})
+	}
+}
+
+func TestGetProductChangesInvalidParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		id    string
+		query string
+	}{
+		{"invalid product ID", "abc", ""},
+		{"limit too large", "1", "limit=5001"},
+		{"invalid limit", "1", "limit=0"},
+		{"invalid range", "1", "from=2024-02-01T00:00:00Z&to=2024-01-01T00:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newQueryContext(tt.query)
+			c.SetParamNames("id")
+			c.SetParamValues(tt.id)
+
+			err := (&API{}).getProductChanges(c)
+			var httpErr *echo.HTTPError
+			if !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+				t.Errorf("got %v, want a 400 error", err)
+			}
+		})
+	}
+}
+
+func TestDeleteCategoryAlertOfOtherUser(t *testing.T) {
+	database := dbtest.Open(t)
+	api := &API{db: database}
+
+	// Users 1 and 2 each have an alert
+	alerts := []models.CategoryAlert{{UserID: 1, CategoryID: 1, DiscountPercent: 10}, {UserID: 2, CategoryID: 1, DiscountPercent: 10}}
+	if err := database.Create(&alerts).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		alert  uint
+		userID uint
+		status int
+	}{
+		{"other user's alert", alerts[1].ID, 1, http.StatusNotFound},
+		{"own alert", alerts[0].ID, 1, http.StatusOK},
+		{"already deleted", alerts[0].ID, 1, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := strconv.FormatUint(uint64(tt.alert), 10)
+			body := `{"user_id": ` + strconv.FormatUint(uint64(tt.userID), 10) + `}`
+			req := httptest.NewRequest(http.MethodDelete, "/api/v1/analyzer/alerts/category/"+id, strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+			c.SetParamNames("id")
+			c.SetParamValues(id)
+
+			status := http.StatusOK
+			if err := api.deleteCategoryAlert(c); err != nil {
+				var httpErr *echo.HTTPError
+				if !errors.As(err, &httpErr) {
+					t.Fatalf("expected an HTTP error, got %v", err)
+				}
+				status = httpErr.Code
+			}
+			if status != tt.status {
+				t.Errorf("status = %d, want %d", status, tt.status)
+			}
+		})
+	}
+
+	// The other user's alert is still there
+	var count int64
+	if err := database.Model(&models.CategoryAlert{}).Where("id = ?", alerts[1].ID).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Error("alert of user 2 was deleted by user 1")
+	}
+}
@@ -0,0 +1,24 @@
+package analyzer
+
+import "github.com/e-commerce/platform/internal/common/models"
+
+const (
+	// defaultBacktestDays is the default lookback of an alert backtest
+	defaultBacktestDays = 90
+	// maxBacktestDays is the longest allowed lookback of an alert backtest
+	maxBacktestDays = 365
+)
+
+// backtestAlert replays a price history, in ascending order, through an
+// alert and returns the changes it would have notified, each at the time of
+// the change, so its cooldown applies as it would have
+func backtestAlert(alert priceAlert, history []models.PriceHistory) []models.PriceHistory {
+	hits := make([]models.PriceHistory, 0)
+	for _, change := range history {
+		if alert.shouldNotify(change, change.CreatedAt) {
+			hits = append(hits, change)
+			alert.LastNotification = change.CreatedAt
+		}
+	}
+	return hits
+}
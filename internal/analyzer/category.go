@@ -0,0 +1,96 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/e-commerce/platform/internal/common/models"
+	"gorm.io/gorm/clause"
+)
+
+// categoryAlertMatches reports whether a price change triggers a category
+// alert: the drop must reach the alert's threshold and happen after the alert
+// was created, so past drops aren't notified
+func categoryAlertMatches(alert models.CategoryAlert, change models.PriceHistory) bool {
+	return change.ChangePercent <= -alert.DiscountPercent && change.CreatedAt.After(alert.CreatedAt)
+}
+
+// checkCategoryAlerts notifies the users with an alert on the product's
+// category, or on any of its parent categories, of the price changes that
+// trigger their alert. Each change is notified once per alert, and at most
+// CategoryAlertDailyLimit changes per alert in 24 hours. Users with a price
+// alert on the product itself are left to that alert.
+func (s *Service) checkCategoryAlerts(ctx context.Context, product models.Product, changes []models.PriceHistory,
+	productAlerts []priceAlert) error {
+	if product.CategoryID == 0 {
+		return nil
+	}
+
+	var alerts []models.CategoryAlert
+	if err := s.db.WithContext(ctx).Raw(`
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM categories WHERE id = ? AND deleted_at IS NULL
+			UNION
+			SELECT c.id, c.parent_id FROM categories c
+			JOIN ancestors a ON c.id = a.parent_id
+			WHERE c.deleted_at IS NULL
+		)
+		SELECT * FROM category_alerts
+		WHERE category_id IN (SELECT id FROM ancestors) AND deleted_at IS NULL
+	`, product.CategoryID).Scan(&alerts).Error; err != nil {
+		return fmt.Errorf("failed to fetch category alerts: %w", err)
+	}
+
+	hasProductAlert := make(map[uint]bool, len(productAlerts))
+	for _, alert := range productAlerts {
+		hasProductAlert[alert.UserID] = true
+	}
+
+	for _, alert := range alerts {
+		if hasProductAlert[alert.UserID] {
+			continue
+		}
+
+		for _, change := range changes {
+			if !categoryAlertMatches(alert, change) {
+				continue
+			}
+
+			if limit := s.config.Analyzer.CategoryAlertDailyLimit; limit > 0 {
+				var sent int64
+				if err := s.db.WithContext(ctx).Model(&models.CategoryAlertNotification{}).
+					Where("category_alert_id = ? AND created_at >= ?", alert.ID, time.Now().Add(-24*time.Hour)).
+					Count(&sent).Error; err != nil {
+					return fmt.Errorf("failed to count category alert notifications: %w", err)
+				}
+				if sent >= int64(limit) {
+					break
+				}
+			}
+
+			// Record the change first, so it's only notified once when
+			// updates of the product are processed concurrently
+			record := models.CategoryAlertNotification{CategoryAlertID: alert.ID, PriceHistoryID: change.ID}
+			result := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+			if result.Error != nil {
+				return fmt.Errorf("failed to record category alert notification: %w", result.Error)
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+
+			if err := s.notifyPriceDrop(ctx, alert.UserID, product, change); err != nil {
+				log.Printf("Failed to notify category price drop: %v", err)
+
+				// Forget the change, so it's retried on the next update
+				if err := s.db.WithContext(ctx).Delete(&record).Error; err != nil {
+					log.Printf("Failed to delete category alert notification: %v", err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
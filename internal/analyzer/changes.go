@@ -0,0 +1,29 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/e-commerce/platform/internal/common/models"
+	"gorm.io/gorm/clause"
+)
+
+// consumeProductChanges records the product change events published by the
+// crawler. Events are unique per product version, variant and field, so
+// redelivered events are ignored.
+func (s *Service) consumeProductChanges(ctx context.Context) {
+	topic := s.config.Kafka.ChangeTopic
+	s.kafka.ConsumeMessagesParallel(ctx, topic, s.config.Kafka.Workers(topic), func(ctx context.Context, message []byte) error {
+		var change models.ProductChangeEvent
+		if err := json.Unmarshal(message, &change); err != nil {
+			return fmt.Errorf("failed to unmarshal product change: %w", err)
+		}
+		change.ID = 0
+
+		if err := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&change).Error; err != nil {
+			return fmt.Errorf("failed to save product change: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,70 @@
+package analyzer
+
+import (
+	"time"
+)
+
+const (
+	// maxCompareProducts is the number of products a price comparison covers at most
+	maxCompareProducts = 10
+	// maxCompareDays is the longest range a price comparison covers, in days
+	maxCompareDays = 366
+)
+
+// dailyPrice is the last price a product changed to on a day
+type dailyPrice struct {
+	ProductID uint
+	Day       time.Time
+	Price     float64
+}
+
+// priceSeries is the daily price of a product aligned to the days of a
+// comparison. Days before its first change in the range are null, and it is
+// empty when the product has no changes in the range.
+type priceSeries struct {
+	ProductID uint       `json:"product_id"`
+	Prices    []*float64 `json:"prices"`
+}
+
+// comparisonDays returns the UTC days from the day of from to the day of to
+func comparisonDays(from, to time.Time) []time.Time {
+	day := from.UTC().Truncate(24 * time.Hour)
+	last := to.UTC().Truncate(24 * time.Hour)
+
+	days := make([]time.Time, 0, int(last.Sub(day).Hours()/24)+1)
+	for ; !day.After(last); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+	return days
+}
+
+// alignDailyPrices builds the series of each product from its daily prices,
+// which must be ordered by day. A price holds on the following days until the
+// product's next change.
+func alignDailyPrices(productIDs []uint, days []time.Time, prices []dailyPrice) []priceSeries {
+	byProduct := make(map[uint][]dailyPrice, len(productIDs))
+	for _, price := range prices {
+		byProduct[price.ProductID] = append(byProduct[price.ProductID], price)
+	}
+
+	series := make([]priceSeries, len(productIDs))
+	for i, productID := range productIDs {
+		series[i] = priceSeries{ProductID: productID, Prices: make([]*float64, 0)}
+		changes := byProduct[productID]
+		if len(changes) == 0 {
+			continue
+		}
+
+		var current *float64
+		next := 0
+		for _, day := range days {
+			for next < len(changes) && !changes[next].Day.UTC().After(day) {
+				price := changes[next].Price
+				current = &price
+				next++
+			}
+			series[i].Prices = append(series[i].Prices, current)
+		}
+	}
+	return series
+}
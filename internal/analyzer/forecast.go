@@ -0,0 +1,98 @@
+package analyzer
+
+import (
+	"math"
+
+	"github.com/e-commerce/platform/internal/common/models"
+)
+
+// Forecast directions
+const (
+	trendRising           = "rising"
+	trendFalling          = "falling"
+	trendStable           = "stable"
+	trendInsufficientData = "insufficient_data"
+)
+
+const (
+	// minForecastPoints is the minimum number of price points needed for a forecast
+	minForecastPoints = 3
+	// fullConfidencePoints is the sample size at which confidence is no longer
+	// reduced for having too few points
+	fullConfidencePoints = 20
+	// stableSlopePercent is the daily change, as a percentage of the mean price,
+	// below which a trend is considered stable
+	stableSlopePercent = 0.1
+)
+
+// priceForecast is a simple trend signal derived from a product's price history
+type priceForecast struct {
+	Direction    string  `json:"direction"`
+	Slope        float64 `json:"slope"`         // Price change per day
+	SlopePercent float64 `json:"slope_percent"` // Price change per day as a percentage of the mean price
+	Confidence   float64 `json:"confidence"`    // Between 0 and 1
+	Points       int     `json:"points"`
+}
+
+// forecastPrices fits a least squares line through the price history, which
+// must be ordered by time, and classifies its slope. Confidence is the fit's
+// R² scaled down for small samples.
+func forecastPrices(history []models.PriceHistory) priceForecast {
+	n := len(history)
+	if n < minForecastPoints {
+		return priceForecast{Direction: trendInsufficientData, Points: n}
+	}
+
+	// x is days since the first point, y is the price
+	start := history[0].CreatedAt
+	var sumX, sumY float64
+	for _, point := range history {
+		sumX += point.CreatedAt.Sub(start).Hours() / 24
+		sumY += point.NewPrice
+	}
+	meanX, meanY := sumX/float64(n), sumY/float64(n)
+
+	var sxx, sxy, syy float64
+	for _, point := range history {
+		dx := point.CreatedAt.Sub(start).Hours()/24 - meanX
+		dy := point.NewPrice - meanY
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+
+	forecast := priceForecast{Direction: trendStable, Points: n}
+
+	// All points at the same instant or the same price carry no trend
+	if sxx == 0 || syy == 0 || meanY == 0 {
+		forecast.Confidence = sampleWeight(n)
+		return forecast
+	}
+
+	forecast.Slope = sxy / sxx
+	forecast.SlopePercent = forecast.Slope / meanY * 100
+	forecast.Confidence = (sxy * sxy) / (sxx * syy) * sampleWeight(n)
+
+	switch {
+	case forecast.SlopePercent >= stableSlopePercent:
+		forecast.Direction = trendRising
+	case forecast.SlopePercent <= -stableSlopePercent:
+		forecast.Direction = trendFalling
+	}
+
+	forecast.Slope = roundTo(forecast.Slope, 4)
+	forecast.SlopePercent = roundTo(forecast.SlopePercent, 4)
+	forecast.Confidence = roundTo(forecast.Confidence, 2)
+	return forecast
+}
+
+// sampleWeight scales confidence down linearly for fewer than fullConfidencePoints points
+func sampleWeight(n int) float64 {
+	return math.Min(1, float64(n)/fullConfidencePoints)
+}
+
+// roundTo rounds v to the given number of decimals
+func roundTo(v float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(v*scale) / scale
+}
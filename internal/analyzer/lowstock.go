@@ -0,0 +1,116 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/e-commerce/platform/internal/common/models"
+)
+
+// lowStockNotificationType is the notification type of low stock alerts
+const lowStockNotificationType = "low_stock"
+
+// checkStockAlerts checks a product's low stock alerts against the latest
+// stock change of their variants, notifying users of stock that fell below
+// their threshold and re-arming alerts whose stock recovered. Low stock is
+// time sensitive, so it's notified immediately even in digest mode.
+func (s *Service) checkStockAlerts(ctx context.Context, product models.Product, alerts []priceAlert) error {
+	var variantIDs []uint
+	for _, alert := range alerts {
+		if alert.StockThreshold > 0 {
+			variantIDs = append(variantIDs, alert.VariantID)
+		}
+	}
+	if len(variantIDs) == 0 {
+		return nil
+	}
+
+	var histories []models.StockHistory
+	if err := s.db.WithContext(ctx).Raw(`
+		SELECT DISTINCT ON (variant_id) * FROM stock_histories
+		WHERE variant_id IN ? AND deleted_at IS NULL
+		ORDER BY variant_id, created_at DESC, id DESC
+	`, variantIDs).Scan(&histories).Error; err != nil {
+		return fmt.Errorf("failed to fetch stock histories: %w", err)
+	}
+	latest := make(map[uint]models.StockHistory, len(histories))
+	for _, history := range histories {
+		latest[history.VariantID] = history
+	}
+
+	for _, alert := range alerts {
+		history, exists := latest[alert.VariantID]
+		if alert.StockThreshold == 0 || !exists {
+			continue
+		}
+
+		low, notify := alert.checkStock(history)
+		if low == alert.StockLow {
+			continue
+		}
+
+		if notify {
+			notification := struct {
+				Type           string `json:"type"`
+				UserID         uint   `json:"user_id"`
+				ProductID      uint   `json:"product_id"`
+				VariantID      uint   `json:"variant_id"`
+				PreviousStock  int    `json:"previous_stock"`
+				NewStock       int    `json:"new_stock"`
+				StockThreshold int    `json:"stock_threshold"`
+				ProductName    string `json:"product_name"`
+				ProductURL     string `json:"product_url"`
+				HistoryID      uint   `json:"history_id"`
+			}{
+				Type:           lowStockNotificationType,
+				UserID:         alert.UserID,
+				ProductID:      product.ID,
+				VariantID:      alert.VariantID,
+				PreviousStock:  history.PreviousStock,
+				NewStock:       history.NewStock,
+				StockThreshold: alert.StockThreshold,
+				ProductName:    product.Name,
+				ProductURL:     product.URL,
+				HistoryID:      history.ID,
+			}
+
+			// Publish notification, keyed by user to keep their notifications in order
+			if err := s.kafka.PublishMessage(ctx, s.config.Kafka.NotificationTopic,
+				fmt.Sprintf("user-%d", alert.UserID), notification); err != nil {
+				// Left armed, so it's retried on the next update
+				log.Printf("Failed to publish low stock notification: %v", err)
+				continue
+			}
+		}
+
+		s.setStockLow(ctx, product.ID, alert.ID, low, notify)
+	}
+
+	return nil
+}
+
+// setStockLow records whether the stock of a low stock alert is below its
+// threshold, along with the notification time when it was notified
+func (s *Service) setStockLow(ctx context.Context, productID, alertID uint, low, notified bool) {
+	now := time.Now()
+	s.alertsMux.Lock()
+	for i := range s.priceAlerts[productID] {
+		if s.priceAlerts[productID][i].ID == alertID {
+			s.priceAlerts[productID][i].StockLow = low
+			if notified {
+				s.priceAlerts[productID][i].LastNotification = now
+			}
+		}
+	}
+	s.alertsMux.Unlock()
+
+	updates := map[string]interface{}{"stock_low": low}
+	if notified {
+		updates["last_notification"] = now
+	}
+	if err := s.db.WithContext(ctx).Model(&models.PriceAlert{}).Where("id = ?", alertID).Updates(updates).Error; err != nil {
+		log.Printf("Failed to update price alert: %v", err)
+	}
+}
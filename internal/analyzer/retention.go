@@ -0,0 +1,231 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// retentionInterval is how often old history is pruned
+	retentionInterval = 24 * time.Hour
+	// retentionBatchSize is the number of rows deleted per statement, so
+	// pruning never holds locks on a large part of a table
+	retentionBatchSize = 5000
+)
+
+// periodicRetention prunes price, stock and favorite history past their retention once a day
+func (s *Service) periodicRetention(ctx context.Context) {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.pruneHistory(ctx)
+		}
+	}
+}
+
+// historyTable describes a history table for pruning
+type historyTable struct {
+	name          string
+	retentionDays int
+	series        string // Column of the series of changes a row belongs to
+	previous      string // Column of the value before the change
+	change        string // Assignment recomputing the change of row k from the value e before it
+}
+
+// historyTables returns the history tables with their configured retention
+func (s *Service) historyTables() []historyTable {
+	return []historyTable{
+		{
+			name:          "price_histories",
+			retentionDays: s.config.Analyzer.PriceHistoryRetentionDays,
+			series:        "variant_id",
+			previous:      "previous_price",
+			change:        "change_percent = CASE WHEN e.previous_price = 0 THEN 0 ELSE (k.new_price - e.previous_price) / e.previous_price * 100 END",
+		},
+		{
+			name:          "stock_histories",
+			retentionDays: s.config.Analyzer.StockHistoryRetentionDays,
+			series:        "variant_id",
+			previous:      "previous_stock",
+			change:        "change_quantity = k.new_stock - e.previous_stock",
+		},
+		{
+			name:          "favorite_histories",
+			retentionDays: s.config.Analyzer.FavoriteHistoryRetentionDays,
+			series:        "product_id",
+			previous:      "previous_count",
+			change:        "change_count = k.new_count - e.previous_count",
+		},
+	}
+}
+
+// pruneHistory prunes the history tables that have a retention configured
+func (s *Service) pruneHistory(ctx context.Context) {
+	for _, table := range s.historyTables() {
+		if table.retentionDays <= 0 {
+			continue
+		}
+
+		cutoff := time.Now().AddDate(0, 0, -table.retentionDays)
+		var (
+			deleted int64
+			err     error
+		)
+		if s.config.Analyzer.DownsampleHistory {
+			deleted, err = s.downsampleHistoryTable(ctx, table, cutoff, retentionBatchSize)
+		} else {
+			deleted, err = s.pruneHistoryTable(ctx, table.name, cutoff)
+		}
+		if err != nil {
+			log.Printf("Failed to prune %s: %v", table.name, err)
+			continue
+		}
+		log.Printf("Pruned %d rows of %s older than %d days", deleted, table.name, table.retentionDays)
+	}
+}
+
+// pruneHistoryTable deletes the rows of a history table created before cutoff, in batches
+func (s *Service) pruneHistoryTable(ctx context.Context, table string, cutoff time.Time) (int64, error) {
+	query := fmt.Sprintf(`DELETE FROM %[1]s WHERE id IN (
+		SELECT id FROM %[1]s WHERE created_at < ? LIMIT ?
+	)`, table)
+
+	var total int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+
+		result := s.db.WithContext(ctx).Exec(query, cutoff, retentionBatchSize)
+		if result.Error != nil {
+			return total, fmt.Errorf("failed to delete history: %w", result.Error)
+		}
+		total += result.RowsAffected
+		if result.RowsAffected < retentionBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// downsampledRow is a history row deleted when downsampling, with the series
+// and day whose last row is kept
+type downsampledRow struct {
+	ID     uint
+	Series uint
+	Day    time.Time
+}
+
+// downsampleHistoryTable deletes the rows of a history table created before
+// cutoff except the last one of each series and day, so old history still
+// shows the daily closing values. The kept row's change is recomputed from
+// the value before the day's first change, so it spans the whole day.
+//
+// Rows are walked once by descending ID, in batches of batchSize. Walking
+// backwards, the first row of a day is deleted in the last batch touching the
+// day, so every batch still finds the value before the day on it.
+func (s *Service) downsampleHistoryTable(ctx context.Context, table historyTable, cutoff time.Time, batchSize int) (int64, error) {
+	// Rows with a later row of their series on the same day before cutoff
+	selectQuery := fmt.Sprintf(`SELECT h.id, h.%[2]s AS series, date_trunc('day', h.created_at) AS day
+		FROM %[1]s h
+		WHERE h.id < ? AND h.created_at < ? AND EXISTS (
+			SELECT 1 FROM %[1]s l
+			WHERE l.%[2]s = h.%[2]s AND l.created_at < ?
+				AND l.created_at < date_trunc('day', h.created_at) + interval '1 day'
+				AND (l.created_at, l.id) > (h.created_at, h.id)
+		)
+		ORDER BY h.id DESC LIMIT ?`, table.name, table.series)
+
+	var (
+		total  int64
+		lastID uint = math.MaxInt64
+	)
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+
+		var rows []downsampledRow
+		if err := s.db.WithContext(ctx).Raw(selectQuery, lastID, cutoff, cutoff, batchSize).Scan(&rows).Error; err != nil {
+			return total, fmt.Errorf("failed to load history to delete: %w", err)
+		}
+		if len(rows) == 0 {
+			return total, nil
+		}
+		lastID = rows[len(rows)-1].ID
+
+		deleted, err := s.deleteDownsampledRows(ctx, table, cutoff, rows)
+		if err != nil {
+			return total, err
+		}
+		total += deleted
+		if len(rows) < batchSize {
+			return total, nil
+		}
+	}
+}
+
+// deleteDownsampledRows deletes a batch of downsampled rows after updating the
+// last row of each of their series and day to the change over the whole day
+func (s *Service) deleteDownsampledRows(ctx context.Context, table historyTable, cutoff time.Time, rows []downsampledRow) (int64, error) {
+	type seriesDay struct {
+		series uint
+		day    time.Time
+	}
+	seen := make(map[seriesDay]bool)
+	ids := make([]uint, 0, len(rows))
+	var (
+		values []string
+		args   []interface{}
+	)
+	for _, row := range rows {
+		ids = append(ids, row.ID)
+		key := seriesDay{row.Series, row.Day.UTC()}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		values = append(values, "(?::bigint, ?::timestamptz)")
+		args = append(args, row.Series, row.Day)
+	}
+
+	// e is the first row of each series and day, k the last
+	updateQuery := fmt.Sprintf(`UPDATE %[1]s k SET %[3]s = e.%[3]s, %[4]s
+		FROM (
+			SELECT DISTINCT ON (d.series, d.day) d.series, d.day, f.%[3]s
+			FROM (VALUES %[5]s) AS d (series, day)
+			JOIN %[1]s f ON f.%[2]s = d.series AND f.created_at >= d.day AND f.created_at < d.day + interval '1 day'
+			ORDER BY d.series, d.day, f.created_at, f.id
+		) e
+		WHERE k.%[2]s = e.series AND k.created_at >= e.day AND k.created_at < LEAST(e.day + interval '1 day', ?)
+			AND NOT EXISTS (
+				SELECT 1 FROM %[1]s l
+				WHERE l.%[2]s = k.%[2]s AND l.created_at < LEAST(e.day + interval '1 day', ?)
+					AND (l.created_at, l.id) > (k.created_at, k.id)
+			)`, table.name, table.series, table.previous, table.change, strings.Join(values, ", "))
+	args = append(args, cutoff, cutoff)
+
+	var deleted int64
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(updateQuery, args...).Error; err != nil {
+			return fmt.Errorf("failed to update kept history: %w", err)
+		}
+		result := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE id IN ?", table.name), ids)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete history: %w", result.Error)
+		}
+		deleted = result.RowsAffected
+		return nil
+	})
+	return deleted, err
+}
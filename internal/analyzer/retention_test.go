@@ -0,0 +1,125 @@
+package analyzer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/e-commerce/platform/internal/common/config"
+	"github.com/e-commerce/platform/internal/common/db/dbtest"
+)
+
+// priceChange is a price history row
+type priceChange struct {
+	variantID uint
+	at        time.Time
+	previous  float64
+	price     float64
+}
+
+func TestDownsampleHistoryTable(t *testing.T) {
+	database := dbtest.Open(t)
+	s := &Service{db: database, config: &config.Config{Analyzer: config.AnalyzerConfig{PriceHistoryRetentionDays: 10}}}
+
+	var productID uint
+	if err := database.Raw(`INSERT INTO products (external_id, name) VALUES ('1', 'Product') RETURNING id`).Scan(&productID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day()-20, 0, 0, 0, 0, time.UTC)
+	recent := time.Now().Add(-2 * time.Hour)
+	changes := []priceChange{
+		// Variant 1 changes three times on day one, once on day two
+		{1, day.Add(10 * time.Hour), 100, 90},
+		{1, day.Add(12 * time.Hour), 90, 80},
+		{1, day.Add(15 * time.Hour), 80, 85},
+		{1, day.Add(34 * time.Hour), 85, 80},
+		// Variant 2 changes once on day one
+		{2, day.Add(11 * time.Hour), 50, 40},
+		// Recent changes aren't touched
+		{1, recent, 80, 70},
+		{1, recent.Add(time.Minute), 70, 75},
+	}
+	for _, change := range changes {
+		if err := database.Exec(`INSERT INTO price_histories (created_at, product_id, variant_id, previous_price, new_price, change_percent)
+			VALUES (?, ?, ?, ?, ?, 0)`, change.at, productID, change.variantID, change.previous, change.price).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// One row per batch, so the day is split across batches
+	cutoff := time.Now().AddDate(0, 0, -10)
+	deleted, err := s.downsampleHistoryTable(context.Background(), s.historyTables()[0], cutoff, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 {
+		t.Errorf("deleted %d rows, want 2", deleted)
+	}
+
+	var rows []struct {
+		VariantID     uint
+		PreviousPrice float64
+		NewPrice      float64
+		ChangePercent float64
+	}
+	if err := database.Raw(`SELECT variant_id, previous_price, new_price, change_percent FROM price_histories
+		ORDER BY variant_id, created_at`).Scan(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		variantID uint
+		previous  float64
+		price     float64
+		change    float64
+	}{
+		// The day's last row spans the whole day
+		{1, 100, 85, -15},
+		{1, 85, 80, 0},
+		{1, 80, 70, 0},
+		{1, 70, 75, 0},
+		{2, 50, 40, 0},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d: %+v", len(rows), len(want), rows)
+	}
+	for i, w := range want {
+		row := rows[i]
+		if row.VariantID != w.variantID || row.PreviousPrice != w.previous || row.NewPrice != w.price || row.ChangePercent != w.change {
+			t.Errorf("row %d = %+v, want %+v", i, row, w)
+		}
+	}
+}
+
+func TestHistoryTables(t *testing.T) {
+	s := &Service{config: &config.Config{Analyzer: config.AnalyzerConfig{
+		PriceHistoryRetentionDays:    30,
+		StockHistoryRetentionDays:    60,
+		FavoriteHistoryRetentionDays: 90,
+	}}}
+
+	want := map[string]struct {
+		retentionDays int
+		series        string
+	}{
+		"price_histories":    {30, "variant_id"},
+		"stock_histories":    {60, "variant_id"},
+		"favorite_histories": {90, "product_id"},
+	}
+	tables := s.historyTables()
+	if len(tables) != len(want) {
+		t.Fatalf("got %d tables, want %d", len(tables), len(want))
+	}
+	for _, table := range tables {
+		w, ok := want[table.name]
+		if !ok {
+			t.Errorf("unexpected table %s", table.name)
+			continue
+		}
+		if table.retentionDays != w.retentionDays || table.series != w.series {
+			t.Errorf("%s: retention %d by %s, want %d by %s", table.name, table.retentionDays, table.series, w.retentionDays, w.series)
+		}
+	}
+}
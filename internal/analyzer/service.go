@@ -3,14 +3,18 @@ package analyzer
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/e-commerce/platform/internal/common/config"
 	"github.com/e-commerce/platform/internal/common/db"
 	"github.com/e-commerce/platform/internal/common/messaging"
 	"github.com/e-commerce/platform/internal/common/models"
+	"gorm.io/gorm/clause"
 )
 
 // Service represents the product analyzer service
@@ -18,18 +22,62 @@ type Service struct {
 	db          *db.Database
 	kafka       *messaging.KafkaClient
 	config      *config.Config
-	priceAlerts map[uint][]priceAlert
+	priceAlerts map[uint][]priceAlert // Maps product ID to its price alerts
+	alertsMux   sync.RWMutex          // Mutex for the price alerts
+	analyzing   atomic.Bool           // Whether an analysis run is in progress
+	background  sync.WaitGroup        // Background goroutines, waited for by Stop
 }
 
+// defaultAlertCooldownHours is the default minimum time between notifications of an alert
+const defaultAlertCooldownHours = 24
+
 // priceAlert represents a price alert configuration
 type priceAlert struct {
+	ID               uint // Persisted alert ID, 0 for default favorite alerts
 	UserID           uint
 	ProductID        uint
 	VariantID        uint
 	DiscountPercent  float64
+	TargetPrice      float64 // Absolute price target, 0 when the alert uses DiscountPercent
+	StockThreshold   int     // Low stock threshold, 0 for price drop alerts
+	StockLow         bool    // Whether the stock was below StockThreshold when last checked
+	Cooldown         time.Duration
 	LastNotification time.Time
 }
 
+// shouldNotify reports whether a price change triggers the alert at now. The
+// change must be of the alert's variant, if it has one, the new price must reach
+// the alert's target, or the drop its threshold, the change must happen after
+// the last notification, and the alert's cooldown must have passed since then.
+func (a priceAlert) shouldNotify(change models.PriceHistory, now time.Time) bool {
+	if a.StockThreshold > 0 {
+		return false
+	}
+	if a.VariantID > 0 && change.VariantID != a.VariantID {
+		return false
+	}
+	if a.TargetPrice > 0 {
+		if change.NewPrice > a.TargetPrice {
+			return false
+		}
+	} else if change.ChangePercent > -a.DiscountPercent {
+		return false
+	}
+	if !change.CreatedAt.After(a.LastNotification) {
+		return false
+	}
+	return now.Sub(a.LastNotification) >= a.Cooldown
+}
+
+// checkStock reports whether the stock of the alert's variant, as of its latest
+// change, is below the alert's threshold and whether that triggers the alert.
+// It triggers when the stock falls below the threshold, but not again until
+// the stock recovered, so an alert notifies once while the stock stays low.
+func (a priceAlert) checkStock(latest models.StockHistory) (low, notify bool) {
+	low = latest.NewStock < a.StockThreshold
+	return low, low && !a.StockLow
+}
+
 // NewAnalyzerService creates a new product analyzer service
 func NewAnalyzerService(db *db.Database, kafka *messaging.KafkaClient, cfg *config.Config) *Service {
 	return &Service{
@@ -42,55 +90,201 @@ func NewAnalyzerService(db *db.Database, kafka *messaging.KafkaClient, cfg *conf
 
 // Start starts the product analyzer service
 func (s *Service) Start(ctx context.Context) error {
+	// Create the topics used by the analyzer if the cluster doesn't auto-create them
+	if err := s.kafka.EnsureTopics(ctx, []messaging.TopicSpec{
+		{Name: s.config.Kafka.ProductTopic},
+		{Name: s.config.Kafka.NotificationTopic},
+		{Name: s.config.Kafka.PriorityTopic},
+		{Name: s.config.Kafka.ChangeTopic},
+	}); err != nil {
+		log.Printf("Warning: failed to ensure Kafka topics: %v", err)
+	}
+
 	// Create Kafka consumer for product updates
 	if err := s.kafka.CreateConsumer(s.config.Kafka.ProductTopic); err != nil {
 		return fmt.Errorf("failed to create Kafka consumer: %w", err)
 	}
 
-	// Create Kafka producer for notifications
-	if err := s.kafka.CreateProducer(s.config.Kafka.NotificationTopic); err != nil {
+	// Create Kafka consumer for product changes
+	if err := s.kafka.CreateConsumer(s.config.Kafka.ChangeTopic); err != nil {
+		return fmt.Errorf("failed to create Kafka consumer: %w", err)
+	}
+
+	// Create Kafka producer for notifications, keyed by user so each user's
+	// notifications are delivered in order
+	if err := s.kafka.CreateProducer(s.config.Kafka.NotificationTopic, messaging.PartitionByKeyHash); err != nil {
 		return fmt.Errorf("failed to create Kafka producer: %w", err)
 	}
 
 	// Load price alerts for favorited products
-	if err := s.loadPriceAlerts(); err != nil {
+	if _, err := s.loadPriceAlerts(); err != nil {
 		log.Printf("Warning: failed to load price alerts: %v", err)
 	}
 
 	// Start consuming product updates
-	go s.consumeProductUpdates(ctx)
+	s.run(func() { s.consumeProductUpdates(ctx) })
+
+	// Start recording product changes into the audit feed
+	s.run(func() { s.consumeProductChanges(ctx) })
+
+	// Start measuring how far the consumers lag behind their topics
+	s.run(func() { s.kafka.MonitorConsumerLag(ctx, s.config.Kafka.LagCheckInterval) })
 
 	// Start periodic analysis
-	go s.periodicAnalysis(ctx)
+	s.run(func() { s.periodicAnalysis(ctx) })
+
+	// Start pruning history past its retention
+	s.run(func() { s.periodicRetention(ctx) })
 
 	return nil
 }
 
-// loadPriceAlerts loads price alerts for favorited products
-func (s *Service) loadPriceAlerts() error {
+// run runs fn in the background, tracked so Stop waits for it to finish
+func (s *Service) run(fn func()) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		fn()
+	}()
+}
+
+// Stop waits for the service's background work to finish once the context
+// passed to Start is cancelled. Consumers stop reading messages but finish
+// the ones being handled. It returns ctx's error if ctx is done first.
+func (s *Service) Stop(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for background work: %w", ctx.Err())
+	}
+}
+
+// loadPriceAlerts loads persisted price alerts and default alerts for favorited
+// products, replacing the in-memory alerts, and returns how many were loaded
+func (s *Service) loadPriceAlerts() (int, error) {
+	var storedAlerts []models.PriceAlert
+	if err := s.db.Find(&storedAlerts).Error; err != nil {
+		return 0, fmt.Errorf("failed to load price alerts: %w", err)
+	}
+
 	var userFavorites []models.UserFavorite
 	if err := s.db.Preload("Product").Find(&userFavorites).Error; err != nil {
-		return fmt.Errorf("failed to load user favorites: %w", err)
+		return 0, fmt.Errorf("failed to load user favorites: %w", err)
+	}
+
+	priceAlerts := make(map[uint][]priceAlert)
+	count := 0
+
+	// Track which user/product pairs already have an explicit alert
+	hasAlert := make(map[[2]uint]bool, len(storedAlerts))
+	for _, stored := range storedAlerts {
+		priceAlerts[stored.ProductID] = append(priceAlerts[stored.ProductID], newPriceAlert(stored))
+		hasAlert[[2]uint{stored.UserID, stored.ProductID}] = true
+		count++
 	}
 
 	for _, favorite := range userFavorites {
+		if hasAlert[[2]uint{favorite.UserID, favorite.ProductID}] {
+			continue
+		}
+
 		// Create a price alert with 10% discount threshold
 		alert := priceAlert{
 			UserID:          favorite.UserID,
 			ProductID:       favorite.ProductID,
 			DiscountPercent: 10.0, // Default 10% discount threshold
+			Cooldown:        defaultAlertCooldownHours * time.Hour,
 		}
 
 		// Add to the price alerts map
-		s.priceAlerts[favorite.ProductID] = append(s.priceAlerts[favorite.ProductID], alert)
+		priceAlerts[favorite.ProductID] = append(priceAlerts[favorite.ProductID], alert)
+		count++
 	}
 
-	return nil
+	s.alertsMux.Lock()
+	defer s.alertsMux.Unlock()
+
+	// Keep notification times only held in memory, so reloading doesn't
+	// restart the cooldown of alerts derived from favorites
+	for productID, alerts := range priceAlerts {
+		for i := range alerts {
+			for _, loaded := range s.priceAlerts[productID] {
+				if loaded.ID == alerts[i].ID && loaded.UserID == alerts[i].UserID &&
+					loaded.LastNotification.After(alerts[i].LastNotification) {
+					alerts[i].LastNotification = loaded.LastNotification
+				}
+			}
+		}
+	}
+	s.priceAlerts = priceAlerts
+
+	return count, nil
+}
+
+// newPriceAlert converts a persisted price alert to its in-memory form
+func newPriceAlert(stored models.PriceAlert) priceAlert {
+	cooldownHours := defaultAlertCooldownHours
+	if stored.CooldownHours != nil {
+		cooldownHours = *stored.CooldownHours
+	}
+
+	var targetPrice float64
+	if stored.TargetPrice != nil {
+		targetPrice = *stored.TargetPrice
+	}
+
+	var stockThreshold int
+	if stored.StockThreshold != nil {
+		stockThreshold = *stored.StockThreshold
+	}
+
+	return priceAlert{
+		ID:               stored.ID,
+		UserID:           stored.UserID,
+		ProductID:        stored.ProductID,
+		VariantID:        stored.VariantID,
+		DiscountPercent:  stored.DiscountPercent,
+		TargetPrice:      targetPrice,
+		StockThreshold:   stockThreshold,
+		StockLow:         stored.StockLow,
+		Cooldown:         time.Duration(cooldownHours) * time.Hour,
+		LastNotification: stored.LastNotification,
+	}
+}
+
+// addPriceAlert adds a persisted price alert to the in-memory alerts
+func (s *Service) addPriceAlert(stored models.PriceAlert) {
+	s.alertsMux.Lock()
+	defer s.alertsMux.Unlock()
+
+	s.priceAlerts[stored.ProductID] = append(s.priceAlerts[stored.ProductID], newPriceAlert(stored))
+}
+
+// removePriceAlert removes a persisted price alert from the in-memory alerts
+func (s *Service) removePriceAlert(productID, alertID uint) {
+	s.alertsMux.Lock()
+	defer s.alertsMux.Unlock()
+
+	alerts := s.priceAlerts[productID]
+	for i, alert := range alerts {
+		if alert.ID == alertID {
+			s.priceAlerts[productID] = append(alerts[:i], alerts[i+1:]...)
+			return
+		}
+	}
 }
 
 // consumeProductUpdates consumes product update messages from Kafka
 func (s *Service) consumeProductUpdates(ctx context.Context) {
-	s.kafka.ConsumeMessages(ctx, s.config.Kafka.ProductTopic, func(message []byte) error {
+	topic := s.config.Kafka.ProductTopic
+	s.kafka.ConsumeMessagesParallel(ctx, topic, s.config.Kafka.Workers(topic), func(ctx context.Context, message []byte) error {
 		var update struct {
 			ExternalID  string    `json:"external_id"`
 			LastUpdated time.Time `json:"last_updated"`
@@ -99,6 +293,14 @@ func (s *Service) consumeProductUpdates(ctx context.Context) {
 			return fmt.Errorf("failed to unmarshal product update: %w", err)
 		}
 
+		// Bound the update's queries like an API request's, so a slow query
+		// doesn't hold up the partition's messages
+		if timeout := s.config.Database.QueryTimeout; timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
 		// Process the product update
 		return s.processProductUpdate(ctx, update.ExternalID)
 	})
@@ -108,13 +310,13 @@ func (s *Service) consumeProductUpdates(ctx context.Context) {
 func (s *Service) processProductUpdate(ctx context.Context, externalID string) error {
 	// Fetch the product from the database
 	var product models.Product
-	if err := s.db.Where("external_id = ?", externalID).First(&product).Error; err != nil {
+	if err := s.db.WithContext(ctx).Where("external_id = ?", externalID).First(&product).Error; err != nil {
 		return fmt.Errorf("failed to fetch product: %w", err)
 	}
 
 	// Check for price history entries
 	var priceHistories []models.PriceHistory
-	if err := s.db.Where("product_id = ?", product.ID).
+	if err := s.db.WithContext(ctx).Where("product_id = ?", product.ID).
 		Order("created_at DESC").
 		Limit(10).
 		Find(&priceHistories).Error; err != nil {
@@ -122,51 +324,32 @@ func (s *Service) processProductUpdate(ctx context.Context, externalID string) e
 	}
 
 	// Check if the product has price alerts
-	if alerts, hasAlerts := s.priceAlerts[product.ID]; hasAlerts && len(priceHistories) > 0 {
+	s.alertsMux.RLock()
+	alerts := append([]priceAlert(nil), s.priceAlerts[product.ID]...)
+	s.alertsMux.RUnlock()
+	if len(alerts) > 0 && len(priceHistories) > 0 {
 		// Process each price alert
 		for _, alert := range alerts {
 			// Check if the price drop exceeds the threshold
 			for _, history := range priceHistories {
-				if history.ChangePercent <= -alert.DiscountPercent && 
-				   time.Since(alert.LastNotification) > 24*time.Hour {
-					// Fetch variant details
-					var variant models.Variant
-					if err := s.db.First(&variant, history.VariantID).Error; err != nil {
-						log.Printf("Failed to fetch variant: %v", err)
-						continue
-					}
-
-					// Create notification message
-					notification := struct {
-						UserID          uint    `json:"user_id"`
-						ProductID       uint    `json:"product_id"`
-						VariantID       uint    `json:"variant_id"`
-						PreviousPrice   float64 `json:"previous_price"`
-						NewPrice        float64 `json:"new_price"`
-						DiscountPercent float64 `json:"discount_percent"`
-						ProductName     string  `json:"product_name"`
-						ProductURL      string  `json:"product_url"`
-					}{
-						UserID:          alert.UserID,
-						ProductID:       product.ID,
-						VariantID:       variant.ID,
-						PreviousPrice:   history.PreviousPrice,
-						NewPrice:        history.NewPrice,
-						DiscountPercent: -history.ChangePercent,
-						ProductName:     product.Name,
-						ProductURL:      product.URL,
-					}
-
-					// Publish notification
-					if err := s.kafka.PublishMessage(ctx, s.config.Kafka.NotificationTopic, 
-													fmt.Sprintf("price-drop-%d-%d", alert.UserID, product.ID), 
-													notification); err != nil {
-						log.Printf("Failed to publish notification: %v", err)
+				if alert.shouldNotify(history, time.Now()) {
+					if err := s.notifyPriceDrop(ctx, alert.UserID, product, history); err != nil {
+						log.Printf("Failed to notify price drop: %v", err)
 					} else {
 						// Update last notification time
+						now := time.Now()
+						alert.LastNotification = now
+						s.alertsMux.Lock()
 						for i := range s.priceAlerts[product.ID] {
-							if s.priceAlerts[product.ID][i].UserID == alert.UserID {
-								s.priceAlerts[product.ID][i].LastNotification = time.Now()
+							if s.priceAlerts[product.ID][i].ID == alert.ID && s.priceAlerts[product.ID][i].UserID == alert.UserID {
+								s.priceAlerts[product.ID][i].LastNotification = now
+							}
+						}
+						s.alertsMux.Unlock()
+						if alert.ID > 0 {
+							if err := s.db.WithContext(ctx).Model(&models.PriceAlert{}).Where("id = ?", alert.ID).
+								Update("last_notification", now).Error; err != nil {
+								log.Printf("Failed to update price alert: %v", err)
 							}
 						}
 					}
@@ -175,6 +358,101 @@ func (s *Service) processProductUpdate(ctx context.Context, externalID string) e
 		}
 	}
 
+	// Check the category alerts
+	if len(priceHistories) > 0 {
+		if err := s.checkCategoryAlerts(ctx, product, priceHistories, alerts); err != nil {
+			return err
+		}
+	}
+
+	// Check the low stock alerts
+	if err := s.checkStockAlerts(ctx, product, alerts); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// notifyPriceDrop notifies a user of a price drop, or queues it for their
+// daily digest when they're in digest mode
+func (s *Service) notifyPriceDrop(ctx context.Context, userID uint, product models.Product, history models.PriceHistory) error {
+	// Fetch variant details
+	var variant models.Variant
+	if err := s.db.WithContext(ctx).First(&variant, history.VariantID).Error; err != nil {
+		return fmt.Errorf("failed to fetch variant: %w", err)
+	}
+
+	// Users in digest mode get the drop in their daily digest instead of
+	// an immediate notification
+	digestMode, err := s.usesDigest(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if digestMode {
+		return s.queueDigestItem(ctx, models.DigestItem{
+			UserID:          userID,
+			PriceHistoryID:  history.ID,
+			ProductID:       product.ID,
+			VariantID:       variant.ID,
+			PreviousPrice:   history.PreviousPrice,
+			NewPrice:        history.NewPrice,
+			DiscountPercent: -history.ChangePercent,
+			Currency:        history.Currency,
+			ProductName:     product.Name,
+			ProductURL:      product.URL,
+		})
+	}
+
+	// Create notification message
+	notification := struct {
+		UserID          uint    `json:"user_id"`
+		ProductID       uint    `json:"product_id"`
+		VariantID       uint    `json:"variant_id"`
+		PreviousPrice   float64 `json:"previous_price"`
+		NewPrice        float64 `json:"new_price"`
+		DiscountPercent float64 `json:"discount_percent"`
+		Currency        string  `json:"currency"`
+		ProductName     string  `json:"product_name"`
+		ProductURL      string  `json:"product_url"`
+		HistoryID       uint    `json:"history_id"`
+	}{
+		UserID:          userID,
+		ProductID:       product.ID,
+		VariantID:       variant.ID,
+		PreviousPrice:   history.PreviousPrice,
+		NewPrice:        history.NewPrice,
+		DiscountPercent: -history.ChangePercent,
+		Currency:        history.Currency,
+		ProductName:     product.Name,
+		ProductURL:      product.URL,
+		HistoryID:       history.ID,
+	}
+
+	// Publish notification, keyed by user to keep their notifications in order
+	if err := s.kafka.PublishMessage(ctx, s.config.Kafka.NotificationTopic,
+		fmt.Sprintf("user-%d", userID), notification); err != nil {
+		return fmt.Errorf("failed to publish notification: %w", err)
+	}
+	return nil
+}
+
+// usesDigest reports whether a user receives price drops in a daily digest
+func (s *Service) usesDigest(ctx context.Context, userID uint) (bool, error) {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.NotificationPreference{}).
+		Where("user_id = ? AND digest_mode = ?", userID, true).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to fetch notification preferences: %w", err)
+	}
+	return count > 0, nil
+}
+
+// queueDigestItem stores a price drop for the user's next digest, ignoring
+// drops that were already queued
+func (s *Service) queueDigestItem(ctx context.Context, item models.DigestItem) error {
+	if err := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&item).Error; err != nil {
+		return fmt.Errorf("failed to queue digest item: %w", err)
+	}
 	return nil
 }
 
@@ -188,84 +466,225 @@ func (s *Service) periodicAnalysis(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			s.analyzeTrends()
-			s.detectAnomalies()
-			s.updatePriorities(ctx)
+			if _, err := s.runAnalysis(ctx); err != nil {
+				log.Printf("Skipping periodic analysis: %v", err)
+			}
 		}
 	}
 }
 
-// analyzeTrends analyzes product trends
-func (s *Service) analyzeTrends() {
+// errAnalysisRunning is returned when analysis is triggered while it runs
+var errAnalysisRunning = errors.New("analysis is already running")
+
+// analysisResult summarizes an analysis run
+type analysisResult struct {
+	StartedAt            time.Time `json:"started_at"`
+	FinishedAt           time.Time `json:"finished_at"`
+	RisingPriceProducts  int       `json:"rising_price_products"`
+	FallingStockProducts int       `json:"falling_stock_products"`
+	PriceDrops           int       `json:"price_drops"`
+	StockSpikes          int       `json:"stock_spikes"`
+	NewAnomalies         int64     `json:"new_anomalies"`
+	PrioritizedProducts  int       `json:"prioritized_products"`
+}
+
+// runAnalysis analyzes trends, detects anomalies and updates crawl priorities,
+// returning errAnalysisRunning instead if a run is already in progress
+func (s *Service) runAnalysis(ctx context.Context) (*analysisResult, error) {
+	if !s.analyzing.CompareAndSwap(false, true) {
+		return nil, errAnalysisRunning
+	}
+	defer s.analyzing.Store(false)
+
+	result := &analysisResult{StartedAt: time.Now()}
+	result.RisingPriceProducts, result.FallingStockProducts = s.analyzeTrends(ctx)
+	result.PriceDrops, result.StockSpikes, result.NewAnomalies = s.detectAnomalies(ctx)
+	result.PrioritizedProducts = s.updatePriorities(ctx)
+	result.FinishedAt = time.Now()
+	return result, nil
+}
+
+// analyzeTrends analyzes product trends, returning the number of products
+// with rising prices and with falling stock
+func (s *Service) analyzeTrends(ctx context.Context) (risingPrices, fallingStock int) {
 	log.Println("Analyzing product trends...")
 
 	// Example: Find products with increasing price trend
 	var products []models.Product
-	s.db.Raw(`
+	if err := s.db.Replica(ctx).Raw(`
 		SELECT p.* FROM products p
 		JOIN price_histories ph ON p.id = ph.product_id
 		GROUP BY p.id
-		HAVING AVG(ph.change_percent) > 5
+		HAVING AVG(ph.change_percent) > ?
 		LIMIT 100
-	`).Scan(&products)
+	`, s.config.Analyzer.PriceTrendThreshold).Scan(&products).Error; err != nil {
+		log.Printf("Failed to find products with increasing price trend: %v", err)
+	}
+	risingPrices = len(products)
 
-	log.Printf("Found %d products with increasing price trend", len(products))
+	log.Printf("Found %d products with increasing price trend", risingPrices)
 
 	// Example: Find products with decreasing stock trend
-	s.db.Raw(`
+	products = nil
+	if err := s.db.Replica(ctx).Raw(`
 		SELECT p.* FROM products p
 		JOIN stock_histories sh ON p.id = sh.product_id
 		GROUP BY p.id
-		HAVING AVG(sh.change_quantity) < -10
+		HAVING AVG(sh.change_quantity) < ?
 		LIMIT 100
-	`).Scan(&products)
+	`, s.config.Analyzer.StockTrendThreshold).Scan(&products).Error; err != nil {
+		log.Printf("Failed to find products with decreasing stock trend: %v", err)
+	}
+	fallingStock = len(products)
 
-	log.Printf("Found %d products with decreasing stock trend", len(products))
+	log.Printf("Found %d products with decreasing stock trend", fallingStock)
+	return risingPrices, fallingStock
 }
 
-// detectAnomalies detects price or stock anomalies
-func (s *Service) detectAnomalies() {
+// Anomaly severities
+const (
+	severityLow    = "low"
+	severityMedium = "medium"
+	severityHigh   = "high"
+)
+
+// detectAnomalies detects price or stock anomalies and stores them, returning
+// the number of price drops and stock spikes found and of anomalies stored
+func (s *Service) detectAnomalies(ctx context.Context) (priceDropCount, stockSpikeCount int, stored int64) {
 	log.Println("Detecting product anomalies...")
 
-	// Example: Find products with sudden price drops
-	var products []models.Product
-	s.db.Raw(`
-		SELECT p.* FROM products p
-		JOIN price_histories ph ON p.id = ph.product_id
-		WHERE ph.change_percent < -30
-		AND ph.created_at > NOW() - INTERVAL '24 hours'
-		GROUP BY p.id
-		LIMIT 100
-	`).Scan(&products)
+	thresholds := s.config.Analyzer
 
-	log.Printf("Found %d products with sudden price drops", len(products))
+	// Find sudden price drops
+	var priceDrops []models.PriceHistory
+	if err := s.db.WithContext(ctx).Where("change_percent < ? AND created_at > NOW() - INTERVAL '24 hours'", thresholds.PriceDropThreshold).
+		Find(&priceDrops).Error; err != nil {
+		log.Printf("Failed to detect price drops: %v", err)
+	}
 
-	// Example: Find products with sudden stock increases
-	s.db.Raw(`
-		SELECT p.* FROM products p
-		JOIN stock_histories sh ON p.id = sh.product_id
-		WHERE sh.change_quantity > 100
-		AND sh.created_at > NOW() - INTERVAL '24 hours'
-		GROUP BY p.id
-		LIMIT 100
-	`).Scan(&products)
+	anomalies := make([]models.Anomaly, 0, len(priceDrops))
+	for _, drop := range priceDrops {
+		anomalies = append(anomalies, newAnomaly(models.AnomalyPriceDrop, drop.ID, drop.ProductID, drop.VariantID,
+			anomalySeverity(drop.ChangePercent, thresholds.PriceDropThreshold), drop.CreatedAt, map[string]interface{}{
+				"previous_price": drop.PreviousPrice,
+				"new_price":      drop.NewPrice,
+				"change_percent": drop.ChangePercent,
+			}))
+	}
 
-	log.Printf("Found %d products with sudden stock increases", len(products))
+	log.Printf("Found %d sudden price drops", len(priceDrops))
+
+	// Find sudden stock increases
+	var stockSpikes []models.StockHistory
+	if err := s.db.WithContext(ctx).Where("change_quantity > ? AND created_at > NOW() - INTERVAL '24 hours'", thresholds.StockSpikeThreshold).
+		Find(&stockSpikes).Error; err != nil {
+		log.Printf("Failed to detect stock spikes: %v", err)
+	}
+
+	for _, spike := range stockSpikes {
+		anomalies = append(anomalies, newAnomaly(models.AnomalyStockSpike, spike.ID, spike.ProductID, spike.VariantID,
+			anomalySeverity(float64(spike.ChangeQuantity), float64(thresholds.StockSpikeThreshold)), spike.CreatedAt, map[string]interface{}{
+				"previous_stock":  spike.PreviousStock,
+				"new_stock":       spike.NewStock,
+				"change_quantity": spike.ChangeQuantity,
+			}))
+	}
+
+	log.Printf("Found %d sudden stock increases", len(stockSpikes))
+
+	// Store the anomalies, skipping changes already recorded by an earlier run
+	if len(anomalies) == 0 {
+		return len(priceDrops), len(stockSpikes), 0
+	}
+	result := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "type"}, {Name: "source_id"}},
+		DoNothing: true,
+	}).Create(&anomalies)
+	if result.Error != nil {
+		log.Printf("Failed to store anomalies: %v", result.Error)
+		return len(priceDrops), len(stockSpikes), 0
+	}
+
+	log.Printf("Stored %d new anomalies", result.RowsAffected)
+	return len(priceDrops), len(stockSpikes), result.RowsAffected
 }
 
-// updatePriorities updates product crawling priorities based on analysis
-func (s *Service) updatePriorities(ctx context.Context) {
+// newAnomaly creates an anomaly for a price or stock history entry
+func newAnomaly(anomalyType string, sourceID, productID, variantID uint, severity string, detectedAt time.Time, details map[string]interface{}) models.Anomaly {
+	detailsJSON, _ := json.Marshal(details)
+	return models.Anomaly{
+		ProductID:  productID,
+		VariantID:  variantID,
+		Type:       anomalyType,
+		SourceID:   sourceID,
+		Severity:   severity,
+		DetectedAt: detectedAt,
+		Details:    detailsJSON,
+	}
+}
+
+// anomalySeverity rates a change by how far it exceeds the detection threshold
+func anomalySeverity(change, threshold float64) string {
+	ratio := change / threshold
+	switch {
+	case ratio >= 2:
+		return severityHigh
+	case ratio >= 1.5:
+		return severityMedium
+	default:
+		return severityLow
+	}
+}
+
+// favoriteGainWindow is the period over which favorites gained are summed to
+// find products gaining popularity fast
+const favoriteGainWindow = 24 * time.Hour
+
+// updatePriorities updates product crawling priorities based on analysis,
+// returning the number of products prioritized
+func (s *Service) updatePriorities(ctx context.Context) int {
 	log.Println("Updating product priorities...")
 
 	// Example: Increase priority for trending products
 	var trendingProducts []models.Product
-	s.db.Raw(`
+	if err := s.db.WithContext(ctx).Raw(`
 		SELECT p.* FROM products p
 		WHERE p.favorite_count > 100
 		AND p.is_active = true
 		ORDER BY p.favorite_count DESC
 		LIMIT 100
-	`).Scan(&trendingProducts)
+	`).Scan(&trendingProducts).Error; err != nil {
+		log.Printf("Failed to find trending products: %v", err)
+	}
+
+	// Products gaining favorites fast are trending before their count is high
+	var risingProducts []models.Product
+	if err := s.db.WithContext(ctx).Raw(`
+		SELECT p.* FROM products p
+		JOIN (
+			SELECT product_id, SUM(change_count) AS gained
+			FROM favorite_histories
+			WHERE created_at >= ? AND deleted_at IS NULL
+			GROUP BY product_id
+			HAVING SUM(change_count) >= ?
+		) f ON f.product_id = p.id
+		WHERE p.is_active = true AND p.deleted_at IS NULL
+		ORDER BY f.gained DESC
+		LIMIT 100
+	`, time.Now().Add(-favoriteGainWindow), s.config.Analyzer.FavoriteGainThreshold).Scan(&risingProducts).Error; err != nil {
+		log.Printf("Failed to find products gaining favorites: %v", err)
+	}
+
+	seen := make(map[string]bool, len(trendingProducts))
+	for _, product := range trendingProducts {
+		seen[product.ExternalID] = true
+	}
+	for _, product := range risingProducts {
+		if !seen[product.ExternalID] {
+			seen[product.ExternalID] = true
+			trendingProducts = append(trendingProducts, product)
+		}
+	}
 
 	// Update priorities
 	for _, product := range trendingProducts {
@@ -278,10 +697,11 @@ func (s *Service) updatePriorities(ctx context.Context) {
 		}
 
 		// Publish priority update
-		if err := s.kafka.PublishMessage(ctx, "product-priorities", product.ExternalID, priorityUpdate); err != nil {
+		if err := s.kafka.PublishMessage(ctx, s.config.Kafka.PriorityTopic, product.ExternalID, priorityUpdate); err != nil {
 			log.Printf("Failed to publish priority update: %v", err)
 		}
 	}
 
 	log.Printf("Updated priorities for %d trending products", len(trendingProducts))
+	return len(trendingProducts)
 }
\ No newline at end of file
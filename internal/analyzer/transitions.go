@@ -0,0 +1,59 @@
+package analyzer
+
+import (
+	"time"
+
+	"github.com/e-commerce/platform/internal/common/models"
+)
+
+// Stock transition directions
+const (
+	transitionOutOfStock  = "out_of_stock"
+	transitionBackInStock = "back_in_stock"
+)
+
+// stockTransition is a point where a variant went out of stock or came back in stock
+type stockTransition struct {
+	VariantID       uint      `json:"variant_id"`
+	Direction       string    `json:"direction"`
+	PreviousStock   int       `json:"previous_stock"`
+	NewStock        int       `json:"new_stock"`
+	At              time.Time `json:"at"`
+	OutOfStockHours *float64  `json:"out_of_stock_hours,omitempty"` // Set on back_in_stock when the matching out_of_stock is known
+}
+
+// stockTransitions returns the availability transitions in the stock history,
+// which must be ordered by time. Changes that stay in stock or stay out of
+// stock are not transitions.
+func stockTransitions(history []models.StockHistory) []stockTransition {
+	transitions := make([]stockTransition, 0)
+	outSince := make(map[uint]time.Time)
+
+	for _, change := range history {
+		wasInStock, isInStock := change.PreviousStock > 0, change.NewStock > 0
+		if wasInStock == isInStock {
+			continue
+		}
+
+		transition := stockTransition{
+			VariantID:     change.VariantID,
+			PreviousStock: change.PreviousStock,
+			NewStock:      change.NewStock,
+			At:            change.CreatedAt,
+		}
+		if isInStock {
+			transition.Direction = transitionBackInStock
+			if since, ok := outSince[change.VariantID]; ok {
+				hours := change.CreatedAt.Sub(since).Hours()
+				transition.OutOfStockHours = &hours
+				delete(outSince, change.VariantID)
+			}
+		} else {
+			transition.Direction = transitionOutOfStock
+			outSince[change.VariantID] = change.CreatedAt
+		}
+		transitions = append(transitions, transition)
+	}
+
+	return transitions
+}
@@ -0,0 +1,29 @@
+package adminauth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// New returns middleware that only lets through requests carrying token as a
+// Bearer token in the Authorization header. Without a token configured admin
+// endpoints are disabled and respond with 503.
+func New(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if token == "" {
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "Admin API is not configured")
+			}
+
+			given, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				return echo.NewHTTPError(http.StatusUnauthorized, "Invalid or missing admin token")
+			}
+
+			return next(c)
+		}
+	}
+}
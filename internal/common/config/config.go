@@ -1,31 +1,70 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
 )
 
 // Config represents the application configuration
 type Config struct {
-	Server    ServerConfig
-	Database  DatabaseConfig
-	Kafka     KafkaConfig
-	Services  ServicesConfig
-	Scraper   ScraperConfig
-	LogLevel  string
-	Environment string
+	Server          ServerConfig
+	Database        DatabaseConfig
+	Kafka           KafkaConfig
+	Services        ServicesConfig
+	Scraper         ScraperConfig
+	ImageMirror     ImageMirrorConfig
+	Analyzer        AnalyzerConfig
+	Notification    NotificationConfig
+	RateLimit       RateLimitConfig
+	Tracing         TracingConfig
+	AdminToken      string // Bearer token admin endpoints require, they are disabled without one
+	LogLevel        string
+	Environment     string
+	DefaultCurrency string // ISO 4217 code of prices whose source doesn't give a currency
 }
 
 // ServerConfig represents the HTTP server configuration
 type ServerConfig struct {
-	Port         int
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
-	IdleTimeout  time.Duration
+	Port               int
+	ReadHeaderTimeout  time.Duration
+	ReadTimeout        time.Duration
+	WriteTimeout       time.Duration
+	IdleTimeout        time.Duration
+	GzipLevel          int                 // Gzip compression level, -1 for the default level
+	GzipMinLength      int                 // Minimum response size in bytes before compressing
+	CORSAllowedOrigins []string            // Browser origins allowed to call the APIs, "*" allows any
+	ServiceCORSOrigins map[string][]string // Allowed origins of a service overriding CORSAllowedOrigins, by service name
+}
+
+// AllowedOrigins returns the browser origins allowed to call service's API
+func (c ServerConfig) AllowedOrigins(service string) []string {
+	if origins, exists := c.ServiceCORSOrigins[service]; exists {
+		return origins
+	}
+	return c.CORSAllowedOrigins
+}
+
+// HTTPServer returns an http.Server listening on address with the configured
+// timeouts applied, so slow clients cannot hold connections open indefinitely.
+func (c ServerConfig) HTTPServer(address string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              address,
+		Handler:           handler,
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		ReadTimeout:       c.ReadTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		IdleTimeout:       c.IdleTimeout,
+	}
 }
 
 // DatabaseConfig represents the database configuration
@@ -38,32 +77,356 @@ type DatabaseConfig struct {
 	MaxIdleConns           int
 	MaxOpenConns           int
 	ConnMaxLifetimeMinutes int
+	AutoMigrate            bool          // Also run GORM AutoMigrate after the versioned migrations, for development
+	QueryTimeout           time.Duration // Time an API request, or a consumed product update, may spend on database queries
+	SSLMode                string        // libpq sslmode, e.g. disable, require or verify-full
+	SSLRootCert            string        // CA certificate file the server certificate is verified with
+	StatementTimeout       time.Duration // Time any statement may run before the server cancels it, 0 for the server's default
+	ApplicationName        string        // Name connections report to the server, shown in pg_stat_activity
+	ReplicaHost            string        // Host of a read replica serving analytics queries, they use the primary when empty
+	ReplicaPort            int
+	ReplicaUsername        string
+	ReplicaPassword        string
+}
+
+// Replica returns the configuration of the read replica, which shares the
+// primary's settings other than its address and credentials, and whether
+// one is configured
+func (c DatabaseConfig) Replica() (DatabaseConfig, bool) {
+	if c.ReplicaHost == "" {
+		return DatabaseConfig{}, false
+	}
+	replica := c
+	replica.Host = c.ReplicaHost
+	replica.Port = c.ReplicaPort
+	replica.Username = c.ReplicaUsername
+	replica.Password = c.ReplicaPassword
+	replica.ReplicaHost = ""
+	return replica, true
+}
+
+// sslModes are the sslmode values libpq accepts
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// Validate checks the SSL and timeout settings
+func (c DatabaseConfig) Validate() error {
+	if !slices.Contains(sslModes, c.SSLMode) {
+		return fmt.Errorf("DB_SSLMODE must be one of %s, got %q", strings.Join(sslModes, ", "), c.SSLMode)
+	}
+	if c.StatementTimeout < 0 {
+		return fmt.Errorf("DB_STATEMENT_TIMEOUT must not be negative, got %v", c.StatementTimeout)
+	}
+	return nil
+}
+
+// DSN returns the connection string of the database in libpq keyword/value
+// format, with values quoted so passwords may contain spaces and quotes
+func (c DatabaseConfig) DSN() string {
+	params := [][2]string{
+		{"host", c.Host},
+		{"port", strconv.Itoa(c.Port)},
+		{"user", c.Username},
+		{"password", c.Password},
+		{"dbname", c.DBName},
+		{"sslmode", c.SSLMode},
+	}
+	if c.SSLRootCert != "" {
+		params = append(params, [2]string{"sslrootcert", c.SSLRootCert})
+	}
+	if c.StatementTimeout > 0 {
+		params = append(params, [2]string{"statement_timeout", strconv.FormatInt(c.StatementTimeout.Milliseconds(), 10)})
+	}
+	if c.ApplicationName != "" {
+		params = append(params, [2]string{"application_name", c.ApplicationName})
+	}
+	params = append(params, [2]string{"TimeZone", "UTC"})
+
+	parts := make([]string, len(params))
+	for i, param := range params {
+		value := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(param[1])
+		parts[i] = param[0] + "='" + value + "'"
+	}
+	return strings.Join(parts, " ")
 }
 
 // KafkaConfig represents the Kafka configuration
 type KafkaConfig struct {
-	Brokers          []string
-	ConsumerGroup    string
-	ProductTopic     string
-	NotificationTopic string
+	Brokers                []string
+	ConsumerGroup          string
+	ProductTopic           string
+	NotificationTopic      string
+	PriorityTopic          string
+	ChangeTopic            string         // Topic of product change events, consumed into the audit feed
+	CreatedTopic           string         // Topic of snapshots of newly discovered products
+	TopicPartitions        int            // Partitions of topics created on startup
+	TopicReplicationFactor int            // Replication factor of topics created on startup
+	LagCheckInterval       time.Duration  // How often consumer lag is measured, 0 disables it
+	MaxConsumerLag         int            // Lag of a partition above which services report not ready, 0 for no limit
+	ConsumerWorkers        map[string]int // Messages handled at a time per consumed topic, topics not listed handle one at a time
+}
+
+// Workers returns the number of messages of topic handled at a time
+func (c KafkaConfig) Workers(topic string) int {
+	if workers, exists := c.ConsumerWorkers[topic]; exists {
+		return workers
+	}
+	return 1
+}
+
+// Validate checks the Kafka configuration for invalid values
+func (c KafkaConfig) Validate() error {
+	for topic, workers := range c.ConsumerWorkers {
+		if workers < 1 {
+			return fmt.Errorf("KAFKA_CONSUMER_WORKERS for %s must be at least 1, got %d", topic, workers)
+		}
+	}
+	return nil
 }
 
 // ServicesConfig represents the service configurations
 type ServicesConfig struct {
-	CrawlerServicePort     int
-	AnalyzerServicePort    int
+	CrawlerServicePort      int
+	AnalyzerServicePort     int
 	NotificationServicePort int
+	CrawlerGRPCPort         int
+	NotificationGRPCPort    int
 }
 
 // ScraperConfig represents the scraper configuration
 type ScraperConfig struct {
-	BaseURL            string
-	UserAgent          string
-	RequestTimeout     time.Duration
-	ConcurrentRequests int
-	RequestDelay       time.Duration
-	RetryAttempts      int
-	RetryDelay         time.Duration
+	BaseURL                 string
+	UserAgent               string
+	RequestTimeout          time.Duration
+	ConcurrentRequests      int
+	RequestDelay            time.Duration
+	MinRequestDelay         time.Duration
+	MaxRequestDelay         time.Duration
+	RetryAttempts           int
+	RetryDelay              time.Duration
+	CrawlTimeout            time.Duration
+	TriggerWorkers          int    // Workers running crawls triggered through the API
+	TriggerQueueSize        int    // Triggered crawls that can wait for a worker before triggers are rejected
+	MaxReviewPages          int    // Review pages fetched per product each crawl, from the first page
+	MaxDiscoveredProducts   int    // Related products not crawled yet queued for a crawl at a time
+	VariantBatchSize        int    // Variants loaded and saved per statement when saving a product
+	Mode                    string // live or fixture
+	FixtureDir              string
+	Headers                 map[string]string // Extra headers sent with every request, overriding the defaults
+	Cookies                 map[string]string // Cookies sent with every request, by name
+	ProductPagePath         string            // Path of product pages scraped when details API responses can't be parsed, {id} is replaced by the product ID
+	Selectors               SelectorConfig    // CSS selectors of the product page fields
+	CircuitFailureThreshold int               // Consecutive failed requests after which requests are paused, 0 disables
+	CircuitCooldown         time.Duration     // Time requests are paused before probing the target again
+	CategoryAllowlist       []string          // External IDs of the only categories crawled periodically, takes precedence over the denylist
+	CategoryDenylist        []string          // External IDs of categories skipped by periodic crawls
+	CrawlMaxDepth           int               // Levels of the category tree crawled from each category, 1 crawls only the category itself
+	FreshnessSLA            time.Duration     // Time within which products should be crawled again, the default age of the stale products report
+	MaxIdleConns            int               // Idle connections kept open across all hosts, 0 means no limit
+	MaxIdleConnsPerHost     int               // Idle connections kept open per host, reused by concurrent requests
+	IdleConnTimeout         time.Duration     // Time an idle connection is kept open
+	TLSHandshakeTimeout     time.Duration     // Time allowed for TLS handshakes
+}
+
+// SelectorConfig holds the CSS selectors of the fields scraped from product
+// pages. Name and price are required, the other fields are skipped when empty.
+type SelectorConfig struct {
+	Name          string `json:"name" yaml:"name"`
+	Price         string `json:"price" yaml:"price"`
+	OriginalPrice string `json:"original_price" yaml:"original_price"`
+	Stock         string `json:"stock" yaml:"stock"`
+	Image         string `json:"image" yaml:"image"`
+	Rating        string `json:"rating" yaml:"rating"`
+}
+
+// DefaultSelectors are the selectors of Trendyol product pages, used when no
+// selectors file is configured
+var DefaultSelectors = SelectorConfig{
+	Name:          "h1.pr-new-br, h1",
+	Price:         ".prc-dsc",
+	OriginalPrice: ".prc-org",
+	Stock:         ".product-stock",
+	Image:         ".product-images img",
+	Rating:        ".rating-score",
+}
+
+// Validate checks that the required selectors are set
+func (c SelectorConfig) Validate() error {
+	if strings.TrimSpace(c.Name) == "" {
+		return fmt.Errorf("name selector is required")
+	}
+	if strings.TrimSpace(c.Price) == "" {
+		return fmt.Errorf("price selector is required")
+	}
+	return nil
+}
+
+// loadSelectorConfig loads product page selectors from a JSON or YAML file,
+// or returns DefaultSelectors when path is empty. The file replaces the
+// defaults rather than overriding some of them, as it describes other markup.
+func loadSelectorConfig(path string) (SelectorConfig, error) {
+	if path == "" {
+		return DefaultSelectors, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return SelectorConfig{}, fmt.Errorf("failed to read SCRAPER_SELECTORS_FILE: %w", err)
+	}
+
+	// YAML is a superset of JSON, so one decoder reads both
+	var selectors SelectorConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&selectors); err != nil {
+		return SelectorConfig{}, fmt.Errorf("invalid SCRAPER_SELECTORS_FILE %s: %w", path, err)
+	}
+	if err := selectors.Validate(); err != nil {
+		return SelectorConfig{}, fmt.Errorf("invalid SCRAPER_SELECTORS_FILE %s: %w", path, err)
+	}
+	return selectors, nil
+}
+
+// ImageMirrorConfig represents the configuration of copying product images
+// to our own storage, so they outlive the source CDN's URLs
+type ImageMirrorConfig struct {
+	Enabled       bool
+	Dir           string        // Directory mirrored images are written to
+	BaseURL       string        // URL the directory is served at, a path is served by the crawler API
+	Workers       int           // Images downloaded at a time
+	BatchSize     int           // Images loaded from the database at a time
+	Interval      time.Duration // Time between passes over images not mirrored yet
+	RetryAttempts int           // Downloads attempted per image each pass
+	RetryDelay    time.Duration // Delay before retrying a download, growing with each attempt
+	MaxAttempts   int           // Passes that may fail to mirror an image before it is given up on
+	MaxSize       int64         // Largest image in bytes that is mirrored
+}
+
+// Validate checks the mirroring settings when mirroring is enabled
+func (c ImageMirrorConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Dir == "" {
+		return fmt.Errorf("IMAGE_MIRROR_DIR is required")
+	}
+	if c.BaseURL == "" {
+		return fmt.Errorf("IMAGE_MIRROR_BASE_URL is required")
+	}
+	if c.Workers < 1 {
+		return fmt.Errorf("IMAGE_MIRROR_WORKERS must be at least 1, got %d", c.Workers)
+	}
+	if c.BatchSize < 1 {
+		return fmt.Errorf("IMAGE_MIRROR_BATCH_SIZE must be at least 1, got %d", c.BatchSize)
+	}
+	if c.Interval <= 0 {
+		return fmt.Errorf("IMAGE_MIRROR_INTERVAL must be positive, got %v", c.Interval)
+	}
+	if c.RetryAttempts < 1 {
+		return fmt.Errorf("IMAGE_MIRROR_RETRY_ATTEMPTS must be at least 1, got %d", c.RetryAttempts)
+	}
+	if c.MaxAttempts < 1 {
+		return fmt.Errorf("IMAGE_MIRROR_MAX_ATTEMPTS must be at least 1, got %d", c.MaxAttempts)
+	}
+	if c.MaxSize <= 0 {
+		return fmt.Errorf("IMAGE_MIRROR_MAX_SIZE must be positive, got %d", c.MaxSize)
+	}
+	return nil
+}
+
+// AnalyzerConfig represents the analyzer's detection thresholds
+type AnalyzerConfig struct {
+	PriceDropThreshold           float64 // Price change percent below which a drop is an anomaly, negative
+	StockSpikeThreshold          int     // Stock increase above which a change is an anomaly
+	PriceTrendThreshold          float64 // Average price change percent above which prices are trending up
+	StockTrendThreshold          float64 // Average stock change below which stock is trending down, negative
+	PriceHistoryRetentionDays    int     // Age in days after which price history is pruned, 0 keeps it forever
+	StockHistoryRetentionDays    int     // Age in days after which stock history is pruned, 0 keeps it forever
+	FavoriteHistoryRetentionDays int     // Age in days after which favorite count history is pruned, 0 keeps it forever
+	DownsampleHistory            bool    // Keep the last change per variant or product and day of pruned history instead of deleting it all
+	CategoryAlertDailyLimit      int     // Notifications a category alert sends per 24 hours, 0 for no limit
+	FavoriteGainThreshold        int     // Favorites gained in a day from which a product is prioritized as trending
+}
+
+// Validate checks that the thresholds point in the right direction
+func (c AnalyzerConfig) Validate() error {
+	if c.PriceDropThreshold >= 0 || c.PriceDropThreshold <= -100 {
+		return fmt.Errorf("ANALYZER_PRICE_DROP_THRESHOLD must be between -100 and 0, got %v", c.PriceDropThreshold)
+	}
+	if c.StockSpikeThreshold <= 0 {
+		return fmt.Errorf("ANALYZER_STOCK_SPIKE_THRESHOLD must be positive, got %d", c.StockSpikeThreshold)
+	}
+	if c.PriceTrendThreshold <= 0 {
+		return fmt.Errorf("ANALYZER_PRICE_TREND_THRESHOLD must be positive, got %v", c.PriceTrendThreshold)
+	}
+	if c.StockTrendThreshold >= 0 {
+		return fmt.Errorf("ANALYZER_STOCK_TREND_THRESHOLD must be negative, got %v", c.StockTrendThreshold)
+	}
+	if c.PriceHistoryRetentionDays < 0 {
+		return fmt.Errorf("PRICE_HISTORY_RETENTION_DAYS must not be negative, got %d", c.PriceHistoryRetentionDays)
+	}
+	if c.StockHistoryRetentionDays < 0 {
+		return fmt.Errorf("STOCK_HISTORY_RETENTION_DAYS must not be negative, got %d", c.StockHistoryRetentionDays)
+	}
+	if c.FavoriteHistoryRetentionDays < 0 {
+		return fmt.Errorf("FAVORITE_HISTORY_RETENTION_DAYS must not be negative, got %d", c.FavoriteHistoryRetentionDays)
+	}
+	if c.FavoriteGainThreshold <= 0 {
+		return fmt.Errorf("ANALYZER_FAVORITE_GAIN_THRESHOLD must be positive, got %d", c.FavoriteGainThreshold)
+	}
+	if c.CategoryAlertDailyLimit < 0 {
+		return fmt.Errorf("ANALYZER_CATEGORY_ALERT_DAILY_LIMIT must not be negative, got %d", c.CategoryAlertDailyLimit)
+	}
+	return nil
+}
+
+// NotificationConfig represents the notification service configuration
+type NotificationConfig struct {
+	RetentionDays           int
+	ArchiveOld              bool     // Archive notifications past retention instead of deleting them
+	WebSocketTokenSecret    string   // Secret user tokens are signed with, WebSocket connections and webhook requests are refused without one
+	WebSocketAllowedOrigins []string // Browser origins allowed to open WebSocket connections, "*" allows any
+	WebSocketMaxConnections int      // Open WebSocket connections allowed in total, 0 means no limit
+	WebSocketMaxPerUser     int      // Open WebSocket connections allowed per user, 0 means no limit
+	ChannelBufferSize       int      // Notifications buffered per connected user
+	OverflowPolicy          string   // What to drop when a user's buffer is full, OverflowDropNewest or OverflowDropOldest
+	WebhookAllowPrivate     bool     // Allow webhooks to private, loopback and link-local addresses, for local development
+}
+
+// Notification buffer overflow policies
+const (
+	OverflowDropNewest = "drop-newest" // Drop the notification that doesn't fit
+	OverflowDropOldest = "drop-oldest" // Evict the oldest buffered notification to make room
+)
+
+// Validate checks the buffer and connection settings
+func (c NotificationConfig) Validate() error {
+	if c.WebSocketMaxConnections < 0 {
+		return fmt.Errorf("NOTIFICATION_WS_MAX_CONNECTIONS must not be negative, got %d", c.WebSocketMaxConnections)
+	}
+	if c.WebSocketMaxPerUser < 0 {
+		return fmt.Errorf("NOTIFICATION_WS_MAX_CONNECTIONS_PER_USER must not be negative, got %d", c.WebSocketMaxPerUser)
+	}
+	if c.ChannelBufferSize <= 0 {
+		return fmt.Errorf("NOTIFICATION_CHANNEL_BUFFER must be positive, got %d", c.ChannelBufferSize)
+	}
+	if c.OverflowPolicy != OverflowDropNewest && c.OverflowPolicy != OverflowDropOldest {
+		return fmt.Errorf("NOTIFICATION_OVERFLOW_POLICY must be %s or %s, got %q", OverflowDropNewest, OverflowDropOldest, c.OverflowPolicy)
+	}
+	return nil
+}
+
+// RateLimitConfig represents the per-client request rate limits of the REST APIs
+type RateLimitConfig struct {
+	RequestsPerSecond          int
+	Burst                      int
+	ExpensiveRequestsPerMinute int // Limit for crawl triggers and heavy queries
+	ExpensiveBurst             int
+}
+
+// TracingConfig represents the OpenTelemetry tracing configuration
+type TracingConfig struct {
+	Endpoint    string  // OTLP/HTTP endpoint URL traces are exported to, tracing is disabled when empty
+	SampleRatio float64 // Fraction of traces sampled, child spans follow their parent's decision
 }
 
 // LoadConfig loads the application configuration from environment variables
@@ -71,12 +434,52 @@ func LoadConfig() (*Config, error) {
 	// Load .env file if it exists
 	_ = godotenv.Load()
 
+	scraperHeaders, err := getEnvAsMap("SCRAPER_HEADERS")
+	if err != nil {
+		return nil, err
+	}
+	scraperCookies, err := getEnvAsMap("SCRAPER_COOKIES")
+	if err != nil {
+		return nil, err
+	}
+	selectors, err := loadSelectorConfig(getEnv("SCRAPER_SELECTORS_FILE", ""))
+	if err != nil {
+		return nil, err
+	}
+	consumerWorkers, err := getEnvAsIntMap("KAFKA_CONSUMER_WORKERS")
+	if err != nil {
+		return nil, err
+	}
+
+	// Any origin may call the APIs in development, elsewhere only the
+	// configured ones
+	environment := getEnv("ENVIRONMENT", "development")
+	defaultSSLMode := "require"
+	if environment == "development" {
+		defaultSSLMode = "disable"
+	}
+	defaultCORSOrigins := []string{}
+	if environment == "development" {
+		defaultCORSOrigins = []string{"*"}
+	}
+	serviceCORSOrigins := make(map[string][]string)
+	for _, service := range []string{"crawler", "analyzer", "notification"} {
+		if origins := getEnvAsSlice(strings.ToUpper(service)+"_CORS_ALLOWED_ORIGINS", nil); origins != nil {
+			serviceCORSOrigins[service] = origins
+		}
+	}
+
 	config := &Config{
 		Server: ServerConfig{
-			Port:         getEnvAsInt("SERVER_PORT", 8080),
-			ReadTimeout:  time.Duration(getEnvAsInt("SERVER_READ_TIMEOUT", 15)) * time.Second,
-			WriteTimeout: time.Duration(getEnvAsInt("SERVER_WRITE_TIMEOUT", 15)) * time.Second,
-			IdleTimeout:  time.Duration(getEnvAsInt("SERVER_IDLE_TIMEOUT", 60)) * time.Second,
+			Port:               getEnvAsInt("SERVER_PORT", 8080),
+			ReadHeaderTimeout:  time.Duration(getEnvAsInt("SERVER_READ_HEADER_TIMEOUT", 5)) * time.Second,
+			ReadTimeout:        time.Duration(getEnvAsInt("SERVER_READ_TIMEOUT", 15)) * time.Second,
+			WriteTimeout:       time.Duration(getEnvAsInt("SERVER_WRITE_TIMEOUT", 15)) * time.Second,
+			IdleTimeout:        time.Duration(getEnvAsInt("SERVER_IDLE_TIMEOUT", 60)) * time.Second,
+			GzipLevel:          getEnvAsInt("SERVER_GZIP_LEVEL", -1),
+			GzipMinLength:      getEnvAsInt("SERVER_GZIP_MIN_LENGTH", 1024),
+			CORSAllowedOrigins: getEnvAsSlice("CORS_ALLOWED_ORIGINS", defaultCORSOrigins),
+			ServiceCORSOrigins: serviceCORSOrigins,
 		},
 		Database: DatabaseConfig{
 			Host:                   getEnv("DB_HOST", "localhost"),
@@ -87,29 +490,136 @@ func LoadConfig() (*Config, error) {
 			MaxIdleConns:           getEnvAsInt("DB_MAX_IDLE_CONNS", 10),
 			MaxOpenConns:           getEnvAsInt("DB_MAX_OPEN_CONNS", 100),
 			ConnMaxLifetimeMinutes: getEnvAsInt("DB_CONN_MAX_LIFETIME", 30),
+			AutoMigrate:            getEnvAsBool("DB_AUTO_MIGRATE", false),
+			QueryTimeout:           time.Duration(getEnvAsInt("DB_QUERY_TIMEOUT", 10)) * time.Second,
+			SSLMode:                getEnv("DB_SSLMODE", defaultSSLMode),
+			SSLRootCert:            getEnv("DB_SSLROOTCERT", ""),
+			StatementTimeout:       time.Duration(getEnvAsInt("DB_STATEMENT_TIMEOUT", 0)) * time.Second,
+			ApplicationName:        getEnv("DB_APPLICATION_NAME", "ecommerce-platform"),
+			ReplicaHost:            getEnv("DB_REPLICA_HOST", ""),
+			ReplicaPort:            getEnvAsInt("DB_REPLICA_PORT", getEnvAsInt("DB_PORT", 5432)),
+			ReplicaUsername:        getEnv("DB_REPLICA_USER", getEnv("DB_USER", "postgres")),
+			ReplicaPassword:        getEnv("DB_REPLICA_PASSWORD", getEnv("DB_PASSWORD", "postgres")),
 		},
 		Kafka: KafkaConfig{
-			Brokers:           getEnvAsSlice("KAFKA_BROKERS", []string{"localhost:9092"}),
-			ConsumerGroup:     getEnv("KAFKA_CONSUMER_GROUP", "ecommerce-group"),
-			ProductTopic:      getEnv("KAFKA_PRODUCT_TOPIC", "product-updates"),
-			NotificationTopic: getEnv("KAFKA_NOTIFICATION_TOPIC", "user-notifications"),
+			Brokers:                getEnvAsSlice("KAFKA_BROKERS", []string{"localhost:9092"}),
+			ConsumerGroup:          getEnv("KAFKA_CONSUMER_GROUP", "ecommerce-group"),
+			ProductTopic:           getEnv("KAFKA_PRODUCT_TOPIC", "product-updates"),
+			NotificationTopic:      getEnv("KAFKA_NOTIFICATION_TOPIC", "user-notifications"),
+			PriorityTopic:          getEnv("KAFKA_PRIORITY_TOPIC", "product-priorities"),
+			ChangeTopic:            getEnv("KAFKA_CHANGE_TOPIC", "product-changes"),
+			CreatedTopic:           getEnv("KAFKA_CREATED_TOPIC", "product-created"),
+			TopicPartitions:        getEnvAsInt("KAFKA_TOPIC_PARTITIONS", 3),
+			TopicReplicationFactor: getEnvAsInt("KAFKA_TOPIC_REPLICATION_FACTOR", 1),
+			LagCheckInterval:       time.Duration(getEnvAsInt("KAFKA_LAG_CHECK_INTERVAL", 30)) * time.Second,
+			MaxConsumerLag:         getEnvAsInt("KAFKA_MAX_CONSUMER_LAG", 0),
+			ConsumerWorkers:        consumerWorkers,
 		},
 		Services: ServicesConfig{
 			CrawlerServicePort:      getEnvAsInt("CRAWLER_SERVICE_PORT", 9001),
 			AnalyzerServicePort:     getEnvAsInt("ANALYZER_SERVICE_PORT", 9002),
 			NotificationServicePort: getEnvAsInt("NOTIFICATION_SERVICE_PORT", 9003),
+			CrawlerGRPCPort:         getEnvAsInt("CRAWLER_GRPC_PORT", 9101),
+			NotificationGRPCPort:    getEnvAsInt("NOTIFICATION_GRPC_PORT", 9103),
 		},
 		Scraper: ScraperConfig{
-			BaseURL:            getEnv("SCRAPER_BASE_URL", "https://www.trendyol.com"),
-			UserAgent:          getEnv("SCRAPER_USER_AGENT", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"),
-			RequestTimeout:     time.Duration(getEnvAsInt("SCRAPER_REQUEST_TIMEOUT", 30)) * time.Second,
-			ConcurrentRequests: getEnvAsInt("SCRAPER_CONCURRENT_REQUESTS", 5),
-			RequestDelay:       time.Duration(getEnvAsInt("SCRAPER_REQUEST_DELAY", 1000)) * time.Millisecond,
-			RetryAttempts:      getEnvAsInt("SCRAPER_RETRY_ATTEMPTS", 3),
-			RetryDelay:         time.Duration(getEnvAsInt("SCRAPER_RETRY_DELAY", 5)) * time.Second,
+			BaseURL:                 getEnv("SCRAPER_BASE_URL", "https://www.trendyol.com"),
+			UserAgent:               getEnv("SCRAPER_USER_AGENT", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"),
+			RequestTimeout:          time.Duration(getEnvAsInt("SCRAPER_REQUEST_TIMEOUT", 30)) * time.Second,
+			ConcurrentRequests:      getEnvAsInt("SCRAPER_CONCURRENT_REQUESTS", 5),
+			VariantBatchSize:        getEnvAsInt("SCRAPER_VARIANT_BATCH_SIZE", 100),
+			RequestDelay:            time.Duration(getEnvAsInt("SCRAPER_REQUEST_DELAY", 1000)) * time.Millisecond,
+			MinRequestDelay:         time.Duration(getEnvAsInt("SCRAPER_MIN_REQUEST_DELAY", 1000)) * time.Millisecond,
+			MaxRequestDelay:         time.Duration(getEnvAsInt("SCRAPER_MAX_REQUEST_DELAY", 60000)) * time.Millisecond,
+			RetryAttempts:           getEnvAsInt("SCRAPER_RETRY_ATTEMPTS", 3),
+			RetryDelay:              time.Duration(getEnvAsInt("SCRAPER_RETRY_DELAY", 5)) * time.Second,
+			CrawlTimeout:            time.Duration(getEnvAsInt("SCRAPER_CRAWL_TIMEOUT", 30)) * time.Minute,
+			TriggerWorkers:          getEnvAsInt("SCRAPER_TRIGGER_WORKERS", 2),
+			TriggerQueueSize:        getEnvAsInt("SCRAPER_TRIGGER_QUEUE_SIZE", 100),
+			MaxReviewPages:          getEnvAsInt("SCRAPER_MAX_REVIEW_PAGES", 5),
+			MaxDiscoveredProducts:   getEnvAsInt("SCRAPER_MAX_DISCOVERED_PRODUCTS", 10000),
+			Mode:                    getEnv("SCRAPER_MODE", "live"),
+			FixtureDir:              getEnv("SCRAPER_FIXTURE_DIR", "fixtures"),
+			Headers:                 scraperHeaders,
+			Cookies:                 scraperCookies,
+			ProductPagePath:         getEnv("SCRAPER_PRODUCT_PAGE_PATH", "/product/{id}"),
+			Selectors:               selectors,
+			CircuitFailureThreshold: getEnvAsInt("SCRAPER_CIRCUIT_FAILURE_THRESHOLD", 5),
+			CircuitCooldown:         time.Duration(getEnvAsInt("SCRAPER_CIRCUIT_COOLDOWN", 60)) * time.Second,
+			CategoryAllowlist:       getEnvAsSlice("CRAWL_CATEGORY_ALLOWLIST", []string{}),
+			CategoryDenylist:        getEnvAsSlice("CRAWL_CATEGORY_DENYLIST", []string{}),
+			CrawlMaxDepth:           getEnvAsInt("CRAWL_MAX_DEPTH", 1),
+			FreshnessSLA:            time.Duration(getEnvAsInt("CRAWL_FRESHNESS_SLA", 1800)) * time.Second,
+			MaxIdleConns:            getEnvAsInt("SCRAPER_MAX_IDLE_CONNS", 100),
+			MaxIdleConnsPerHost:     getEnvAsInt("SCRAPER_MAX_IDLE_CONNS_PER_HOST", 10),
+			IdleConnTimeout:         time.Duration(getEnvAsInt("SCRAPER_IDLE_CONN_TIMEOUT", 90)) * time.Second,
+			TLSHandshakeTimeout:     time.Duration(getEnvAsInt("SCRAPER_TLS_HANDSHAKE_TIMEOUT", 10)) * time.Second,
+		},
+		ImageMirror: ImageMirrorConfig{
+			Enabled:       getEnvAsBool("IMAGE_MIRROR_ENABLED", false),
+			Dir:           getEnv("IMAGE_MIRROR_DIR", "./data/images"),
+			BaseURL:       strings.TrimSuffix(getEnv("IMAGE_MIRROR_BASE_URL", "/images"), "/"),
+			Workers:       getEnvAsInt("IMAGE_MIRROR_WORKERS", 4),
+			BatchSize:     getEnvAsInt("IMAGE_MIRROR_BATCH_SIZE", 100),
+			Interval:      time.Duration(getEnvAsInt("IMAGE_MIRROR_INTERVAL", 300)) * time.Second,
+			RetryAttempts: getEnvAsInt("IMAGE_MIRROR_RETRY_ATTEMPTS", 3),
+			RetryDelay:    time.Duration(getEnvAsInt("IMAGE_MIRROR_RETRY_DELAY", 2)) * time.Second,
+			MaxAttempts:   getEnvAsInt("IMAGE_MIRROR_MAX_ATTEMPTS", 5),
+			MaxSize:       int64(getEnvAsInt("IMAGE_MIRROR_MAX_SIZE", 10<<20)),
+		},
+		Analyzer: AnalyzerConfig{
+			PriceDropThreshold:           getEnvAsFloat("ANALYZER_PRICE_DROP_THRESHOLD", -30),
+			StockSpikeThreshold:          getEnvAsInt("ANALYZER_STOCK_SPIKE_THRESHOLD", 100),
+			PriceTrendThreshold:          getEnvAsFloat("ANALYZER_PRICE_TREND_THRESHOLD", 5),
+			StockTrendThreshold:          getEnvAsFloat("ANALYZER_STOCK_TREND_THRESHOLD", -10),
+			PriceHistoryRetentionDays:    getEnvAsInt("PRICE_HISTORY_RETENTION_DAYS", 365),
+			StockHistoryRetentionDays:    getEnvAsInt("STOCK_HISTORY_RETENTION_DAYS", 365),
+			FavoriteHistoryRetentionDays: getEnvAsInt("FAVORITE_HISTORY_RETENTION_DAYS", 365),
+			DownsampleHistory:            getEnvAsBool("HISTORY_DOWNSAMPLE", true),
+			CategoryAlertDailyLimit:      getEnvAsInt("ANALYZER_CATEGORY_ALERT_DAILY_LIMIT", 10),
+			FavoriteGainThreshold:        getEnvAsInt("ANALYZER_FAVORITE_GAIN_THRESHOLD", 50),
+		},
+		Notification: NotificationConfig{
+			RetentionDays:           getEnvAsInt("NOTIFICATION_RETENTION_DAYS", 30),
+			ArchiveOld:              getEnvAsBool("NOTIFICATION_ARCHIVE_OLD", false),
+			WebSocketTokenSecret:    getEnv("NOTIFICATION_WS_TOKEN_SECRET", ""),
+			WebSocketAllowedOrigins: getEnvAsSlice("NOTIFICATION_WS_ALLOWED_ORIGINS", []string{}),
+			WebSocketMaxConnections: getEnvAsInt("NOTIFICATION_WS_MAX_CONNECTIONS", 10000),
+			WebSocketMaxPerUser:     getEnvAsInt("NOTIFICATION_WS_MAX_CONNECTIONS_PER_USER", 5),
+			ChannelBufferSize:       getEnvAsInt("NOTIFICATION_CHANNEL_BUFFER", 100),
+			OverflowPolicy:          getEnv("NOTIFICATION_OVERFLOW_POLICY", OverflowDropNewest),
+			WebhookAllowPrivate:     getEnvAsBool("NOTIFICATION_WEBHOOK_ALLOW_PRIVATE", false),
+		},
+		RateLimit: RateLimitConfig{
+			RequestsPerSecond:          getEnvAsInt("RATE_LIMIT_REQUESTS_PER_SECOND", 20),
+			Burst:                      getEnvAsInt("RATE_LIMIT_BURST", 40),
+			ExpensiveRequestsPerMinute: getEnvAsInt("RATE_LIMIT_EXPENSIVE_REQUESTS_PER_MINUTE", 10),
+			ExpensiveBurst:             getEnvAsInt("RATE_LIMIT_EXPENSIVE_BURST", 5),
+		},
+		Tracing: TracingConfig{
+			Endpoint:    getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+			SampleRatio: getEnvAsFloat("OTEL_TRACES_SAMPLE_RATIO", 1),
 		},
-		LogLevel:    getEnv("LOG_LEVEL", "info"),
-		Environment: getEnv("ENVIRONMENT", "development"),
+		AdminToken:      getEnv("ADMIN_TOKEN", ""),
+		LogLevel:        getEnv("LOG_LEVEL", "info"),
+		Environment:     environment,
+		DefaultCurrency: getEnv("DEFAULT_CURRENCY", "TRY"),
+	}
+
+	if err := config.Database.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid database configuration: %w", err)
+	}
+	if err := config.Kafka.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid Kafka configuration: %w", err)
+	}
+	if err := config.ImageMirror.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid image mirror configuration: %w", err)
+	}
+	if err := config.Analyzer.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid analyzer configuration: %w", err)
+	}
+	if err := config.Notification.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid notification configuration: %w", err)
 	}
 
 	return config, nil
@@ -132,6 +642,52 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return value
 }
 
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	valueStr := getEnv(key, "")
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	valueStr := getEnv(key, strconv.FormatBool(defaultValue))
+	value, err := strconv.ParseBool(valueStr)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvAsMap parses a JSON object of strings, such as {"Accept-Language": "tr-TR"}
+func getEnvAsMap(key string) (map[string]string, error) {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return nil, nil
+	}
+
+	var value map[string]string
+	if err := json.Unmarshal([]byte(valueStr), &value); err != nil {
+		return nil, fmt.Errorf("%s must be a JSON object of strings: %w", key, err)
+	}
+	return value, nil
+}
+
+// getEnvAsIntMap parses a JSON object of integers, such as {"user-notifications": 4}
+func getEnvAsIntMap(key string) (map[string]int, error) {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return nil, nil
+	}
+
+	var value map[string]int
+	if err := json.Unmarshal([]byte(valueStr), &value); err != nil {
+		return nil, fmt.Errorf("%s must be a JSON object of integers: %w", key, err)
+	}
+	return value, nil
+}
+
 func getEnvAsSlice(key string, defaultValue []string) []string {
 	valueStr := getEnv(key, "")
 	if valueStr == "" {
@@ -140,9 +696,13 @@ func getEnvAsSlice(key string, defaultValue []string) []string {
 	return split(valueStr, ",")
 }
 
+// split splits s by sep, trimming spaces and dropping empty parts
 func split(s string, sep string) []string {
-	if s == "" {
-		return []string{}
+	parts := make([]string, 0)
+	for _, part := range strings.Split(s, sep) {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
 	}
-	return []string{s}
-}
\ No newline at end of file
+	return parts
+}
@@ -0,0 +1,51 @@
+package cors
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// New returns middleware answering CORS requests from the allowed origins,
+// "*" allowing any. Credentials are only allowed with an explicit allowlist,
+// and without any allowed origins no CORS headers are sent so browsers block
+// cross-origin requests.
+func New(origins []string) echo.MiddlewareFunc {
+	if len(origins) == 0 {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return next
+		}
+	}
+
+	wildcard := false
+	for _, origin := range origins {
+		if origin == "*" {
+			wildcard = true
+		}
+	}
+
+	return middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins: origins,
+		AllowMethods: []string{
+			http.MethodGet,
+			http.MethodHead,
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodPatch,
+			http.MethodDelete,
+			http.MethodOptions,
+		},
+		AllowHeaders: []string{
+			echo.HeaderOrigin,
+			echo.HeaderContentType,
+			echo.HeaderAccept,
+			echo.HeaderAuthorization,
+			echo.HeaderXRequestID,
+			"Idempotency-Key",
+		},
+		ExposeHeaders:    []string{echo.HeaderXRequestID, echo.HeaderRetryAfter, "X-Truncated", "X-Total-Count"},
+		AllowCredentials: !wildcard,
+		MaxAge:           600,
+	})
+}
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// migrationFiles holds the versioned migrations, named <version>_<name>.sql
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migration is a versioned schema change
+type migration struct {
+	Version int64
+	Name    string
+	SQL     string
+}
+
+// loadMigrations reads the migrations under dir ordered by version
+func loadMigrations(fsys fs.FS, dir string) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	migrations := make([]migration, 0, len(entries))
+	seen := make(map[int64]string)
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+
+		base := strings.TrimSuffix(entry.Name(), ".sql")
+		prefix, name, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration file name %s, expected <version>_<name>.sql", entry.Name())
+		}
+		if other, exists := seen[version]; exists {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", other, entry.Name())
+		}
+		seen[version] = entry.Name()
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migrations = append(migrations, migration{Version: version, Name: name, SQL: string(content)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Migrate applies the pending versioned migrations in order and returns the
+// versions it applied. Each migration runs in a transaction together with its
+// schema_migrations row, so a failed migration leaves no partial changes, and
+// concurrent runs wait for each other instead of applying a migration twice.
+func (db *Database) Migrate() ([]int64, error) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`).Error; err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	applied := make([]int64, 0)
+	for _, m := range migrations {
+		ran := false
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("LOCK TABLE schema_migrations IN EXCLUSIVE MODE").Error; err != nil {
+				return fmt.Errorf("failed to lock schema_migrations: %w", err)
+			}
+
+			var count int64
+			if err := tx.Table("schema_migrations").Where("version = ?", m.Version).Count(&count).Error; err != nil {
+				return fmt.Errorf("failed to check migration %d: %w", m.Version, err)
+			}
+			if count > 0 {
+				return nil
+			}
+
+			if err := tx.Exec(m.SQL).Error; err != nil {
+				return fmt.Errorf("failed to apply migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			if err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name).Error; err != nil {
+				return fmt.Errorf("failed to record migration %d: %w", m.Version, err)
+			}
+			ran = true
+			return nil
+		})
+		if err != nil {
+			return applied, err
+		}
+
+		if ran {
+			log.Printf("Applied migration %d_%s", m.Version, m.Name)
+			applied = append(applied, m.Version)
+		}
+	}
+
+	return applied, nil
+}
+
+// SchemaVersion returns the latest applied migration version, 0 if none was applied
+func (db *Database) SchemaVersion() (int64, error) {
+	if !db.Migrator().HasTable("schema_migrations") {
+		return 0, nil
+	}
+
+	var version int64
+	if err := db.Raw("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version).Error; err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
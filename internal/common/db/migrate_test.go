@@ -0,0 +1,183 @@
+package db
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    fstest.MapFS
+		versions []int64
+		wantErr  bool
+	}{
+		{
+			name: "ordered by version",
+			files: fstest.MapFS{
+				"m/0010_later.sql":  {Data: []byte("SELECT 10")},
+				"m/0002_second.sql": {Data: []byte("SELECT 2")},
+				"m/0001_first.sql":  {Data: []byte("SELECT 1")},
+				"m/README.md":       {Data: []byte("not a migration")},
+			},
+			versions: []int64{1, 2, 10},
+		},
+		{
+			name: "duplicate version",
+			files: fstest.MapFS{
+				"m/0001_first.sql": {Data: []byte("SELECT 1")},
+				"m/1_again.sql":    {Data: []byte("SELECT 1")},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "missing version",
+			files:   fstest.MapFS{"m/initial.sql": {Data: []byte("SELECT 1")}},
+			wantErr: true,
+		},
+		{
+			name:    "zero version",
+			files:   fstest.MapFS{"m/0000_initial.sql": {Data: []byte("SELECT 1")}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := loadMigrations(tt.files, "m")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %d migrations", len(migrations))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(migrations) != len(tt.versions) {
+				t.Fatalf("got %d migrations, want %d", len(migrations), len(tt.versions))
+			}
+			for i, m := range migrations {
+				if m.Version != tt.versions[i] {
+					t.Errorf("migration %d has version %d, want %d", i, m.Version, tt.versions[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %s has version %d, want %d", m.Name, m.Version, i+1)
+		}
+	}
+}
+
+// baselineSchema is the schema of the tables whose columns changed before
+// migrations were versioned, as AutoMigrate created them
+const baselineSchema = `
+CREATE TABLE "notifications" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"user_id" bigint,"product_id" bigint,"message" text,"is_read" boolean DEFAULT false,"delivered_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX "idx_notifications_deleted_at" ON "notifications" ("deleted_at");
+CREATE TABLE "price_alerts" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"user_id" bigint NOT NULL,"product_id" bigint NOT NULL,"variant_id" bigint,"discount_percent" decimal,"last_notification" timestamptz,PRIMARY KEY ("id"));
+INSERT INTO "notifications" ("user_id","product_id","message","delivered_at") VALUES (1, 1, 'Price drop alert', now());
+INSERT INTO "notifications" ("user_id","product_id","message","delivered_at") VALUES (1, 2, 'Daily digest: 2 price drops on your products', now());
+`
+
+// openTestDatabase connects to TEST_DATABASE_URL using a new empty schema,
+// skipping the test when no test database is configured
+func openTestDatabase(t *testing.T) *Database {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	schema := fmt.Sprintf("migrate_test_%d", time.Now().UnixNano())
+	if err := admin.Exec(`CREATE SCHEMA "` + schema + `"`).Error; err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(`DROP SCHEMA "` + schema + `" CASCADE`)
+	})
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("TEST_DATABASE_URL must be a URL: %v", err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+
+	db, err := gorm.Open(postgres.Open(u.String()), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to connect to test schema: %v", err)
+	}
+	return &Database{db}
+}
+
+func TestMigrateBaselineSchema(t *testing.T) {
+	db := openTestDatabase(t)
+	if err := db.Exec(baselineSchema).Error; err != nil {
+		t.Fatalf("failed to create baseline schema: %v", err)
+	}
+
+	if _, err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate baseline schema: %v", err)
+	}
+
+	columns := []struct{ table, column string }{
+		{"notifications", "archived"},
+		{"notifications", "dedupe_key"},
+		{"notifications", "type"},
+		{"price_alerts", "target_price"},
+		{"price_alerts", "cooldown_hours"},
+		{"price_alerts", "stock_threshold"},
+	}
+	for _, c := range columns {
+		if !db.Migrator().HasColumn(c.table, c.column) {
+			t.Errorf("%s has no %s column after migrating", c.table, c.column)
+		}
+	}
+
+	// Notifications saved without dedupe keys keep their type
+	types := map[string]string{
+		"Price drop alert": "price_drop",
+		"Daily digest: 2 price drops on your products": "digest",
+	}
+	for message, want := range types {
+		var got string
+		if err := db.Raw(`SELECT "type" FROM "notifications" WHERE "message" = ?`, message).Scan(&got).Error; err != nil {
+			t.Fatalf("failed to read notification type: %v", err)
+		}
+		if got != want {
+			t.Errorf("notification %q has type %q, want %q", message, got, want)
+		}
+	}
+
+	// Running again applies nothing
+	applied, err := db.Migrate()
+	if err != nil {
+		t.Fatalf("failed to migrate again: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("second run applied %v, want none", applied)
+	}
+}
@@ -0,0 +1,102 @@
+-- Initial schema, matching what MigrateSchema (GORM AutoMigrate) creates so
+-- databases set up by it before versioning can adopt this migration as is.
+
+CREATE TABLE IF NOT EXISTS "categories" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"name" text NOT NULL,"description" text,"external_id" text NOT NULL,"parent_id" bigint,"level" bigint NOT NULL,"is_active" boolean DEFAULT true,PRIMARY KEY ("id"),CONSTRAINT "fk_categories_children" FOREIGN KEY ("parent_id") REFERENCES "categories"("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_categories_external_id" ON "categories" ("external_id");
+CREATE INDEX IF NOT EXISTS "idx_categories_deleted_at" ON "categories" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "brands" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"name" text NOT NULL,"external_id" text NOT NULL,"logo_url" text,"is_active" boolean DEFAULT true,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_brands_external_id" ON "brands" ("external_id");
+CREATE INDEX IF NOT EXISTS "idx_brands_deleted_at" ON "brands" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "sellers" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"name" text NOT NULL,"external_id" text NOT NULL,"rating" decimal,"positive_ratio" decimal,"is_active" boolean DEFAULT true,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_sellers_external_id" ON "sellers" ("external_id");
+CREATE INDEX IF NOT EXISTS "idx_sellers_deleted_at" ON "sellers" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "products" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"external_id" text NOT NULL,"name" text NOT NULL,"description" text,"url" text,"is_active" boolean DEFAULT true,"category_id" bigint,"brand_id" bigint,"seller_id" bigint,"rating" decimal,"rating_count" bigint,"favorite_count" bigint,"comment_count" bigint,"last_updated" timestamptz,PRIMARY KEY ("id"),CONSTRAINT "fk_products_category" FOREIGN KEY ("category_id") REFERENCES "categories"("id"),CONSTRAINT "fk_products_seller" FOREIGN KEY ("seller_id") REFERENCES "sellers"("id"),CONSTRAINT "fk_products_brand" FOREIGN KEY ("brand_id") REFERENCES "brands"("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_products_external_id" ON "products" ("external_id");
+CREATE INDEX IF NOT EXISTS "idx_products_deleted_at" ON "products" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "product_relations" ("product_id" bigint,"related_product_id" bigint,PRIMARY KEY ("product_id","related_product_id"),CONSTRAINT "fk_product_relations_product" FOREIGN KEY ("product_id") REFERENCES "products"("id"),CONSTRAINT "fk_product_relations_related_products" FOREIGN KEY ("related_product_id") REFERENCES "products"("id"));
+
+CREATE TABLE IF NOT EXISTS "attributes" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"name" text NOT NULL,"external_id" text NOT NULL,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_attributes_external_id" ON "attributes" ("external_id");
+CREATE INDEX IF NOT EXISTS "idx_attributes_deleted_at" ON "attributes" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "product_attributes" ("product_id" bigint,"attribute_id" bigint,PRIMARY KEY ("product_id","attribute_id"),CONSTRAINT "fk_product_attributes_product" FOREIGN KEY ("product_id") REFERENCES "products"("id"),CONSTRAINT "fk_product_attributes_attribute" FOREIGN KEY ("attribute_id") REFERENCES "attributes"("id"));
+
+CREATE TABLE IF NOT EXISTS "images" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"product_id" bigint,"url" text NOT NULL,"is_main" boolean DEFAULT false,"external_id" text NOT NULL,PRIMARY KEY ("id"),CONSTRAINT "fk_products_images" FOREIGN KEY ("product_id") REFERENCES "products"("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_images_external_id" ON "images" ("external_id");
+CREATE INDEX IF NOT EXISTS "idx_images_deleted_at" ON "images" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "videos" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"product_id" bigint,"url" text NOT NULL,"external_id" text NOT NULL,PRIMARY KEY ("id"),CONSTRAINT "fk_products_videos" FOREIGN KEY ("product_id") REFERENCES "products"("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_videos_external_id" ON "videos" ("external_id");
+CREATE INDEX IF NOT EXISTS "idx_videos_deleted_at" ON "videos" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "variants" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"product_id" bigint,"external_id" text NOT NULL,"price" decimal,"original_price" decimal,"discount_rate" bigint,"stock_count" bigint,"is_active" boolean DEFAULT true,"available" boolean,"max_months" bigint,"bank_options" bigint,PRIMARY KEY ("id"),CONSTRAINT "fk_products_variants" FOREIGN KEY ("product_id") REFERENCES "products"("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_variants_external_id" ON "variants" ("external_id");
+CREATE INDEX IF NOT EXISTS "idx_variants_deleted_at" ON "variants" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "attribute_values" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"value" text NOT NULL,"external_id" text NOT NULL,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_attribute_values_external_id" ON "attribute_values" ("external_id");
+CREATE INDEX IF NOT EXISTS "idx_attribute_values_deleted_at" ON "attribute_values" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "variant_attribute_values" ("variant_id" bigint,"attribute_value_id" bigint,PRIMARY KEY ("variant_id","attribute_value_id"),CONSTRAINT "fk_variant_attribute_values_variant" FOREIGN KEY ("variant_id") REFERENCES "variants"("id"),CONSTRAINT "fk_variant_attribute_values_attribute_value" FOREIGN KEY ("attribute_value_id") REFERENCES "attribute_values"("id"));
+
+CREATE TABLE IF NOT EXISTS "reviews" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"product_id" bigint,"external_id" text NOT NULL,"rating" bigint,"text" text,"author" text,"posted_at" timestamptz,PRIMARY KEY ("id"),CONSTRAINT "fk_products_reviews" FOREIGN KEY ("product_id") REFERENCES "products"("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_reviews_external_id" ON "reviews" ("external_id");
+CREATE INDEX IF NOT EXISTS "idx_reviews_product_id" ON "reviews" ("product_id");
+CREATE INDEX IF NOT EXISTS "idx_reviews_deleted_at" ON "reviews" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "price_histories" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"product_id" bigint,"variant_id" bigint,"previous_price" decimal,"new_price" decimal,"change_percent" decimal,PRIMARY KEY ("id"),CONSTRAINT "fk_products_price_history" FOREIGN KEY ("product_id") REFERENCES "products"("id"));
+CREATE INDEX IF NOT EXISTS "idx_price_histories_deleted_at" ON "price_histories" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "stock_histories" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"product_id" bigint,"variant_id" bigint,"previous_stock" bigint,"new_stock" bigint,"change_quantity" bigint,PRIMARY KEY ("id"),CONSTRAINT "fk_products_stock_history" FOREIGN KEY ("product_id") REFERENCES "products"("id"));
+CREATE INDEX IF NOT EXISTS "idx_stock_histories_deleted_at" ON "stock_histories" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "users" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"email" text NOT NULL,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_email" ON "users" ("email");
+CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "user_favorites" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"user_id" bigint,"product_id" bigint,PRIMARY KEY ("id"),CONSTRAINT "fk_user_favorites_product" FOREIGN KEY ("product_id") REFERENCES "products"("id"),CONSTRAINT "fk_users_favorites" FOREIGN KEY ("user_id") REFERENCES "users"("id"));
+CREATE INDEX IF NOT EXISTS "idx_user_favorites_deleted_at" ON "user_favorites" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "notifications" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"user_id" bigint,"product_id" bigint,"message" text,"is_read" boolean DEFAULT false,"archived" boolean DEFAULT false,"delivered_at" timestamptz,PRIMARY KEY ("id"));
+-- Databases created before notifications could be archived already have the
+-- table, so the create above leaves it without the column
+ALTER TABLE "notifications" ADD COLUMN IF NOT EXISTS "archived" boolean DEFAULT false;
+CREATE INDEX IF NOT EXISTS "idx_notifications_archived" ON "notifications" ("archived");
+CREATE INDEX IF NOT EXISTS "idx_notifications_deleted_at" ON "notifications" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "price_alerts" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"user_id" bigint NOT NULL,"product_id" bigint NOT NULL,"variant_id" bigint,"discount_percent" decimal,"target_price" decimal,"cooldown_hours" bigint DEFAULT 24,"last_notification" timestamptz,PRIMARY KEY ("id"));
+-- Added to price alerts after they were first created
+ALTER TABLE "price_alerts" ADD COLUMN IF NOT EXISTS "target_price" decimal;
+ALTER TABLE "price_alerts" ADD COLUMN IF NOT EXISTS "cooldown_hours" bigint DEFAULT 24;
+CREATE INDEX IF NOT EXISTS "idx_price_alerts_user_id" ON "price_alerts" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_price_alerts_product_id" ON "price_alerts" ("product_id");
+CREATE INDEX IF NOT EXISTS "idx_price_alerts_deleted_at" ON "price_alerts" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "webhooks" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"user_id" bigint NOT NULL,"url" text NOT NULL,"secret" text NOT NULL,"active" boolean DEFAULT true,"consecutive_failures" bigint,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_webhooks_user_id" ON "webhooks" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_webhooks_deleted_at" ON "webhooks" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "anomalies" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"product_id" bigint,"variant_id" bigint,"type" text NOT NULL,"source_id" bigint,"severity" text,"detected_at" timestamptz,"details" jsonb,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_anomaly_source" ON "anomalies" ("type","source_id");
+CREATE INDEX IF NOT EXISTS "idx_anomalies_product_id" ON "anomalies" ("product_id");
+CREATE INDEX IF NOT EXISTS "idx_anomalies_severity" ON "anomalies" ("severity");
+CREATE INDEX IF NOT EXISTS "idx_anomalies_detected_at" ON "anomalies" ("detected_at");
+CREATE INDEX IF NOT EXISTS "idx_anomalies_deleted_at" ON "anomalies" ("deleted_at");
+
+-- Indexes for the common lookups AutoMigrate has no tags for: product listings
+-- by category, brand and seller, history and alert checks per product and
+-- variant, favorites per user and notifications per user
+CREATE INDEX IF NOT EXISTS "idx_products_category_id" ON "products" ("category_id");
+CREATE INDEX IF NOT EXISTS "idx_products_brand_id" ON "products" ("brand_id");
+CREATE INDEX IF NOT EXISTS "idx_products_seller_id" ON "products" ("seller_id");
+CREATE INDEX IF NOT EXISTS "idx_variants_product_id" ON "variants" ("product_id");
+CREATE INDEX IF NOT EXISTS "idx_price_histories_product_created" ON "price_histories" ("product_id","created_at" DESC);
+CREATE INDEX IF NOT EXISTS "idx_price_histories_variant_created" ON "price_histories" ("variant_id","created_at" DESC);
+CREATE INDEX IF NOT EXISTS "idx_stock_histories_product_created" ON "stock_histories" ("product_id","created_at" DESC);
+CREATE INDEX IF NOT EXISTS "idx_user_favorites_user_product" ON "user_favorites" ("user_id","product_id");
+CREATE INDEX IF NOT EXISTS "idx_user_favorites_product_id" ON "user_favorites" ("product_id");
+CREATE INDEX IF NOT EXISTS "idx_notifications_user_created" ON "notifications" ("user_id","created_at" DESC);
@@ -0,0 +1,3 @@
+-- Version of each product, incremented on every save so the crawler can
+-- detect concurrent updates of the same product
+ALTER TABLE "products" ADD COLUMN IF NOT EXISTS "version" bigint NOT NULL DEFAULT 1;
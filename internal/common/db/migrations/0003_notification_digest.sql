@@ -0,0 +1,9 @@
+-- Notification preferences and the price drops collected for daily digests
+CREATE TABLE IF NOT EXISTS "notification_preferences" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"user_id" bigint NOT NULL,"digest_mode" boolean DEFAULT false,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_notification_preferences_user_id" ON "notification_preferences" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_notification_preferences_deleted_at" ON "notification_preferences" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "digest_items" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"user_id" bigint NOT NULL,"price_history_id" bigint NOT NULL,"product_id" bigint,"variant_id" bigint,"previous_price" decimal,"new_price" decimal,"discount_percent" decimal,"product_name" text,"product_url" text,"digested_at" timestamptz,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_digest_item_change" ON "digest_items" ("user_id","price_history_id");
+CREATE INDEX IF NOT EXISTS "idx_digest_items_digested_at" ON "digest_items" ("digested_at");
+CREATE INDEX IF NOT EXISTS "idx_digest_items_deleted_at" ON "digest_items" ("deleted_at");
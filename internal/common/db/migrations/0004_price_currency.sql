@@ -0,0 +1,4 @@
+-- ISO 4217 currency of variant prices and of the price changes derived from them
+ALTER TABLE "variants" ADD COLUMN IF NOT EXISTS "currency" varchar(3);
+ALTER TABLE "price_histories" ADD COLUMN IF NOT EXISTS "currency" varchar(3);
+ALTER TABLE "digest_items" ADD COLUMN IF NOT EXISTS "currency" varchar(3);
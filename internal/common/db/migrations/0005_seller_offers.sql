@@ -0,0 +1,4 @@
+-- Offers of a product by the sellers listing it
+CREATE TABLE IF NOT EXISTS "seller_offers" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"product_id" bigint NOT NULL,"seller_id" bigint NOT NULL,"price" decimal,"currency" varchar(3),"stock_count" bigint,"url" text,PRIMARY KEY ("id"),CONSTRAINT "fk_seller_offers_seller" FOREIGN KEY ("seller_id") REFERENCES "sellers"("id"),CONSTRAINT "fk_products_offers" FOREIGN KEY ("product_id") REFERENCES "products"("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_seller_offer_product_seller" ON "seller_offers" ("product_id","seller_id");
+CREATE INDEX IF NOT EXISTS "idx_seller_offers_deleted_at" ON "seller_offers" ("deleted_at");
@@ -0,0 +1,4 @@
+-- Audit feed of product changes found by crawls
+CREATE TABLE IF NOT EXISTS "product_change_events" ("id" bigserial,"product_id" bigint NOT NULL,"version" bigint NOT NULL,"variant_external_id" text NOT NULL DEFAULT '',"field" varchar(50) NOT NULL,"old_value" text,"new_value" text,"changed_at" timestamptz,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_product_change_events_changed_at" ON "product_change_events" ("changed_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_product_change_event" ON "product_change_events" ("product_id","version","variant_external_id","field");
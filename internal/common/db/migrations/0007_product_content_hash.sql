@@ -0,0 +1,3 @@
+-- Source hash of the crawled product details, compared with category listings
+-- to skip fetching unchanged products
+ALTER TABLE "products" ADD COLUMN IF NOT EXISTS "content_hash" text;
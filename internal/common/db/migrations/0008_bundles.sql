@@ -0,0 +1,8 @@
+-- Bundles of products sold together as one listing
+CREATE TABLE IF NOT EXISTS "bundles" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"product_id" bigint NOT NULL,"price" decimal,"original_price" decimal,"currency" varchar(3),PRIMARY KEY ("id"),CONSTRAINT "fk_products_bundle" FOREIGN KEY ("product_id") REFERENCES "products"("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_bundles_product_id" ON "bundles" ("product_id");
+CREATE INDEX IF NOT EXISTS "idx_bundles_deleted_at" ON "bundles" ("deleted_at");
+CREATE TABLE IF NOT EXISTS "bundle_items" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"bundle_id" bigint NOT NULL,"product_external_id" text NOT NULL,"product_id" bigint,"quantity" bigint NOT NULL DEFAULT 1,PRIMARY KEY ("id"),CONSTRAINT "fk_bundles_items" FOREIGN KEY ("bundle_id") REFERENCES "bundles"("id"),CONSTRAINT "fk_bundle_items_product" FOREIGN KEY ("product_id") REFERENCES "products"("id"));
+CREATE INDEX IF NOT EXISTS "idx_bundle_items_product_id" ON "bundle_items" ("product_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_bundle_item" ON "bundle_items" ("bundle_id","product_external_id");
+CREATE INDEX IF NOT EXISTS "idx_bundle_items_deleted_at" ON "bundle_items" ("deleted_at");
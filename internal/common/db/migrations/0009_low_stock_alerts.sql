@@ -0,0 +1,3 @@
+-- Low stock thresholds on price alerts
+ALTER TABLE "price_alerts" ADD COLUMN IF NOT EXISTS "stock_threshold" bigint;
+ALTER TABLE "price_alerts" ADD COLUMN IF NOT EXISTS "stock_low" boolean DEFAULT false;
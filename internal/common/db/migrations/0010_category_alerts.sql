@@ -0,0 +1,9 @@
+-- Price drop alerts on whole categories and the drops they notified
+CREATE TABLE IF NOT EXISTS "category_alerts" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"user_id" bigint NOT NULL,"category_id" bigint NOT NULL,"discount_percent" decimal,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_category_alerts_category_id" ON "category_alerts" ("category_id");
+CREATE INDEX IF NOT EXISTS "idx_category_alerts_user_id" ON "category_alerts" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_category_alerts_deleted_at" ON "category_alerts" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "category_alert_notifications" ("id" bigserial,"category_alert_id" bigint NOT NULL,"price_history_id" bigint NOT NULL,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_category_alert_notifications_created_at" ON "category_alert_notifications" ("created_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_category_alert_notification" ON "category_alert_notifications" ("category_alert_id","price_history_id");
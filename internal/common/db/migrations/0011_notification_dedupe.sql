@@ -0,0 +1,3 @@
+-- Dedupe keys of notifications, so each alert is saved and delivered once
+ALTER TABLE "notifications" ADD COLUMN IF NOT EXISTS "dedupe_key" text;
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_notifications_dedupe_key" ON "notifications" ("dedupe_key");
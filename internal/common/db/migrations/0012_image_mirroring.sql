@@ -0,0 +1,2 @@
+-- URLs of images copied to our own storage
+ALTER TABLE "images" ADD COLUMN IF NOT EXISTS "mirrored_url" text NOT NULL DEFAULT '';
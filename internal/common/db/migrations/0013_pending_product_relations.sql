@@ -0,0 +1,3 @@
+-- Related products listed before they were crawled, linked once they are
+CREATE TABLE IF NOT EXISTS "pending_product_relations" ("product_id" bigint,"related_external_id" text,"created_at" timestamptz,PRIMARY KEY ("product_id","related_external_id"));
+CREATE INDEX IF NOT EXISTS "idx_pending_product_relations_related_external_id" ON "pending_product_relations" ("related_external_id");
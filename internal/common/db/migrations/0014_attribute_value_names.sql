@@ -0,0 +1,8 @@
+-- Attribute names of attribute values, for filtering products by attribute
+ALTER TABLE "attribute_values" ADD COLUMN IF NOT EXISTS "attribute_name" text NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS "idx_attribute_values_attribute_name" ON "attribute_values" ("attribute_name");
+
+-- Value external IDs are the attribute's external ID, a dash and the value
+UPDATE "attribute_values" av SET "attribute_name" = a."name"
+FROM "attributes" a
+WHERE av."attribute_name" = '' AND av."external_id" LIKE a."external_id" || '-%';
@@ -0,0 +1,6 @@
+-- Time products were last crawled, for the stale products report
+ALTER TABLE "products" ADD COLUMN IF NOT EXISTS "last_crawled_at" timestamptz;
+CREATE INDEX IF NOT EXISTS "idx_products_last_crawled_at" ON "products" ("last_crawled_at");
+
+-- Products crawled before are assumed last crawled when last updated
+UPDATE "products" SET "last_crawled_at" = "last_updated" WHERE "last_crawled_at" IS NULL;
@@ -0,0 +1,6 @@
+-- Changes of the favorite count of products, for spotting products gaining popularity
+CREATE TABLE IF NOT EXISTS "favorite_histories" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"product_id" bigint,"previous_count" bigint,"new_count" bigint,"change_count" bigint,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_favorite_histories_product_id" ON "favorite_histories" ("product_id");
+CREATE INDEX IF NOT EXISTS "idx_favorite_histories_deleted_at" ON "favorite_histories" ("deleted_at");
+-- Favorites gained per product over recent days, for the trending products check
+CREATE INDEX IF NOT EXISTS "idx_favorite_histories_created_product" ON "favorite_histories" ("created_at","product_id");
@@ -0,0 +1,12 @@
+-- Types of notifications, and an index for listing the notifications of a product
+ALTER TABLE "notifications" ADD COLUMN IF NOT EXISTS "type" varchar(20) NOT NULL DEFAULT 'price_drop';
+CREATE INDEX IF NOT EXISTS "idx_notifications_product_delivered" ON "notifications" ("product_id","delivered_at" DESC);
+
+-- Dedupe keys start with the alert type. Digests have no dedupe key, but
+-- neither do alerts saved before dedupe keys, so digests are told apart by
+-- their message and the digest items marked when they were sent.
+UPDATE "notifications" SET "type" = 'low_stock' WHERE "dedupe_key" LIKE 'low\_stock:%';
+UPDATE "notifications" n SET "type" = 'digest'
+WHERE n."dedupe_key" IS NULL AND (n."message" LIKE 'Daily digest: %' OR EXISTS (
+	SELECT 1 FROM "digest_items" d WHERE d."user_id" = n."user_id" AND d."digested_at" = n."delivered_at"
+));
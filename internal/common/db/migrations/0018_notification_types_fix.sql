@@ -0,0 +1,7 @@
+-- 0017 first labeled every notification without a dedupe key a digest,
+-- including the alerts saved before dedupe keys. Alerts that don't look like
+-- a digest are price drops again.
+UPDATE "notifications" n SET "type" = 'price_drop'
+WHERE n."type" = 'digest' AND n."dedupe_key" IS NULL AND n."message" NOT LIKE 'Daily digest: %' AND NOT EXISTS (
+	SELECT 1 FROM "digest_items" d WHERE d."user_id" = n."user_id" AND d."digested_at" = n."delivered_at"
+);
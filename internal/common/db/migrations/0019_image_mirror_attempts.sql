@@ -0,0 +1,5 @@
+-- Failed attempts to mirror an image and when the next one is due, so images
+-- that keep failing are retried with a growing delay and eventually given up on
+ALTER TABLE "images" ADD COLUMN IF NOT EXISTS "mirror_attempts" bigint NOT NULL DEFAULT 0;
+ALTER TABLE "images" ADD COLUMN IF NOT EXISTS "mirror_retry_at" timestamptz;
+CREATE INDEX IF NOT EXISTS "idx_images_mirror_pending" ON "images" ("id") WHERE "mirrored_url" = '' AND "deleted_at" IS NULL;
@@ -0,0 +1,2 @@
+-- Stock history by variant, for downsampling old history per variant and day
+CREATE INDEX IF NOT EXISTS "idx_stock_histories_variant_created" ON "stock_histories" ("variant_id","created_at" DESC);
@@ -0,0 +1,3 @@
+-- Kafka messages saved with the changes they report, deleted once published
+CREATE TABLE IF NOT EXISTS "outbox_messages" ("id" bigserial,"topic" text NOT NULL,"key" text NOT NULL,"payload" jsonb NOT NULL,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_outbox_messages_created_at" ON "outbox_messages" ("created_at");
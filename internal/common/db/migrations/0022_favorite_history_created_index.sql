@@ -0,0 +1,3 @@
+-- Favorites gained per product over recent days, for the trending products
+-- check, on databases that applied 0016 before it created the index
+CREATE INDEX IF NOT EXISTS "idx_favorite_histories_created_product" ON "favorite_histories" ("created_at","product_id");
@@ -1,15 +1,20 @@
 package db
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
 	"github.com/e-commerce/platform/internal/common/config"
 	"github.com/e-commerce/platform/internal/common/models"
+	"github.com/e-commerce/platform/internal/common/tracing"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
 )
 
 // Database is a wrapper around gorm.DB
@@ -19,9 +24,6 @@ type Database struct {
 
 // NewPostgresDB creates a new database connection
 func NewPostgresDB(cfg *config.DatabaseConfig) (*Database, error) {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable TimeZone=UTC",
-		cfg.Host, cfg.Username, cfg.Password, cfg.DBName, cfg.Port)
-
 	newLogger := logger.New(
 		log.Default(),
 		logger.Config{
@@ -32,13 +34,32 @@ func NewPostgresDB(cfg *config.DatabaseConfig) (*Database, error) {
 		},
 	)
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+	db, err := gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{
 		Logger: newLogger,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	// Trace queries as part of the request or message they are bound to
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		return nil, fmt.Errorf("failed to register tracing: %w", err)
+	}
+
+	// Serve the reads of queries using Replica from the read replica, other
+	// queries aren't routed and stay on the primary
+	if replica, ok := cfg.Replica(); ok {
+		resolver := dbresolver.Register(dbresolver.Config{
+			Replicas: []gorm.Dialector{postgres.Open(replica.DSN())},
+		}, replicaResolver).
+			SetMaxIdleConns(cfg.MaxIdleConns).
+			SetMaxOpenConns(cfg.MaxOpenConns).
+			SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetimeMinutes) * time.Minute)
+		if err := db.Use(resolver); err != nil {
+			return nil, fmt.Errorf("failed to connect to read replica: %w", err)
+		}
+	}
+
 	// Set connection pool settings
 	sqlDB, err := db.DB()
 	if err != nil {
@@ -57,22 +78,87 @@ func NewPostgresDB(cfg *config.DatabaseConfig) (*Database, error) {
 	return &Database{db}, nil
 }
 
-// MigrateSchema creates or updates the database schema
-func (db *Database) MigrateSchema() error {
-	return db.AutoMigrate(
+// replicaResolver names the resolver routing queries to the read replica
+const replicaResolver = "read-replica"
+
+// Replica returns a session bound to ctx whose queries run on the read
+// replica, or on the primary when no replica is configured. It's only for
+// reads, and as they may lag behind writes, for analytics rather than reads
+// of data just written.
+func (db *Database) Replica(ctx context.Context) *gorm.DB {
+	return db.WithContext(ctx).Clauses(dbresolver.Use(replicaResolver), dbresolver.Read)
+}
+
+// Close closes the database connections
+func (db *Database) Close() error {
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	return sqlDB.Close()
+}
+
+// uniqueViolation is the PostgreSQL error code of a unique constraint violation
+const uniqueViolation = "23505"
+
+// IsUniqueViolation reports whether err is caused by a unique constraint violation
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
+
+// schemaModels returns the models whose tables make up the database schema
+func schemaModels() []interface{} {
+	return []interface{}{
 		&models.Product{},
 		&models.Category{},
 		&models.Brand{},
 		&models.Seller{},
+		&models.SellerOffer{},
+		&models.Bundle{},
+		&models.BundleItem{},
+		&models.PendingProductRelation{},
 		&models.Image{},
 		&models.Video{},
 		&models.Variant{},
 		&models.Attribute{},
 		&models.AttributeValue{},
+		&models.Review{},
 		&models.PriceHistory{},
 		&models.StockHistory{},
+		&models.FavoriteHistory{},
+		&models.ProductChangeEvent{},
+		&models.OutboxMessage{},
 		&models.UserFavorite{},
 		&models.User{},
 		&models.Notification{},
-	)
-}
\ No newline at end of file
+		&models.PriceAlert{},
+		&models.CategoryAlert{},
+		&models.CategoryAlertNotification{},
+		&models.Webhook{},
+		&models.Anomaly{},
+		&models.NotificationPreference{},
+		&models.DigestItem{},
+	}
+}
+
+// joinTables are the many-to-many join tables created by MigrateSchema
+var joinTables = []string{"product_attributes", "product_relations", "variant_attribute_values"}
+
+// MigrateSchema creates or updates the database schema from the models with
+// GORM AutoMigrate. It can't drop or rename columns and records no history, so
+// it's only a development fallback for Migrate.
+func (db *Database) MigrateSchema() error {
+	return db.AutoMigrate(schemaModels()...)
+}
+
+// DropSchema drops all tables of the database schema and the migration
+// history, deleting their data
+func (db *Database) DropSchema() error {
+	tables := schemaModels()
+	for _, table := range joinTables {
+		tables = append(tables, table)
+	}
+	tables = append(tables, "schema_migrations")
+	return db.Migrator().DropTable(tables...)
+}
@@ -0,0 +1,42 @@
+package dbtimeout
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// New returns middleware that cancels the request context after timeout, so
+// queries bound to it with WithContext are cancelled instead of holding a
+// connection. Requests that fail because of it get 503. WebSocket upgrades are
+// skipped, as the connection outlives any request timeout. A non-positive
+// timeout disables the middleware; queries are then only cancelled when the
+// client disconnects.
+func New(timeout time.Duration) echo.MiddlewareFunc {
+	if timeout <= 0 {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return next
+		}
+	}
+
+	return middleware.ContextTimeoutWithConfig(middleware.ContextTimeoutConfig{
+		Skipper: func(c echo.Context) bool {
+			return websocket.IsWebSocketUpgrade(c.Request())
+		},
+		Timeout: timeout,
+		ErrorHandler: func(err error, c echo.Context) error {
+			// Handlers report failed queries as their own errors, so check the context.
+			// The handler's error isn't kept as the internal error, as echo would
+			// respond with it if it's an HTTP error.
+			if ctxErr := c.Request().Context().Err(); errors.Is(ctxErr, context.DeadlineExceeded) {
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "Request timed out").SetInternal(ctxErr)
+			}
+			return err
+		},
+	})
+}
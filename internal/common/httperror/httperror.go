@@ -0,0 +1,165 @@
+package httperror
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// Response is the JSON body of every error response
+type Response struct {
+	Error Body `json:"error"`
+}
+
+// Body describes an error with a stable, machine-readable code
+type Body struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+	// RequestID is the X-Request-ID of the failed request, for correlating
+	// the error with the logs of every service that handled it
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Error is an HTTP error with an explicit code, for handlers whose error
+// doesn't map to the code derived from its status and message
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Details interface{}
+}
+
+// New creates an HTTP error with an explicit code
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// WithDetails sets the details of the error
+func (e *Error) WithDetails(details interface{}) *Error {
+	e.Details = details
+	return e
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// statusCodes are the codes of errors that have no more specific one
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            "validation_failed",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "request_too_large",
+	http.StatusUnsupportedMediaType:  "unsupported_media_type",
+	http.StatusTooManyRequests:       "rate_limited",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusServiceUnavailable:    "unavailable",
+}
+
+// Handler is an echo HTTPErrorHandler rendering every error as a Response.
+// Errors are mapped to a status and code as follows:
+//   - *Error keeps its status and code
+//   - *echo.HTTPError keeps its status; "<thing> not found" messages get the
+//     code <thing>_not_found, other messages the code of the status
+//   - gorm.ErrRecordNotFound becomes 404 not_found
+//   - anything else becomes 500 internal_error and is logged
+//
+// The body includes the request ID set by echo's RequestID middleware.
+func Handler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	status, body := render(err)
+	body.RequestID = c.Response().Header().Get(echo.HeaderXRequestID)
+	if status >= http.StatusInternalServerError {
+		log.Printf("%s %s failed (request_id=%s): %v", c.Request().Method, c.Request().URL.Path, body.RequestID, err)
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(status)
+	} else {
+		err = c.JSON(status, Response{Error: body})
+	}
+	if err != nil {
+		log.Printf("Failed to send error response: %v", err)
+	}
+}
+
+// render returns the status and body of the response for err
+func render(err error) (int, Body) {
+	var codedErr *Error
+	if errors.As(err, &codedErr) {
+		return codedErr.Status, Body{Code: codedErr.Code, Message: codedErr.Message, Details: codedErr.Details}
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		// Middleware may wrap a more specific HTTP error, as echo's default handler unwraps
+		var internal *echo.HTTPError
+		if errors.As(httpErr.Internal, &internal) {
+			httpErr = internal
+		}
+
+		body := Body{Code: codeFor(httpErr.Code, "")}
+		switch message := httpErr.Message.(type) {
+		case string:
+			body.Message = message
+			body.Code = codeFor(httpErr.Code, message)
+		case error:
+			body.Message = message.Error()
+		default:
+			body.Message = http.StatusText(httpErr.Code)
+			body.Details = message
+		}
+		return httpErr.Code, body
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return http.StatusNotFound, Body{Code: "not_found", Message: "Resource not found"}
+	}
+
+	return http.StatusInternalServerError, Body{Code: "internal_error", Message: http.StatusText(http.StatusInternalServerError)}
+}
+
+// codeFor returns the code of an error with the given status and message
+func codeFor(status int, message string) string {
+	if status == http.StatusNotFound && strings.HasSuffix(strings.ToLower(message), " not found") {
+		return slug(message)
+	}
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status >= http.StatusInternalServerError {
+		return "internal_error"
+	}
+	return "request_failed"
+}
+
+// slug converts a message to a snake case code, e.g. "Product not found" to product_not_found
+func slug(message string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(message) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if underscore && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+			underscore = false
+		} else {
+			underscore = true
+		}
+	}
+	return b.String()
+}
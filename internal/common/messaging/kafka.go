@@ -3,34 +3,161 @@ package messaging
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/e-commerce/platform/internal/common/config"
+	"github.com/e-commerce/platform/internal/common/tracing"
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const (
+	// consumerInitialBackoff is the delay after the first failed read
+	consumerInitialBackoff = 500 * time.Millisecond
+	// consumerMaxBackoff caps the delay between failed reads
+	consumerMaxBackoff = 30 * time.Second
+	// consumerUnhealthyThreshold is the number of consecutive failed reads
+	// after which a consumer is reported unhealthy
+	consumerUnhealthyThreshold = 5
+	// topicCreationTimeout bounds the request creating missing topics
+	topicCreationTimeout = 10 * time.Second
+)
+
+// PartitionStrategy selects how a producer assigns messages to partitions
+type PartitionStrategy int
+
+const (
+	// PartitionLeastBytes sends each message to the partition that has received
+	// the least data, ignoring the key. It spreads load evenly but gives no
+	// ordering between messages with the same key.
+	PartitionLeastBytes PartitionStrategy = iota
+	// PartitionByKeyHash sends all messages with the same key to the same
+	// partition, so they are consumed in the order they were published. A key
+	// that carries much more traffic than the others makes its partition a hot spot.
+	PartitionByKeyHash
+	// PartitionByKeyMurmur2 routes keys like PartitionByKeyHash, using the murmur2
+	// hash of the Java client so partitions match producers written against it.
+	PartitionByKeyMurmur2
+)
+
+// balancer returns the kafka-go balancer implementing the strategy
+func (s PartitionStrategy) balancer() kafka.Balancer {
+	switch s {
+	case PartitionByKeyHash:
+		return &kafka.Hash{}
+	case PartitionByKeyMurmur2:
+		return &kafka.Murmur2Balancer{}
+	default:
+		return &kafka.LeastBytes{}
+	}
+}
+
+// TopicSpec describes a topic created by EnsureTopics
+type TopicSpec struct {
+	Name              string
+	Partitions        int // Defaults to the configured topic partitions when zero
+	ReplicationFactor int // Defaults to the configured replication factor when zero
+}
+
+// topicAdmin creates topics, implemented by *kafka.Client
+type topicAdmin interface {
+	CreateTopics(ctx context.Context, req *kafka.CreateTopicsRequest) (*kafka.CreateTopicsResponse, error)
+}
+
+// messageReader reads messages from a topic, implemented by *kafka.Reader
+type messageReader interface {
+	ReadMessage(ctx context.Context) (kafka.Message, error)
+}
+
 // KafkaClient represents a Kafka client for producing and consuming messages
 type KafkaClient struct {
-	producers map[string]*kafka.Writer
-	consumers map[string]*kafka.Reader
-	brokers   []string
-	group     string
+	producers         map[string]*kafka.Writer
+	consumers         map[string]*kafka.Reader
+	consumersMux      sync.RWMutex
+	brokers           []string
+	group             string
+	partitions        int
+	replicationFactor int
+	failures          map[string]int // Consecutive read failures per consumed topic
+	failuresMux       sync.RWMutex
+	maxLag            int64                    // Consumer lag above which CaughtUp is false, 0 for no limit
+	lag               map[string]map[int]int64 // Consumer lag per topic and partition, see MonitorConsumerLag
+	lagMux            sync.RWMutex
 }
 
 // NewKafkaClient creates a new Kafka client
 func NewKafkaClient(cfg *config.KafkaConfig) *KafkaClient {
 	return &KafkaClient{
-		producers: make(map[string]*kafka.Writer),
-		consumers: make(map[string]*kafka.Reader),
-		brokers:   cfg.Brokers,
-		group:     cfg.ConsumerGroup,
+		producers:         make(map[string]*kafka.Writer),
+		consumers:         make(map[string]*kafka.Reader),
+		brokers:           cfg.Brokers,
+		group:             cfg.ConsumerGroup,
+		partitions:        cfg.TopicPartitions,
+		replicationFactor: cfg.TopicReplicationFactor,
+		failures:          make(map[string]int),
+		maxLag:            int64(cfg.MaxConsumerLag),
 	}
 }
 
-// CreateProducer creates a new Kafka producer for a topic
-func (k *KafkaClient) CreateProducer(topic string) error {
+// EnsureTopics creates the topics that don't exist yet, for clusters with topic
+// auto-creation disabled. Existing topics are left unchanged, so it is safe to
+// call on every startup.
+func (k *KafkaClient) EnsureTopics(ctx context.Context, specs []TopicSpec) error {
+	ctx, cancel := context.WithTimeout(ctx, topicCreationTimeout)
+	defer cancel()
+
+	return k.ensureTopics(ctx, &kafka.Client{Addr: kafka.TCP(k.brokers...)}, specs)
+}
+
+// ensureTopics creates the topics of specs using admin, ignoring topics that already exist
+func (k *KafkaClient) ensureTopics(ctx context.Context, admin topicAdmin, specs []TopicSpec) error {
+	if len(specs) == 0 {
+		return nil
+	}
+
+	topics := make([]kafka.TopicConfig, 0, len(specs))
+	for _, spec := range specs {
+		topic := kafka.TopicConfig{
+			Topic:             spec.Name,
+			NumPartitions:     spec.Partitions,
+			ReplicationFactor: spec.ReplicationFactor,
+		}
+		if topic.NumPartitions <= 0 {
+			topic.NumPartitions = k.partitions
+		}
+		if topic.ReplicationFactor <= 0 {
+			topic.ReplicationFactor = k.replicationFactor
+		}
+		topics = append(topics, topic)
+	}
+
+	response, err := admin.CreateTopics(ctx, &kafka.CreateTopicsRequest{Topics: topics})
+	if err != nil {
+		return fmt.Errorf("error creating Kafka topics: %w", err)
+	}
+
+	var errs []error
+	for topic, err := range response.Errors {
+		if err == nil || errors.Is(err, kafka.TopicAlreadyExists) {
+			continue
+		}
+		errs = append(errs, fmt.Errorf("error creating Kafka topic %s: %w", topic, err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// CreateProducer creates a new Kafka producer for a topic that partitions messages
+// using strategy. Producers created implicitly by PublishMessage use PartitionLeastBytes.
+func (k *KafkaClient) CreateProducer(topic string, strategy PartitionStrategy) error {
 	if _, exists := k.producers[topic]; exists {
 		return nil
 	}
@@ -38,7 +165,7 @@ func (k *KafkaClient) CreateProducer(topic string) error {
 	writer := &kafka.Writer{
 		Addr:         kafka.TCP(k.brokers...),
 		Topic:        topic,
-		Balancer:     &kafka.LeastBytes{},
+		Balancer:     strategy.balancer(),
 		BatchSize:    100,
 		BatchTimeout: 10 * time.Millisecond,
 		RequiredAcks: kafka.RequireAll,
@@ -50,6 +177,9 @@ func (k *KafkaClient) CreateProducer(topic string) error {
 
 // CreateConsumer creates a new Kafka consumer for a topic
 func (k *KafkaClient) CreateConsumer(topic string) error {
+	k.consumersMux.Lock()
+	defer k.consumersMux.Unlock()
+
 	if _, exists := k.consumers[topic]; exists {
 		return nil
 	}
@@ -68,62 +198,252 @@ func (k *KafkaClient) CreateConsumer(topic string) error {
 	return nil
 }
 
-// PublishMessage publishes a message to a Kafka topic
-func (k *KafkaClient) PublishMessage(ctx context.Context, topic string, key string, data interface{}) error {
+// consumer returns the consumer of a topic, creating it if needed
+func (k *KafkaClient) consumer(topic string) (*kafka.Reader, error) {
+	if err := k.CreateConsumer(topic); err != nil {
+		return nil, err
+	}
+
+	k.consumersMux.RLock()
+	defer k.consumersMux.RUnlock()
+	return k.consumers[topic], nil
+}
+
+// consumedTopics returns the topics consumers were created for
+func (k *KafkaClient) consumedTopics() []string {
+	k.consumersMux.RLock()
+	defer k.consumersMux.RUnlock()
+
+	topics := make([]string, 0, len(k.consumers))
+	for topic := range k.consumers {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// Message is a keyed message published with PublishMessages
+type Message struct {
+	Key  string
+	Data interface{} // Marshaled to JSON
+}
+
+// producer returns the producer of a topic, creating it if needed
+func (k *KafkaClient) producer(topic string) (*kafka.Writer, error) {
 	producer, exists := k.producers[topic]
 	if !exists {
-		if err := k.CreateProducer(topic); err != nil {
-			return err
+		if err := k.CreateProducer(topic, PartitionLeastBytes); err != nil {
+			return nil, err
 		}
 		producer = k.producers[topic]
 	}
+	return producer, nil
+}
+
+// PublishMessage publishes a message to a Kafka topic
+func (k *KafkaClient) PublishMessage(ctx context.Context, topic string, key string, data interface{}) error {
+	return k.PublishMessages(ctx, topic, []Message{{Key: key, Data: data}})
+}
+
+// PublishMessages publishes messages to a Kafka topic in a single write, which
+// is much faster than publishing them one by one as the write waits for all
+// replicas to acknowledge. When only some messages fail, the error wraps a
+// kafka.WriteErrors with one entry per message.
+func (k *KafkaClient) PublishMessages(ctx context.Context, topic string, messages []Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
 
-	value, err := json.Marshal(data)
+	producer, err := k.producer(topic)
 	if err != nil {
-		return fmt.Errorf("error marshaling message: %w", err)
+		return err
 	}
 
-	err = producer.WriteMessages(ctx, kafka.Message{
-		Key:   []byte(key),
-		Value: value,
-		Time:  time.Now(),
-	})
+	ctx, span := tracing.Tracer().Start(ctx, "kafka.publish "+topic,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(semconv.MessagingSystemKafka, semconv.MessagingDestinationName(topic)),
+	)
+	defer span.End()
 
-	if err != nil {
-		return fmt.Errorf("error writing message to Kafka: %w", err)
+	// Consumers continue the trace and keep the request ID of the messages
+	now := time.Now()
+	headers := requestIDHeaders(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier{&headers})
+	kafkaMessages := make([]kafka.Message, 0, len(messages))
+	for _, message := range messages {
+		value, err := json.Marshal(message.Data)
+		if err != nil {
+			return fmt.Errorf("error marshaling message: %w", err)
+		}
+
+		kafkaMessages = append(kafkaMessages, kafka.Message{
+			Key:     []byte(message.Key),
+			Value:   value,
+			Time:    now,
+			Headers: headers,
+		})
+	}
+
+	if err := producer.WriteMessages(ctx, kafkaMessages...); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("error writing messages to Kafka: %w", err)
 	}
 
 	return nil
 }
 
-// ConsumeMessages consumes messages from a Kafka topic and processes them using a handler function
-func (k *KafkaClient) ConsumeMessages(ctx context.Context, topic string, handler func([]byte) error) error {
-	consumer, exists := k.consumers[topic]
-	if !exists {
-		if err := k.CreateConsumer(topic); err != nil {
-			return err
-		}
-		consumer = k.consumers[topic]
+// MessageHandler processes a consumed message. Its context carries the
+// request ID of the message, see RequestID, and isn't cancelled when the
+// consumer stops, so a message being handled on shutdown is finished.
+type MessageHandler func(ctx context.Context, message []byte) error
+
+// ConsumeMessages consumes messages from a Kafka topic and processes them using a handler function.
+// Failed reads are retried with exponential backoff until the context is done or the consumer is closed.
+func (k *KafkaClient) ConsumeMessages(ctx context.Context, topic string, handler MessageHandler) error {
+	consumer, err := k.consumer(topic)
+	if err != nil {
+		return err
 	}
 
+	return k.consume(ctx, topic, consumer, handler)
+}
+
+// consume reads messages from reader until ctx is done or a fatal error occurs
+func (k *KafkaClient) consume(ctx context.Context, topic string, reader messageReader, handler MessageHandler) error {
+	return k.readMessages(ctx, topic, reader.ReadMessage, func(msg kafka.Message) {
+		k.handleAndLog(ctx, topic, msg, handler)
+	})
+}
+
+// readMessages reads messages with read and passes them to process until ctx
+// is done or a fatal error occurs. Failed reads are retried with exponential
+// backoff and counted as consumer failures.
+func (k *KafkaClient) readMessages(ctx context.Context, topic string, read func(context.Context) (kafka.Message, error),
+	process func(kafka.Message)) error {
+	backoff := consumerInitialBackoff
+
 	for {
 		select {
 		case <-ctx.Done():
 			log.Printf("Context done, stopping Kafka consumer for topic %s", topic)
 			return ctx.Err()
 		default:
-			msg, err := consumer.ReadMessage(ctx)
+			msg, err := read(ctx)
 			if err != nil {
-				log.Printf("Error reading message from Kafka: %v", err)
+				if ctx.Err() != nil {
+					continue
+				}
+				if isFatalConsumerError(err) {
+					log.Printf("Kafka consumer for topic %s closed: %v", topic, err)
+					return err
+				}
+
+				failures := k.recordConsumerFailure(topic)
+				log.Printf("Error reading message from Kafka topic %s (%d consecutive failures), retrying in %v: %v",
+					topic, failures, backoff, err)
+
+				select {
+				case <-ctx.Done():
+				case <-time.After(backoff):
+				}
+				backoff = nextConsumerBackoff(backoff)
 				continue
 			}
 
-			if err := handler(msg.Value); err != nil {
-				log.Printf("Error processing message: %v", err)
-				// Continue processing other messages
-			}
+			k.resetConsumerFailures(topic)
+			backoff = consumerInitialBackoff
+
+			process(msg)
+		}
+	}
+}
+
+// handleAndLog handles a message, logging the error of a failed handler as
+// failed messages are not retried
+func (k *KafkaClient) handleAndLog(ctx context.Context, topic string, msg kafka.Message, handler MessageHandler) {
+	if err := k.handle(ctx, topic, msg, handler); err != nil {
+		if requestID := messageRequestID(msg); requestID != "" {
+			log.Printf("Error processing message (request_id=%s): %v", requestID, err)
+		} else {
+			log.Printf("Error processing message: %v", err)
+		}
+	}
+}
+
+// handle processes a message in a consumer span continuing the trace of the
+// publisher, with the message's request ID in the handler's context
+func (k *KafkaClient) handle(ctx context.Context, topic string, msg kafka.Message, handler MessageHandler) error {
+	ctx = otel.GetTextMapPropagator().Extract(context.WithoutCancel(ctx), headerCarrier{&msg.Headers})
+	ctx, span := tracing.Tracer().Start(ctx, "kafka.consume "+topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingDestinationName(topic),
+			semconv.MessagingKafkaMessageKey(string(msg.Key)),
+		),
+	)
+	defer span.End()
+
+	err := handler(WithRequestID(ctx, messageRequestID(msg)), msg.Value)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// isFatalConsumerError reports whether a read error means the consumer can
+// no longer be used, as opposed to a transient broker error
+func isFatalConsumerError(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe)
+}
+
+// nextConsumerBackoff doubles the backoff up to consumerMaxBackoff
+func nextConsumerBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > consumerMaxBackoff {
+		return consumerMaxBackoff
+	}
+	return backoff
+}
+
+// recordConsumerFailure increments and returns the consecutive failures of a topic
+func (k *KafkaClient) recordConsumerFailure(topic string) int {
+	k.failuresMux.Lock()
+	defer k.failuresMux.Unlock()
+
+	k.failures[topic]++
+	return k.failures[topic]
+}
+
+// resetConsumerFailures clears the consecutive failures of a topic after a successful read
+func (k *KafkaClient) resetConsumerFailures(topic string) {
+	k.failuresMux.Lock()
+	defer k.failuresMux.Unlock()
+
+	k.failures[topic] = 0
+}
+
+// ConsumerFailures returns the consecutive read failures of each consumed topic
+func (k *KafkaClient) ConsumerFailures() map[string]int {
+	k.failuresMux.RLock()
+	defer k.failuresMux.RUnlock()
+
+	failures := make(map[string]int, len(k.failures))
+	for topic, count := range k.failures {
+		failures[topic] = count
+	}
+	return failures
+}
+
+// Healthy reports whether no consumer has reached consumerUnhealthyThreshold consecutive failed reads
+func (k *KafkaClient) Healthy() bool {
+	for _, count := range k.ConsumerFailures() {
+		if count >= consumerUnhealthyThreshold {
+			return false
 		}
 	}
+	return true
 }
 
 // Close closes all Kafka producers and consumers
@@ -134,6 +454,8 @@ func (k *KafkaClient) Close() error {
 		}
 	}
 
+	k.consumersMux.RLock()
+	defer k.consumersMux.RUnlock()
 	for topic, consumer := range k.consumers {
 		if err := consumer.Close(); err != nil {
 			log.Printf("Error closing consumer for topic %s: %v", topic, err)
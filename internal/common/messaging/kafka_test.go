@@ -0,0 +1,196 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/e-commerce/platform/internal/common/config"
+	"github.com/segmentio/kafka-go"
+)
+
+// readResult is a message or error returned by a fakeReader
+type readResult struct {
+	msg kafka.Message
+	err error
+}
+
+// fakeReader is a messageReader returning its results in order, then io.EOF
+// as if it was closed
+type fakeReader struct {
+	results []readResult
+	reads   int
+}
+
+var _ messageReader = (*fakeReader)(nil)
+
+func (r *fakeReader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	if r.reads >= len(r.results) {
+		return kafka.Message{}, io.EOF
+	}
+	result := r.results[r.reads]
+	r.reads++
+	return result.msg, result.err
+}
+
+func TestConsume(t *testing.T) {
+	transient := errors.New("broker not available")
+	message := readResult{msg: kafka.Message{Value: []byte("message")}}
+
+	tests := []struct {
+		name     string
+		results  []readResult
+		handled  int
+		failures int
+	}{
+		{"messages", []readResult{message, message}, 2, 0},
+		{"read failure retried", []readResult{{err: transient}, message}, 1, 0},
+		{"failures counted until a read succeeds", []readResult{message, {err: transient}}, 1, 1},
+		{"closed", nil, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := NewKafkaClient(&config.KafkaConfig{})
+			reader := &fakeReader{results: tt.results}
+
+			handled := 0
+			err := k.consume(context.Background(), "orders", reader, func(ctx context.Context, message []byte) error {
+				handled++
+				return nil
+			})
+			if !errors.Is(err, io.EOF) {
+				t.Errorf("error = %v, want io.EOF", err)
+			}
+			if handled != tt.handled {
+				t.Errorf("handled %d messages, want %d", handled, tt.handled)
+			}
+			if failures := k.ConsumerFailures()["orders"]; failures != tt.failures {
+				t.Errorf("failures = %d, want %d", failures, tt.failures)
+			}
+		})
+	}
+}
+
+func TestConsumeStopsWithContext(t *testing.T) {
+	k := NewKafkaClient(&config.KafkaConfig{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := k.consume(ctx, "orders", &fakeReader{}, func(ctx context.Context, message []byte) error {
+		t.Error("handler called after the context was done")
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+}
+
+func TestNextConsumerBackoff(t *testing.T) {
+	tests := []struct {
+		backoff time.Duration
+		want    time.Duration
+	}{
+		{consumerInitialBackoff, 2 * consumerInitialBackoff},
+		{consumerMaxBackoff / 2, consumerMaxBackoff},
+		{consumerMaxBackoff, consumerMaxBackoff},
+	}
+
+	for _, tt := range tests {
+		if got := nextConsumerBackoff(tt.backoff); got != tt.want {
+			t.Errorf("nextConsumerBackoff(%v) = %v, want %v", tt.backoff, got, tt.want)
+		}
+	}
+}
+
+func TestHealthy(t *testing.T) {
+	k := NewKafkaClient(&config.KafkaConfig{})
+	for range consumerUnhealthyThreshold - 1 {
+		k.recordConsumerFailure("orders")
+	}
+	if !k.Healthy() {
+		t.Error("unhealthy below the failure threshold")
+	}
+
+	k.recordConsumerFailure("orders")
+	if k.Healthy() {
+		t.Error("healthy at the failure threshold")
+	}
+
+	k.resetConsumerFailures("orders")
+	if !k.Healthy() {
+		t.Error("unhealthy after a successful read")
+	}
+}
+
+// fakeAdmin is a topicAdmin recording the topics it was asked to create
+type fakeAdmin struct {
+	topics []kafka.TopicConfig
+	errors map[string]error // Per topic errors of the response
+	err    error            // Error of the request
+}
+
+var _ topicAdmin = (*fakeAdmin)(nil)
+
+func (a *fakeAdmin) CreateTopics(ctx context.Context, req *kafka.CreateTopicsRequest) (*kafka.CreateTopicsResponse, error) {
+	a.topics = append(a.topics, req.Topics...)
+	if a.err != nil {
+		return nil, a.err
+	}
+
+	errs := make(map[string]error, len(req.Topics))
+	for _, topic := range req.Topics {
+		errs[topic.Topic] = a.errors[topic.Topic]
+	}
+	return &kafka.CreateTopicsResponse{Errors: errs}, nil
+}
+
+func TestEnsureTopics(t *testing.T) {
+	specs := []TopicSpec{
+		{Name: "orders"},
+		{Name: "products", Partitions: 12, ReplicationFactor: 2},
+	}
+
+	tests := []struct {
+		name    string
+		specs   []TopicSpec
+		admin   *fakeAdmin
+		created []kafka.TopicConfig
+		wantErr bool
+	}{
+		{"defaults", specs, &fakeAdmin{}, []kafka.TopicConfig{
+			{Topic: "orders", NumPartitions: 3, ReplicationFactor: 1},
+			{Topic: "products", NumPartitions: 12, ReplicationFactor: 2},
+		}, false},
+		{"already exists", specs[:1], &fakeAdmin{errors: map[string]error{"orders": kafka.TopicAlreadyExists}},
+			[]kafka.TopicConfig{{Topic: "orders", NumPartitions: 3, ReplicationFactor: 1}}, false},
+		{"topic error", specs[:1], &fakeAdmin{errors: map[string]error{"orders": kafka.InvalidReplicationFactor}},
+			[]kafka.TopicConfig{{Topic: "orders", NumPartitions: 3, ReplicationFactor: 1}}, true},
+		{"request error", specs[:1], &fakeAdmin{err: errors.New("connection refused")},
+			[]kafka.TopicConfig{{Topic: "orders", NumPartitions: 3, ReplicationFactor: 1}}, true},
+		{"no topics", nil, &fakeAdmin{}, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := NewKafkaClient(&config.KafkaConfig{TopicPartitions: 3, TopicReplicationFactor: 1})
+
+			err := k.ensureTopics(context.Background(), tt.admin, tt.specs)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(tt.admin.topics) != len(tt.created) {
+				t.Fatalf("created %+v, want %+v", tt.admin.topics, tt.created)
+			}
+			for i, topic := range tt.admin.topics {
+				want := tt.created[i]
+				if topic.Topic != want.Topic || topic.NumPartitions != want.NumPartitions ||
+					topic.ReplicationFactor != want.ReplicationFactor {
+					t.Errorf("topic %d = %+v, want %+v", i, topic, want)
+				}
+			}
+		})
+	}
+}
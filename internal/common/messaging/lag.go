@@ -0,0 +1,177 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/segmentio/kafka-go"
+)
+
+// lagRequestTimeout bounds each request made while measuring consumer lag
+const lagRequestTimeout = 10 * time.Second
+
+// consumerLagGauge exports the lag measured by MonitorConsumerLag
+var consumerLagGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "kafka_consumer_lag",
+	Help: "Messages in a partition not yet committed by the consumer group",
+}, []string{"group", "topic", "partition"})
+
+// offsetReader fetches the offsets consumer lag is measured from,
+// implemented by *kafka.Client
+type offsetReader interface {
+	Metadata(ctx context.Context, req *kafka.MetadataRequest) (*kafka.MetadataResponse, error)
+	OffsetFetch(ctx context.Context, req *kafka.OffsetFetchRequest) (*kafka.OffsetFetchResponse, error)
+	ListOffsets(ctx context.Context, req *kafka.ListOffsetsRequest) (*kafka.ListOffsetsResponse, error)
+}
+
+// MonitorConsumerLag measures the lag of the consumed topics every interval
+// until ctx is done, exporting it as the kafka_consumer_lag gauge. A
+// non-positive interval disables it.
+func (k *KafkaClient) MonitorConsumerLag(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	client := &kafka.Client{Addr: kafka.TCP(k.brokers...), Timeout: lagRequestTimeout}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := k.updateConsumerLag(ctx, client); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to measure Kafka consumer lag: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// updateConsumerLag measures the lag of each partition of the consumed topics
+// as the partition's last offset minus the group's committed offset.
+// Partitions without a committed offset lag from their first offset, as
+// consumers start from there.
+func (k *KafkaClient) updateConsumerLag(ctx context.Context, client offsetReader) error {
+	topics := k.consumedTopics()
+	if len(topics) == 0 {
+		return nil
+	}
+
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: topics})
+	if err != nil {
+		return fmt.Errorf("failed to fetch topic metadata: %w", err)
+	}
+
+	var errs []error
+	partitions := make(map[string][]int, len(topics))
+	offsetRequests := make(map[string][]kafka.OffsetRequest, len(topics))
+	for _, topic := range metadata.Topics {
+		if topic.Error != nil {
+			errs = append(errs, fmt.Errorf("failed to fetch metadata of topic %s: %w", topic.Name, topic.Error))
+			continue
+		}
+		for _, partition := range topic.Partitions {
+			partitions[topic.Name] = append(partitions[topic.Name], partition.ID)
+			offsetRequests[topic.Name] = append(offsetRequests[topic.Name],
+				kafka.FirstOffsetOf(partition.ID), kafka.LastOffsetOf(partition.ID))
+		}
+	}
+	if len(partitions) == 0 {
+		return errors.Join(errs...)
+	}
+
+	committed, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{GroupID: k.group, Topics: partitions})
+	if err != nil {
+		return fmt.Errorf("failed to fetch committed offsets: %w", err)
+	}
+	if committed.Error != nil {
+		return fmt.Errorf("failed to fetch committed offsets: %w", committed.Error)
+	}
+
+	offsets, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: offsetRequests})
+	if err != nil {
+		return fmt.Errorf("failed to list offsets: %w", err)
+	}
+
+	committedOffsets := make(map[string]map[int]int64, len(committed.Topics))
+	for topic, topicPartitions := range committed.Topics {
+		committedOffsets[topic] = make(map[int]int64, len(topicPartitions))
+		for _, partition := range topicPartitions {
+			if partition.Error != nil {
+				errs = append(errs, fmt.Errorf("failed to fetch committed offset of %s/%d: %w",
+					topic, partition.Partition, partition.Error))
+				continue
+			}
+			committedOffsets[topic][partition.Partition] = partition.CommittedOffset
+		}
+	}
+
+	lag := make(map[string]map[int]int64, len(offsets.Topics))
+	for topic, topicPartitions := range offsets.Topics {
+		for _, partition := range topicPartitions {
+			if partition.Error != nil {
+				errs = append(errs, fmt.Errorf("failed to list offsets of %s/%d: %w",
+					topic, partition.Partition, partition.Error))
+				continue
+			}
+			offset, exists := committedOffsets[topic][partition.Partition]
+			if !exists || offset < 0 {
+				offset = partition.FirstOffset
+			}
+
+			if lag[topic] == nil {
+				lag[topic] = make(map[int]int64, len(topicPartitions))
+			}
+			lag[topic][partition.Partition] = max(partition.LastOffset-offset, 0)
+			consumerLagGauge.WithLabelValues(k.group, topic, strconv.Itoa(partition.Partition)).
+				Set(float64(lag[topic][partition.Partition]))
+		}
+	}
+
+	k.lagMux.Lock()
+	k.lag = lag
+	k.lagMux.Unlock()
+
+	return errors.Join(errs...)
+}
+
+// ConsumerLag returns the lag of each partition of the consumed topics as
+// last measured by MonitorConsumerLag
+func (k *KafkaClient) ConsumerLag() map[string]map[int]int64 {
+	k.lagMux.RLock()
+	defer k.lagMux.RUnlock()
+
+	lag := make(map[string]map[int]int64, len(k.lag))
+	for topic, partitions := range k.lag {
+		lag[topic] = make(map[int]int64, len(partitions))
+		for partition, count := range partitions {
+			lag[topic][partition] = count
+		}
+	}
+	return lag
+}
+
+// CaughtUp reports whether no partition lags more than the configured maximum
+// consumer lag. It is always true when no maximum is configured.
+func (k *KafkaClient) CaughtUp() bool {
+	if k.maxLag <= 0 {
+		return true
+	}
+
+	for _, partitions := range k.ConsumerLag() {
+		for _, count := range partitions {
+			if count > k.maxLag {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+package messaging
+
+import (
+	"context"
+	"testing"
+
+	"github.com/e-commerce/platform/internal/common/config"
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeOffsets is an offsetReader serving the offsets of one topic's partitions
+type fakeOffsets struct {
+	committed map[int]int64 // Committed offset per partition, missing when never committed
+	first     map[int]int64
+	last      map[int]int64
+}
+
+var _ offsetReader = (*fakeOffsets)(nil)
+
+func (f *fakeOffsets) Metadata(ctx context.Context, req *kafka.MetadataRequest) (*kafka.MetadataResponse, error) {
+	response := &kafka.MetadataResponse{}
+	for _, topic := range req.Topics {
+		var partitions []kafka.Partition
+		for partition := range f.last {
+			partitions = append(partitions, kafka.Partition{Topic: topic, ID: partition})
+		}
+		response.Topics = append(response.Topics, kafka.Topic{Name: topic, Partitions: partitions})
+	}
+	return response, nil
+}
+
+func (f *fakeOffsets) OffsetFetch(ctx context.Context, req *kafka.OffsetFetchRequest) (*kafka.OffsetFetchResponse, error) {
+	response := &kafka.OffsetFetchResponse{Topics: make(map[string][]kafka.OffsetFetchPartition)}
+	for topic, partitions := range req.Topics {
+		for _, partition := range partitions {
+			offset, exists := f.committed[partition]
+			if !exists {
+				offset = -1
+			}
+			response.Topics[topic] = append(response.Topics[topic],
+				kafka.OffsetFetchPartition{Partition: partition, CommittedOffset: offset})
+		}
+	}
+	return response, nil
+}
+
+func (f *fakeOffsets) ListOffsets(ctx context.Context, req *kafka.ListOffsetsRequest) (*kafka.ListOffsetsResponse, error) {
+	response := &kafka.ListOffsetsResponse{Topics: make(map[string][]kafka.PartitionOffsets)}
+	for topic, requests := range req.Topics {
+		listed := make(map[int]bool)
+		for _, request := range requests {
+			if listed[request.Partition] {
+				continue
+			}
+			listed[request.Partition] = true
+			response.Topics[topic] = append(response.Topics[topic], kafka.PartitionOffsets{
+				Partition:   request.Partition,
+				FirstOffset: f.first[request.Partition],
+				LastOffset:  f.last[request.Partition],
+			})
+		}
+	}
+	return response, nil
+}
+
+func TestUpdateConsumerLag(t *testing.T) {
+	tests := []struct {
+		name    string
+		offsets *fakeOffsets
+		maxLag  int
+		want    map[int]int64
+		caught  bool
+	}{
+		{"committed", &fakeOffsets{committed: map[int]int64{0: 90, 1: 100}, last: map[int]int64{0: 100, 1: 100}},
+			20, map[int]int64{0: 10, 1: 0}, true},
+		{"never committed", &fakeOffsets{first: map[int]int64{0: 40}, last: map[int]int64{0: 100}},
+			20, map[int]int64{0: 60}, false},
+		{"no maximum", &fakeOffsets{committed: map[int]int64{0: 0}, last: map[int]int64{0: 1000}},
+			0, map[int]int64{0: 1000}, true},
+		{"committed past the end", &fakeOffsets{committed: map[int]int64{0: 110}, last: map[int]int64{0: 100}},
+			20, map[int]int64{0: 0}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := NewKafkaClient(&config.KafkaConfig{ConsumerGroup: "test", MaxConsumerLag: tt.maxLag})
+			// Consumed topics are the keys of the consumers
+			k.consumers["orders"] = nil
+
+			if err := k.updateConsumerLag(context.Background(), tt.offsets); err != nil {
+				t.Fatal(err)
+			}
+
+			lag := k.ConsumerLag()["orders"]
+			if len(lag) != len(tt.want) {
+				t.Fatalf("lag = %v, want %v", lag, tt.want)
+			}
+			for partition, want := range tt.want {
+				if lag[partition] != want {
+					t.Errorf("lag of partition %d = %d, want %d", partition, lag[partition], want)
+				}
+			}
+			if k.CaughtUp() != tt.caught {
+				t.Errorf("CaughtUp = %v, want %v", k.CaughtUp(), tt.caught)
+			}
+		})
+	}
+}
+
+func TestUpdateConsumerLagWithoutConsumers(t *testing.T) {
+	k := NewKafkaClient(&config.KafkaConfig{})
+
+	// No request is made, so a nil offset reader isn't used
+	if err := k.updateConsumerLag(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(k.ConsumerLag()) != 0 {
+		t.Errorf("lag = %v, want none", k.ConsumerLag())
+	}
+}
@@ -0,0 +1,165 @@
+package messaging
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// workerQueueSize is the number of fetched messages queued per worker
+const workerQueueSize = 16
+
+// messageFetcher fetches messages and commits them once handled,
+// implemented by *kafka.Reader
+type messageFetcher interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// ConsumeMessagesParallel consumes messages from a Kafka topic like
+// ConsumeMessages, handling up to workers messages at a time.
+//
+// Messages with the same key are handled by the same worker, so they're
+// handled in the order they were published, but messages with different keys
+// may be handled in any order. Offsets are committed once a message and every
+// earlier message of its partition were handled, so messages not yet handled
+// when the consumer stops are redelivered, and a handler may see a message
+// again after a restart. With one worker it is the same as ConsumeMessages.
+func (k *KafkaClient) ConsumeMessagesParallel(ctx context.Context, topic string, workers int, handler MessageHandler) error {
+	if workers <= 1 {
+		return k.ConsumeMessages(ctx, topic, handler)
+	}
+
+	consumer, err := k.consumer(topic)
+	if err != nil {
+		return err
+	}
+
+	return k.consumeParallel(ctx, topic, consumer, workers, handler)
+}
+
+// consumeParallel fetches messages from fetcher and dispatches them to
+// workers until ctx is done or a fatal error occurs, then waits for the
+// workers to finish the queued messages
+func (k *KafkaClient) consumeParallel(ctx context.Context, topic string, fetcher messageFetcher, workers int,
+	handler MessageHandler) error {
+	tracker := newOffsetTracker()
+	queues := make([]chan kafka.Message, workers)
+
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan kafka.Message, workerQueueSize)
+		wg.Add(1)
+		go func(queue <-chan kafka.Message) {
+			defer wg.Done()
+			for msg := range queue {
+				k.handleAndLog(ctx, topic, msg, handler)
+				tracker.handled(msg, func(commit kafka.Message) {
+					// Commit even while stopping, the message was handled
+					if err := fetcher.CommitMessages(context.WithoutCancel(ctx), commit); err != nil {
+						log.Printf("Error committing offset %d of Kafka topic %s partition %d: %v",
+							commit.Offset, topic, commit.Partition, err)
+					}
+				})
+			}
+		}(queues[i])
+	}
+
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+		wg.Wait()
+	}()
+
+	return k.readMessages(ctx, topic, fetcher.FetchMessage, func(msg kafka.Message) {
+		tracker.fetched(msg)
+		select {
+		case queues[workerFor(msg, workers)] <- msg:
+		case <-ctx.Done():
+			// Left uncommitted, so it's redelivered
+		}
+	})
+}
+
+// workerFor returns the worker handling a message, the same for every
+// message with the same key. Messages without a key are spread by offset.
+func workerFor(msg kafka.Message, workers int) int {
+	if len(msg.Key) == 0 {
+		return int(msg.Offset % int64(workers))
+	}
+
+	h := fnv.New32a()
+	h.Write(msg.Key)
+	return int(h.Sum32() % uint32(workers))
+}
+
+// offsetTracker tracks the fetched messages of each partition that weren't
+// committed yet, to find the offsets that can be committed as messages
+// finish out of order
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int]*partitionOffsets
+	commitMux  sync.Mutex    // Serializes commits, so offsets are committed in order
+	committed  map[int]int64 // Last offset committed per partition
+}
+
+// partitionOffsets are the uncommitted offsets of a partition
+type partitionOffsets struct {
+	pending []int64        // Fetched offsets not yet committed, in fetch order
+	done    map[int64]bool // Pending offsets that were handled
+}
+
+// newOffsetTracker creates an empty offset tracker
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{
+		partitions: make(map[int]*partitionOffsets),
+		committed:  make(map[int]int64),
+	}
+}
+
+// fetched records a message as fetched but not yet handled
+func (t *offsetTracker) fetched(msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	partition, exists := t.partitions[msg.Partition]
+	if !exists {
+		partition = &partitionOffsets{done: make(map[int64]bool)}
+		t.partitions[msg.Partition] = partition
+	}
+	partition.pending = append(partition.pending, msg.Offset)
+}
+
+// handled records a message as handled and, if it and every earlier message
+// of its partition were handled, calls commit with the last of them
+func (t *offsetTracker) handled(msg kafka.Message, commit func(kafka.Message)) {
+	t.mu.Lock()
+	partition := t.partitions[msg.Partition]
+	partition.done[msg.Offset] = true
+
+	last := int64(-1)
+	for len(partition.pending) > 0 && partition.done[partition.pending[0]] {
+		last = partition.pending[0]
+		delete(partition.done, last)
+		partition.pending = partition.pending[1:]
+	}
+	t.mu.Unlock()
+
+	if last < 0 {
+		return
+	}
+
+	t.commitMux.Lock()
+	defer t.commitMux.Unlock()
+
+	// A later offset may have been committed while waiting
+	if committed, exists := t.committed[msg.Partition]; exists && committed >= last {
+		return
+	}
+	commit(kafka.Message{Topic: msg.Topic, Partition: msg.Partition, Offset: last})
+	t.committed[msg.Partition] = last
+}
@@ -0,0 +1,202 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/e-commerce/platform/internal/common/config"
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeFetcher is a messageFetcher returning its messages in order, then
+// io.EOF as if it was closed, and recording the commits
+type fakeFetcher struct {
+	messages []kafka.Message
+	fetches  int
+	commits  []kafka.Message
+	mu       sync.Mutex
+}
+
+var _ messageFetcher = (*fakeFetcher)(nil)
+
+func (f *fakeFetcher) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	if f.fetches >= len(f.messages) {
+		return kafka.Message{}, io.EOF
+	}
+	msg := f.messages[f.fetches]
+	f.fetches++
+	return msg, nil
+}
+
+func (f *fakeFetcher) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.commits = append(f.commits, msgs...)
+	return nil
+}
+
+func TestOffsetTracker(t *testing.T) {
+	tests := []struct {
+		name    string
+		fetched []int64
+		handled []int64
+		commits []int64
+	}{
+		{"in order", []int64{0, 1, 2}, []int64{0, 1, 2}, []int64{0, 1, 2}},
+		{"out of order", []int64{0, 1, 2}, []int64{2, 1, 0}, []int64{2}},
+		{"gap", []int64{0, 1, 2, 3}, []int64{1, 0, 3, 2}, []int64{1, 3}},
+		{"earliest pending", []int64{5, 6, 7}, []int64{6, 7}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newOffsetTracker()
+			for _, offset := range tt.fetched {
+				tracker.fetched(kafka.Message{Partition: 0, Offset: offset})
+			}
+
+			var commits []int64
+			for _, offset := range tt.handled {
+				tracker.handled(kafka.Message{Partition: 0, Offset: offset}, func(msg kafka.Message) {
+					commits = append(commits, msg.Offset)
+				})
+			}
+
+			if len(commits) != len(tt.commits) {
+				t.Fatalf("committed %v, want %v", commits, tt.commits)
+			}
+			for i := range commits {
+				if commits[i] != tt.commits[i] {
+					t.Errorf("committed %v, want %v", commits, tt.commits)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestOffsetTrackerPartitions(t *testing.T) {
+	tracker := newOffsetTracker()
+	tracker.fetched(kafka.Message{Partition: 0, Offset: 10})
+	tracker.fetched(kafka.Message{Partition: 1, Offset: 10})
+
+	// A pending message of one partition doesn't hold back the others
+	var committed []kafka.Message
+	tracker.handled(kafka.Message{Partition: 1, Offset: 10}, func(msg kafka.Message) {
+		committed = append(committed, msg)
+	})
+	if len(committed) != 1 || committed[0].Partition != 1 || committed[0].Offset != 10 {
+		t.Errorf("committed %+v, want partition 1 offset 10", committed)
+	}
+}
+
+func TestConsumeParallel(t *testing.T) {
+	tests := []struct {
+		name       string
+		workers    int
+		partitions int
+		keys       int
+		messages   int
+	}{
+		{"one partition", 4, 1, 3, 50},
+		{"several partitions", 4, 3, 5, 90},
+		{"no keys", 3, 2, 0, 40},
+		{"more workers than keys", 8, 1, 2, 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher := &fakeFetcher{}
+			last := make(map[int]int64)
+			for i := range tt.messages {
+				msg := kafka.Message{Partition: i % tt.partitions, Offset: int64(i / tt.partitions), Value: []byte(strconv.Itoa(i))}
+				if tt.keys > 0 {
+					msg.Key = []byte(strconv.Itoa(i % tt.keys))
+				}
+				fetcher.messages = append(fetcher.messages, msg)
+				last[msg.Partition] = msg.Offset
+			}
+
+			var mu sync.Mutex
+			handled := make(map[string][]int) // Handled messages per key, in order
+			k := NewKafkaClient(&config.KafkaConfig{})
+			err := k.consumeParallel(context.Background(), "orders", fetcher, tt.workers,
+				func(ctx context.Context, message []byte) error {
+					i, _ := strconv.Atoi(string(message))
+					key := ""
+					if tt.keys > 0 {
+						key = strconv.Itoa(i % tt.keys)
+					}
+
+					mu.Lock()
+					defer mu.Unlock()
+					handled[key] = append(handled[key], i)
+					return nil
+				})
+			if !errors.Is(err, io.EOF) {
+				t.Errorf("error = %v, want io.EOF", err)
+			}
+
+			// Every message is handled before consumeParallel returns, and
+			// messages with the same key in the order they were fetched
+			total := 0
+			for key, messages := range handled {
+				total += len(messages)
+				if key == "" {
+					continue
+				}
+				for j := 1; j < len(messages); j++ {
+					if messages[j] < messages[j-1] {
+						t.Errorf("key %s handled out of order: %v", key, messages)
+						break
+					}
+				}
+			}
+			if total != tt.messages {
+				t.Errorf("handled %d messages, want %d", total, tt.messages)
+			}
+
+			// Commits of a partition only move forward, up to its last message
+			committed := make(map[int]int64)
+			for _, commit := range fetcher.commits {
+				if previous, exists := committed[commit.Partition]; exists && commit.Offset <= previous {
+					t.Errorf("partition %d committed offset %d after %d", commit.Partition, commit.Offset, previous)
+				}
+				committed[commit.Partition] = commit.Offset
+			}
+			for partition, offset := range last {
+				if committed[partition] != offset {
+					t.Errorf("partition %d committed up to %d, want %d", partition, committed[partition], offset)
+				}
+			}
+		})
+	}
+}
+
+func TestWorkerFor(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b kafka.Message
+		same bool
+	}{
+		{"same key", kafka.Message{Key: []byte("7"), Offset: 1}, kafka.Message{Key: []byte("7"), Offset: 2}, true},
+		{"no key", kafka.Message{Offset: 1}, kafka.Message{Offset: 2}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := workerFor(tt.a, 4), workerFor(tt.b, 4)
+			if a < 0 || a >= 4 || b < 0 || b >= 4 {
+				t.Fatalf("workers %d and %d out of range", a, b)
+			}
+			if (a == b) != tt.same {
+				t.Errorf("workers %d and %d, want same = %v", a, b, tt.same)
+			}
+		})
+	}
+}
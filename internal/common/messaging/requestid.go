@@ -0,0 +1,48 @@
+package messaging
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// RequestIDHeader is the header of messages carrying the ID of the HTTP
+// request that caused them, so services can log the same correlation ID
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDKey is the context key of the request ID
+type requestIDKey struct{}
+
+// WithRequestID returns a context whose published messages carry requestID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	if requestID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID of a context, or "" if it has none. Message
+// handlers get the request ID of the message they process.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// requestIDHeaders returns the headers carrying the request ID of ctx
+func requestIDHeaders(ctx context.Context) []kafka.Header {
+	requestID := RequestID(ctx)
+	if requestID == "" {
+		return nil
+	}
+	return []kafka.Header{{Key: RequestIDHeader, Value: []byte(requestID)}}
+}
+
+// messageRequestID returns the request ID header of a message, or ""
+func messageRequestID(msg kafka.Message) string {
+	for _, header := range msg.Headers {
+		if header.Key == RequestIDHeader {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
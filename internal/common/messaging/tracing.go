@@ -0,0 +1,41 @@
+package messaging
+
+import (
+	"github.com/segmentio/kafka-go"
+)
+
+// headerCarrier adapts the headers of a Kafka message to a
+// propagation.TextMapCarrier, so trace context travels with messages
+type headerCarrier struct {
+	headers *[]kafka.Header
+}
+
+// Get returns the value of a header
+func (c headerCarrier) Get(key string) string {
+	for _, header := range *c.headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+// Set sets the value of a header, replacing an existing one
+func (c headerCarrier) Set(key, value string) {
+	for i, header := range *c.headers {
+		if header.Key == key {
+			(*c.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.headers = append(*c.headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+// Keys returns the keys of the headers
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, len(*c.headers))
+	for i, header := range *c.headers {
+		keys[i] = header.Key
+	}
+	return keys
+}
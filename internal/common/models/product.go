@@ -1,14 +1,25 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"gorm.io/gorm"
 )
 
+// Model holds the same columns as gorm.Model, with the snake case JSON names
+// used by the rest of the API. Timestamps are formatted as RFC 3339 and the
+// soft delete timestamp, internal to the database, is left out of responses.
+type Model struct {
+	ID        uint           `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
 // Product represents the main product entity
 type Product struct {
-	gorm.Model
+	Model
 	ExternalID      string         `json:"external_id" gorm:"uniqueIndex;not null"`
 	Name            string         `json:"name" gorm:"not null"`
 	Description     string         `json:"description"`
@@ -28,15 +39,23 @@ type Product struct {
 	FavoriteCount   int            `json:"favorite_count"`
 	CommentCount    int            `json:"comment_count"`
 	LastUpdated     time.Time      `json:"last_updated"`
+	LastCrawledAt   time.Time      `json:"last_crawled_at" gorm:"index"`      // Last time a crawl fetched the product or found it unchanged
+	Version         int            `json:"version" gorm:"not null;default:1"` // Incremented on every save to detect concurrent updates
+	ContentHash     string         `json:"content_hash,omitempty"`            // Source hash of the crawled details, compared with listings to skip unchanged products
 	Attributes      []Attribute    `json:"attributes" gorm:"many2many:product_attributes;"`
 	RelatedProducts []Product      `json:"related_products" gorm:"many2many:product_relations;"`
 	PriceHistory    []PriceHistory `json:"price_history" gorm:"foreignKey:ProductID"`
 	StockHistory    []StockHistory `json:"stock_history" gorm:"foreignKey:ProductID"`
+	Reviews         []Review       `json:"-" gorm:"foreignKey:ProductID"`
+	Offers          []SellerOffer  `json:"-" gorm:"foreignKey:ProductID"`                // Offers of other sellers, nil when the source doesn't list them
+	Bundle          *Bundle        `json:"bundle,omitempty" gorm:"foreignKey:ProductID"` // Set for listings selling several products together
+	ScrapedFields   []string       `json:"-" gorm:"-"`                                   // Set for products scraped from their page, naming the fields the page provided
+	RelatedIDs      []string       `json:"-" gorm:"-"`                                   // External IDs of the related products the source lists, nil when it doesn't list them
 }
 
 // Category represents product categories
 type Category struct {
-	gorm.Model
+	Model
 	Name        string     `json:"name" gorm:"not null"`
 	Description string     `json:"description"`
 	ExternalID  string     `json:"external_id" gorm:"uniqueIndex;not null"`
@@ -45,6 +64,9 @@ type Category struct {
 	Children    []Category `json:"children" gorm:"foreignKey:ParentID"`
 	Level       int        `json:"level" gorm:"not null"`
 	IsActive    bool       `json:"is_active" gorm:"default:true"`
+
+	// ParentExternalID is the source's parent category ID, resolved to ParentID when saving
+	ParentExternalID string `json:"-" gorm:"-"`
 }
 
 // Brand represents product brands
@@ -66,13 +88,60 @@ type Seller struct {
 	IsActive      bool    `json:"is_active" gorm:"default:true"`
 }
 
+// SellerOffer is a seller's listing of a product on a marketplace, where the
+// same product can be offered by several sellers
+type SellerOffer struct {
+	gorm.Model
+	ProductID  uint    `json:"product_id" gorm:"not null;uniqueIndex:idx_seller_offer_product_seller"`
+	SellerID   uint    `json:"seller_id" gorm:"not null;uniqueIndex:idx_seller_offer_product_seller"`
+	Seller     Seller  `json:"seller"`
+	Price      float64 `json:"price"`
+	Currency   string  `json:"currency" gorm:"size:3"`
+	StockCount int     `json:"stock_count"`
+	URL        string  `json:"url"`
+}
+
+// Bundle is a listing that sells several products together. The listing is
+// saved as a product of its own whose variant prices are the bundle's total
+// price, so price history and price alerts of the product watch the total.
+type Bundle struct {
+	gorm.Model
+	ProductID     uint         `json:"product_id" gorm:"uniqueIndex;not null"` // The product the bundle is listed as
+	Price         float64      `json:"price"`                                  // Total price of the bundled products
+	OriginalPrice float64      `json:"original_price"`
+	Currency      string       `json:"currency" gorm:"size:3"`
+	Items         []BundleItem `json:"items" gorm:"foreignKey:BundleID"`
+}
+
+// BundleItem is a product contained in a bundle. Bundled products are matched
+// by external ID, ProductID is set once the product itself has been crawled.
+type BundleItem struct {
+	gorm.Model
+	BundleID          uint     `json:"bundle_id" gorm:"not null;uniqueIndex:idx_bundle_item"`
+	ProductExternalID string   `json:"product_external_id" gorm:"not null;uniqueIndex:idx_bundle_item"`
+	ProductID         *uint    `json:"product_id" gorm:"index"`
+	Product           *Product `json:"product,omitempty"`
+	Quantity          int      `json:"quantity" gorm:"not null;default:1"`
+}
+
+// PendingProductRelation is a related product listed by a product before it
+// was crawled, linked in product_relations once it is
+type PendingProductRelation struct {
+	ProductID         uint      `json:"product_id" gorm:"primaryKey;autoIncrement:false"`
+	RelatedExternalID string    `json:"related_external_id" gorm:"primaryKey;index"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
 // Image represents product images
 type Image struct {
 	gorm.Model
-	ProductID  uint   `json:"product_id"`
-	URL        string `json:"url" gorm:"not null"`
-	IsMain     bool   `json:"is_main" gorm:"default:false"`
-	ExternalID string `json:"external_id" gorm:"uniqueIndex;not null"`
+	ProductID      uint       `json:"product_id"`
+	URL            string     `json:"url" gorm:"not null"`
+	IsMain         bool       `json:"is_main" gorm:"default:false"`
+	ExternalID     string     `json:"external_id" gorm:"uniqueIndex;not null"`
+	MirroredURL    string     `json:"mirrored_url,omitempty" gorm:"not null;default:''"` // Copy of the image in our storage, empty until mirrored
+	MirrorAttempts int        `json:"-" gorm:"not null;default:0"`                       // Passes that failed to mirror the image
+	MirrorRetryAt  *time.Time `json:"-"`                                                 // Time before which mirroring isn't retried
 }
 
 // Video represents product videos
@@ -91,6 +160,7 @@ type Variant struct {
 	AttributeValues []AttributeValue   `json:"attribute_values" gorm:"many2many:variant_attribute_values;"`
 	Price           float64            `json:"price"`
 	OriginalPrice   float64            `json:"original_price"`
+	Currency        string             `json:"currency" gorm:"size:3"` // ISO 4217 code of the prices
 	DiscountRate    int                `json:"discount_rate"`
 	StockCount      int                `json:"stock_count"`
 	IsActive        bool               `json:"is_active" gorm:"default:true"`
@@ -108,8 +178,9 @@ type Attribute struct {
 // AttributeValue represents values for attributes
 type AttributeValue struct {
 	gorm.Model
-	Value      string `json:"value" gorm:"not null"`
-	ExternalID string `json:"external_id" gorm:"uniqueIndex;not null"`
+	AttributeName string `json:"attribute_name" gorm:"not null;default:'';index"` // Name of the attribute the value is of, e.g. Color
+	Value         string `json:"value" gorm:"not null"`
+	ExternalID    string `json:"external_id" gorm:"uniqueIndex;not null"`
 }
 
 // InstallmentOptions represents installment payment options
@@ -119,6 +190,17 @@ type InstallmentOptions struct {
 	BankOptions int  `json:"bank_options"`
 }
 
+// Review represents a customer review of a product
+type Review struct {
+	gorm.Model
+	ProductID  uint      `json:"product_id" gorm:"index"`
+	ExternalID string    `json:"external_id" gorm:"uniqueIndex;not null"`
+	Rating     int       `json:"rating"`
+	Text       string    `json:"text"`
+	Author     string    `json:"author"`
+	PostedAt   time.Time `json:"posted_at"`
+}
+
 // PriceHistory tracks price changes for products
 type PriceHistory struct {
 	gorm.Model
@@ -127,6 +209,7 @@ type PriceHistory struct {
 	PreviousPrice float64 `json:"previous_price"`
 	NewPrice      float64 `json:"new_price"`
 	ChangePercent float64 `json:"change_percent"`
+	Currency      string  `json:"currency" gorm:"size:3"`
 }
 
 // StockHistory tracks stock changes for products
@@ -139,6 +222,41 @@ type StockHistory struct {
 	ChangeQuantity int  `json:"change_quantity"`
 }
 
+// FavoriteHistory tracks changes of the favorite count of products
+type FavoriteHistory struct {
+	gorm.Model
+	ProductID     uint `json:"product_id" gorm:"index"`
+	PreviousCount int  `json:"previous_count"`
+	NewCount      int  `json:"new_count"`
+	ChangeCount   int  `json:"change_count"`
+}
+
+// ProductChangeEvent records a change of a product field found when a crawl
+// saved the product, or of a variant field when VariantExternalID is set.
+// Values are stored as strings so every field fits the same timeline.
+type ProductChangeEvent struct {
+	ID                uint      `json:"id" gorm:"primarykey"`
+	ProductID         uint      `json:"product_id" gorm:"not null;uniqueIndex:idx_product_change_event"`
+	Version           int       `json:"version" gorm:"not null;uniqueIndex:idx_product_change_event"` // Product version that made the change
+	VariantExternalID string    `json:"variant_external_id,omitempty" gorm:"not null;default:'';uniqueIndex:idx_product_change_event"`
+	Field             string    `json:"field" gorm:"size:50;not null;uniqueIndex:idx_product_change_event"`
+	OldValue          string    `json:"old_value"`
+	NewValue          string    `json:"new_value"`
+	ChangedAt         time.Time `json:"changed_at" gorm:"index"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// OutboxMessage is a Kafka message saved in the transaction of the changes it
+// reports, so it is published even when Kafka fails at commit time. It is
+// deleted once published.
+type OutboxMessage struct {
+	ID        uint      `gorm:"primarykey"`
+	Topic     string    `gorm:"not null"`
+	Key       string    `gorm:"not null"`
+	Payload   string    `gorm:"type:jsonb;not null"` // Message value, as JSON
+	CreatedAt time.Time `gorm:"index"`
+}
+
 // UserFavorite represents user favorites for notification priority
 type UserFavorite struct {
 	gorm.Model
@@ -156,10 +274,100 @@ type User struct {
 
 // Notification represents user notifications for price drops
 type Notification struct {
-	gorm.Model
+	Model
 	UserID      uint      `json:"user_id"`
 	ProductID   uint      `json:"product_id"`
+	Type        string    `json:"type" gorm:"size:20;not null;default:'price_drop'"` // price_drop, low_stock or digest
 	Message     string    `json:"message"`
 	IsRead      bool      `json:"is_read" gorm:"default:false"`
+	Archived    bool      `json:"archived" gorm:"default:false;index"`
 	DeliveredAt time.Time `json:"delivered_at"`
+	DedupeKey   *string   `json:"-" gorm:"uniqueIndex"` // Identifies the alert a notification is for, so it's saved once
+}
+
+// NotificationPreference holds how a user wants to receive notifications
+type NotificationPreference struct {
+	gorm.Model
+	UserID     uint `json:"user_id" gorm:"uniqueIndex;not null"`
+	DigestMode bool `json:"digest_mode" gorm:"default:false"` // Receive a daily digest instead of a notification per price drop
+}
+
+// DigestItem is a price drop collected for the daily digest of a user in
+// digest mode. DigestedAt is set once it was included in a digest, and each
+// price change is collected only once per user.
+type DigestItem struct {
+	gorm.Model
+	UserID          uint       `json:"user_id" gorm:"not null;uniqueIndex:idx_digest_item_change"`
+	PriceHistoryID  uint       `json:"price_history_id" gorm:"not null;uniqueIndex:idx_digest_item_change"`
+	ProductID       uint       `json:"product_id"`
+	VariantID       uint       `json:"variant_id"`
+	PreviousPrice   float64    `json:"previous_price"`
+	NewPrice        float64    `json:"new_price"`
+	DiscountPercent float64    `json:"discount_percent"`
+	Currency        string     `json:"currency" gorm:"size:3"`
+	ProductName     string     `json:"product_name"`
+	ProductURL      string     `json:"product_url"`
+	DigestedAt      *time.Time `json:"digested_at" gorm:"index"`
+}
+
+// PriceAlert represents a user's price drop or low stock alert for a product
+type PriceAlert struct {
+	gorm.Model
+	UserID           uint      `json:"user_id" gorm:"index;not null"`
+	ProductID        uint      `json:"product_id" gorm:"index;not null"`
+	VariantID        uint      `json:"variant_id"`
+	DiscountPercent  float64   `json:"discount_percent"`
+	TargetPrice      *float64  `json:"target_price"`                     // Notify when the price reaches this value instead of a percentage drop
+	CooldownHours    *int      `json:"cooldown_hours" gorm:"default:24"` // Minimum hours between notifications, 0 notifies on every drop
+	StockThreshold   *int      `json:"stock_threshold"`                  // Notify when the variant's stock falls below this value instead of on price drops
+	StockLow         bool      `json:"stock_low" gorm:"default:false"`   // Whether the stock was below the threshold when last checked, so it notifies once per fall
+	LastNotification time.Time `json:"last_notification"`
+}
+
+// CategoryAlert represents a user's price drop alert for every product of a
+// category and its subcategories
+type CategoryAlert struct {
+	gorm.Model
+	UserID          uint    `json:"user_id" gorm:"index;not null"`
+	CategoryID      uint    `json:"category_id" gorm:"index;not null"`
+	DiscountPercent float64 `json:"discount_percent"`
+}
+
+// CategoryAlertNotification records a price drop notified by a category alert,
+// so each drop is notified once and notifications can be capped per day
+type CategoryAlertNotification struct {
+	ID              uint      `json:"id" gorm:"primarykey"`
+	CategoryAlertID uint      `json:"category_alert_id" gorm:"not null;uniqueIndex:idx_category_alert_notification"`
+	PriceHistoryID  uint      `json:"price_history_id" gorm:"not null;uniqueIndex:idx_category_alert_notification"`
+	CreatedAt       time.Time `json:"created_at" gorm:"index"`
+}
+
+// Webhook represents a user's webhook endpoint for notification delivery
+type Webhook struct {
+	gorm.Model
+	UserID              uint   `json:"user_id" gorm:"index;not null"`
+	URL                 string `json:"url" gorm:"not null"`
+	Secret              string `json:"-" gorm:"not null"`
+	Active              bool   `json:"active" gorm:"default:true"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+}
+
+// Anomaly types
+const (
+	AnomalyPriceDrop  = "price_drop"
+	AnomalyStockSpike = "stock_spike"
+)
+
+// Anomaly represents a sudden price or stock change found by the analyzer.
+// SourceID is the price or stock history entry it was detected from, so each
+// change is recorded only once.
+type Anomaly struct {
+	gorm.Model
+	ProductID  uint            `json:"product_id" gorm:"index"`
+	VariantID  uint            `json:"variant_id"`
+	Type       string          `json:"type" gorm:"not null;uniqueIndex:idx_anomaly_source"`
+	SourceID   uint            `json:"source_id" gorm:"uniqueIndex:idx_anomaly_source"`
+	Severity   string          `json:"severity" gorm:"index"`
+	DetectedAt time.Time       `json:"detected_at" gorm:"index"`
+	Details    json.RawMessage `json:"details" gorm:"type:jsonb"`
 }
@@ -0,0 +1,50 @@
+// Package money formats prices in their currency.
+package money
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// currencyLocales are the locales whose separators are used for a currency,
+// currencies not listed use English separators
+var currencyLocales = map[string]language.Tag{
+	"TRY": language.Turkish,
+	"USD": language.AmericanEnglish,
+	"GBP": language.BritishEnglish,
+	"EUR": language.German,
+}
+
+// Normalize returns the upper case ISO 4217 code of a currency, or fallback
+// if code is empty or not a known currency
+func Normalize(code, fallback string) string {
+	unit, err := currency.ParseISO(strings.TrimSpace(code))
+	if err != nil {
+		return fallback
+	}
+	return unit.String()
+}
+
+// Format formats an amount with the symbol, separators and decimals of its
+// currency, e.g. ₺1.299,99 for TRY and $1,299.99 for USD. Amounts in an
+// unknown currency are formatted with two decimals followed by the code.
+func Format(amount float64, code string) string {
+	unit, err := currency.ParseISO(code)
+	if err != nil {
+		return strings.TrimSpace(fmt.Sprintf("%.2f %s", amount, code))
+	}
+
+	tag, ok := currencyLocales[unit.String()]
+	if !ok {
+		tag = language.English
+	}
+	printer := message.NewPrinter(tag)
+
+	scale, _ := currency.Standard.Rounding(unit)
+	return printer.Sprint(currency.NarrowSymbol(unit)) + printer.Sprint(number.Decimal(amount, number.Scale(scale)))
+}
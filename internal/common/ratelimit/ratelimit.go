@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/time/rate"
+)
+
+// visitorExpiry is how long an idle client's token bucket is kept
+const visitorExpiry = 3 * time.Minute
+
+// New returns middleware that limits each client IP to limit requests per second
+// with the given burst. Rejected requests get 429 with a Retry-After header.
+// A non-positive limit disables rate limiting.
+func New(limit rate.Limit, burst int) echo.MiddlewareFunc {
+	if limit <= 0 {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return next
+		}
+	}
+
+	// Time until the bucket refills by one token
+	retryAfter := strconv.Itoa(int(math.Ceil(1 / float64(limit))))
+
+	return middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+		Store: middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+			Rate:      limit,
+			Burst:     burst,
+			ExpiresIn: visitorExpiry,
+		}),
+		IdentifierExtractor: func(c echo.Context) (string, error) {
+			return c.RealIP(), nil
+		},
+		ErrorHandler: func(c echo.Context, err error) error {
+			return echo.NewHTTPError(http.StatusForbidden, "Unable to identify client")
+		},
+		DenyHandler: func(c echo.Context, identifier string, err error) error {
+			c.Response().Header().Set("Retry-After", retryAfter)
+			return echo.NewHTTPError(http.StatusTooManyRequests, "Rate limit exceeded")
+		},
+	})
+}
+
+// PerMinute converts a number of requests per minute to a rate limit
+func PerMinute(requests int) rate.Limit {
+	return rate.Limit(float64(requests) / 60)
+}
@@ -2,39 +2,72 @@ package crawler
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/e-commerce/platform/internal/common/adminauth"
 	"github.com/e-commerce/platform/internal/common/config"
+	"github.com/e-commerce/platform/internal/common/cors"
 	"github.com/e-commerce/platform/internal/common/db"
+	"github.com/e-commerce/platform/internal/common/dbtimeout"
+	"github.com/e-commerce/platform/internal/common/httperror"
+	"github.com/e-commerce/platform/internal/common/messaging"
 	"github.com/e-commerce/platform/internal/common/models"
+	"github.com/e-commerce/platform/internal/common/ratelimit"
+	"github.com/e-commerce/platform/internal/common/tracing"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/time/rate"
 	"gorm.io/gorm"
 )
 
 // API represents the API server for the crawler service
 type API struct {
-	echo   *echo.Echo
-	db     *db.Database
-	config *config.Config
-	service *Service
+	echo        *echo.Echo
+	db          *db.Database
+	config      *config.Config
+	service     *Service
+	idempotency *idempotencyCache
+	jobs        *jobTracker
+	crawlCtx    context.Context    // Parent context of background crawls
+	crawlCancel context.CancelFunc // Cancels background crawls on shutdown
+	crawlWg     sync.WaitGroup     // Tracks running background crawls
 }
 
 // NewAPI creates a new API server
 func NewAPI(db *db.Database, config *config.Config, service *Service) *API {
 	e := echo.New()
+	e.HTTPErrorHandler = httperror.Handler
 
 	// Middleware
+	e.Use(middleware.RequestID())
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
-	e.Use(middleware.CORS())
+	e.Use(tracing.Middleware())
+	e.Use(cors.New(config.Server.AllowedOrigins("crawler")))
+	e.Use(middleware.GzipWithConfig(middleware.GzipConfig{
+		Level:     config.Server.GzipLevel,
+		MinLength: config.Server.GzipMinLength,
+	}))
+
+	crawlCtx, crawlCancel := context.WithCancel(context.Background())
 
 	api := &API{
-		echo:   e,
-		db:     db,
-		config: config,
-		service: service,
+		echo:        e,
+		db:          db,
+		config:      config,
+		service:     service,
+		idempotency: newIdempotencyCache(idempotencyKeyTTL),
+		jobs:        newJobTracker(crawlJobTTL),
+		crawlCtx:    crawlCtx,
+		crawlCancel: crawlCancel,
 	}
 
 	// Routes
@@ -48,21 +81,63 @@ func (api *API) registerRoutes() {
 	// Health check
 	api.echo.GET("/health", api.healthCheck)
 
-	// API group
-	v1 := api.echo.Group("/api/v1/crawler")
+	// Readiness and Prometheus metrics
+	api.echo.GET("/ready", api.readyCheck)
+	api.echo.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+
+	// API group, rate limited per client with stricter limits for expensive endpoints
+	// and with the database queries of each request bounded by the query timeout
+	limits := api.config.RateLimit
+	limiter := ratelimit.New(rate.Limit(limits.RequestsPerSecond), limits.Burst)
+	v1 := api.echo.Group("/api/v1/crawler", limiter, dbtimeout.New(api.config.Database.QueryTimeout))
+	expensive := ratelimit.New(ratelimit.PerMinute(limits.ExpensiveRequestsPerMinute), limits.ExpensiveBurst)
+
+	// Mirrored images, when mirrored to a path of this API
+	if mirror := api.config.ImageMirror; mirror.Enabled && strings.HasPrefix(mirror.BaseURL, "/") {
+		api.echo.Static(mirror.BaseURL, mirror.Dir)
+	}
+
+	// Exports stream the whole catalog, so they aren't bound by the query timeout
+	api.echo.GET("/api/v1/crawler/products/export", api.exportProducts, limiter, expensive)
 	
 	// Category routes
 	v1.GET("/categories", api.getCategories)
+	v1.GET("/categories/tree", api.getCategoryTree)
 	v1.GET("/categories/:id", api.getCategoryByID)
+	v1.GET("/categories/:id/descendants", api.getCategoryDescendants)
+	
+	// Brand and seller routes
+	v1.GET("/brands/:id", api.getBrandByID)
+	v1.GET("/brands/:id/products", api.getBrandProducts)
+	v1.GET("/sellers/:id", api.getSellerByID)
+	v1.GET("/sellers/:id/products", api.getSellerProducts)
 	
 	// Product routes
 	v1.GET("/products", api.getProducts)
+	v1.GET("/products/facets", api.getProductFacets)
+	v1.GET("/products/stale", api.getStaleProducts)
 	v1.GET("/products/:id", api.getProductByID)
+	v1.GET("/products/:id/reviews", api.getProductReviews)
+	v1.GET("/products/:id/offers", api.getProductOffers)
+	v1.GET("/products/:id/similar", api.getSimilarProducts)
+	v1.POST("/products/batch", api.getProductsBatch, expensive)
 	v1.POST("/products/:id/priority", api.updateProductPriority)
+
+	// Bundle routes
+	v1.GET("/bundles/:id", api.getBundle)
+
+	// User routes
+	v1.POST("/users/:id/favorites/import", api.importFavorites, expensive)
 	
 	// Crawler control
-	v1.POST("/crawl/category/:id", api.crawlCategory)
-	v1.POST("/crawl/product/:id", api.crawlProduct)
+	v1.POST("/crawl/category/:id", api.crawlCategory, expensive)
+	v1.POST("/crawl/product/:id", api.crawlProduct, expensive)
+	v1.POST("/crawl/favorites", api.crawlFavorites, expensive)
+	v1.GET("/jobs/:job_id", api.getJob)
+
+	// Admin routes
+	admin := v1.Group("/admin", adminauth.New(api.config.AdminToken))
+	admin.POST("/reload", api.reload)
 }
 
 // Start starts the API server
@@ -70,7 +145,8 @@ func (api *API) Start(ctx context.Context) error {
 	// Server
 	go func() {
 		address := ":" + strconv.Itoa(api.config.Server.Port)
-		if err := api.echo.Start(address); err != nil && err != http.ErrServerClosed {
+		srv := api.config.Server.HTTPServer(address, api.echo)
+		if err := api.echo.StartServer(srv); err != nil && err != http.ErrServerClosed {
 			api.echo.Logger.Fatal("shutting down the server")
 		}
 	}()
@@ -82,25 +158,109 @@ func (api *API) Start(ctx context.Context) error {
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), api.config.Server.IdleTimeout)
 	defer cancel()
 	
-	return api.echo.Shutdown(shutdownCtx)
+	err := api.echo.Shutdown(shutdownCtx)
+	
+	// Stop background crawls after their current product and wait for them
+	api.crawlCancel()
+	api.waitForCrawls(shutdownCtx)
+	
+	return err
 }
 
-// healthCheck is a health check endpoint
+// waitForCrawls waits for background crawls to finish or ctx to be done
+func (api *API) waitForCrawls(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		api.crawlWg.Wait()
+		close(done)
+	}()
+	
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("Timed out waiting for background crawls to finish")
+	}
+}
+
+// runCrawl queues a crawl for the crawler's trigger workers with a context
+// that is cancelled on shutdown or after the configured crawl timeout. The
+// product updates it publishes carry the ID of the request that triggered it.
+// It returns 429 Too Many Requests when too many crawls are already queued.
+func (api *API) runCrawl(c echo.Context, crawl func(ctx context.Context)) error {
+	requestID := c.Response().Header().Get(echo.HeaderXRequestID)
+	ctx := messaging.WithRequestID(api.crawlCtx, requestID)
+
+	api.crawlWg.Add(1)
+	if err := api.service.enqueueCrawl(ctx, func(ctx context.Context) {
+		defer api.crawlWg.Done()
+		crawl(ctx)
+	}); err != nil {
+		api.crawlWg.Done()
+		return echo.NewHTTPError(http.StatusTooManyRequests, "Crawl queue is full, try again later").SetInternal(err)
+	}
+	return nil
+}
+
+// requestDB returns the database bound to the request context, so queries are
+// cancelled when the client disconnects or the request times out
+func (api *API) requestDB(c echo.Context) *gorm.DB {
+	return api.db.WithContext(c.Request().Context())
+}
+
+// healthCheck is a liveness check endpoint. Dependencies are checked by
+// readyCheck instead, as restarting the service doesn't fix them.
 func (api *API) healthCheck(c echo.Context) error {
-	return c.JSON(http.StatusOK, map[string]string{
-		"status": "ok",
-		"service": "crawler",
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status":        "ok",
+		"service":       "crawler",
+		"queued_crawls": api.service.queuedCrawls(),
 	})
 }
 
+// readyCheck reports the Kafka consumer failures and lag and the scraper
+// circuit breaker, responding 503 while a consumer keeps failing, a partition
+// lags more than the configured maximum or the breaker is open. Restarting
+// the crawler while the target is down would just reset the breaker.
+func (api *API) readyCheck(c echo.Context) error {
+	status, code := "ready", http.StatusOK
+	if !api.service.kafka.CaughtUp() {
+		status, code = "lagging", http.StatusServiceUnavailable
+	}
+	if !api.service.kafka.Healthy() {
+		status, code = "degraded", http.StatusServiceUnavailable
+	}
+
+	response := map[string]interface{}{
+		"service":                 "crawler",
+		"kafka_consumer_failures": api.service.kafka.ConsumerFailures(),
+		"kafka_consumer_lag":      api.service.kafka.ConsumerLag(),
+	}
+
+	if reporter, ok := api.service.source.(circuitReporter); ok {
+		state, trips := reporter.CircuitState()
+		if state == circuitOpen {
+			status, code = "circuit_open", http.StatusServiceUnavailable
+		}
+		response["scraper_circuit"] = state
+		response["scraper_circuit_trips"] = trips
+	}
+	response["status"] = status
+
+	return c.JSON(code, response)
+}
+
 // getCategories returns all categories
 func (api *API) getCategories(c echo.Context) error {
 	var categories []models.Category
 	
-	if err := api.db.Find(&categories).Error; err != nil {
+	if err := api.requestDB(c).Order("id ASC").Find(&categories).Error; err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch categories")
 	}
 	
+	if notModified(c, categoriesETag(categories)) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	
 	return c.JSON(http.StatusOK, categories)
 }
 
@@ -109,7 +269,7 @@ func (api *API) getCategoryByID(c echo.Context) error {
 	id := c.Param("id")
 	
 	var category models.Category
-	if err := api.db.Where("external_id = ?", id).First(&category).Error; err != nil {
+	if err := api.requestDB(c).Where("external_id = ?", id).First(&category).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return echo.NewHTTPError(http.StatusNotFound, "Category not found")
 		}
@@ -119,8 +279,361 @@ func (api *API) getCategoryByID(c echo.Context) error {
 	return c.JSON(http.StatusOK, category)
 }
 
-// getProducts returns products with pagination
+// getCategoryTree returns all categories nested under their parents
+func (api *API) getCategoryTree(c echo.Context) error {
+	var categories []models.Category
+	
+	if err := api.requestDB(c).Order("id ASC").Find(&categories).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch categories")
+	}
+	
+	return c.JSON(http.StatusOK, buildCategoryTree(categories))
+}
+
+// getCategoryDescendants returns all transitive children of a category
+func (api *API) getCategoryDescendants(c echo.Context) error {
+	id := c.Param("id")
+	
+	var category models.Category
+	if err := api.requestDB(c).Where("external_id = ?", id).First(&category).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "Category not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch category")
+	}
+	
+	var categories []models.Category
+	if err := api.requestDB(c).Order("id ASC").Find(&categories).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch categories")
+	}
+	
+	return c.JSON(http.StatusOK, categoryDescendants(categories, category.ID))
+}
+
+// buildCategoryTree nests a flat category list under their parents. Categories
+// whose parent is missing become roots, and any parent link that would close a
+// cycle is dropped so every category appears exactly once.
+func buildCategoryTree(categories []models.Category) []models.Category {
+	byID := make(map[uint]models.Category, len(categories))
+	childIDs := make(map[uint][]uint)
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+	for _, category := range categories {
+		if category.ParentID != nil {
+			if _, exists := byID[*category.ParentID]; exists && *category.ParentID != category.ID {
+				childIDs[*category.ParentID] = append(childIDs[*category.ParentID], category.ID)
+			}
+		}
+	}
+	
+	visited := make(map[uint]bool, len(categories))
+	var build func(id uint) models.Category
+	build = func(id uint) models.Category {
+		visited[id] = true
+		node := byID[id]
+		node.Children = make([]models.Category, 0, len(childIDs[id]))
+		for _, childID := range childIDs[id] {
+			if visited[childID] {
+				continue
+			}
+			node.Children = append(node.Children, build(childID))
+		}
+		return node
+	}
+	
+	roots := make([]models.Category, 0)
+	for _, category := range categories {
+		parentID := category.ParentID
+		if parentID == nil || *parentID == category.ID {
+			roots = append(roots, build(category.ID))
+		} else if _, exists := byID[*parentID]; !exists {
+			roots = append(roots, build(category.ID))
+		}
+	}
+	
+	// Categories not reached from a root are part of a parent cycle; break the
+	// cycle by promoting the first unvisited category to a root
+	for _, category := range categories {
+		if !visited[category.ID] {
+			log.Printf("Category %s is part of a parent cycle, treating it as a root", category.ExternalID)
+			roots = append(roots, build(category.ID))
+		}
+	}
+	
+	return roots
+}
+
+// categoryDescendants returns all transitive children of the given category,
+// guarding against parent cycles
+func categoryDescendants(categories []models.Category, rootID uint) []models.Category {
+	childIndexes := make(map[uint][]int)
+	for i, category := range categories {
+		if category.ParentID != nil {
+			childIndexes[*category.ParentID] = append(childIndexes[*category.ParentID], i)
+		}
+	}
+	
+	descendants := make([]models.Category, 0)
+	visited := map[uint]bool{rootID: true}
+	queue := []uint{rootID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, i := range childIndexes[id] {
+			child := categories[i]
+			if visited[child.ID] {
+				continue
+			}
+			visited[child.ID] = true
+			descendants = append(descendants, child)
+			queue = append(queue, child.ID)
+		}
+	}
+	
+	return descendants
+}
+
+// productStats holds aggregates over the products of a brand or seller
+type productStats struct {
+	ActiveProducts  int64   `json:"active_products"`
+	AverageRating   float64 `json:"average_rating"`
+	AverageDiscount float64 `json:"average_discount"`
+}
+
+// productStatsFor computes the product aggregates of a brand or seller, column
+// must be either brand_id or seller_id
+func (api *API) productStatsFor(ctx context.Context, column string, id uint) (productStats, error) {
+	var stats productStats
+	err := api.db.WithContext(ctx).Raw(`
+		SELECT
+			COUNT(*) AS active_products,
+			COALESCE(AVG(p.rating), 0) AS average_rating,
+			COALESCE((
+				SELECT AVG(v.discount_rate) FROM variants v
+				JOIN products vp ON vp.id = v.product_id
+				WHERE vp.`+column+` = ? AND vp.is_active = true AND vp.deleted_at IS NULL
+				AND v.is_active = true AND v.deleted_at IS NULL
+			), 0) AS average_discount
+		FROM products p
+		WHERE p.`+column+` = ? AND p.is_active = true AND p.deleted_at IS NULL
+	`, id, id).Scan(&stats).Error
+	return stats, err
+}
+
+// getBrandByID returns a brand with aggregates over its active products
+func (api *API) getBrandByID(c echo.Context) error {
+	brand, err := api.findBrand(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	
+	stats, err := api.productStatsFor(c.Request().Context(), "brand_id", brand.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to compute brand statistics")
+	}
+	
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"brand": brand,
+		"stats": stats,
+	})
+}
+
+// getBrandProducts returns the products of a brand, accepting the product listing filters
+func (api *API) getBrandProducts(c echo.Context) error {
+	brand, err := api.findBrand(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	
+	filter, err := parseProductFilter(c)
+	if err != nil {
+		return err
+	}
+	filter.BrandID = brand.ID
+	
+	return api.listProducts(c, filter)
+}
+
+// findBrand fetches a brand by external ID
+func (api *API) findBrand(ctx context.Context, id string) (*models.Brand, error) {
+	var brand models.Brand
+	if err := api.db.WithContext(ctx).Where("external_id = ?", id).First(&brand).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, echo.NewHTTPError(http.StatusNotFound, "Brand not found")
+		}
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch brand")
+	}
+	return &brand, nil
+}
+
+// getSellerByID returns a seller with aggregates over its active products
+func (api *API) getSellerByID(c echo.Context) error {
+	seller, err := api.findSeller(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	
+	stats, err := api.productStatsFor(c.Request().Context(), "seller_id", seller.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to compute seller statistics")
+	}
+	
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"seller": seller,
+		"stats":  stats,
+	})
+}
+
+// getSellerProducts returns the products of a seller, accepting the product listing filters
+func (api *API) getSellerProducts(c echo.Context) error {
+	seller, err := api.findSeller(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	
+	filter, err := parseProductFilter(c)
+	if err != nil {
+		return err
+	}
+	filter.SellerID = seller.ID
+	
+	return api.listProducts(c, filter)
+}
+
+// findSeller fetches a seller by external ID
+func (api *API) findSeller(ctx context.Context, id string) (*models.Seller, error) {
+	var seller models.Seller
+	if err := api.db.WithContext(ctx).Where("external_id = ?", id).First(&seller).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, echo.NewHTTPError(http.StatusNotFound, "Seller not found")
+		}
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch seller")
+	}
+	return &seller, nil
+}
+
+// getProducts returns products with offset pagination, or keyset pagination
+// when after_id is given (use after_id=0 to start from the beginning)
 func (api *API) getProducts(c echo.Context) error {
+	filter, err := parseProductFilter(c)
+	if err != nil {
+		return err
+	}
+	
+	return api.listProducts(c, filter)
+}
+
+// parseProductFilter parses the product listing filters from the query
+func parseProductFilter(c echo.Context) (productFilter, error) {
+	var filter productFilter
+	if category := c.QueryParam("category"); category != "" {
+		categoryID, err := strconv.ParseUint(category, 10, 32)
+		if err != nil {
+			return filter, echo.NewHTTPError(http.StatusBadRequest, "Invalid category")
+		}
+		filter.CategoryID = uint(categoryID)
+	}
+	
+	if brand := c.QueryParam("brand"); brand != "" {
+		brandID, err := strconv.ParseUint(brand, 10, 32)
+		if err != nil {
+			return filter, echo.NewHTTPError(http.StatusBadRequest, "Invalid brand")
+		}
+		filter.BrandID = uint(brandID)
+	}
+	
+	if active := c.QueryParam("active"); active != "" {
+		isActive := active == "true"
+		filter.IsActive = &isActive
+	}
+
+	attributes, err := parseAttributeFilter(c.QueryParams())
+	if err != nil {
+		return filter, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	filter.Attributes = attributes
+	
+	return filter, nil
+}
+
+// exportProducts streams the products matching the product listing filters as
+// a CSV or JSON file, loading them in batches
+func (api *API) exportProducts(c echo.Context) error {
+	filter, err := parseProductFilter(c)
+	if err != nil {
+		return err
+	}
+
+	format := c.QueryParam("format")
+	if format == "" {
+		format = "csv"
+	}
+
+	res := c.Response()
+	var contentType string
+	switch format {
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+	case "json":
+		contentType = echo.MIMEApplicationJSONCharsetUTF8
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "format must be csv or json")
+	}
+
+	res.Header().Set(echo.HeaderContentType, contentType)
+	res.Header().Set(echo.HeaderContentDisposition,
+		fmt.Sprintf("attachment; filename=\"products-%s.%s\"", time.Now().UTC().Format("20060102-150405"), format))
+
+	// Large exports take longer than the server write timeout allows
+	if err := http.NewResponseController(res).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Failed to clear export write deadline: %v", err)
+	}
+	res.WriteHeader(http.StatusOK)
+
+	var writer exportWriter
+	if format == "csv" {
+		writer, err = newCSVExportWriter(res)
+	} else {
+		writer, err = newJSONExportWriter(res)
+	}
+	if err != nil {
+		log.Printf("Failed to start product export: %v", err)
+		return nil
+	}
+
+	// The response is already started, so failures can only end it early
+	var products []models.Product
+	result := api.service.productsQuery(c.Request().Context(), filter).
+		Preload("Category").
+		Preload("Brand").
+		Preload("Variants").
+		FindInBatches(&products, exportBatchSize, func(tx *gorm.DB, batch int) error {
+			for _, product := range products {
+				if err := writer.Write(newExportRow(product)); err != nil {
+					return err
+				}
+			}
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			res.Flush()
+			return nil
+		})
+	if result.Error != nil {
+		log.Printf("Product export stopped after %d products: %v", result.RowsAffected, result.Error)
+		return nil
+	}
+
+	if err := writer.Close(); err != nil {
+		log.Printf("Failed to finish product export: %v", err)
+	}
+	return nil
+}
+
+// listProducts writes a page of the products matching filter, using keyset
+// pagination when after_id is given and offset pagination otherwise
+func (api *API) listProducts(c echo.Context, filter productFilter) error {
 	// Pagination
 	page, _ := strconv.Atoi(c.QueryParam("page"))
 	if page <= 0 {
@@ -138,25 +651,37 @@ func (api *API) getProducts(c echo.Context) error {
 	var products []models.Product
 	var total int64
 	
-	query := api.db.Model(&models.Product{})
-	
-	// Apply filters
-	if category := c.QueryParam("category"); category != "" {
-		query = query.Where("category_id = ?", category)
-	}
-	
-	if brand := c.QueryParam("brand"); brand != "" {
-		query = query.Where("brand_id = ?", brand)
-	}
-	
-	if active := c.QueryParam("active"); active != "" {
-		isActive := active == "true"
-		query = query.Where("is_active = ?", isActive)
-	}
+	query := api.service.productsQuery(c.Request().Context(), filter)
 	
 	// Count total
 	query.Count(&total)
 	
+	// Keyset pagination is preferred for deep scans since it doesn't degrade
+	// with large offsets and is stable while the crawler inserts new products
+	if afterIDStr := c.QueryParam("after_id"); afterIDStr != "" {
+		afterID, err := strconv.ParseUint(afterIDStr, 10, 32)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid after_id")
+		}
+		
+		if err := query.Where("id > ?", afterID).Order("id ASC").Limit(limit).Find(&products).Error; err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch products")
+		}
+		
+		// Only return a cursor when there may be more results
+		var nextCursor *uint
+		if len(products) == limit {
+			nextCursor = &products[len(products)-1].ID
+		}
+		
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"products":    products,
+			"total":       total,
+			"limit":       limit,
+			"next_cursor": nextCursor,
+		})
+	}
+	
 	// Get paginated results
 	if err := query.Limit(limit).Offset(offset).Find(&products).Error; err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch products")
@@ -175,24 +700,397 @@ func (api *API) getProducts(c echo.Context) error {
 func (api *API) getProductByID(c echo.Context) error {
 	id := c.Param("id")
 	
+	product, err := api.service.getProduct(c.Request().Context(), id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "Product not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch product")
+	}
+	
+	if notModified(c, productETag(product)) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	
+	return c.JSON(http.StatusOK, newProductResponse(*product))
+}
+
+// getProductReviews returns the reviews of a product with pagination, newest first
+func (api *API) getProductReviews(c echo.Context) error {
+	id := c.Param("id")
+	
+	// Pagination
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	if page <= 0 {
+		page = 1
+	}
+	
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	
+	offset := (page - 1) * limit
+	
+	// Check if product exists
 	var product models.Product
-	if err := api.db.
-		Preload("Category").
-		Preload("Brand").
-		Preload("Seller").
-		Preload("Images").
-		Preload("Videos").
-		Preload("Variants").
-		Preload("Attributes").
-		Where("external_id = ?", id).
-		First(&product).Error; err != nil {
+	if err := api.requestDB(c).Where("external_id = ?", id).First(&product).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return echo.NewHTTPError(http.StatusNotFound, "Product not found")
 		}
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch product")
 	}
 	
-	return c.JSON(http.StatusOK, product)
+	// Query
+	var reviews []models.Review
+	var total int64
+	
+	query := api.requestDB(c).Model(&models.Review{}).Where("product_id = ?", product.ID)
+	
+	// Count total
+	query.Count(&total)
+	
+	// Get paginated results
+	if err := query.Order("posted_at DESC").Limit(limit).Offset(offset).Find(&reviews).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch reviews")
+	}
+	
+	// Response
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"reviews": reviews,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// getSimilarProducts returns products in the same category as a product,
+// those sharing the most attribute values first
+func (api *API) getSimilarProducts(c echo.Context) error {
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit <= 0 || limit > maxSimilarLimit {
+		limit = defaultSimilarLimit
+	}
+
+	products, err := api.service.similarProducts(c.Request().Context(), c.Param("id"), limit)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "Product not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch similar products")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"products": products,
+	})
+}
+
+// getProductFacets returns the attribute values of the products in a category
+// with the number of products having each, narrowed by the listing filters
+func (api *API) getProductFacets(c echo.Context) error {
+	filter, err := parseProductFilter(c)
+	if err != nil {
+		return err
+	}
+	if filter.CategoryID == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "category is required")
+	}
+
+	facets, err := api.service.productFacets(c.Request().Context(), filter)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch facets")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"facets": facets,
+	})
+}
+
+// getStaleProducts returns the products not crawled within max_age, by
+// default the freshness SLA, the stalest first
+func (api *API) getStaleProducts(c echo.Context) error {
+	maxAge := api.config.Scraper.FreshnessSLA
+	if maxAgeStr := c.QueryParam("max_age"); maxAgeStr != "" {
+		parsed, err := time.ParseDuration(maxAgeStr)
+		if err != nil || parsed <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid max_age, expected a positive duration such as 30m")
+		}
+		maxAge = parsed
+	}
+
+	minPriority := 0
+	if minPriorityStr := c.QueryParam("min_priority"); minPriorityStr != "" {
+		parsed, err := strconv.Atoi(minPriorityStr)
+		if err != nil || parsed < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid min_priority")
+		}
+		minPriority = parsed
+	}
+
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit <= 0 || limit > maxStaleLimit {
+		limit = defaultStaleLimit
+	}
+
+	products, err := api.service.staleProducts(c.Request().Context(), maxAge, minPriority, limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch stale products")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"max_age_seconds": int64(maxAge.Seconds()),
+		"min_priority":    minPriority,
+		"products":        products,
+	})
+}
+
+// getProductOffers returns the offers of all sellers listing a product, cheapest first
+func (api *API) getProductOffers(c echo.Context) error {
+	id := c.Param("id")
+
+	// Check if product exists
+	var product models.Product
+	if err := api.requestDB(c).Where("external_id = ?", id).First(&product).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "Product not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch product")
+	}
+
+	var offers []models.SellerOffer
+	if err := api.requestDB(c).Preload("Seller").
+		Where("product_id = ?", product.ID).
+		Order("price ASC, id ASC").
+		Find(&offers).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch offers")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"offers": offers,
+		"total":  len(offers),
+	})
+}
+
+// getBundle returns the bundle a product is listed as, with the bundled products
+func (api *API) getBundle(c echo.Context) error {
+	bundle, err := api.service.getBundle(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "Bundle not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch bundle")
+	}
+
+	return c.JSON(http.StatusOK, bundle)
+}
+
+// bestPrice describes the lowest priced active variant of a product
+type bestPrice struct {
+	VariantID     uint    `json:"variant_id"`
+	Price         float64 `json:"price"`
+	OriginalPrice float64 `json:"original_price"`
+	DiscountRate  int     `json:"discount_rate"`
+}
+
+// productResponse is a product with fields computed from its variants
+type productResponse struct {
+	models.Product
+	BestPrice *bestPrice `json:"best_price"`
+	InStock   bool       `json:"in_stock"`
+}
+
+// newProductResponse computes the best price and stock status from the
+// product's preloaded variants
+func newProductResponse(product models.Product) productResponse {
+	response := productResponse{Product: product}
+	
+	for _, variant := range product.Variants {
+		if !variant.IsActive {
+			continue
+		}
+		
+		if variant.StockCount > 0 {
+			response.InStock = true
+		}
+		
+		if response.BestPrice == nil || variant.Price < response.BestPrice.Price {
+			response.BestPrice = &bestPrice{
+				VariantID:     variant.ID,
+				Price:         variant.Price,
+				OriginalPrice: variant.OriginalPrice,
+				DiscountRate:  variant.DiscountRate,
+			}
+		}
+	}
+	
+	return response
+}
+
+// maxBatchSize is the maximum number of products that can be fetched in one batch request
+const maxBatchSize = 100
+
+// getProductsBatch returns multiple products by external ID in request order
+func (api *API) getProductsBatch(c echo.Context) error {
+	var request struct {
+		ExternalIDs []string `json:"external_ids"`
+	}
+
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	// Validate batch size
+	if len(request.ExternalIDs) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "external_ids must not be empty")
+	}
+	if len(request.ExternalIDs) > maxBatchSize {
+		return echo.NewHTTPError(http.StatusBadRequest, "Batch size must not exceed "+strconv.Itoa(maxBatchSize))
+	}
+
+	var products []models.Product
+	if err := api.requestDB(c).
+		Preload("Category").
+		Preload("Brand").
+		Preload("Variants").
+		Where("external_id IN ?", request.ExternalIDs).
+		Find(&products).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch products")
+	}
+
+	// Index products by external ID to preserve the request order
+	productMap := make(map[string]models.Product, len(products))
+	for _, product := range products {
+		productMap[product.ExternalID] = product
+	}
+
+	found := make([]productResponse, 0, len(products))
+	notFound := make([]string, 0)
+	for _, id := range request.ExternalIDs {
+		if product, exists := productMap[id]; exists {
+			found = append(found, newProductResponse(product))
+		} else {
+			notFound = append(notFound, id)
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"products":  found,
+		"not_found": notFound,
+	})
+}
+
+// importFavorites adds the products listed in an uploaded CSV file to the
+// favorites of a user and raises their crawl priority, reporting each row as
+// added, skipped when already a favorite or not_found
+func (api *API) importFavorites(c echo.Context) error {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	// Bound the upload, allowing for the multipart framing around the file
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, maxFavoriteImportSize+4096)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "File must not exceed 1 MB")
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, "A CSV file is required in the file field")
+	}
+	if fileHeader.Size > maxFavoriteImportSize {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "File must not exceed 1 MB")
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Failed to read file")
+	}
+	defer file.Close()
+
+	results, err := parseFavoriteImport(file)
+	if err != nil {
+		if err == errTooManyImportRows {
+			return echo.NewHTTPError(http.StatusBadRequest, "File must not contain more than "+strconv.Itoa(maxFavoriteImportRows)+" products")
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid CSV file")
+	}
+	if len(results) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "File contains no products")
+	}
+
+	var userCount int64
+	if err := api.requestDB(c).Model(&models.User{}).Where("id = ?", userID).Count(&userCount).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch user")
+	}
+	if userCount == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "User not found")
+	}
+
+	// Resolve the listed products and the user's existing favorites up front
+	externalIDs := make([]string, 0, len(results))
+	for _, result := range results {
+		externalIDs = append(externalIDs, result.ExternalID)
+	}
+
+	var products []models.Product
+	if err := api.requestDB(c).Select("id", "external_id").
+		Where("external_id IN ?", externalIDs).
+		Find(&products).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch products")
+	}
+	productIDs := make(map[string]uint, len(products))
+	for _, product := range products {
+		productIDs[product.ExternalID] = product.ID
+	}
+
+	var favoriteIDs []uint
+	if err := api.requestDB(c).Model(&models.UserFavorite{}).
+		Where("user_id = ?", userID).
+		Pluck("product_id", &favoriteIDs).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch favorites")
+	}
+	favorited := make(map[uint]bool, len(favoriteIDs))
+	for _, id := range favoriteIDs {
+		favorited[id] = true
+	}
+
+	var favorites []models.UserFavorite
+	counts := make(map[string]int, 3)
+	for i := range results {
+		result := &results[i]
+		productID, exists := productIDs[result.ExternalID]
+		switch {
+		case !exists:
+			result.Status = favoriteImportNotFound
+		case favorited[productID]:
+			result.Status = favoriteImportSkipped
+		default:
+			result.Status = favoriteImportAdded
+			favorited[productID] = true
+			favorites = append(favorites, models.UserFavorite{UserID: uint(userID), ProductID: productID})
+		}
+		counts[result.Status]++
+	}
+
+	if len(favorites) > 0 {
+		if err := api.requestDB(c).Create(&favorites).Error; err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create user favorites")
+		}
+	}
+
+	// Favorited products are crawled at favorite priority
+	for externalID := range productIDs {
+		api.service.setPriority(externalID, favoritePriority)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"added":     counts[favoriteImportAdded],
+		"skipped":   counts[favoriteImportSkipped],
+		"not_found": counts[favoriteImportNotFound],
+		"results":   results,
+	})
 }
 
 // updateProductPriority updates the priority of a product
@@ -215,7 +1113,7 @@ func (api *API) updateProductPriority(c echo.Context) error {
 	
 	// Check if product exists
 	var product models.Product
-	if err := api.db.Where("external_id = ?", id).First(&product).Error; err != nil {
+	if err := api.requestDB(c).Where("external_id = ?", id).First(&product).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return echo.NewHTTPError(http.StatusNotFound, "Product not found")
 		}
@@ -223,9 +1121,7 @@ func (api *API) updateProductPriority(c echo.Context) error {
 	}
 	
 	// Update priority in service
-	api.service.priorityMux.Lock()
-	api.service.priorityList[id] = request.Priority
-	api.service.priorityMux.Unlock()
+	api.service.setPriority(id, request.Priority)
 	
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"success":  true,
@@ -235,50 +1131,88 @@ func (api *API) updateProductPriority(c echo.Context) error {
 	})
 }
 
+// idempotencyKeyHeader is the request header used to deduplicate crawl triggers
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// withIdempotency runs a crawl trigger once per Idempotency-Key, replaying the
+// original response for repeated keys within the TTL
+func (api *API) withIdempotency(c echo.Context, trigger func() (map[string]interface{}, error)) error {
+	var response map[string]interface{}
+	var err error
+	
+	if key := c.Request().Header.Get(idempotencyKeyHeader); key != "" {
+		// Scope keys to the route so the same key can't collide across endpoints
+		response, err = api.idempotency.do(c.Request().URL.Path+"|"+key, trigger)
+	} else {
+		response, err = trigger()
+	}
+	if err != nil {
+		return err
+	}
+	
+	return c.JSON(http.StatusOK, response)
+}
+
 // crawlCategory triggers crawling for a specific category
 func (api *API) crawlCategory(c echo.Context) error {
 	id := c.Param("id")
 	
-	// Check if category exists
-	var category models.Category
-	if err := api.db.Where("external_id = ?", id).First(&category).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return echo.NewHTTPError(http.StatusNotFound, "Category not found")
-		}
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch category")
-	}
-	
-	// Trigger crawling in background
-	go func() {
-		productIDs, err := api.service.scraper.GetProductIDsByCategory(id)
-		if err != nil {
-			api.echo.Logger.Errorf("Error crawling category %s: %v", id, err)
-			return
+	return api.withIdempotency(c, func() (map[string]interface{}, error) {
+		// Check if category exists
+		var category models.Category
+		if err := api.requestDB(c).Where("external_id = ?", id).First(&category).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, echo.NewHTTPError(http.StatusNotFound, "Category not found")
+			}
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch category")
 		}
 		
-		// Process each product
-		for _, productID := range productIDs {
-			product, err := api.service.scraper.GetProductDetails(productID)
-			if err != nil {
-				api.echo.Logger.Errorf("Error getting product details for ID %s: %v", productID, err)
-				continue
+		// Crawl its subcategories too, down to the configured depth
+		categories := []models.Category{category}
+		if api.service.crawlMaxDepth() > 1 {
+			var all []models.Category
+			if err := api.requestDB(c).Find(&all).Error; err != nil {
+				return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch categories")
 			}
+			categories = withSubcategories(all, categories, api.service.crawlMaxDepth())
+		}
+		
+		job := api.jobs.create("category", id)
+		
+		// Queue crawling in background
+		if err := api.runCrawl(c, func(ctx context.Context) {
+			api.jobs.start(job.ID)
 			
-			// Save product
-			if err := api.service.saveProduct(product); err != nil {
-				api.echo.Logger.Errorf("Error saving product: %v", err)
+			for _, category := range categories {
+				productIDs, err := api.service.source.GetProductIDsByCategory(category.ExternalID)
+				if err != nil {
+					api.echo.Logger.Errorf("Error crawling category %s: %v", category.ExternalID, err)
+					api.jobs.finish(job.ID, err)
+					return
+				}
+				
+				// Process each product, stopping between products on shutdown or timeout
+				for _, productID := range productIDs {
+					if ctx.Err() != nil {
+						api.echo.Logger.Errorf("Stopped crawling category %s: %v", id, ctx.Err())
+						api.jobs.finish(job.ID, ctx.Err())
+						return
+					}
+					api.jobs.recordProduct(job.ID, api.service.crawlProduct(ctx, productID))
+				}
 			}
 			
-			// Publish product update
-			if err := api.service.publishProductUpdate(context.Background(), product); err != nil {
-				api.echo.Logger.Errorf("Error publishing product update: %v", err)
-			}
+			api.jobs.finish(job.ID, nil)
+		}); err != nil {
+			api.jobs.remove(job.ID)
+			return nil, err
 		}
-	}()
-	
-	return c.JSON(http.StatusOK, map[string]interface{}{
-		"success": true,
-		"message": "Crawling started for category: " + category.Name,
+		
+		return map[string]interface{}{
+			"success": true,
+			"message": "Crawling started for category: " + category.Name,
+			"job_id":  job.ID,
+		}, nil
 	})
 }
 
@@ -286,27 +1220,80 @@ func (api *API) crawlCategory(c echo.Context) error {
 func (api *API) crawlProduct(c echo.Context) error {
 	id := c.Param("id")
 	
-	// Trigger crawling in background
-	go func() {
-		product, err := api.service.scraper.GetProductDetails(id)
-		if err != nil {
-			api.echo.Logger.Errorf("Error getting product details for ID %s: %v", id, err)
-			return
+	return api.withIdempotency(c, func() (map[string]interface{}, error) {
+		job := api.jobs.create("product", id)
+		
+		// Queue crawling in background
+		if err := api.runCrawl(c, func(ctx context.Context) {
+			api.jobs.start(job.ID)
+			
+			err := api.service.crawlProduct(ctx, id)
+			api.jobs.recordProduct(job.ID, err)
+			api.jobs.finish(job.ID, err)
+		}); err != nil {
+			api.jobs.remove(job.ID)
+			return nil, err
 		}
 		
-		// Save product
-		if err := api.service.saveProduct(product); err != nil {
-			api.echo.Logger.Errorf("Error saving product: %v", err)
+		return map[string]interface{}{
+			"success": true,
+			"message": "Crawling started for product: " + id,
+			"job_id":  job.ID,
+		}, nil
+	})
+}
+
+// crawlFavorites triggers a refresh of every favorited product
+func (api *API) crawlFavorites(c echo.Context) error {
+	return api.withIdempotency(c, func() (map[string]interface{}, error) {
+		productIDs, err := api.service.favoriteProductIDs()
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch favorited products")
 		}
 		
-		// Publish product update
-		if err := api.service.publishProductUpdate(context.Background(), product); err != nil {
-			api.echo.Logger.Errorf("Error publishing product update: %v", err)
+		job := api.jobs.create("favorites", "")
+		
+		// Queue crawling in background through the worker pool
+		if err := api.runCrawl(c, func(ctx context.Context) {
+			api.jobs.start(job.ID)
+			
+			api.service.crawlProducts(ctx, productIDs, func(err error) {
+				api.jobs.recordProduct(job.ID, err)
+			})
+			
+			api.jobs.finish(job.ID, ctx.Err())
+		}); err != nil {
+			api.jobs.remove(job.ID)
+			return nil, err
 		}
-	}()
+		
+		return map[string]interface{}{
+			"success":  true,
+			"message":  "Crawling started for favorited products",
+			"products": len(productIDs),
+			"job_id":   job.ID,
+		}, nil
+	})
+}
+
+// getJob returns the status of a background crawl job
+func (api *API) getJob(c echo.Context) error {
+	job, exists := api.jobs.get(c.Param("job_id"))
+	if !exists {
+		return echo.NewHTTPError(http.StatusNotFound, "Job not found")
+	}
 	
+	return c.JSON(http.StatusOK, job)
+}
+
+// reload reloads the crawl priorities of favorited products from the database
+func (api *API) reload(c echo.Context) error {
+	count, err := api.service.loadPriorityList()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to reload priority list").SetInternal(err)
+	}
+
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"success": true,
-		"message": "Crawling started for product: " + id,
+		"favorite_priorities": count,
 	})
-}
\ No newline at end of file
+}
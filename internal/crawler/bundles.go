@@ -0,0 +1,91 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/e-commerce/platform/internal/common/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// saveBundle upserts the bundle a saved product is listed as and its items,
+// deleting items no longer in it, or deletes the bundle of a product that is no
+// longer listed as one. Items of any bundle containing the product are linked
+// to it, as bundles may be crawled before the products they contain.
+func saveBundle(tx *gorm.DB, product *models.Product) error {
+	if err := tx.Model(&models.BundleItem{}).
+		Where("product_external_id = ? AND product_id IS NULL", product.ExternalID).
+		Update("product_id", product.ID).Error; err != nil {
+		return fmt.Errorf("failed to link bundle items: %w", err)
+	}
+
+	if product.Bundle == nil {
+		if err := tx.Where("product_id = ?", product.ID).Delete(&models.Bundle{}).Error; err != nil {
+			return fmt.Errorf("failed to delete bundle: %w", err)
+		}
+		return nil
+	}
+
+	bundle := product.Bundle
+	bundle.ProductID = product.ID
+	if err := tx.Omit("Items").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "product_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"price", "original_price", "currency", "updated_at", "deleted_at"}),
+	}).Create(bundle).Error; err != nil {
+		return fmt.Errorf("failed to save bundle: %w", err)
+	}
+
+	externalIDs := make([]string, 0, len(bundle.Items))
+	for _, item := range bundle.Items {
+		externalIDs = append(externalIDs, item.ProductExternalID)
+	}
+
+	// Link items to the bundled products that were already crawled
+	var bundled []models.Product
+	if err := tx.Select("id", "external_id").Where("external_id IN ?", externalIDs).Find(&bundled).Error; err != nil {
+		return fmt.Errorf("failed to fetch bundled products: %w", err)
+	}
+	productIDs := make(map[string]uint, len(bundled))
+	for _, p := range bundled {
+		productIDs[p.ExternalID] = p.ID
+	}
+
+	for i := range bundle.Items {
+		item := &bundle.Items[i]
+		item.BundleID = bundle.ID
+		if id, exists := productIDs[item.ProductExternalID]; exists {
+			item.ProductID = &id
+		}
+		if err := tx.Omit("Product").Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "bundle_id"}, {Name: "product_external_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"product_id", "quantity", "updated_at", "deleted_at"}),
+		}).Create(item).Error; err != nil {
+			return fmt.Errorf("failed to save bundle item: %w", err)
+		}
+	}
+
+	if err := tx.Where("bundle_id = ? AND product_external_id NOT IN ?", bundle.ID, externalIDs).
+		Delete(&models.BundleItem{}).Error; err != nil {
+		return fmt.Errorf("failed to delete stale bundle items: %w", err)
+	}
+	return nil
+}
+
+// getBundle fetches the bundle a product is listed as, with the product and
+// the bundled products with their variants
+func (s *Service) getBundle(ctx context.Context, externalID string) (*models.Bundle, error) {
+	var bundle models.Bundle
+	if err := s.db.WithContext(ctx).
+		Joins("JOIN products ON products.id = bundles.product_id").
+		Preload("Items", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id ASC")
+		}).
+		Preload("Items.Product").
+		Preload("Items.Product.Variants").
+		Where("products.external_id = ? AND products.deleted_at IS NULL", externalID).
+		First(&bundle).Error; err != nil {
+		return nil, err
+	}
+	return &bundle, nil
+}
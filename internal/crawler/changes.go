@@ -0,0 +1,93 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/e-commerce/platform/internal/common/models"
+	"gorm.io/gorm"
+)
+
+// productChanges returns the change events between the stored state of a
+// product and its crawled state, which is saved as the given version.
+// existingVariants are the stored variants by external ID; new variants have
+// no previous values and produce no events.
+func productChanges(existing, product *models.Product, existingVariants map[string]models.Variant, version int, changedAt time.Time) []models.ProductChangeEvent {
+	var changes []models.ProductChangeEvent
+	add := func(variantExternalID, field, oldValue, newValue string) {
+		if oldValue == newValue {
+			return
+		}
+		changes = append(changes, models.ProductChangeEvent{
+			ProductID:         existing.ID,
+			Version:           version,
+			VariantExternalID: variantExternalID,
+			Field:             field,
+			OldValue:          oldValue,
+			NewValue:          newValue,
+			ChangedAt:         changedAt,
+		})
+	}
+
+	add("", "name", existing.Name, product.Name)
+	add("", "description", existing.Description, product.Description)
+	add("", "url", existing.URL, product.URL)
+	add("", "is_active", strconv.FormatBool(existing.IsActive), strconv.FormatBool(product.IsActive))
+
+	for _, variant := range product.Variants {
+		existingVariant, exists := existingVariants[variant.ExternalID]
+		if !exists {
+			continue
+		}
+		if priceChanged(existingVariant.Price, variant.Price) {
+			add(variant.ExternalID, "price", formatPrice(existingVariant.Price), formatPrice(variant.Price))
+		}
+		add(variant.ExternalID, "stock_count", strconv.Itoa(existingVariant.StockCount), strconv.Itoa(variant.StockCount))
+	}
+
+	return changes
+}
+
+// formatPrice formats a price for a change event
+func formatPrice(price float64) string {
+	return strconv.FormatFloat(price, 'f', -1, 64)
+}
+
+// saveChangeOutbox saves the change events of a product to the outbox in the
+// transaction saving the product, keyed by product so the events of a product
+// are consumed in order. It returns the saved messages, to publish once the
+// transaction committed.
+func saveChangeOutbox(tx *gorm.DB, topic string, changes []models.ProductChangeEvent, batchSize int) ([]models.OutboxMessage, error) {
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	messages := make([]models.OutboxMessage, len(changes))
+	for i, change := range changes {
+		payload, err := json.Marshal(change)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal product change: %w", err)
+		}
+		messages[i] = models.OutboxMessage{
+			Topic:   topic,
+			Key:     strconv.FormatUint(uint64(change.ProductID), 10),
+			Payload: string(payload),
+		}
+	}
+	if err := tx.CreateInBatches(&messages, batchSize).Error; err != nil {
+		return nil, fmt.Errorf("failed to save product changes to the outbox: %w", err)
+	}
+	return messages, nil
+}
+
+// publishProductCreated publishes the full snapshot of a product saved for the
+// first time, keyed by its external ID. Later saves publish only updates.
+func (s *Service) publishProductCreated(ctx context.Context, product *models.Product) {
+	if err := s.kafka.PublishMessage(ctx, s.config.Kafka.CreatedTopic, product.ExternalID, product); err != nil {
+		log.Printf("Error publishing creation of product %s: %v", product.ExternalID, err)
+	}
+}
@@ -0,0 +1,83 @@
+package crawler
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/e-commerce/platform/internal/common/db/dbtest"
+	"github.com/e-commerce/platform/internal/common/models"
+)
+
+func TestProductChanges(t *testing.T) {
+	existing := &models.Product{Name: "Phone", Description: "A phone", URL: "/phone", IsActive: true}
+	existing.ID = 7
+	existingVariants := map[string]models.Variant{
+		"v1": {ExternalID: "v1", Price: 100, StockCount: 5},
+	}
+
+	tests := []struct {
+		name    string
+		product models.Product
+		fields  []string
+	}{
+		{"unchanged", models.Product{Name: "Phone", Description: "A phone", URL: "/phone", IsActive: true,
+			Variants: []models.Variant{{ExternalID: "v1", Price: 100, StockCount: 5}}}, nil},
+		{"renamed", models.Product{Name: "Smartphone", Description: "A phone", URL: "/phone", IsActive: true}, []string{"name"}},
+		{"deactivated", models.Product{Name: "Phone", Description: "A phone", URL: "/phone"}, []string{"is_active"}},
+		{"variant changed", models.Product{Name: "Phone", Description: "A phone", URL: "/phone", IsActive: true,
+			Variants: []models.Variant{{ExternalID: "v1", Price: 90, StockCount: 3}}}, []string{"price", "stock_count"}},
+		{"new variant", models.Product{Name: "Phone", Description: "A phone", URL: "/phone", IsActive: true,
+			Variants: []models.Variant{{ExternalID: "v2", Price: 90, StockCount: 3}}}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := productChanges(existing, &tt.product, existingVariants, 3, time.Now())
+			if len(changes) != len(tt.fields) {
+				t.Fatalf("got %d changes, want %d: %+v", len(changes), len(tt.fields), changes)
+			}
+			for i, change := range changes {
+				if change.Field != tt.fields[i] || change.ProductID != existing.ID || change.Version != 3 {
+					t.Errorf("change %d = %+v, want field %s of product %d version 3", i, change, tt.fields[i], existing.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestSaveChangeOutbox(t *testing.T) {
+	database := dbtest.Open(t)
+
+	changes := []models.ProductChangeEvent{
+		{ProductID: 7, Version: 3, Field: "name", OldValue: "Phone", NewValue: "Smartphone"},
+		{ProductID: 7, Version: 3, VariantExternalID: "v1", Field: "price", OldValue: "100", NewValue: "90"},
+	}
+	saved, err := saveChangeOutbox(database.DB, "product-changes", changes, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != len(changes) {
+		t.Fatalf("saved %d messages, want %d", len(saved), len(changes))
+	}
+
+	var messages []models.OutboxMessage
+	if err := database.Order("id").Find(&messages).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != len(changes) {
+		t.Fatalf("outbox holds %d messages, want %d", len(messages), len(changes))
+	}
+	for i, message := range messages {
+		if message.ID != saved[i].ID || message.Topic != "product-changes" || message.Key != "7" {
+			t.Errorf("message %d = %+v", i, message)
+		}
+		var change models.ProductChangeEvent
+		if err := json.Unmarshal([]byte(message.Payload), &change); err != nil {
+			t.Fatalf("message %d payload: %v", i, err)
+		}
+		if change.Field != changes[i].Field || change.NewValue != changes[i].NewValue {
+			t.Errorf("message %d carries %+v, want %+v", i, change, changes[i])
+		}
+	}
+}
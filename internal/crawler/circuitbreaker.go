@@ -0,0 +1,152 @@
+package crawler
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Circuit breaker states
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+)
+
+// circuitStateValues are the values of the scraper_circuit_state gauge
+var circuitStateValues = map[string]float64{
+	circuitClosed:   0,
+	circuitHalfOpen: 1,
+	circuitOpen:     2,
+}
+
+// Metrics of the scraper circuit breaker
+var (
+	circuitStateGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "scraper_circuit_state",
+		Help: "State of the scraper circuit breaker: 0 closed, 1 half-open, 2 open",
+	})
+	circuitTripsCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "scraper_circuit_trips_total",
+		Help: "Number of times the scraper circuit breaker opened",
+	})
+)
+
+// errCircuitOpen is returned instead of sending a request while the circuit is open
+var errCircuitOpen = errors.New("scraper circuit breaker is open")
+
+// circuitReporter is implemented by product sources that guard their requests
+// with a circuit breaker
+type circuitReporter interface {
+	// CircuitState returns the state of the circuit breaker and how often it tripped
+	CircuitState() (state string, trips int64)
+}
+
+// circuitBreaker stops requests to a failing target. It opens after
+// failureThreshold consecutive failures, rejects requests for cooldown, then
+// lets a single probe through (half-open): the probe closes the circuit on
+// success and reopens it on failure. A zero threshold disables the breaker.
+type circuitBreaker struct {
+	failureThreshold int
+	cooldown         time.Duration
+	state            string
+	failures         int
+	openedAt         time.Time
+	probing          bool
+	trips            int64
+	mu               sync.Mutex
+}
+
+// newCircuitBreaker creates a new closed circuit breaker
+func newCircuitBreaker(failureThreshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		state:            circuitClosed,
+	}
+}
+
+// allow returns errCircuitOpen if a request must not be sent now
+func (b *circuitBreaker) allow() error {
+	if b.failureThreshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return errCircuitOpen
+		}
+		b.setState(circuitHalfOpen)
+		b.probing = true
+		log.Printf("Scraper circuit breaker half-open, probing the target")
+		return nil
+	case circuitHalfOpen:
+		// Only one probe at a time
+		if b.probing {
+			return errCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// record updates the breaker with the outcome of an allowed request
+func (b *circuitBreaker) record(success bool) {
+	if b.failureThreshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if success {
+		if b.state != circuitClosed {
+			log.Printf("Scraper circuit breaker closed")
+		}
+		b.setState(circuitClosed)
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.failureThreshold {
+		b.setState(circuitOpen)
+		b.openedAt = time.Now()
+		b.failures = 0
+		b.trips++
+		circuitTripsCounter.Inc()
+		log.Printf("Scraper circuit breaker open for %s after failed requests", b.cooldown)
+	}
+}
+
+// setState changes the state and exports it, with b.mu held
+func (b *circuitBreaker) setState(state string) {
+	b.state = state
+	circuitStateGauge.Set(circuitStateValues[state])
+}
+
+// cancel releases an allowed request that never got a response from the
+// target, without counting it as a success or failure
+func (b *circuitBreaker) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// snapshot returns the current state and the number of times the breaker tripped
+func (b *circuitBreaker) snapshot() (string, int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state, b.trips
+}
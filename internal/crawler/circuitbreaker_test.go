@@ -0,0 +1,96 @@
+package crawler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// metricValue returns the value of a gauge or counter
+func metricValue(t *testing.T, metric prometheus.Metric) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := metric.Write(&m); err != nil {
+		t.Fatalf("failed to read metric: %v", err)
+	}
+	if m.Counter != nil {
+		return m.Counter.GetValue()
+	}
+	return m.Gauge.GetValue()
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		outcomes  []bool // Outcomes of allowed requests, in order
+		state     string
+		trips     int64
+	}{
+		{"closed while succeeding", 2, []bool{true, true, true}, circuitClosed, 0},
+		{"failures below the threshold", 3, []bool{false, false}, circuitClosed, 0},
+		{"success resets the failures", 2, []bool{false, true, false}, circuitClosed, 0},
+		{"opens at the threshold", 2, []bool{false, false}, circuitOpen, 1},
+		{"disabled", 0, []bool{false, false, false}, circuitClosed, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newCircuitBreaker(tt.threshold, time.Hour)
+			for _, success := range tt.outcomes {
+				if err := b.allow(); err != nil {
+					t.Fatalf("request refused: %v", err)
+				}
+				b.record(success)
+			}
+
+			state, trips := b.snapshot()
+			if state != tt.state || trips != tt.trips {
+				t.Errorf("state = %s with %d trips, want %s with %d", state, trips, tt.state, tt.trips)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerProbe(t *testing.T) {
+	trips := metricValue(t, circuitTripsCounter)
+	b := newCircuitBreaker(1, 10*time.Millisecond)
+
+	b.allow()
+	b.record(false)
+	if err := b.allow(); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("open circuit allowed a request: %v", err)
+	}
+	if got := metricValue(t, circuitStateGauge); got != circuitStateValues[circuitOpen] {
+		t.Errorf("state gauge = %v while open", got)
+	}
+	if got := metricValue(t, circuitTripsCounter); got != trips+1 {
+		t.Errorf("trips counter = %v, want %v", got, trips+1)
+	}
+
+	// After the cooldown a single probe is let through
+	time.Sleep(20 * time.Millisecond)
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe refused after cooldown: %v", err)
+	}
+	if err := b.allow(); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("second request allowed while probing: %v", err)
+	}
+
+	// A cancelled probe frees the slot without closing the circuit
+	b.cancel()
+	if err := b.allow(); err != nil {
+		t.Fatalf("probe refused after the previous one was cancelled: %v", err)
+	}
+
+	b.record(true)
+	if state, _ := b.snapshot(); state != circuitClosed {
+		t.Errorf("state = %s after a successful probe, want closed", state)
+	}
+	if got := metricValue(t, circuitStateGauge); got != circuitStateValues[circuitClosed] {
+		t.Errorf("state gauge = %v after closing", got)
+	}
+}
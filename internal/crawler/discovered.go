@@ -0,0 +1,78 @@
+package crawler
+
+import (
+	"log"
+	"time"
+)
+
+// discoveredProductTTL is how long a related product stays queued for a crawl
+// without being crawled
+const discoveredProductTTL = 24 * time.Hour
+
+// queueDiscovered queues related products not crawled yet with the regular
+// priority products, up to MaxDiscoveredProducts at a time. Products already
+// in the priority list keep their priority.
+func (s *Service) queueDiscovered(productIDs []string) {
+	if len(productIDs) == 0 {
+		return
+	}
+
+	s.priorityMux.Lock()
+	defer s.priorityMux.Unlock()
+
+	now := time.Now()
+	skipped := 0
+	for _, productID := range productIDs {
+		if _, exists := s.priorityList[productID]; exists {
+			continue
+		}
+		if len(s.discovered) >= s.config.Scraper.MaxDiscoveredProducts {
+			skipped++
+			continue
+		}
+		s.priorityList[productID] = defaultPriority
+		s.discovered[productID] = now
+	}
+	if skipped > 0 {
+		log.Printf("Skipped queueing %d related products, %d are queued already", skipped, len(s.discovered))
+	}
+}
+
+// forgetDiscovered takes a crawled product off the related products queued
+// for a crawl
+func (s *Service) forgetDiscovered(productID string) {
+	s.priorityMux.Lock()
+	defer s.priorityMux.Unlock()
+	s.dropDiscovered(productID)
+}
+
+// expireDiscovered takes the related products queued before cutoff and still
+// not crawled off the queue
+func (s *Service) expireDiscovered(cutoff time.Time) {
+	s.priorityMux.Lock()
+	defer s.priorityMux.Unlock()
+
+	expired := 0
+	for productID, queuedAt := range s.discovered {
+		if queuedAt.Before(cutoff) {
+			s.dropDiscovered(productID)
+			expired++
+		}
+	}
+	if expired > 0 {
+		log.Printf("Expired %d related products never crawled", expired)
+	}
+}
+
+// dropDiscovered removes a related product from the queue, with priorityMux
+// held. Products prioritized since they were queued, such as favorited ones,
+// stay in the priority list.
+func (s *Service) dropDiscovered(productID string) {
+	if _, exists := s.discovered[productID]; !exists {
+		return
+	}
+	delete(s.discovered, productID)
+	if s.priorityList[productID] == defaultPriority {
+		delete(s.priorityList, productID)
+	}
+}
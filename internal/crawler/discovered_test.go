@@ -0,0 +1,77 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/e-commerce/platform/internal/common/config"
+)
+
+// newTestService returns a crawler service without a database, Kafka or source
+func newTestService(scraper config.ScraperConfig) *Service {
+	return NewCrawlerService(nil, nil, &config.Config{Scraper: scraper}, nil)
+}
+
+func TestQueueDiscovered(t *testing.T) {
+	tests := []struct {
+		name        string
+		max         int
+		prioritized map[string]int
+		queue       []string
+		want        map[string]int
+		discovered  int
+	}{
+		{"queued", 10, nil, []string{"1", "2"}, map[string]int{"1": defaultPriority, "2": defaultPriority}, 2},
+		{"capped", 2, nil, []string{"1", "2", "3"}, map[string]int{"1": defaultPriority, "2": defaultPriority}, 2},
+		{"disabled", 0, nil, []string{"1"}, map[string]int{}, 0},
+		{"already prioritized", 10, map[string]int{"1": favoritePriority}, []string{"1", "2"},
+			map[string]int{"1": favoritePriority, "2": defaultPriority}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(config.ScraperConfig{MaxDiscoveredProducts: tt.max})
+			for productID, priority := range tt.prioritized {
+				s.setPriority(productID, priority)
+			}
+
+			s.queueDiscovered(tt.queue)
+			if len(s.priorityList) != len(tt.want) {
+				t.Errorf("priority list = %v, want %v", s.priorityList, tt.want)
+			}
+			for productID, priority := range tt.want {
+				if s.priorityList[productID] != priority {
+					t.Errorf("priority of %s = %d, want %d", productID, s.priorityList[productID], priority)
+				}
+			}
+			if len(s.discovered) != tt.discovered {
+				t.Errorf("%d products discovered, want %d", len(s.discovered), tt.discovered)
+			}
+		})
+	}
+}
+
+func TestDiscoveredLeaveQueue(t *testing.T) {
+	s := newTestService(config.ScraperConfig{MaxDiscoveredProducts: 10})
+	s.queueDiscovered([]string{"crawled", "stale", "favorited"})
+	s.setPriority("favorited", favoritePriority)
+
+	s.forgetDiscovered("crawled")
+	s.discovered["stale"] = time.Now().Add(-2 * discoveredProductTTL)
+	s.discovered["favorited"] = time.Now().Add(-2 * discoveredProductTTL)
+	s.expireDiscovered(time.Now().Add(-discoveredProductTTL))
+
+	if len(s.discovered) != 0 {
+		t.Errorf("discovered = %v, want none", s.discovered)
+	}
+	// Products prioritized since they were discovered keep their priority
+	if len(s.priorityList) != 1 || s.priorityList["favorited"] != favoritePriority {
+		t.Errorf("priority list = %v, want only the favorited product", s.priorityList)
+	}
+
+	// Room freed by crawled and expired products is used again
+	s.queueDiscovered([]string{"new"})
+	if s.priorityList["new"] != defaultPriority {
+		t.Errorf("new product wasn't queued: %v", s.priorityList)
+	}
+}
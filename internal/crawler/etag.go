@@ -0,0 +1,86 @@
+package crawler
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/e-commerce/platform/internal/common/models"
+	"github.com/labstack/echo/v4"
+)
+
+// etagBuilder hashes the versioning fields of a response into an ETag
+type etagBuilder struct {
+	buf []byte
+}
+
+// addUint adds an ID or counter to the ETag
+func (b *etagBuilder) addUint(v uint64) {
+	b.buf = binary.BigEndian.AppendUint64(b.buf, v)
+}
+
+// addTime adds a timestamp to the ETag
+func (b *etagBuilder) addTime(t time.Time) {
+	b.addUint(uint64(t.UnixNano()))
+}
+
+// String returns the quoted strong ETag
+func (b *etagBuilder) String() string {
+	sum := sha256.Sum256(b.buf)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// productETag computes an ETag that changes whenever the product or any of its
+// variants is updated, including price and stock changes
+func productETag(product *models.Product) string {
+	var b etagBuilder
+	b.addUint(uint64(product.ID))
+	b.addTime(product.UpdatedAt)
+	b.addTime(product.LastUpdated)
+	b.addUint(uint64(len(product.Variants)))
+	for _, variant := range product.Variants {
+		b.addUint(uint64(variant.ID))
+		b.addTime(variant.UpdatedAt)
+	}
+	// Relations to products crawled later are linked without updating the product
+	b.addUint(uint64(len(product.RelatedProducts)))
+	for _, related := range product.RelatedProducts {
+		b.addUint(uint64(related.ID))
+	}
+	return b.String()
+}
+
+// categoriesETag computes an ETag for a list of categories
+func categoriesETag(categories []models.Category) string {
+	var b etagBuilder
+	b.addUint(uint64(len(categories)))
+	for _, category := range categories {
+		b.addUint(uint64(category.ID))
+		b.addTime(category.UpdatedAt)
+	}
+	return b.String()
+}
+
+// notModified sets the ETag header and reports whether the request's
+// If-None-Match header matches it, in which case a 304 should be returned
+func notModified(c echo.Context, etag string) bool {
+	c.Response().Header().Set("ETag", etag)
+
+	ifNoneMatch := c.Request().Header.Get("If-None-Match")
+	if ifNoneMatch == "" {
+		return false
+	}
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		// Weak comparison, as a W/ prefix may be added by intermediaries
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package crawler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/e-commerce/platform/internal/common/models"
+)
+
+// exportBatchSize is the number of products loaded at a time while exporting
+const exportBatchSize = 500
+
+// exportRow is a product flattened for export, with its variants reduced to
+// the lowest active price and the total stock
+type exportRow struct {
+	ID            uint      `json:"id"`
+	ExternalID    string    `json:"external_id"`
+	Name          string    `json:"name"`
+	URL           string    `json:"url"`
+	Category      string    `json:"category"`
+	Brand         string    `json:"brand"`
+	IsActive      bool      `json:"is_active"`
+	Price         *float64  `json:"price"`
+	OriginalPrice *float64  `json:"original_price"`
+	DiscountRate  *int      `json:"discount_rate"`
+	Currency      string    `json:"currency"`
+	StockCount    int       `json:"stock_count"`
+	InStock       bool      `json:"in_stock"`
+	Rating        float64   `json:"rating"`
+	RatingCount   int       `json:"rating_count"`
+	LastUpdated   time.Time `json:"last_updated"`
+}
+
+// exportColumns is the CSV header row, in the order of exportRow.record
+var exportColumns = []string{
+	"id", "external_id", "name", "url", "category", "brand", "is_active", "price", "original_price",
+	"discount_rate", "currency", "stock_count", "in_stock", "rating", "rating_count", "last_updated",
+}
+
+// newExportRow flattens a product with its category, brand and variants preloaded
+func newExportRow(product models.Product) exportRow {
+	response := newProductResponse(product)
+	row := exportRow{
+		ID:          product.ID,
+		ExternalID:  product.ExternalID,
+		Name:        product.Name,
+		URL:         product.URL,
+		Category:    product.Category.Name,
+		Brand:       product.Brand.Name,
+		IsActive:    product.IsActive,
+		InStock:     response.InStock,
+		Rating:      product.Rating,
+		RatingCount: product.RatingCount,
+		LastUpdated: product.LastUpdated,
+	}
+
+	if best := response.BestPrice; best != nil {
+		row.Price = &best.Price
+		row.OriginalPrice = &best.OriginalPrice
+		row.DiscountRate = &best.DiscountRate
+	}
+
+	for _, variant := range product.Variants {
+		if !variant.IsActive {
+			continue
+		}
+		row.StockCount += variant.StockCount
+		if response.BestPrice != nil && variant.ID == response.BestPrice.VariantID {
+			row.Currency = variant.Currency
+		}
+	}
+
+	return row
+}
+
+// record returns the row as CSV fields, leaving prices of products without
+// an active variant empty
+func (r exportRow) record() []string {
+	var price, originalPrice, discountRate string
+	if r.Price != nil {
+		price = strconv.FormatFloat(*r.Price, 'f', -1, 64)
+		originalPrice = strconv.FormatFloat(*r.OriginalPrice, 'f', -1, 64)
+		discountRate = strconv.Itoa(*r.DiscountRate)
+	}
+
+	return []string{
+		strconv.FormatUint(uint64(r.ID), 10),
+		r.ExternalID,
+		r.Name,
+		r.URL,
+		r.Category,
+		r.Brand,
+		strconv.FormatBool(r.IsActive),
+		price,
+		originalPrice,
+		discountRate,
+		r.Currency,
+		strconv.Itoa(r.StockCount),
+		strconv.FormatBool(r.InStock),
+		strconv.FormatFloat(r.Rating, 'f', -1, 64),
+		strconv.Itoa(r.RatingCount),
+		r.LastUpdated.Format(time.RFC3339),
+	}
+}
+
+// exportWriter writes export rows in one of the export formats
+type exportWriter interface {
+	// Write writes a row
+	Write(row exportRow) error
+	// Flush writes any buffered rows
+	Flush() error
+	// Close finishes the export after the last row
+	Close() error
+}
+
+// csvExportWriter writes rows as CSV with a header row
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+// newCSVExportWriter creates a CSV export writer, writing the header row
+func newCSVExportWriter(w io.Writer) (*csvExportWriter, error) {
+	writer := &csvExportWriter{w: csv.NewWriter(w)}
+	if err := writer.w.Write(exportColumns); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// Write writes a row
+func (e *csvExportWriter) Write(row exportRow) error {
+	return e.w.Write(row.record())
+}
+
+// Flush writes any buffered rows
+func (e *csvExportWriter) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// Close writes any buffered rows
+func (e *csvExportWriter) Close() error {
+	return e.Flush()
+}
+
+// jsonExportWriter writes rows as the elements of a JSON array
+type jsonExportWriter struct {
+	w     io.Writer
+	count int
+}
+
+// newJSONExportWriter creates a JSON export writer, opening the array
+func newJSONExportWriter(w io.Writer) (*jsonExportWriter, error) {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return nil, err
+	}
+	return &jsonExportWriter{w: w}, nil
+}
+
+// Write writes a row
+func (e *jsonExportWriter) Write(row exportRow) error {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		if _, err := io.WriteString(e.w, ","); err != nil {
+			return err
+		}
+	}
+	e.count++
+	_, err = e.w.Write(data)
+	return err
+}
+
+// Flush does nothing, as rows aren't buffered
+func (e *jsonExportWriter) Flush() error {
+	return nil
+}
+
+// Close closes the array
+func (e *jsonExportWriter) Close() error {
+	_, err := io.WriteString(e.w, "]\n")
+	return err
+}
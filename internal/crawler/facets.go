@@ -0,0 +1,143 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/e-commerce/platform/internal/common/models"
+	"gorm.io/gorm"
+)
+
+// attributeFacet is an attribute with the number of products having each of
+// its values
+type attributeFacet struct {
+	Name   string       `json:"name"`
+	Values []facetValue `json:"values"`
+}
+
+// facetValue is an attribute value and the number of products having it
+type facetValue struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// parseAttributeFilter parses attribute filters given as attr[Name]=Value
+// query parameters, repeated for several values of an attribute
+func parseAttributeFilter(params url.Values) (map[string][]string, error) {
+	var attributes map[string][]string
+	for key, values := range params {
+		if !strings.HasPrefix(key, "attr[") {
+			continue
+		}
+		name := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(key, "attr["), "]"))
+		if !strings.HasSuffix(key, "]") || name == "" {
+			return nil, fmt.Errorf("invalid attribute filter %q", key)
+		}
+
+		for _, value := range values {
+			if value = strings.TrimSpace(value); value != "" {
+				if attributes == nil {
+					attributes = make(map[string][]string)
+				}
+				attributes[name] = append(attributes[name], value)
+			}
+		}
+	}
+	return attributes, nil
+}
+
+// filterByAttributes keeps the products with a variant matching every
+// attribute filter, matching any of the values given for an attribute.
+// Names and values are matched case-insensitively.
+func filterByAttributes(query *gorm.DB, attributes map[string][]string) *gorm.DB {
+	if len(attributes) == 0 {
+		return query
+	}
+
+	// Sort the names so the same filters always build the same statement
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	conditions := make([]string, 0, len(names))
+	args := make([]interface{}, 0, 2*len(names))
+	for _, name := range names {
+		values := make([]string, len(attributes[name]))
+		for i, value := range attributes[name] {
+			values[i] = strings.ToLower(value)
+		}
+		conditions = append(conditions, `EXISTS (
+			SELECT 1 FROM variant_attribute_values vav
+			JOIN attribute_values av ON av.id = vav.attribute_value_id
+			WHERE vav.variant_id = v.id AND LOWER(av.attribute_name) = ? AND LOWER(av.value) IN ?
+		)`)
+		args = append(args, strings.ToLower(name), values)
+	}
+
+	return query.Where(`products.id IN (
+		SELECT v.product_id FROM variants v
+		WHERE v.deleted_at IS NULL AND `+strings.Join(conditions, " AND ")+`
+	)`, args...)
+}
+
+// productFacets returns the attribute values of the variants of the products
+// matching the filter, each with the number of those products having it
+func (s *Service) productFacets(ctx context.Context, filter productFilter) ([]attributeFacet, error) {
+	products := s.productsQuery(ctx, filter).Select("products.id")
+
+	var rows []struct {
+		Name  string
+		Value string
+		Count int64
+	}
+	if err := s.db.WithContext(ctx).Raw(`
+		SELECT av.attribute_name AS name, av.value, COUNT(DISTINCT v.product_id) AS count
+		FROM variants v
+		JOIN variant_attribute_values vav ON vav.variant_id = v.id
+		JOIN attribute_values av ON av.id = vav.attribute_value_id
+		WHERE v.deleted_at IS NULL AND av.deleted_at IS NULL AND av.attribute_name <> ''
+			AND v.product_id IN (?)
+		GROUP BY av.attribute_name, av.value
+		ORDER BY av.attribute_name, count DESC, av.value
+	`, products).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count attribute values: %w", err)
+	}
+
+	facets := make([]attributeFacet, 0)
+	for _, row := range rows {
+		if len(facets) == 0 || facets[len(facets)-1].Name != row.Name {
+			facets = append(facets, attributeFacet{Name: row.Name})
+		}
+		facet := &facets[len(facets)-1]
+		facet.Values = append(facet.Values, facetValue{Value: row.Value, Count: row.Count})
+	}
+	return facets, nil
+}
+
+// nameAttributeValues records the attribute names of a saved product's
+// variant attribute values. Values are only inserted when missing, so this
+// names those stored before names were recorded.
+func nameAttributeValues(tx *gorm.DB, product *models.Product) error {
+	byName := make(map[string][]string)
+	for _, variant := range product.Variants {
+		for _, value := range variant.AttributeValues {
+			if value.AttributeName != "" {
+				byName[value.AttributeName] = append(byName[value.AttributeName], value.ExternalID)
+			}
+		}
+	}
+
+	for name, externalIDs := range byName {
+		if err := tx.Model(&models.AttributeValue{}).
+			Where("external_id IN ? AND attribute_name = ''", externalIDs).
+			Update("attribute_name", name).Error; err != nil {
+			return fmt.Errorf("failed to name attribute values: %w", err)
+		}
+	}
+	return nil
+}
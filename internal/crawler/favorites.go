@@ -0,0 +1,87 @@
+package crawler
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// maxFavoriteImportSize is the maximum size in bytes of a favorites import file
+	maxFavoriteImportSize = 1 << 20
+	// maxFavoriteImportRows is the maximum number of products in a favorites import file
+	maxFavoriteImportRows = 1000
+)
+
+// Outcomes of the rows of a favorites import
+const (
+	favoriteImportAdded    = "added"
+	favoriteImportSkipped  = "skipped"
+	favoriteImportNotFound = "not_found"
+)
+
+// errTooManyImportRows is returned for favorites import files with more than
+// maxFavoriteImportRows products
+var errTooManyImportRows = fmt.Errorf("file must not contain more than %d products", maxFavoriteImportRows)
+
+// favoriteImportResult reports the outcome of one row of a favorites import
+type favoriteImportResult struct {
+	Row        int    `json:"row"`
+	ExternalID string `json:"external_id"`
+	Status     string `json:"status"`
+}
+
+// parseFavoriteImport reads the product external IDs of a favorites import
+// CSV. IDs are taken from the external_id column when the first row is a
+// header naming one, such as the header of a product export, and from the
+// first column otherwise. Empty rows are ignored.
+func parseFavoriteImport(r io.Reader) ([]favoriteImportResult, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var rows []favoriteImportResult
+	column := 0
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		if first {
+			if i := headerColumn(record, "external_id"); i >= 0 {
+				column = i
+				continue
+			}
+		}
+
+		if column >= len(record) || strings.TrimSpace(record[column]) == "" {
+			continue
+		}
+		if len(rows) == maxFavoriteImportRows {
+			return nil, errTooManyImportRows
+		}
+		rows = append(rows, favoriteImportResult{
+			Row:        line,
+			ExternalID: strings.TrimSpace(record[column]),
+		})
+	}
+
+	return rows, nil
+}
+
+// headerColumn returns the index of the column named name, or -1
+func headerColumn(record []string, name string) int {
+	for i, field := range record {
+		if strings.EqualFold(strings.TrimSpace(field), name) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,102 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/e-commerce/platform/internal/common/models"
+)
+
+// FixtureSource is a ProductSource that reads recorded responses from local
+// JSON files for offline development. The directory layout mirrors the live API:
+//
+//	categories.json            - response of /api/categories
+//	categories/<id>.json       - response of /api/category/<id>/products
+//	products/<id>.json         - response of /api/product/<id>
+//	reviews/<id>-<page>.json   - response of /api/product/<id>/reviews?page=<page>
+type FixtureSource struct {
+	dir string
+}
+
+// Ensure FixtureSource implements ProductSource
+var _ ProductSource = (*FixtureSource)(nil)
+
+// NewFixtureSource creates a new fixture source reading from dir
+func NewFixtureSource(dir string) *FixtureSource {
+	return &FixtureSource{dir: dir}
+}
+
+// GetCategories reads all product categories from the fixtures
+func (f *FixtureSource) GetCategories() ([]models.Category, error) {
+	file, err := f.open("categories.json")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return parseCategories(file)
+}
+
+// GetProductIDsByCategory reads product IDs for a specific category from the fixtures
+func (f *FixtureSource) GetProductIDsByCategory(categoryID string) ([]string, error) {
+	listings, err := f.GetProductListings(categoryID)
+	if err != nil {
+		return nil, err
+	}
+	return listingIDs(listings), nil
+}
+
+// GetProductListings reads the products of a specific category with their
+// change signals from the fixtures
+func (f *FixtureSource) GetProductListings(categoryID string) ([]ProductListing, error) {
+	file, err := f.open(filepath.Join("categories", filepath.Base(categoryID)+".json"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return parseProductListings(file)
+}
+
+// GetProductDetails reads detailed information for a specific product from the
+// fixtures, products without a fixture file are not found
+func (f *FixtureSource) GetProductDetails(productID string) (*models.Product, error) {
+	file, err := f.open(filepath.Join("products", filepath.Base(productID)+".json"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %v", ErrProductNotFound, err)
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	return parseProductDetails(file)
+}
+
+// GetProductReviews reads a page of reviews for a specific product from the
+// fixtures, pages without a fixture file have no reviews
+func (f *FixtureSource) GetProductReviews(productID string, page int) ([]models.Review, error) {
+	file, err := f.open(filepath.Join("reviews", filepath.Base(productID)+"-"+strconv.Itoa(page)+".json"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	return parseReviews(file)
+}
+
+// open opens a fixture file relative to the fixture directory
+func (f *FixtureSource) open(name string) (*os.File, error) {
+	file, err := os.Open(filepath.Join(f.dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open fixture %s: %w", name, err)
+	}
+	return file, nil
+}
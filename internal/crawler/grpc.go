@@ -0,0 +1,271 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/e-commerce/platform/internal/common/config"
+	"github.com/e-commerce/platform/internal/common/db"
+	"github.com/e-commerce/platform/internal/common/models"
+	pb "github.com/e-commerce/platform/internal/common/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// GRPCServer serves product queries to other services over gRPC
+type GRPCServer struct {
+	pb.UnimplementedProductServiceServer
+	server  *grpc.Server
+	db      *db.Database
+	config  *config.Config
+	service *Service
+}
+
+// NewGRPCServer creates a new gRPC server for the product service
+func NewGRPCServer(db *db.Database, config *config.Config, service *Service) *GRPCServer {
+	s := &GRPCServer{
+		server:  grpc.NewServer(),
+		db:      db,
+		config:  config,
+		service: service,
+	}
+
+	pb.RegisterProductServiceServer(s.server, s)
+
+	return s
+}
+
+// Start starts the gRPC server and stops it gracefully when ctx is done
+func (s *GRPCServer) Start(ctx context.Context) error {
+	address := ":" + strconv.Itoa(s.config.Services.CrawlerGRPCPort)
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		s.server.GracefulStop()
+	}()
+
+	log.Printf("Starting crawler gRPC server on %s", address)
+	return s.server.Serve(listener)
+}
+
+// GetProduct returns a product by external ID
+func (s *GRPCServer) GetProduct(ctx context.Context, req *pb.ProductRequest) (*pb.ProductResponse, error) {
+	product, err := s.service.getProduct(ctx, req.GetExternalId())
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, status.Error(codes.NotFound, "product not found")
+		}
+		return nil, status.Error(codes.Internal, "failed to fetch product")
+	}
+
+	return &pb.ProductResponse{Product: toProtoProduct(product)}, nil
+}
+
+// ListProducts returns a page of products filtered by category and brand
+func (s *GRPCServer) ListProducts(ctx context.Context, req *pb.ListProductsRequest) (*pb.ListProductsResponse, error) {
+	page := req.GetPage()
+	if page <= 0 {
+		page = 1
+	}
+
+	limit := req.GetLimit()
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	filter := productFilter{
+		CategoryID: uint(req.GetCategoryId()),
+		BrandID:    uint(req.GetBrandId()),
+	}
+
+	var products []models.Product
+	var total int64
+
+	query := s.service.productsQuery(ctx, filter)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, status.Error(codes.Internal, "failed to count products")
+	}
+
+	if err := query.Limit(int(limit)).Offset(int((page - 1) * limit)).Find(&products).Error; err != nil {
+		return nil, status.Error(codes.Internal, "failed to fetch products")
+	}
+
+	response := &pb.ListProductsResponse{
+		Products: make([]*pb.Product, 0, len(products)),
+		Total:    total,
+		Page:     page,
+		Limit:    limit,
+	}
+	for i := range products {
+		response.Products = append(response.Products, toProtoProduct(&products[i]))
+	}
+
+	return response, nil
+}
+
+// UpdateProductPriority updates the crawl priority of a product
+func (s *GRPCServer) UpdateProductPriority(ctx context.Context, req *pb.PriorityRequest) (*pb.PriorityResponse, error) {
+	if req.GetPriority() > 10 {
+		return nil, status.Error(codes.InvalidArgument, "priority must be between 0 and 10")
+	}
+
+	var product models.Product
+	if err := s.db.WithContext(ctx).Where("external_id = ?", req.GetExternalId()).First(&product).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, status.Error(codes.NotFound, "product not found")
+		}
+		return nil, status.Error(codes.Internal, "failed to fetch product")
+	}
+
+	s.service.setPriority(req.GetExternalId(), int(req.GetPriority()))
+
+	return &pb.PriorityResponse{
+		Success: true,
+		Message: "Priority updated successfully",
+	}, nil
+}
+
+// ListUserFavorites returns the products favorited by a user
+func (s *GRPCServer) ListUserFavorites(ctx context.Context, req *pb.UserFavoritesRequest) (*pb.UserFavoritesResponse, error) {
+	var favorites []models.UserFavorite
+	if err := s.db.WithContext(ctx).Preload("Product").Where("user_id = ?", req.GetUserId()).Find(&favorites).Error; err != nil {
+		return nil, status.Error(codes.Internal, "failed to fetch favorites")
+	}
+
+	response := &pb.UserFavoritesResponse{
+		Products: make([]*pb.Product, 0, len(favorites)),
+	}
+	for i := range favorites {
+		response.Products = append(response.Products, toProtoProduct(&favorites[i].Product))
+	}
+
+	return response, nil
+}
+
+// toProtoProduct converts a product and its loaded associations to its protobuf form
+func toProtoProduct(product *models.Product) *pb.Product {
+	p := &pb.Product{
+		Id:            uint32(product.ID),
+		ExternalId:    product.ExternalID,
+		Name:          product.Name,
+		Description:   product.Description,
+		Url:           product.URL,
+		IsActive:      product.IsActive,
+		Rating:        product.Rating,
+		RatingCount:   int32(product.RatingCount),
+		FavoriteCount: int32(product.FavoriteCount),
+		CommentCount:  int32(product.CommentCount),
+		LastUpdated:   timestamppb.New(product.LastUpdated),
+	}
+
+	if product.Category.ID > 0 {
+		p.Category = &pb.Category{
+			Id:          uint32(product.Category.ID),
+			Name:        product.Category.Name,
+			Description: product.Category.Description,
+			ExternalId:  product.Category.ExternalID,
+			Level:       int32(product.Category.Level),
+			IsActive:    product.Category.IsActive,
+		}
+		if product.Category.ParentID != nil {
+			p.Category.ParentId = uint32(*product.Category.ParentID)
+		}
+	}
+
+	if product.Brand.ID > 0 {
+		p.Brand = &pb.Brand{
+			Id:         uint32(product.Brand.ID),
+			Name:       product.Brand.Name,
+			ExternalId: product.Brand.ExternalID,
+			LogoUrl:    product.Brand.LogoURL,
+			IsActive:   product.Brand.IsActive,
+		}
+	}
+
+	if product.Seller.ID > 0 {
+		p.Seller = &pb.Seller{
+			Id:            uint32(product.Seller.ID),
+			Name:          product.Seller.Name,
+			ExternalId:    product.Seller.ExternalID,
+			Rating:        product.Seller.Rating,
+			PositiveRatio: product.Seller.PositiveRatio,
+			IsActive:      product.Seller.IsActive,
+		}
+	}
+
+	for _, image := range product.Images {
+		p.Images = append(p.Images, &pb.Image{
+			Id:         uint32(image.ID),
+			ProductId:  uint32(image.ProductID),
+			Url:        image.URL,
+			IsMain:     image.IsMain,
+			ExternalId: image.ExternalID,
+		})
+	}
+
+	for _, video := range product.Videos {
+		p.Videos = append(p.Videos, &pb.Video{
+			Id:         uint32(video.ID),
+			ProductId:  uint32(video.ProductID),
+			Url:        video.URL,
+			ExternalId: video.ExternalID,
+		})
+	}
+
+	for _, variant := range product.Variants {
+		p.Variants = append(p.Variants, &pb.Variant{
+			Id:              uint32(variant.ID),
+			ProductId:       uint32(variant.ProductID),
+			ExternalId:      variant.ExternalID,
+			AttributeValues: toProtoAttributeValues(variant.AttributeValues),
+			Price:           variant.Price,
+			OriginalPrice:   variant.OriginalPrice,
+			DiscountRate:    int32(variant.DiscountRate),
+			StockCount:      int32(variant.StockCount),
+			IsActive:        variant.IsActive,
+			InstallmentInfo: &pb.InstallmentOptions{
+				Available:   variant.InstallmentInfo.Available,
+				MaxMonths:   int32(variant.InstallmentInfo.MaxMonths),
+				BankOptions: int32(variant.InstallmentInfo.BankOptions),
+			},
+		})
+	}
+
+	for _, attribute := range product.Attributes {
+		p.Attributes = append(p.Attributes, &pb.Attribute{
+			Id:         uint32(attribute.ID),
+			Name:       attribute.Name,
+			ExternalId: attribute.ExternalID,
+			Values:     toProtoAttributeValues(attribute.Values),
+		})
+	}
+
+	for _, related := range product.RelatedProducts {
+		p.RelatedProductIds = append(p.RelatedProductIds, uint32(related.ID))
+	}
+
+	return p
+}
+
+// toProtoAttributeValues converts attribute values to their protobuf form
+func toProtoAttributeValues(values []models.AttributeValue) []*pb.AttributeValue {
+	result := make([]*pb.AttributeValue, 0, len(values))
+	for _, value := range values {
+		result = append(result, &pb.AttributeValue{
+			Id:         uint32(value.ID),
+			Value:      value.Value,
+			ExternalId: value.ExternalID,
+		})
+	}
+	return result
+}
@@ -0,0 +1,87 @@
+package crawler
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// idempotencyKeyTTL is how long a seen Idempotency-Key is remembered
+const idempotencyKeyTTL = 10 * time.Minute
+
+// idempotencyEntry is a cached response for an idempotency key
+type idempotencyEntry struct {
+	response  map[string]interface{}
+	expiresAt time.Time
+}
+
+// idempotencyCache remembers responses for recently seen idempotency keys
+type idempotencyCache struct {
+	entries  map[string]idempotencyEntry
+	ttl      time.Duration
+	mu       sync.Mutex         // Guards entries, never held while running a call
+	inflight singleflight.Group // Calls running per key
+}
+
+// newIdempotencyCache creates a new idempotency cache
+func newIdempotencyCache(ttl time.Duration) *idempotencyCache {
+	return &idempotencyCache{
+		entries: make(map[string]idempotencyEntry),
+		ttl:     ttl,
+	}
+}
+
+// do returns the cached response for key if it was seen within the TTL,
+// otherwise it runs fn and caches its response on success. Concurrent retries
+// with the same key wait for a single run of fn and share its result, calls
+// with other keys run independently.
+func (c *idempotencyCache) do(key string, fn func() (map[string]interface{}, error)) (map[string]interface{}, error) {
+	if response, exists := c.cached(key); exists {
+		return response, nil
+	}
+
+	result, err, _ := c.inflight.Do(key, func() (interface{}, error) {
+		// A call with the same key may have finished since the check above
+		if response, exists := c.cached(key); exists {
+			return response, nil
+		}
+
+		response, err := fn()
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		c.entries[key] = idempotencyEntry{
+			response:  response,
+			expiresAt: time.Now().Add(c.ttl),
+		}
+		c.mu.Unlock()
+		return response, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(map[string]interface{}), nil
+}
+
+// cached returns the unexpired response cached for key
+func (c *idempotencyCache) cached(key string) (map[string]interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.evictExpired(time.Now())
+	entry, exists := c.entries[key]
+	return entry.response, exists
+}
+
+// evictExpired removes expired entries, the caller must hold the lock
+func (c *idempotencyCache) evictExpired(now time.Time) {
+	for key, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package crawler
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyCacheReplay(t *testing.T) {
+	errTrigger := errors.New("trigger failed")
+
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		wait    time.Duration // Between the two calls
+		results []error       // Results of fn on each run
+		runs    int32
+	}{
+		{"replayed within the TTL", time.Minute, 0, []error{nil}, 1},
+		{"run again after expiry", 10 * time.Millisecond, 20 * time.Millisecond, []error{nil, nil}, 2},
+		{"failures aren't cached", time.Minute, 0, []error{errTrigger, nil}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newIdempotencyCache(tt.ttl)
+			var runs atomic.Int32
+			fn := func() (map[string]interface{}, error) {
+				run := runs.Add(1)
+				if err := tt.results[run-1]; err != nil {
+					return nil, err
+				}
+				return map[string]interface{}{"run": run}, nil
+			}
+
+			first, firstErr := cache.do("key", fn)
+			time.Sleep(tt.wait)
+			second, err := cache.do("key", fn)
+			if err != nil {
+				t.Fatalf("second call failed: %v", err)
+			}
+
+			if runs.Load() != tt.runs {
+				t.Errorf("fn ran %d times, want %d", runs.Load(), tt.runs)
+			}
+			if tt.runs == 1 && (firstErr != nil || first["run"] != second["run"]) {
+				t.Errorf("second call got %v, want the replayed %v", second, first)
+			}
+		})
+	}
+}
+
+func TestIdempotencyCacheConcurrentSameKey(t *testing.T) {
+	cache := newIdempotencyCache(time.Minute)
+	var runs atomic.Int32
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := cache.do("key", func() (map[string]interface{}, error) {
+				runs.Add(1)
+				<-release
+				return map[string]interface{}{"success": true}, nil
+			})
+			if err != nil || response["success"] != true {
+				t.Errorf("got %v, %v", response, err)
+			}
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if runs.Load() != 1 {
+		t.Errorf("fn ran %d times for concurrent calls with the same key, want 1", runs.Load())
+	}
+}
+
+func TestIdempotencyCacheKeysIndependent(t *testing.T) {
+	cache := newIdempotencyCache(time.Minute)
+	release := make(chan struct{})
+	defer close(release)
+
+	// A slow call must not hold up calls with other keys
+	go cache.do("slow", func() (map[string]interface{}, error) {
+		<-release
+		return map[string]interface{}{}, nil
+	})
+	time.Sleep(10 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		cache.do("fast", func() (map[string]interface{}, error) {
+			return map[string]interface{}{}, nil
+		})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("call with another key waited for a running call")
+	}
+}
@@ -0,0 +1,297 @@
+package crawler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/e-commerce/platform/internal/common/config"
+	"github.com/e-commerce/platform/internal/common/db"
+	"github.com/e-commerce/platform/internal/common/models"
+)
+
+// errImageRejected is returned for downloads retrying won't fix, such as
+// missing images or responses that aren't images
+var errImageRejected = errors.New("image rejected")
+
+// maxMirrorBackoff caps the delay before retrying an image that failed to mirror
+const maxMirrorBackoff = 24 * time.Hour
+
+// imageStorage stores mirrored images under a name and returns their URL
+type imageStorage interface {
+	Save(name string, data []byte) (string, error)
+}
+
+// localImageStorage stores images as files in a directory served at baseURL
+type localImageStorage struct {
+	dir     string
+	baseURL string
+}
+
+// Save writes the image to a temporary file renamed into place, so a file
+// served under name is never partially written
+func (s localImageStorage) Save(name string, data []byte) (string, error) {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create image directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".mirror-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create image file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write image file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write image file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write image file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, name)); err != nil {
+		return "", fmt.Errorf("failed to move image file into place: %w", err)
+	}
+	return s.baseURL + "/" + name, nil
+}
+
+// imageMirror copies product images to storage and records their mirrored URL
+type imageMirror struct {
+	db        *db.Database
+	client    *http.Client
+	storage   imageStorage
+	limiter   *adaptiveLimiter
+	config    config.ImageMirrorConfig
+	userAgent string
+}
+
+// newImageMirror creates an image mirror storing images in the configured
+// directory. Downloads wait for limiter, shared with the scraper so mirroring
+// doesn't add to the request rate the target sees; nil doesn't limit them.
+func newImageMirror(db *db.Database, cfg *config.Config, limiter *adaptiveLimiter) *imageMirror {
+	return &imageMirror{
+		db:        db,
+		client:    &http.Client{Timeout: cfg.Scraper.RequestTimeout},
+		storage:   localImageStorage{dir: cfg.ImageMirror.Dir, baseURL: cfg.ImageMirror.BaseURL},
+		limiter:   limiter,
+		config:    cfg.ImageMirror,
+		userAgent: cfg.Scraper.UserAgent,
+	}
+}
+
+// run mirrors the images not mirrored yet every interval until ctx is done
+func (m *imageMirror) run(ctx context.Context) {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		mirrored, failed := m.mirrorPending(ctx)
+		if mirrored > 0 || failed > 0 {
+			log.Printf("Mirrored %d images, %d failed", mirrored, failed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// mirrorPending mirrors every image without a mirrored URL that is due, in
+// batches by ID so images that fail don't hold up the rest until the next
+// pass. Images that failed MaxAttempts passes, or were rejected, are skipped.
+func (m *imageMirror) mirrorPending(ctx context.Context) (mirrored, failed int) {
+	var lastID uint
+	for ctx.Err() == nil {
+		var images []models.Image
+		if err := m.db.WithContext(ctx).
+			Where("mirrored_url = '' AND id > ? AND mirror_attempts < ?", lastID, m.config.MaxAttempts).
+			Where("mirror_retry_at IS NULL OR mirror_retry_at <= ?", time.Now()).
+			Order("id").
+			Limit(m.config.BatchSize).
+			Find(&images).Error; err != nil {
+			log.Printf("Error loading images to mirror: %v", err)
+			return mirrored, failed
+		}
+		if len(images) == 0 {
+			return mirrored, failed
+		}
+		lastID = images[len(images)-1].ID
+
+		pending := make(chan models.Image)
+		var (
+			wg  sync.WaitGroup
+			mux sync.Mutex
+		)
+		for i := 0; i < min(m.config.Workers, len(images)); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for image := range pending {
+					err := m.mirror(ctx, image)
+					if err != nil && ctx.Err() == nil {
+						log.Printf("Error mirroring image %d (%s): %v", image.ID, image.URL, err)
+						m.recordFailure(ctx, image, err)
+					}
+
+					mux.Lock()
+					if err != nil {
+						failed++
+					} else {
+						mirrored++
+					}
+					mux.Unlock()
+				}
+			}()
+		}
+		for _, image := range images {
+			pending <- image
+		}
+		close(pending)
+		wg.Wait()
+	}
+	return mirrored, failed
+}
+
+// mirror downloads an image, retrying failed downloads with a growing delay,
+// stores it and records its mirrored URL
+func (m *imageMirror) mirror(ctx context.Context, image models.Image) error {
+	var (
+		data        []byte
+		contentType string
+		err         error
+	)
+	for attempt := 1; attempt <= m.config.RetryAttempts; attempt++ {
+		data, contentType, err = m.download(ctx, image.URL)
+		if err == nil || errors.Is(err, errImageRejected) || attempt == m.config.RetryAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(m.config.RetryDelay * time.Duration(attempt)):
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	mirroredURL, err := m.storage.Save(imageName(image.URL, contentType), data)
+	if err != nil {
+		return err
+	}
+
+	if err := m.db.WithContext(ctx).Model(&models.Image{}).
+		Where("id = ?", image.ID).
+		Update("mirrored_url", mirroredURL).Error; err != nil {
+		return fmt.Errorf("failed to record mirrored URL: %w", err)
+	}
+	return nil
+}
+
+// recordFailure counts a failed pass for an image and schedules its next
+// attempt after a delay doubling with every failure. Rejected images won't
+// mirror by retrying, so they are given up on straight away.
+func (m *imageMirror) recordFailure(ctx context.Context, image models.Image, err error) {
+	attempts := image.MirrorAttempts + 1
+	if errors.Is(err, errImageRejected) {
+		attempts = m.config.MaxAttempts
+	}
+	retryAt := time.Now().Add(mirrorBackoff(m.config.Interval, attempts))
+
+	if err := m.db.WithContext(ctx).Model(&models.Image{}).
+		Where("id = ?", image.ID).
+		Updates(map[string]interface{}{"mirror_attempts": attempts, "mirror_retry_at": retryAt}).Error; err != nil {
+		log.Printf("Error recording failure to mirror image %d: %v", image.ID, err)
+	}
+}
+
+// mirrorBackoff returns the delay before retrying an image that failed to
+// mirror attempts times: interval doubled for every failure after the first,
+// capped at maxMirrorBackoff
+func mirrorBackoff(interval time.Duration, attempts int) time.Duration {
+	backoff := interval
+	for i := 1; i < attempts && backoff < maxMirrorBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxMirrorBackoff)
+}
+
+// download fetches an image, returning its content and content type
+func (m *imageMirror) download(ctx context.Context, url string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: invalid URL: %v", errImageRejected, err)
+	}
+	req.Header.Set("User-Agent", m.userAgent)
+
+	if m.limiter != nil {
+		if err := m.limiter.wait(ctx); err != nil {
+			return nil, "", err
+		}
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if m.limiter != nil {
+		m.limiter.observe(resp)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		// Client errors such as a missing image won't go away by retrying,
+		// but rate limiting will
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return nil, "", fmt.Errorf("%w: unexpected status code: %d", errImageRejected, resp.StatusCode)
+		}
+		return nil, "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if _, supported := imageExtensions[contentType]; !supported {
+		return nil, "", fmt.Errorf("%w: unsupported content type %q", errImageRejected, contentType)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, m.config.MaxSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read response body: %w", err)
+	}
+	if int64(len(data)) > m.config.MaxSize {
+		return nil, "", fmt.Errorf("%w: larger than %d bytes", errImageRejected, m.config.MaxSize)
+	}
+	return data, contentType, nil
+}
+
+// imageExtensions are the file extensions of the image content types that
+// are mirrored. SVG isn't, as served from our origin it could run scripts.
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"image/avif": ".avif",
+}
+
+// imageName names a mirrored image after a hash of its source URL, so
+// images shared by several products are stored once
+func imageName(url, contentType string) string {
+	hash := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(hash[:]) + imageExtensions[contentType]
+}
@@ -0,0 +1,105 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/e-commerce/platform/internal/common/config"
+)
+
+func TestMirrorBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 5 * time.Minute},
+		{2, 10 * time.Minute},
+		{3, 20 * time.Minute},
+		{10, maxMirrorBackoff},
+		{1000, maxMirrorBackoff},
+	}
+
+	for _, tt := range tests {
+		if got := mirrorBackoff(5*time.Minute, tt.attempts); got != tt.want {
+			t.Errorf("mirrorBackoff(5m, %d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestImageMirrorDownload(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		rejected    bool
+		wantErr     bool
+	}{
+		{"image", http.StatusOK, "image/png", "png", false, false},
+		{"missing", http.StatusNotFound, "text/html", "", true, true},
+		{"rate limited", http.StatusTooManyRequests, "text/html", "", false, true},
+		{"server error", http.StatusBadGateway, "text/html", "", false, true},
+		{"not an image", http.StatusOK, "text/html", "<html>", true, true},
+		{"svg", http.StatusOK, "image/svg+xml", "<svg>", true, true},
+		{"too large", http.StatusOK, "image/jpeg", "0123456789abcdef", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			limiter := newAdaptiveLimiter(0, 0, time.Second)
+			mirror := newImageMirror(nil, &config.Config{ImageMirror: config.ImageMirrorConfig{MaxSize: 8}}, limiter)
+
+			data, contentType, err := mirror.download(context.Background(), server.URL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, errImageRejected) != tt.rejected {
+				t.Errorf("rejected = %v, want %v (error %v)", !tt.rejected, tt.rejected, err)
+			}
+			if err == nil && (string(data) != tt.body || contentType != tt.contentType) {
+				t.Errorf("got %q (%s), want %q (%s)", data, contentType, tt.body, tt.contentType)
+			}
+
+			// The response went through the shared limiter
+			if tt.status == http.StatusTooManyRequests && limiter.delay == 0 {
+				t.Error("limiter delay wasn't increased after a 429 response")
+			}
+		})
+	}
+}
+
+func TestImageMirrorDownloadWaitsForLimiter(t *testing.T) {
+	limiter := newAdaptiveLimiter(time.Hour, time.Hour, time.Hour)
+	// Take the free slot, the download has to wait an hour for the next one
+	if err := limiter.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	requested := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+	}))
+	defer server.Close()
+
+	mirror := newImageMirror(nil, &config.Config{ImageMirror: config.ImageMirrorConfig{MaxSize: 8}}, limiter)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, _, err := mirror.download(ctx, server.URL); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if requested {
+		t.Error("image was requested before the limiter allowed it")
+	}
+}
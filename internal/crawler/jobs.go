@@ -0,0 +1,155 @@
+package crawler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// crawlJobTTL is how long finished crawl jobs are kept for status queries
+const crawlJobTTL = time.Hour
+
+// Crawl job statuses
+const (
+	jobStatusPending = "pending"
+	jobStatusRunning = "running"
+	jobStatusDone    = "done"
+	jobStatusFailed  = "failed"
+)
+
+// crawlJob represents a background crawl triggered through the API
+type crawlJob struct {
+	ID         string     `json:"job_id"`
+	Type       string     `json:"type"`
+	Target     string     `json:"target"`
+	Status     string     `json:"status"`
+	Processed  int        `json:"processed"`
+	Failed     int        `json:"failed"`
+	Skipped    int        `json:"skipped"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// jobTracker keeps track of background crawl jobs in memory
+type jobTracker struct {
+	jobs map[string]*crawlJob
+	ttl  time.Duration
+	mu   sync.RWMutex
+}
+
+// newJobTracker creates a new job tracker
+func newJobTracker(ttl time.Duration) *jobTracker {
+	return &jobTracker{
+		jobs: make(map[string]*crawlJob),
+		ttl:  ttl,
+	}
+}
+
+// create registers a new pending job
+func (t *jobTracker) create(jobType, target string) crawlJob {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.evictExpired(now)
+
+	job := &crawlJob{
+		ID:        newJobID(),
+		Type:      jobType,
+		Target:    target,
+		Status:    jobStatusPending,
+		CreatedAt: now,
+	}
+	t.jobs[job.ID] = job
+
+	return *job
+}
+
+// get returns a snapshot of a job
+func (t *jobTracker) get(id string) (crawlJob, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	job, exists := t.jobs[id]
+	if !exists {
+		return crawlJob{}, false
+	}
+	return *job, true
+}
+
+// start marks a job as running
+func (t *jobTracker) start(id string) {
+	t.update(id, func(job *crawlJob) {
+		now := time.Now()
+		job.Status = jobStatusRunning
+		job.StartedAt = &now
+	})
+}
+
+// recordProduct records the outcome of processing a single product, products
+// skipped because another crawl was already running are counted separately
+func (t *jobTracker) recordProduct(id string, err error) {
+	t.update(id, func(job *crawlJob) {
+		if errors.Is(err, errCrawlInFlight) {
+			job.Skipped++
+		} else if err != nil {
+			job.Failed++
+		} else {
+			job.Processed++
+		}
+	})
+}
+
+// finish marks a job as done, or failed if err is not nil
+func (t *jobTracker) finish(id string, err error) {
+	t.update(id, func(job *crawlJob) {
+		now := time.Now()
+		job.FinishedAt = &now
+		if err != nil {
+			job.Status = jobStatusFailed
+			job.Error = err.Error()
+		} else {
+			job.Status = jobStatusDone
+		}
+	})
+}
+
+// remove forgets a job that never ran
+func (t *jobTracker) remove(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.jobs, id)
+}
+
+// update applies a change to a job under the lock
+func (t *jobTracker) update(id string, fn func(job *crawlJob)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if job, exists := t.jobs[id]; exists {
+		fn(job)
+	}
+}
+
+// evictExpired removes finished jobs older than the TTL, the caller must hold the lock
+func (t *jobTracker) evictExpired(now time.Time) {
+	for id, job := range t.jobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > t.ttl {
+			delete(t.jobs, id)
+		}
+	}
+}
+
+// newJobID generates a random job ID
+func newJobID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,122 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/e-commerce/platform/internal/common/messaging"
+	"github.com/e-commerce/platform/internal/common/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// outboxRelayInterval is how often outbox messages left unpublished are retried
+	outboxRelayInterval = 10 * time.Second
+	// outboxBatchSize is the number of outbox messages the relay publishes at a time
+	outboxBatchSize = 100
+)
+
+// publishOutbox publishes outbox messages once the transaction saving them
+// committed. Messages that fail to publish stay in the outbox for the relay.
+func (s *Service) publishOutbox(ctx context.Context, messages []models.OutboxMessage) {
+	if len(messages) == 0 {
+		return
+	}
+
+	if _, err := s.publishOutboxMessages(ctx, outboxIDs(messages)); err != nil {
+		log.Printf("Error publishing %d outbox messages, retrying later: %v", len(messages), err)
+	}
+}
+
+// relayOutbox publishes the outbox messages left unpublished, such as when
+// Kafka was down when they were saved, every outboxRelayInterval until ctx is done
+func (s *Service) relayOutbox(ctx context.Context) {
+	ticker := time.NewTicker(outboxRelayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for ctx.Err() == nil {
+			published, err := s.publishOutboxMessages(ctx, nil)
+			if err != nil {
+				log.Printf("Error relaying outbox messages: %v", err)
+				break
+			}
+			if published > 0 {
+				log.Printf("Relayed %d outbox messages", published)
+			}
+			if published < outboxBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// publishOutboxMessages publishes the outbox messages with the given IDs, or
+// the oldest batch when ids is nil, and deletes them. The messages are locked
+// while published, skipping those another publisher holds, so a message isn't
+// published twice at the same time. A message published but not deleted, as
+// when the database fails afterwards, is published again: consumers must
+// tolerate duplicates.
+func (s *Service) publishOutboxMessages(ctx context.Context, ids []uint) (int, error) {
+	var published int
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).Order("id")
+		if ids != nil {
+			query = query.Where("id IN ?", ids)
+		} else {
+			query = query.Limit(outboxBatchSize)
+		}
+
+		var messages []models.OutboxMessage
+		if err := query.Find(&messages).Error; err != nil {
+			return fmt.Errorf("failed to load outbox messages: %w", err)
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+
+		// Publish per topic, keeping the order of each topic's messages
+		var topics []string
+		byTopic := make(map[string][]messaging.Message)
+		for _, message := range messages {
+			if _, exists := byTopic[message.Topic]; !exists {
+				topics = append(topics, message.Topic)
+			}
+			byTopic[message.Topic] = append(byTopic[message.Topic], messaging.Message{
+				Key:  message.Key,
+				Data: json.RawMessage(message.Payload),
+			})
+		}
+		for _, topic := range topics {
+			if err := s.kafka.PublishMessages(ctx, topic, byTopic[topic]); err != nil {
+				return fmt.Errorf("failed to publish to %s: %w", topic, err)
+			}
+		}
+
+		if err := tx.Delete(&models.OutboxMessage{}, outboxIDs(messages)).Error; err != nil {
+			return fmt.Errorf("failed to delete published outbox messages: %w", err)
+		}
+		published = len(messages)
+		return nil
+	})
+	return published, err
+}
+
+// outboxIDs returns the IDs of outbox messages
+func outboxIDs(messages []models.OutboxMessage) []uint {
+	ids := make([]uint, len(messages))
+	for i, message := range messages {
+		ids[i] = message.ID
+	}
+	return ids
+}
@@ -0,0 +1,252 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/e-commerce/platform/internal/common/config"
+	"github.com/e-commerce/platform/internal/common/models"
+)
+
+// Fields scraped from product pages, as listed in ScrapedFields
+const (
+	pageFieldName          = "name"
+	pageFieldPrice         = "price"
+	pageFieldOriginalPrice = "original_price"
+	pageFieldStock         = "stock"
+	pageFieldImage         = "image"
+	pageFieldRating        = "rating"
+)
+
+// errNoPageFields is returned for product pages none of the selectors match
+var errNoPageFields = errors.New("product page has none of the expected fields")
+
+// getProductPage scrapes the fields its selectors find on a product's page,
+// for when the details API response can't be parsed
+func (s *Scraper) getProductPage(productID string) (*models.Product, error) {
+	pageURL := s.config.BaseURL + strings.ReplaceAll(s.config.ProductPagePath, "{id}", url.PathEscape(productID))
+	doc, err := s.scrapeHTML(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	return parseProductPage(doc, productID, pageURL, s.config.Selectors)
+}
+
+// parseProductPage parses the fields selectors find on a product page into
+// a partial Product, listing the fields found in ScrapedFields. Prices and
+// stock are given as a single variant with the product's ID.
+func parseProductPage(doc *goquery.Document, productID, pageURL string, selectors config.SelectorConfig) (*models.Product, error) {
+	product := &models.Product{
+		ExternalID:  productID,
+		URL:         pageURL,
+		IsActive:    true,
+		LastUpdated: time.Now(),
+	}
+	variant := models.Variant{ExternalID: productID, IsActive: true}
+
+	// text returns the trimmed text of the first element a selector matches
+	text := func(selector string) string {
+		if selector == "" {
+			return ""
+		}
+		return strings.TrimSpace(doc.Find(selector).First().Text())
+	}
+
+	if name := text(selectors.Name); name != "" {
+		product.Name = name
+		product.ScrapedFields = append(product.ScrapedFields, pageFieldName)
+	}
+
+	if price, ok := parsePagePrice(text(selectors.Price)); ok {
+		variant.Price = price
+		variant.OriginalPrice = price
+		product.ScrapedFields = append(product.ScrapedFields, pageFieldPrice)
+
+		if originalPrice, ok := parsePagePrice(text(selectors.OriginalPrice)); ok && originalPrice > price {
+			variant.OriginalPrice = originalPrice
+			variant.DiscountRate = int(math.Round((originalPrice - price) / originalPrice * 100))
+			product.ScrapedFields = append(product.ScrapedFields, pageFieldOriginalPrice)
+		}
+	}
+
+	if stock, ok := parsePageCount(text(selectors.Stock)); ok {
+		variant.StockCount = stock
+		variant.IsActive = stock > 0
+		product.IsActive = stock > 0
+		product.ScrapedFields = append(product.ScrapedFields, pageFieldStock)
+	}
+
+	if rating, err := strconv.ParseFloat(strings.ReplaceAll(text(selectors.Rating), ",", "."), 64); err == nil {
+		product.Rating = rating
+		product.ScrapedFields = append(product.ScrapedFields, pageFieldRating)
+	}
+
+	if selectors.Image != "" {
+		base, _ := url.Parse(pageURL)
+		doc.Find(selectors.Image).Each(func(i int, img *goquery.Selection) {
+			src := img.AttrOr("src", "")
+			if src == "" {
+				src = img.AttrOr("data-src", "")
+			}
+			ref, err := url.Parse(strings.TrimSpace(src))
+			if src == "" || err != nil {
+				return
+			}
+			if base != nil {
+				ref = base.ResolveReference(ref)
+			}
+			product.Images = append(product.Images, models.Image{URL: ref.String(), IsMain: len(product.Images) == 0})
+		})
+		if len(product.Images) > 0 {
+			product.ScrapedFields = append(product.ScrapedFields, pageFieldImage)
+		}
+	}
+
+	if len(product.ScrapedFields) == 0 {
+		return nil, errNoPageFields
+	}
+	if hasField(product.ScrapedFields, pageFieldPrice) || hasField(product.ScrapedFields, pageFieldStock) {
+		product.Variants = append(product.Variants, variant)
+	}
+	return product, nil
+}
+
+// parsePagePrice parses a displayed price such as "1.299,99 TL" or "$1,299.99",
+// in either decimal separator convention
+func parsePagePrice(text string) (float64, bool) {
+	var b strings.Builder
+	for _, r := range text {
+		if (r >= '0' && r <= '9') || r == '.' || r == ',' {
+			b.WriteRune(r)
+		}
+	}
+	number := strings.Trim(b.String(), ".,")
+	if number == "" {
+		return 0, false
+	}
+
+	// The last separator is the decimal one, unless it is repeated or is the
+	// only kind of separator and followed by three digits
+	if i := strings.LastIndexAny(number, ".,"); i >= 0 {
+		sep := number[i : i+1]
+		digits := strings.NewReplacer(".", "", ",", "")
+		thousands := strings.Count(number, sep) > 1 ||
+			(len(number)-i-1 == 3 && !strings.ContainsAny(number, otherSeparator(number[i])))
+		if thousands {
+			number = digits.Replace(number)
+		} else {
+			number = digits.Replace(number[:i]) + "." + number[i+1:]
+		}
+	}
+
+	price, err := strconv.ParseFloat(number, 64)
+	if err != nil || price <= 0 {
+		return 0, false
+	}
+	return price, true
+}
+
+// otherSeparator returns the separator that isn't sep
+func otherSeparator(sep byte) string {
+	if sep == '.' {
+		return ","
+	}
+	return "."
+}
+
+// parsePageCount parses the first number in a text such as "Only 3 left"
+func parsePageCount(text string) (int, bool) {
+	start := strings.IndexAny(text, "0123456789")
+	if start < 0 {
+		return 0, false
+	}
+	end := start
+	for end < len(text) && text[end] >= '0' && text[end] <= '9' {
+		end++
+	}
+	count, err := strconv.Atoi(text[start:end])
+	return count, err == nil
+}
+
+// hasField reports whether fields contains field
+func hasField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeScrapedProduct applies the fields scraped from a product's page to the
+// stored product. Prices and stock are only applied to products with a single
+// variant, as the page doesn't tell which variant it shows.
+func mergeScrapedProduct(stored, scraped *models.Product) *models.Product {
+	product := stored
+	product.LastUpdated = scraped.LastUpdated
+	product.ScrapedFields = scraped.ScrapedFields
+
+	if hasField(scraped.ScrapedFields, pageFieldName) {
+		product.Name = scraped.Name
+	}
+	if hasField(scraped.ScrapedFields, pageFieldRating) {
+		product.Rating = scraped.Rating
+	}
+	if product.URL == "" {
+		product.URL = scraped.URL
+	}
+
+	// Add images not stored yet, stored ones are kept
+	storedImages := make(map[string]bool, len(product.Images))
+	for _, image := range product.Images {
+		storedImages[image.URL] = true
+	}
+	for _, image := range scraped.Images {
+		if !storedImages[image.URL] {
+			image.IsMain = image.IsMain && len(product.Images) == 0
+			product.Images = append(product.Images, image)
+		}
+	}
+
+	if len(product.Variants) == 1 && len(scraped.Variants) == 1 {
+		variant, page := &product.Variants[0], scraped.Variants[0]
+		if hasField(scraped.ScrapedFields, pageFieldPrice) {
+			variant.Price = page.Price
+			variant.OriginalPrice = page.OriginalPrice
+			variant.DiscountRate = page.DiscountRate
+		}
+		if hasField(scraped.ScrapedFields, pageFieldStock) {
+			variant.StockCount = page.StockCount
+			variant.IsActive = page.IsActive
+			product.IsActive = page.IsActive
+		}
+	}
+
+	return product
+}
+
+// mergeProductPage merges a product scraped from its page into the stored
+// product, as pages lack the category, brand and seller a new product needs
+func (s *Service) mergeProductPage(ctx context.Context, scraped *models.Product) (*models.Product, error) {
+	var stored models.Product
+	if err := s.db.WithContext(ctx).
+		Preload("Category").
+		Preload("Brand").
+		Preload("Seller").
+		Preload("Images").
+		Preload("Variants").
+		Preload("Offers.Seller").
+		Preload("Bundle.Items").
+		Where("external_id = ?", scraped.ExternalID).
+		First(&stored).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch product %s to merge its page into: %w", scraped.ExternalID, err)
+	}
+	return mergeScrapedProduct(&stored, scraped), nil
+}
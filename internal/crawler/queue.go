@@ -0,0 +1,72 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+)
+
+// errCrawlQueueFull is returned when a crawl is triggered while the queue of
+// triggered crawls is full
+var errCrawlQueueFull = errors.New("crawl queue is full")
+
+// crawlTask is a crawl triggered through the API, waiting for a trigger worker
+type crawlTask struct {
+	ctx   context.Context
+	crawl func(ctx context.Context)
+}
+
+// enqueueCrawl queues a crawl for the trigger workers without blocking,
+// returning errCrawlQueueFull if the queue is full. The crawl is called with
+// ctx bounded by the crawl timeout, which starts once a worker picks it up.
+// Triggered crawls share the scraper's rate limiter with periodic crawls, so
+// the workers bound the crawls running at once, not the request rate.
+func (s *Service) enqueueCrawl(ctx context.Context, crawl func(ctx context.Context)) error {
+	select {
+	case s.crawlQueue <- crawlTask{ctx: ctx, crawl: crawl}:
+		return nil
+	default:
+		return errCrawlQueueFull
+	}
+}
+
+// queuedCrawls returns the number of triggered crawls waiting for a worker
+func (s *Service) queuedCrawls() int {
+	return len(s.crawlQueue)
+}
+
+// triggerWorkers returns the number of workers running triggered crawls
+func (s *Service) triggerWorkers() int {
+	if s.config.Scraper.TriggerWorkers > 0 {
+		return s.config.Scraper.TriggerWorkers
+	}
+	return 1
+}
+
+// runCrawlQueue runs queued crawls until ctx is done, then runs the crawls
+// still queued, so whoever queued them sees them finish. Their own contexts
+// are cancelled on shutdown, so they stop early.
+func (s *Service) runCrawlQueue(ctx context.Context) {
+	for {
+		select {
+		case task := <-s.crawlQueue:
+			s.runCrawlTask(task)
+		case <-ctx.Done():
+			for {
+				select {
+				case task := <-s.crawlQueue:
+					s.runCrawlTask(task)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// runCrawlTask runs a queued crawl bounded by the crawl timeout
+func (s *Service) runCrawlTask(task crawlTask) {
+	ctx, cancel := context.WithTimeout(task.ctx, s.config.Scraper.CrawlTimeout)
+	defer cancel()
+
+	task.crawl(ctx)
+}
@@ -0,0 +1,126 @@
+package crawler
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// recoveryThreshold is the number of consecutive successful responses after
+// which the limiter shortens its delay
+const recoveryThreshold = 10
+
+// limitedSource is implemented by product sources whose rate limiter other
+// requests to the target, such as image downloads, must share
+type limitedSource interface {
+	limiter() *adaptiveLimiter
+}
+
+// adaptiveLimiter spaces outbound requests by a delay that adapts to the
+// target's responses: the delay doubles on 429/403 responses and shrinks by a
+// fixed step after sustained success (AIMD), staying within min/max bounds.
+type adaptiveLimiter struct {
+	delay     time.Duration
+	minDelay  time.Duration
+	maxDelay  time.Duration
+	step      time.Duration
+	next      time.Time
+	successes int
+	mu        sync.Mutex
+}
+
+// newAdaptiveLimiter creates a new adaptive limiter starting at the given delay
+func newAdaptiveLimiter(initial, minDelay, maxDelay time.Duration) *adaptiveLimiter {
+	if maxDelay < minDelay {
+		maxDelay = minDelay
+	}
+	if initial < minDelay {
+		initial = minDelay
+	}
+	if initial > maxDelay {
+		initial = maxDelay
+	}
+
+	step := minDelay
+	if step <= 0 {
+		step = 100 * time.Millisecond
+	}
+
+	return &adaptiveLimiter{
+		delay:    initial,
+		minDelay: minDelay,
+		maxDelay: maxDelay,
+		step:     step,
+	}
+}
+
+// wait blocks until the next request slot is available or ctx is done. A
+// wait cancelled by ctx releases its slot when no later wait reserved one
+// after it, so cancelled requests don't delay the ones that follow.
+func (l *adaptiveLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	reserved := slot.Add(l.delay)
+	l.next = reserved
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(slot))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		l.mu.Lock()
+		if l.next.Equal(reserved) {
+			l.next = slot
+		}
+		l.mu.Unlock()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// observe adapts the delay to a response from the target
+func (l *adaptiveLimiter) observe(resp *http.Response) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusForbidden {
+		// Multiplicative increase when the target pushes back
+		l.successes = 0
+		l.delay *= 2
+		if l.delay < l.step {
+			l.delay = l.step
+		}
+		if l.delay > l.maxDelay {
+			l.delay = l.maxDelay
+		}
+		log.Printf("Rate limited with status %d, increasing request delay to %s", resp.StatusCode, l.delay)
+
+		// Honor Retry-After when the target tells us how long to back off
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			retryAt := time.Now().Add(time.Duration(seconds) * time.Second)
+			if retryAt.After(l.next) {
+				l.next = retryAt
+			}
+		}
+		return
+	}
+
+	// Additive decrease after sustained success
+	l.successes++
+	if l.successes >= recoveryThreshold {
+		l.successes = 0
+		l.delay -= l.step
+		if l.delay < l.minDelay {
+			l.delay = l.minDelay
+		}
+	}
+}
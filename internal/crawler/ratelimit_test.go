@@ -0,0 +1,107 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveLimiterObserve(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []int
+		want      time.Duration
+	}{
+		{"rate limited", []int{http.StatusTooManyRequests}, 2 * time.Second},
+		{"forbidden", []int{http.StatusForbidden}, 2 * time.Second},
+		{"capped", []int{429, 429, 429, 429, 429}, 10 * time.Second},
+		{"too few successes", []int{429, 200, 200, 200}, 2 * time.Second},
+		{"recovered", append([]int{429}, successes(recoveryThreshold)...), 1500 * time.Millisecond},
+		{"not below minimum", successes(3 * recoveryThreshold), 500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newAdaptiveLimiter(time.Second, 500*time.Millisecond, 10*time.Second)
+			for _, status := range tt.responses {
+				l.observe(&http.Response{StatusCode: status, Header: http.Header{}})
+			}
+			if l.delay != tt.want {
+				t.Errorf("delay = %v, want %v", l.delay, tt.want)
+			}
+		})
+	}
+}
+
+// successes returns n successful response status codes
+func successes(n int) []int {
+	statuses := make([]int, n)
+	for i := range statuses {
+		statuses[i] = http.StatusOK
+	}
+	return statuses
+}
+
+func TestAdaptiveLimiterCancelReleasesSlot(t *testing.T) {
+	l := newAdaptiveLimiter(time.Hour, time.Hour, time.Hour)
+	if err := l.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	next := l.next
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.wait(ctx); err != context.Canceled {
+		t.Fatalf("error = %v, want %v", err, context.Canceled)
+	}
+
+	// The cancelled wait's slot is free for the next request
+	if !l.next.Equal(next) {
+		t.Errorf("next slot = %v, want %v", l.next, next)
+	}
+}
+
+func TestAdaptiveLimiterCancelKeepsLaterSlots(t *testing.T) {
+	l := newAdaptiveLimiter(time.Hour, time.Hour, time.Hour)
+	if err := l.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A wait that is cancelled after another reserved the slot following its own
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- l.wait(ctx) }()
+	waitForReservation(l, 90*time.Minute)
+
+	later, cancelLater := context.WithCancel(context.Background())
+	defer cancelLater()
+	go l.wait(later)
+	next := waitForReservation(l, 150*time.Minute)
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("error = %v, want %v", err, context.Canceled)
+	}
+
+	// Releasing the slot would let two requests share the later one
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.next.Equal(next) {
+		t.Errorf("next slot = %v, want %v", l.next, next)
+	}
+}
+
+// waitForReservation waits until a wait reserved the limiter's slots up to
+// at least ahead from now and returns the end of the reservation
+func waitForReservation(l *adaptiveLimiter, ahead time.Duration) time.Time {
+	for {
+		l.mu.Lock()
+		next := l.next
+		l.mu.Unlock()
+		if !next.Before(time.Now().Add(ahead)) {
+			return next
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,87 @@
+package crawler
+
+import (
+	"fmt"
+
+	"github.com/e-commerce/platform/internal/common/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// productRelation is a row of the product_relations join table
+type productRelation struct {
+	ProductID        uint
+	RelatedProductID uint
+}
+
+// saveRelations links a saved product to the related products it lists,
+// replacing its previous relations, and returns the external IDs of those
+// not crawled yet. They are kept as pending relations and linked once they
+// are crawled, as are pending relations of other products to this one.
+// Products whose source doesn't list related products keep their relations.
+func saveRelations(tx *gorm.DB, product *models.Product) ([]string, error) {
+	if err := tx.Exec(`
+		INSERT INTO product_relations (product_id, related_product_id)
+		SELECT product_id, ? FROM pending_product_relations WHERE related_external_id = ?
+		ON CONFLICT DO NOTHING
+	`, product.ID, product.ExternalID).Error; err != nil {
+		return nil, fmt.Errorf("failed to link pending relations: %w", err)
+	}
+	if err := tx.Where("related_external_id = ?", product.ExternalID).
+		Delete(&models.PendingProductRelation{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete linked pending relations: %w", err)
+	}
+
+	if product.RelatedIDs == nil {
+		return nil, nil
+	}
+
+	// Link the related products that were already crawled
+	var related []models.Product
+	if len(product.RelatedIDs) > 0 {
+		if err := tx.Select("id", "external_id").
+			Where("external_id IN ? AND id <> ?", product.RelatedIDs, product.ID).
+			Find(&related).Error; err != nil {
+			return nil, fmt.Errorf("failed to fetch related products: %w", err)
+		}
+	}
+	crawled := make(map[string]bool, len(related))
+	relations := make([]productRelation, 0, len(related))
+	for _, p := range related {
+		crawled[p.ExternalID] = true
+		relations = append(relations, productRelation{ProductID: product.ID, RelatedProductID: p.ID})
+	}
+
+	if err := tx.Table("product_relations").Where("product_id = ?", product.ID).
+		Delete(&productRelation{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete stale relations: %w", err)
+	}
+	if len(relations) > 0 {
+		if err := tx.Table("product_relations").Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&relations).Error; err != nil {
+			return nil, fmt.Errorf("failed to save relations: %w", err)
+		}
+	}
+
+	// Keep the others pending until they are crawled
+	if err := tx.Where("product_id = ?", product.ID).
+		Delete(&models.PendingProductRelation{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete stale pending relations: %w", err)
+	}
+	var missing []string
+	pending := make([]models.PendingProductRelation, 0)
+	for _, externalID := range product.RelatedIDs {
+		if crawled[externalID] || externalID == product.ExternalID {
+			continue
+		}
+		crawled[externalID] = true // Skip duplicates
+		missing = append(missing, externalID)
+		pending = append(pending, models.PendingProductRelation{ProductID: product.ID, RelatedExternalID: externalID})
+	}
+	if len(pending) > 0 {
+		if err := tx.Create(&pending).Error; err != nil {
+			return nil, fmt.Errorf("failed to save pending relations: %w", err)
+		}
+	}
+	return missing, nil
+}
@@ -2,8 +2,10 @@ package crawler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -13,6 +15,9 @@ import (
 	"github.com/PuerkitoBio/goquery"
 	"github.com/e-commerce/platform/internal/common/config"
 	"github.com/e-commerce/platform/internal/common/models"
+	"github.com/e-commerce/platform/internal/common/money"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 // Scraper is responsible for scraping product data from Trendyol
@@ -21,30 +26,45 @@ type Scraper struct {
 	config          *config.ScraperConfig
 	currentProxyIdx int
 	proxies         []string
-	rateLimiter     <-chan time.Time
+	rateLimiter     *adaptiveLimiter
+	breaker         *circuitBreaker
 }
 
 // NewScraper creates a new scraper instance
 func NewScraper(cfg *config.ScraperConfig) *Scraper {
 	client := &http.Client{
-		Timeout: cfg.RequestTimeout,
+		Timeout:   cfg.RequestTimeout,
+		// Spans of requests are recorded, but trace context isn't sent to the site
+		Transport: otelhttp.NewTransport(newTransport(cfg),
+			otelhttp.WithPropagators(propagation.NewCompositeTextMapPropagator())),
 	}
 
 	// Create a rate limiter to avoid getting banned
-	rateLimiter := time.Tick(cfg.RequestDelay)
+	rateLimiter := newAdaptiveLimiter(cfg.RequestDelay, cfg.MinRequestDelay, cfg.MaxRequestDelay)
 
 	return &Scraper{
 		client:      client,
 		config:      cfg,
 		rateLimiter: rateLimiter,
+		breaker:     newCircuitBreaker(cfg.CircuitFailureThreshold, cfg.CircuitCooldown),
 		proxies:     []string{}, // Add proxies if needed
 	}
 }
 
+// newTransport creates the scraper's HTTP transport, keeping enough idle
+// connections per host for concurrent crawls to reuse them instead of
+// opening a new connection per request
+func newTransport(cfg *config.ScraperConfig) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = cfg.MaxIdleConns
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	transport.IdleConnTimeout = cfg.IdleConnTimeout
+	transport.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout
+	return transport
+}
+
 // GetCategories fetches all product categories
 func (s *Scraper) GetCategories() ([]models.Category, error) {
-	<-s.rateLimiter // Rate limiting
-
 	// Create a request to fetch categories
 	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/categories", s.config.BaseURL), nil)
 	if err != nil {
@@ -54,7 +74,7 @@ func (s *Scraper) GetCategories() ([]models.Category, error) {
 	req.Header.Set("User-Agent", s.config.UserAgent)
 	req.Header.Set("Accept", "application/json")
 
-	resp, err := s.client.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -64,48 +84,20 @@ func (s *Scraper) GetCategories() ([]models.Category, error) {
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
-	// Parse the JSON response
-	var result struct {
-		Categories []struct {
-			ID          int    `json:"id"`
-			Name        string `json:"name"`
-			ParentID    *int   `json:"parentId"`
-			DisplayOrder int    `json:"displayOrder"`
-			Level       int    `json:"level"`
-			URL         string `json:"url"`
-		} `json:"categories"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	// Convert to Category models
-	categories := make([]models.Category, 0, len(result.Categories))
-	for _, cat := range result.Categories {
-		var parentID *uint
-		if cat.ParentID != nil {
-			parentUint := uint(*cat.ParentID)
-			parentID = &parentUint
-		}
-
-		category := models.Category{
-			Name:       cat.Name,
-			ExternalID: strconv.Itoa(cat.ID),
-			ParentID:   parentID,
-			Level:      cat.Level,
-			IsActive:   true,
-		}
-		categories = append(categories, category)
-	}
-
-	return categories, nil
+	return parseCategories(resp.Body)
 }
 
 // GetProductIDsByCategory fetches product IDs for a specific category
 func (s *Scraper) GetProductIDsByCategory(categoryID string) ([]string, error) {
-	<-s.rateLimiter // Rate limiting
+	listings, err := s.GetProductListings(categoryID)
+	if err != nil {
+		return nil, err
+	}
+	return listingIDs(listings), nil
+}
 
+// GetProductListings fetches the products of a specific category with their change signals
+func (s *Scraper) GetProductListings(categoryID string) ([]ProductListing, error) {
 	// Create a request to fetch products in a category
 	reqURL := fmt.Sprintf("%s/api/category/%s/products?page=1&limit=100", s.config.BaseURL, categoryID)
 	req, err := http.NewRequest("GET", reqURL, nil)
@@ -116,7 +108,7 @@ func (s *Scraper) GetProductIDsByCategory(categoryID string) ([]string, error) {
 	req.Header.Set("User-Agent", s.config.UserAgent)
 	req.Header.Set("Accept", "application/json")
 
-	resp, err := s.client.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -126,33 +118,77 @@ func (s *Scraper) GetProductIDsByCategory(categoryID string) ([]string, error) {
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
-	// Parse the JSON response
-	var result struct {
-		Products []struct {
-			ID string `json:"id"`
-		} `json:"products"`
-		TotalCount int `json:"totalCount"`
+	return parseProductListings(resp.Body)
+}
+
+// GetProductDetails fetches detailed information for a specific product. When
+// the details API returns a response it can't make sense of, as when its
+// format changed, the fields the HTML selectors find on the product page are
+// returned instead, as a partial product listing them in ScrapedFields.
+// Failed requests, such as rate limited, server error or timed out ones, are
+// returned for the crawl to retry instead, as the page would most likely fail
+// the same way, once RetryAttempts attempts failed.
+func (s *Scraper) GetProductDetails(productID string) (*models.Product, error) {
+	var (
+		product *models.Product
+		err     error
+	)
+	attempts := max(s.config.RetryAttempts, 1)
+	for attempt := 1; attempt <= attempts; attempt++ {
+		product, err = s.getProductDetailsJSON(productID)
+		if err == nil || !retryableDetailsError(err) || attempt == attempts {
+			break
+		}
+		time.Sleep(s.config.RetryDelay * time.Duration(attempt))
+	}
+	if err == nil || !unexpectedDetails(err) {
+		return product, err
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	product, pageErr := s.getProductPage(productID)
+	if pageErr != nil {
+		return nil, fmt.Errorf("%w (product page fallback failed: %v)", err, pageErr)
 	}
+	log.Printf("Scraped product %s from its page, the details API failed: %v", productID, err)
+	return product, nil
+}
 
-	// Extract product IDs
-	productIDs := make([]string, 0, len(result.Products))
-	for _, product := range result.Products {
-		productIDs = append(productIDs, product.ID)
+// getProductDetailsJSON fetches a product from the details API
+func (s *Scraper) getProductDetailsJSON(productID string) (*models.Product, error) {
+	// Create a request to fetch product details
+	reqURL := fmt.Sprintf("%s/api/product/%s", s.config.BaseURL, productID)
+	req, err := http.NewRequest("GET", reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	return productIDs, nil
+	req.Header.Set("User-Agent", s.config.UserAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Delisted products are gone for good, unlike other failed responses
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return nil, fmt.Errorf("%w: status code %d", ErrProductNotFound, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return parseProductDetails(resp.Body)
 }
 
-// GetProductDetails fetches detailed information for a specific product
-func (s *Scraper) GetProductDetails(productID string) (*models.Product, error) {
-	<-s.rateLimiter // Rate limiting
+// reviewsPageSize is the number of reviews requested per page
+const reviewsPageSize = 50
 
-	// Create a request to fetch product details
-	reqURL := fmt.Sprintf("%s/api/product/%s", s.config.BaseURL, productID)
+// GetProductReviews fetches a page of reviews for a specific product
+func (s *Scraper) GetProductReviews(productID string, page int) ([]models.Review, error) {
+	// Create a request to fetch product reviews
+	reqURL := fmt.Sprintf("%s/api/product/%s/reviews?page=%d&limit=%d", s.config.BaseURL, productID, page, reviewsPageSize)
 	req, err := http.NewRequest("GET", reqURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -161,7 +197,7 @@ func (s *Scraper) GetProductDetails(productID string) (*models.Product, error) {
 	req.Header.Set("User-Agent", s.config.UserAgent)
 	req.Header.Set("Accept", "application/json")
 
-	resp, err := s.client.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
@@ -171,6 +207,155 @@ func (s *Scraper) GetProductDetails(productID string) (*models.Product, error) {
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
+	return parseReviews(resp.Body)
+}
+
+// do sends a request with the configured headers and cookies once the rate
+// limiter allows it and adapts the rate limiter to the response
+func (s *Scraper) do(req *http.Request) (*http.Response, error) {
+	for name, value := range s.config.Headers {
+		req.Header.Set(name, value)
+	}
+	for name, value := range s.config.Cookies {
+		req.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+
+	if err := s.breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	if err := s.rateLimiter.wait(req.Context()); err != nil {
+		s.breaker.cancel()
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// A cancelled request says nothing about the target
+		if req.Context().Err() != nil {
+			s.breaker.cancel()
+		} else {
+			s.breaker.record(false)
+		}
+		return nil, err
+	}
+
+	s.breaker.record(resp.StatusCode < http.StatusInternalServerError)
+	s.rateLimiter.observe(resp)
+	return resp, nil
+}
+
+// limiter returns the rate limiter the scraper's requests wait for
+func (s *Scraper) limiter() *adaptiveLimiter {
+	return s.rateLimiter
+}
+
+// CircuitState returns the state of the scraper's circuit breaker and how often it tripped
+func (s *Scraper) CircuitState() (string, int64) {
+	return s.breaker.snapshot()
+}
+
+// parseCategories parses a categories response into Category models
+func parseCategories(r io.Reader) ([]models.Category, error) {
+	// Parse the JSON response
+	var result struct {
+		Categories []struct {
+			ID          int    `json:"id"`
+			Name        string `json:"name"`
+			ParentID    *int   `json:"parentId"`
+			DisplayOrder int    `json:"displayOrder"`
+			Level       int    `json:"level"`
+			URL         string `json:"url"`
+		} `json:"categories"`
+	}
+
+	if err := json.NewDecoder(r).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	// Convert to Category models
+	categories := make([]models.Category, 0, len(result.Categories))
+	for _, cat := range result.Categories {
+		// The source parent ID is an external ID and is resolved to the
+		// internal ParentID once the categories are stored
+		var parentExternalID string
+		if cat.ParentID != nil {
+			parentExternalID = strconv.Itoa(*cat.ParentID)
+		}
+
+		category := models.Category{
+			Name:             cat.Name,
+			ExternalID:       strconv.Itoa(cat.ID),
+			ParentExternalID: parentExternalID,
+			Level:            cat.Level,
+			IsActive:         true,
+		}
+		categories = append(categories, category)
+	}
+
+	return categories, nil
+}
+
+// parseProductListings parses a category products response into product
+// listings. Sources may include a contentHash and an RFC3339 lastModified per
+// product, which are left empty when missing or invalid.
+func parseProductListings(r io.Reader) ([]ProductListing, error) {
+	// Parse the JSON response
+	var result struct {
+		Products []struct {
+			ID           string `json:"id"`
+			ContentHash  string `json:"contentHash"`
+			LastModified string `json:"lastModified"`
+		} `json:"products"`
+		TotalCount int `json:"totalCount"`
+	}
+
+	if err := json.NewDecoder(r).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	listings := make([]ProductListing, 0, len(result.Products))
+	for _, product := range result.Products {
+		listing := ProductListing{ID: product.ID, ContentHash: product.ContentHash}
+		if lastModified, err := time.Parse(time.RFC3339, product.LastModified); err == nil {
+			listing.LastModified = lastModified
+		}
+		listings = append(listings, listing)
+	}
+
+	return listings, nil
+}
+
+// listingIDs returns the product IDs of listings
+func listingIDs(listings []ProductListing) []string {
+	productIDs := make([]string, 0, len(listings))
+	for _, listing := range listings {
+		productIDs = append(productIDs, listing.ID)
+	}
+	return productIDs
+}
+
+// errUnexpectedDetails is returned for product details responses without the
+// product's ID or name, as when the API changed its format
+var errUnexpectedDetails = errors.New("unexpected product details response")
+
+// unexpectedDetails reports whether err means a details response came back
+// but couldn't be parsed, rather than the request failing
+func unexpectedDetails(err error) bool {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return errors.Is(err, errUnexpectedDetails) || errors.As(err, &syntaxErr) || errors.As(err, &typeErr)
+}
+
+// retryableDetailsError reports whether a failed details request may succeed
+// when sent again. Delisted products, responses that can't be parsed and
+// requests the open circuit breaker refused won't.
+func retryableDetailsError(err error) bool {
+	return !errors.Is(err, ErrProductNotFound) && !errors.Is(err, errCircuitOpen) && !unexpectedDetails(err)
+}
+
+// parseProductDetails parses a product details response into a Product model
+func parseProductDetails(r io.Reader) (*models.Product, error) {
 	// Parse the JSON response
 	var result struct {
 		ID               string  `json:"id"`
@@ -194,6 +379,8 @@ func (s *Scraper) GetProductDetails(productID string) (*models.Product, error) {
 		DiscountRate     int     `json:"discountRate"`
 		HasVideo         bool    `json:"hasVideo"`
 		InstallmentCount int     `json:"installmentCount"`
+		Currency         string  `json:"currency"`
+		ContentHash      string  `json:"contentHash"`
 		Images           []struct {
 			ID     string `json:"id"`
 			URL    string `json:"url"`
@@ -207,6 +394,7 @@ func (s *Scraper) GetProductDetails(productID string) (*models.Product, error) {
 			ID            string  `json:"id"`
 			Price         float64 `json:"price"`
 			OriginalPrice float64 `json:"originalPrice"`
+			Currency      string  `json:"currency"`
 			DiscountRate  int     `json:"discountRate"`
 			StockCount    int     `json:"stockCount"`
 			IsInStock     bool    `json:"isInStock"`
@@ -222,11 +410,34 @@ func (s *Scraper) GetProductDetails(productID string) (*models.Product, error) {
 			Value string `json:"value"`
 		} `json:"attributes"`
 		RelatedProducts []string `json:"relatedProductIds"`
+		SellerOffers    []struct {
+			SellerID      string  `json:"sellerId"`
+			SellerName    string  `json:"sellerName"`
+			SellerRating  float64 `json:"sellerRating"`
+			PositiveRatio float64 `json:"positiveRatio"`
+			Price         float64 `json:"price"`
+			Currency      string  `json:"currency"`
+			StockCount    int     `json:"stockCount"`
+			URL           string  `json:"url"`
+		} `json:"sellerOffers"`
+		Bundle *struct {
+			Price         float64 `json:"price"`
+			OriginalPrice float64 `json:"originalPrice"`
+			Currency      string  `json:"currency"`
+			StockCount    int     `json:"stockCount"`
+			Items         []struct {
+				ProductID string `json:"productId"`
+				Quantity  int    `json:"quantity"`
+			} `json:"items"`
+		} `json:"bundle"`
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	if err := json.NewDecoder(r).Decode(&result); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
+	if result.ID == "" || result.Name == "" {
+		return nil, errUnexpectedDetails
+	}
 
 	// Create brand model
 	brand := models.Brand{
@@ -267,6 +478,7 @@ func (s *Scraper) GetProductDetails(productID string) (*models.Product, error) {
 		FavoriteCount: result.FavoriteCount,
 		CommentCount:  result.CommentCount,
 		LastUpdated:   time.Now(),
+		ContentHash:   result.ContentHash,
 	}
 
 	// Add images
@@ -300,8 +512,9 @@ func (s *Scraper) GetProductDetails(productID string) (*models.Product, error) {
 		}
 
 		attrValue := models.AttributeValue{
-			Value:      attr.Value,
-			ExternalID: fmt.Sprintf("%s-%s", attr.ID, url.QueryEscape(attr.Value)),
+			AttributeName: attr.Name,
+			Value:         attr.Value,
+			ExternalID:    fmt.Sprintf("%s-%s", attr.ID, url.QueryEscape(attr.Value)),
 		}
 		attributeValueMap[attrValue.ExternalID] = attrValue
 
@@ -321,6 +534,7 @@ func (s *Scraper) GetProductDetails(productID string) (*models.Product, error) {
 			ExternalID:      v.ID,
 			Price:           v.Price,
 			OriginalPrice:   v.OriginalPrice,
+			Currency:        money.Normalize(v.Currency, money.Normalize(result.Currency, "")),
 			DiscountRate:    v.DiscountRate,
 			StockCount:      v.StockCount,
 			IsActive:        v.IsInStock,
@@ -330,8 +544,9 @@ func (s *Scraper) GetProductDetails(productID string) (*models.Product, error) {
 		// Add variant attributes
 		for _, attr := range v.Attributes {
 			attrValue := models.AttributeValue{
-				Value:      attr.Value,
-				ExternalID: fmt.Sprintf("%s-%s", attr.ID, url.QueryEscape(attr.Value)),
+				AttributeName: attr.Name,
+				Value:         attr.Value,
+				ExternalID:    fmt.Sprintf("%s-%s", attr.ID, url.QueryEscape(attr.Value)),
 			}
 
 			if existingValue, exists := attributeValueMap[attrValue.ExternalID]; !exists {
@@ -345,13 +560,110 @@ func (s *Scraper) GetProductDetails(productID string) (*models.Product, error) {
 		product.Variants = append(product.Variants, variant)
 	}
 
+	// Related products are linked when the product is saved
+	product.RelatedIDs = result.RelatedProducts
+
+	// Add the offers of other sellers listing the same product, an empty list
+	// when the response lists none so the stored ones are deleted
+	if result.SellerOffers != nil {
+		product.Offers = make([]models.SellerOffer, 0, len(result.SellerOffers))
+	}
+	for _, offer := range result.SellerOffers {
+		product.Offers = append(product.Offers, models.SellerOffer{
+			Seller: models.Seller{
+				Name:          offer.SellerName,
+				ExternalID:    offer.SellerID,
+				Rating:        offer.SellerRating,
+				PositiveRatio: offer.PositiveRatio,
+				IsActive:      true,
+			},
+			Price:      offer.Price,
+			Currency:   money.Normalize(offer.Currency, money.Normalize(result.Currency, "")),
+			StockCount: offer.StockCount,
+			URL:        offer.URL,
+		})
+	}
+
+	// Bundles list the products they contain with the price of the whole set
+	if result.Bundle != nil && len(result.Bundle.Items) > 0 {
+		bundle := &models.Bundle{
+			Price:         result.Bundle.Price,
+			OriginalPrice: result.Bundle.OriginalPrice,
+			Currency:      money.Normalize(result.Bundle.Currency, money.Normalize(result.Currency, "")),
+		}
+
+		itemIndex := make(map[string]int, len(result.Bundle.Items))
+		for _, item := range result.Bundle.Items {
+			quantity := max(item.Quantity, 1)
+			if i, exists := itemIndex[item.ProductID]; exists {
+				bundle.Items[i].Quantity += quantity
+				continue
+			}
+			itemIndex[item.ProductID] = len(bundle.Items)
+			bundle.Items = append(bundle.Items, models.BundleItem{
+				ProductExternalID: item.ProductID,
+				Quantity:          quantity,
+			})
+		}
+		product.Bundle = bundle
+
+		// A bundle sold only as a whole has no variants, its total price is
+		// recorded as a variant so price history and alerts watch it
+		if len(product.Variants) == 0 {
+			product.Variants = append(product.Variants, models.Variant{
+				ExternalID:    result.ID + "-bundle",
+				Price:         bundle.Price,
+				OriginalPrice: bundle.OriginalPrice,
+				Currency:      bundle.Currency,
+				DiscountRate:  result.DiscountRate,
+				StockCount:    result.Bundle.StockCount,
+				IsActive:      result.IsInStock,
+				InstallmentInfo: models.InstallmentOptions{
+					Available: result.InstallmentCount > 0,
+					MaxMonths: result.InstallmentCount,
+				},
+			})
+		}
+	}
+
 	return product, nil
 }
 
+// parseReviews parses a product reviews response into Review models
+func parseReviews(r io.Reader) ([]models.Review, error) {
+	// Parse the JSON response
+	var result struct {
+		Reviews []struct {
+			ID           string    `json:"id"`
+			Rating       int       `json:"rate"`
+			Comment      string    `json:"comment"`
+			UserFullName string    `json:"userFullName"`
+			CreatedDate  time.Time `json:"createdDate"`
+		} `json:"reviews"`
+	}
+
+	if err := json.NewDecoder(r).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	// Convert to Review models
+	reviews := make([]models.Review, 0, len(result.Reviews))
+	for _, rev := range result.Reviews {
+		review := models.Review{
+			ExternalID: rev.ID,
+			Rating:     rev.Rating,
+			Text:       rev.Comment,
+			Author:     rev.UserFullName,
+			PostedAt:   rev.CreatedDate,
+		}
+		reviews = append(reviews, review)
+	}
+
+	return reviews, nil
+}
+
 // scrapeHTML parses HTML content using goquery
 func (s *Scraper) scrapeHTML(url string) (*goquery.Document, error) {
-	<-s.rateLimiter // Rate limiting
-
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -359,7 +671,7 @@ func (s *Scraper) scrapeHTML(url string) (*goquery.Document, error) {
 
 	req.Header.Set("User-Agent", s.config.UserAgent)
 
-	resp, err := s.client.Do(req)
+	resp, err := s.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
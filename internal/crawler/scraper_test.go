@@ -0,0 +1,131 @@
+package crawler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/e-commerce/platform/internal/common/config"
+)
+
+// productPage is a product page the default selectors find a name and price on
+const productPage = `<html><body><h1>Page Product</h1><span class="prc-dsc">149,90 TL</span></body></html>`
+
+func TestGetProductDetailsFallback(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		body         string
+		wantRequests int32
+		wantPage     bool
+		wantErr      error
+	}{
+		{"details", http.StatusOK, `{"id": "1", "name": "API Product"}`, 1, false, nil},
+		{"changed format", http.StatusOK, `{"productId": "1"}`, 1, true, nil},
+		{"not JSON", http.StatusOK, `<html>`, 1, true, nil},
+		{"wrong types", http.StatusOK, `{"id": 1}`, 1, true, nil},
+		{"delisted", http.StatusNotFound, ``, 1, false, ErrProductNotFound},
+		{"rate limited", http.StatusTooManyRequests, ``, 3, false, nil},
+		{"server error", http.StatusInternalServerError, ``, 3, false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var apiRequests, pageRequests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasPrefix(r.URL.Path, "/api/") {
+					apiRequests.Add(1)
+					w.WriteHeader(tt.status)
+					w.Write([]byte(tt.body))
+					return
+				}
+				pageRequests.Add(1)
+				w.Write([]byte(productPage))
+			}))
+			defer server.Close()
+
+			scraper := NewScraper(&config.ScraperConfig{
+				BaseURL:         server.URL,
+				RetryAttempts:   3,
+				ProductPagePath: "/product/{id}",
+				Selectors:       config.DefaultSelectors,
+			})
+
+			product, err := scraper.GetProductDetails("1")
+			if got := apiRequests.Load(); got != tt.wantRequests {
+				t.Errorf("details requests = %d, want %d", got, tt.wantRequests)
+			}
+			if fetched := pageRequests.Load() > 0; fetched != tt.wantPage {
+				t.Errorf("page fetched = %v, want %v", fetched, tt.wantPage)
+			}
+
+			wantErr := tt.wantErr != nil || tt.wantRequests > 1
+			if (err != nil) != wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, wantErr)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && tt.wantPage && len(product.ScrapedFields) == 0 {
+				t.Error("product scraped from its page lists no scraped fields")
+			}
+		})
+	}
+}
+
+func TestGetProductDetailsCircuitOpen(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	scraper := NewScraper(&config.ScraperConfig{
+		BaseURL:                 server.URL,
+		RetryAttempts:           3,
+		CircuitFailureThreshold: 2,
+		CircuitCooldown:         time.Minute,
+	})
+
+	// The retries trip the breaker, which stops further requests and the page fallback
+	if _, err := scraper.GetProductDetails("1"); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("error = %v, want %v", err, errCircuitOpen)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+}
+
+func TestParseProductDetailsOffers(t *testing.T) {
+	tests := []struct {
+		name   string
+		offers string
+		listed bool
+		count  int
+	}{
+		{"not listed", ``, false, 0},
+		{"null", `, "sellerOffers": null`, false, 0},
+		{"none", `, "sellerOffers": []`, true, 0},
+		{"one", `, "sellerOffers": [{"sellerId": "s1", "sellerName": "Seller", "price": 10}]`, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			product, err := parseProductDetails(strings.NewReader(`{"id": "1", "name": "Product"` + tt.offers + `}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (product.Offers != nil) != tt.listed {
+				t.Errorf("offers listed = %v, want %v", product.Offers != nil, tt.listed)
+			}
+			if len(product.Offers) != tt.count {
+				t.Errorf("got %d offers, want %d", len(product.Offers), tt.count)
+			}
+		})
+	}
+}
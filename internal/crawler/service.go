@@ -3,8 +3,11 @@ package crawler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"slices"
 	"sync"
 	"time"
 
@@ -12,6 +15,9 @@ import (
 	"github.com/e-commerce/platform/internal/common/db"
 	"github.com/e-commerce/platform/internal/common/messaging"
 	"github.com/e-commerce/platform/internal/common/models"
+	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // Service represents the crawler service
@@ -19,59 +25,160 @@ type Service struct {
 	db           *db.Database
 	kafka        *messaging.KafkaClient
 	config       *config.Config
-	scraper      *Scraper
-	priorityList map[string]int // Maps productID to priority level
-	priorityMux  sync.RWMutex   // Mutex for the priority list
+	source       ProductSource
+	priorityList map[string]int       // Maps productID to priority level
+	priorityMux  sync.RWMutex         // Mutex for the priority list
+	discovered   map[string]time.Time // Related products queued for a crawl, by external ID, with when they were queued
+	inFlight     map[string]bool      // Products currently being crawled
+	inFlightMux  sync.Mutex           // Mutex for the in-flight products
+	crawlQueue   chan crawlTask       // Crawls triggered through the API, run by the trigger workers
+	background   sync.WaitGroup       // Background goroutines, waited for by Stop
 }
 
-// NewCrawlerService creates a new crawler service
-func NewCrawlerService(db *db.Database, kafka *messaging.KafkaClient, cfg *config.Config) *Service {
+// Crawl priorities of products found in listings and of favorited products
+const (
+	defaultPriority  = 1
+	favoritePriority = 10
+)
+
+// errCrawlInFlight is returned when a product is already being crawled
+var errCrawlInFlight = errors.New("product is already being crawled")
+
+// NewCrawlerService creates a new crawler service that crawls the given product source
+func NewCrawlerService(db *db.Database, kafka *messaging.KafkaClient, cfg *config.Config, source ProductSource) *Service {
 	return &Service{
 		db:           db,
 		kafka:        kafka,
 		config:       cfg,
-		scraper:      NewScraper(&cfg.Scraper),
+		source:       source,
 		priorityList: make(map[string]int),
+		discovered:   make(map[string]time.Time),
+		inFlight:     make(map[string]bool),
+		crawlQueue:   make(chan crawlTask, max(cfg.Scraper.TriggerQueueSize, 0)),
 	}
 }
 
 // Start starts the crawler service
 func (s *Service) Start(ctx context.Context) error {
-	// Create Kafka producer for product updates
-	if err := s.kafka.CreateProducer(s.config.Kafka.ProductTopic); err != nil {
+	// Create the topics used by the crawler if the cluster doesn't auto-create them
+	if err := s.kafka.EnsureTopics(ctx, []messaging.TopicSpec{
+		{Name: s.config.Kafka.ProductTopic},
+		{Name: s.config.Kafka.PriorityTopic},
+		{Name: s.config.Kafka.ChangeTopic},
+		{Name: s.config.Kafka.CreatedTopic},
+	}); err != nil {
+		log.Printf("Warning: failed to ensure Kafka topics: %v", err)
+	}
+
+	// Create Kafka producer for product updates. The analyzer reloads each product
+	// from the database, so updates are spread evenly rather than ordered per product.
+	if err := s.kafka.CreateProducer(s.config.Kafka.ProductTopic, messaging.PartitionLeastBytes); err != nil {
+		return fmt.Errorf("failed to create Kafka producer: %w", err)
+	}
+
+	// Create Kafka producer for product changes, keyed by product so each
+	// product's changes are consumed in order
+	if err := s.kafka.CreateProducer(s.config.Kafka.ChangeTopic, messaging.PartitionByKeyHash); err != nil {
+		return fmt.Errorf("failed to create Kafka producer: %w", err)
+	}
+
+	// Create Kafka producer for newly discovered products
+	if err := s.kafka.CreateProducer(s.config.Kafka.CreatedTopic, messaging.PartitionByKeyHash); err != nil {
 		return fmt.Errorf("failed to create Kafka producer: %w", err)
 	}
 
 	// Load priority list from user favorites
-	if err := s.loadPriorityList(); err != nil {
+	if _, err := s.loadPriorityList(); err != nil {
 		log.Printf("Warning: failed to load priority list: %v", err)
 	}
 
 	// Start periodic crawling
-	go s.periodicCrawling(ctx)
+	s.run(func() { s.periodicCrawling(ctx) })
+
+	// Start the workers running crawls triggered through the API
+	for i := 0; i < s.triggerWorkers(); i++ {
+		s.run(func() { s.runCrawlQueue(ctx) })
+	}
 
 	// Listen for priority update requests
-	go s.listenForPriorityUpdates(ctx)
+	s.run(func() { s.listenForPriorityUpdates(ctx) })
+
+	// Publish the change events Kafka failed to take when they were saved
+	s.run(func() { s.relayOutbox(ctx) })
+
+	// Start measuring how far the consumers lag behind their topics
+	s.run(func() { s.kafka.MonitorConsumerLag(ctx, s.config.Kafka.LagCheckInterval) })
+
+	// Copy product images to our own storage if enabled
+	if s.config.ImageMirror.Enabled {
+		var limiter *adaptiveLimiter
+		if source, ok := s.source.(limitedSource); ok {
+			limiter = source.limiter()
+		}
+		mirror := newImageMirror(s.db, s.config, limiter)
+		s.run(func() { mirror.run(ctx) })
+	}
 
 	return nil
 }
 
-// loadPriorityList loads the priority list from user favorites
-func (s *Service) loadPriorityList() error {
+// run runs fn in the background, tracked so Stop waits for it to finish
+func (s *Service) run(fn func()) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		fn()
+	}()
+}
+
+// Stop waits for the service's background work to finish once the context
+// passed to Start is cancelled. Consumers stop reading messages but finish
+// the ones being handled. It returns ctx's error if ctx is done first.
+func (s *Service) Stop(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for background work: %w", ctx.Err())
+	}
+}
+
+// loadPriorityList loads the priority list from user favorites and returns how
+// many favorited products it prioritized. Products left at favorite priority
+// that are no longer favorited drop back to the default priority, so it can be
+// re-run to pick up changes made directly in the database.
+func (s *Service) loadPriorityList() (int, error) {
 	var userFavorites []models.UserFavorite
 	if err := s.db.Preload("Product").Find(&userFavorites).Error; err != nil {
-		return fmt.Errorf("failed to load user favorites: %w", err)
+		return 0, fmt.Errorf("failed to load user favorites: %w", err)
+	}
+
+	favorites := make(map[string]bool, len(userFavorites))
+	for _, favorite := range userFavorites {
+		favorites[favorite.Product.ExternalID] = true
 	}
 
 	s.priorityMux.Lock()
 	defer s.priorityMux.Unlock()
 
-	for _, favorite := range userFavorites {
+	for productID, priority := range s.priorityList {
+		if priority == favoritePriority && !favorites[productID] {
+			s.priorityList[productID] = defaultPriority
+		}
+	}
+
+	for productID := range favorites {
 		// Set higher priority for favorited products
-		s.priorityList[favorite.Product.ExternalID] = 10
+		s.priorityList[productID] = favoritePriority
 	}
 
-	return nil
+	return len(favorites), nil
 }
 
 // periodicCrawling performs periodic crawling based on priority
@@ -80,104 +187,212 @@ func (s *Service) periodicCrawling(ctx context.Context) {
 	highPriorityTicker := time.NewTicker(5 * time.Minute) // Higher priority crawl interval
 
 	// Get category list to start crawling
-	categories, err := s.scraper.GetCategories()
+	categories, err := s.source.GetCategories()
 	if err != nil {
 		log.Printf("Error getting categories: %v", err)
 		return
 	}
 
 	// Store categories in the database
-	for _, category := range categories {
+	s.saveCategories(categories)
+
+	// Start crawling products by category
+	s.run(func() { s.crawlProductsByCategory(ctx, categories) })
+
+	for {
+		select {
+		case <-ctx.Done():
+			ticker.Stop()
+			highPriorityTicker.Stop()
+			return
+		case <-ticker.C:
+			// Regular priority crawling
+			s.run(func() { s.crawlRegularPriorityProducts(ctx) })
+		case <-highPriorityTicker.C:
+			// High priority crawling
+			s.run(func() { s.crawlHighPriorityProducts(ctx) })
+		}
+	}
+}
+
+// saveCategories stores categories and links them to their parents. Parents are
+// linked in a second pass since the source doesn't guarantee parents come first.
+func (s *Service) saveCategories(categories []models.Category) {
+	// First pass: create or update categories and collect their internal IDs
+	idsByExternalID := make(map[string]uint, len(categories))
+	for i := range categories {
+		category := &categories[i]
+
 		var existingCategory models.Category
 		result := s.db.Where("external_id = ?", category.ExternalID).First(&existingCategory)
 		if result.Error != nil {
 			// Create new category
-			if err := s.db.Create(&category).Error; err != nil {
+			if err := s.db.Omit("ParentID").Create(category).Error; err != nil {
 				log.Printf("Error creating category: %v", err)
+				continue
 			}
 		} else {
-			// Update existing category
+			// Update existing category, keeping the parent until it is resolved
 			category.ID = existingCategory.ID
-			if err := s.db.Save(&category).Error; err != nil {
+			category.CreatedAt = existingCategory.CreatedAt
+			category.ParentID = existingCategory.ParentID
+			if err := s.db.Save(category).Error; err != nil {
 				log.Printf("Error updating category: %v", err)
+				continue
 			}
 		}
+		idsByExternalID[category.ExternalID] = category.ID
 	}
 
-	// Start crawling products by category
-	go s.crawlProductsByCategory(ctx, categories)
+	// Second pass: resolve parent external IDs to internal IDs
+	for i := range categories {
+		category := &categories[i]
+		if category.ID == 0 {
+			continue
+		}
 
-	for {
-		select {
-		case <-ctx.Done():
-			ticker.Stop()
-			highPriorityTicker.Stop()
-			return
-		case <-ticker.C:
-			// Regular priority crawling
-			go s.crawlRegularPriorityProducts(ctx)
-		case <-highPriorityTicker.C:
-			// High priority crawling
-			go s.crawlHighPriorityProducts(ctx)
+		var parentID *uint
+		if category.ParentExternalID != "" {
+			id, exists := idsByExternalID[category.ParentExternalID]
+			if !exists {
+				// Fall back to a parent stored by an earlier crawl
+				var parent models.Category
+				if err := s.db.Select("id").Where("external_id = ?", category.ParentExternalID).First(&parent).Error; err != nil {
+					log.Printf("Parent category %s not found for category %s", category.ParentExternalID, category.ExternalID)
+					continue
+				}
+				id = parent.ID
+			}
+			parentID = &id
+		}
+
+		category.ParentID = parentID
+		if err := s.db.Model(&models.Category{}).Where("id = ?", category.ID).Update("parent_id", parentID).Error; err != nil {
+			log.Printf("Error linking category %s to its parent: %v", category.ExternalID, err)
 		}
 	}
 }
 
 // crawlProductsByCategory crawls products by category
 func (s *Service) crawlProductsByCategory(ctx context.Context, categories []models.Category) {
+	crawled := filterCategories(categories, s.config.Scraper.CategoryAllowlist, s.config.Scraper.CategoryDenylist)
+	crawled = withSubcategories(categories, crawled, s.crawlMaxDepth())
+	if len(s.config.Scraper.CategoryAllowlist) == 0 {
+		// Subcategories of crawled categories may be denylisted themselves
+		crawled = filterCategories(crawled, nil, s.config.Scraper.CategoryDenylist)
+	}
+	categories = crawled
+
 	for _, category := range categories {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			productIDs, err := s.scraper.GetProductIDsByCategory(category.ExternalID)
+			productIDs, err := s.source.GetProductIDsByCategory(category.ExternalID)
 			if err != nil {
 				log.Printf("Error getting product IDs for category %s: %v", category.Name, err)
 				continue
 			}
 
+			newProductIDs := make([]string, 0, len(productIDs))
 			for _, productID := range productIDs {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-					// Check if product already exists in the database
-					var existingProduct models.Product
-					result := s.db.Where("external_id = ?", productID).First(&existingProduct)
-					if result.Error == nil {
-						// Product exists, update its priority in the list
-						s.priorityMux.Lock()
-						if _, exists := s.priorityList[productID]; !exists {
-							s.priorityList[productID] = 1 // Default priority
-						}
-						s.priorityMux.Unlock()
-					} else {
-						// New product, crawl it immediately
-						product, err := s.scraper.GetProductDetails(productID)
-						if err != nil {
-							log.Printf("Error getting product details for ID %s: %v", productID, err)
-							continue
-						}
-
-						// Save the product to the database
-						if err := s.saveProduct(product); err != nil {
-							log.Printf("Error saving product: %v", err)
-							continue
-						}
-
-						// Publish product to Kafka
-						if err := s.publishProductUpdate(ctx, product); err != nil {
-							log.Printf("Error publishing product update: %v", err)
-						}
+				// Check if product already exists in the database
+				var existingProduct models.Product
+				result := s.db.Where("external_id = ?", productID).First(&existingProduct)
+				if result.Error == nil {
+					// Product exists, update its priority in the list
+					s.priorityMux.Lock()
+					if _, exists := s.priorityList[productID]; !exists {
+						s.priorityList[productID] = defaultPriority
 					}
+					s.priorityMux.Unlock()
+				} else {
+					// New product, crawl it immediately
+					newProductIDs = append(newProductIDs, productID)
+				}
+			}
+
+			s.crawlProducts(ctx, newProductIDs, nil)
+		}
+	}
+}
+
+// filterCategories returns the categories whose external ID is in allowlist,
+// or when the allowlist is empty, the categories whose external ID isn't in denylist
+func filterCategories(categories []models.Category, allowlist, denylist []string) []models.Category {
+	if len(allowlist) == 0 && len(denylist) == 0 {
+		return categories
+	}
+
+	filtered := make([]models.Category, 0, len(categories))
+	for _, category := range categories {
+		if len(allowlist) > 0 {
+			if slices.Contains(allowlist, category.ExternalID) {
+				filtered = append(filtered, category)
+			}
+		} else if !slices.Contains(denylist, category.ExternalID) {
+			filtered = append(filtered, category)
+		}
+	}
+	return filtered
+}
+
+// crawlMaxDepth returns the levels of the category tree crawled from a category
+func (s *Service) crawlMaxDepth() int {
+	if s.config.Scraper.CrawlMaxDepth > 0 {
+		return s.config.Scraper.CrawlMaxDepth
+	}
+	return 1
+}
+
+// withSubcategories returns roots followed by their children down to maxDepth
+// levels, counting the roots as the first, looked up in all. Each category is
+// returned once, so parent cycles and overlapping roots don't repeat crawls.
+func withSubcategories(all, roots []models.Category, maxDepth int) []models.Category {
+	children := make(map[uint][]models.Category)
+	for _, category := range all {
+		if category.ParentID != nil && category.ID != 0 {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+	}
+
+	result := make([]models.Category, 0, len(roots))
+	visited := make(map[string]bool, len(roots))
+	level := make([]models.Category, 0, len(roots))
+	for _, root := range roots {
+		if !visited[root.ExternalID] {
+			visited[root.ExternalID] = true
+			level = append(level, root)
+		}
+	}
+
+	for depth := 1; len(level) > 0; depth++ {
+		result = append(result, level...)
+		if depth == maxDepth {
+			break
+		}
+
+		var next []models.Category
+		for _, category := range level {
+			if category.ID == 0 {
+				continue
+			}
+			for _, child := range children[category.ID] {
+				if !visited[child.ExternalID] {
+					visited[child.ExternalID] = true
+					next = append(next, child)
 				}
 			}
 		}
+		level = next
 	}
+	return result
 }
 
 // crawlRegularPriorityProducts crawls regular priority products
 func (s *Service) crawlRegularPriorityProducts(ctx context.Context) {
+	s.expireDiscovered(time.Now().Add(-discoveredProductTTL))
+
 	s.priorityMux.RLock()
 	regularPriorityProducts := make([]string, 0)
 	for productID, priority := range s.priorityList {
@@ -193,29 +408,92 @@ func (s *Service) crawlRegularPriorityProducts(ctx context.Context) {
 		regularPriorityProducts = regularPriorityProducts[:maxProducts]
 	}
 
-	for _, productID := range regularPriorityProducts {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			product, err := s.scraper.GetProductDetails(productID)
-			if err != nil {
-				log.Printf("Error getting product details for ID %s: %v", productID, err)
-				continue
+	// Skip products the listings report unchanged since they were last fetched
+	unchanged := s.unchangedProducts(regularPriorityProducts)
+	if len(unchanged) > 0 {
+		changedProducts := make([]string, 0, len(regularPriorityProducts)-len(unchanged))
+		for _, productID := range regularPriorityProducts {
+			if !unchanged[productID] {
+				changedProducts = append(changedProducts, productID)
 			}
+		}
+		log.Printf("Skipping %d unchanged regular priority products", len(unchanged))
+		regularPriorityProducts = changedProducts
 
-			// Save the product to the database
-			if err := s.saveProduct(product); err != nil {
-				log.Printf("Error saving product: %v", err)
-				continue
-			}
+		// They are up to date as of this crawl
+		unchangedIDs := make([]string, 0, len(unchanged))
+		for productID := range unchanged {
+			unchangedIDs = append(unchangedIDs, productID)
+		}
+		if err := s.db.WithContext(ctx).Model(&models.Product{}).
+			Where("external_id IN ?", unchangedIDs).
+			UpdateColumn("last_crawled_at", time.Now()).Error; err != nil {
+			log.Printf("Error recording crawl of unchanged products: %v", err)
+		}
+	}
+
+	s.crawlProducts(ctx, regularPriorityProducts, nil)
+}
+
+// unchangedProducts returns the saved products among productIDs whose
+// category listing reports them unchanged: their content hash matches the
+// stored one or, when the listing has no hash, they were last modified before
+// they were last fetched. Products without such a signal are fetched in full.
+func (s *Service) unchangedProducts(productIDs []string) map[string]bool {
+	unchanged := make(map[string]bool)
+	if len(productIDs) == 0 {
+		return unchanged
+	}
+
+	var products []struct {
+		ExternalID         string
+		ContentHash        string
+		LastUpdated        time.Time
+		CategoryExternalID string
+	}
+	if err := s.db.Model(&models.Product{}).
+		Select("products.external_id, products.content_hash, products.last_updated, categories.external_id AS category_external_id").
+		Joins("JOIN categories ON categories.id = products.category_id").
+		Where("products.external_id IN ?", productIDs).
+		Scan(&products).Error; err != nil {
+		log.Printf("Error fetching products to check for changes: %v", err)
+		return unchanged
+	}
+
+	// List each category once
+	listings := make(map[string]ProductListing)
+	listed := make(map[string]bool)
+	for _, product := range products {
+		if listed[product.CategoryExternalID] {
+			continue
+		}
+		listed[product.CategoryExternalID] = true
+
+		categoryListings, err := s.source.GetProductListings(product.CategoryExternalID)
+		if err != nil {
+			log.Printf("Error getting product listings for category %s: %v", product.CategoryExternalID, err)
+			continue
+		}
+		for _, listing := range categoryListings {
+			listings[listing.ID] = listing
+		}
+	}
 
-			// Publish product to Kafka
-			if err := s.publishProductUpdate(ctx, product); err != nil {
-				log.Printf("Error publishing product update: %v", err)
+	for _, product := range products {
+		listing, ok := listings[product.ExternalID]
+		if !ok {
+			continue
+		}
+		if listing.ContentHash != "" {
+			if listing.ContentHash == product.ContentHash {
+				unchanged[product.ExternalID] = true
 			}
+		} else if !listing.LastModified.IsZero() && listing.LastModified.Before(product.LastUpdated) {
+			unchanged[product.ExternalID] = true
 		}
 	}
+
+	return unchanged
 }
 
 // crawlHighPriorityProducts crawls high priority products
@@ -229,93 +507,383 @@ func (s *Service) crawlHighPriorityProducts(ctx context.Context) {
 	}
 	s.priorityMux.RUnlock()
 
-	for _, productID := range highPriorityProducts {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			product, err := s.scraper.GetProductDetails(productID)
-			if err != nil {
-				log.Printf("Error getting product details for ID %s: %v", productID, err)
-				continue
+	s.crawlProducts(ctx, highPriorityProducts, nil)
+}
+
+// publishBatchSize is the number of product updates crawlProducts publishes in one write
+const publishBatchSize = 100
+
+// crawlProducts crawls products in parallel using a worker pool bounded by
+// ConcurrentRequests. Outbound requests are still serialized by the scraper's
+// rate limiter, the pool only overlaps saving and publishing with fetching.
+// Product updates are published in batches of publishBatchSize.
+// onProduct, if not nil, is called with the outcome of each product.
+func (s *Service) crawlProducts(ctx context.Context, productIDs []string, onProduct func(err error)) {
+	var pendingMux sync.Mutex
+	pending := make([]messaging.Message, 0, publishBatchSize)
+
+	// takePending returns the pending updates if there are at least threshold of them
+	takePending := func(threshold int) []messaging.Message {
+		pendingMux.Lock()
+		defer pendingMux.Unlock()
+
+		if len(pending) < threshold {
+			return nil
+		}
+		batch := pending
+		pending = make([]messaging.Message, 0, publishBatchSize)
+		return batch
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(s.concurrency())
+
+	for _, productID := range productIDs {
+		if gctx.Err() != nil {
+			break
+		}
+
+		g.Go(func() error {
+			// Errors are logged per product so one failure doesn't cancel the others
+			product, err := s.fetchProduct(gctx, productID)
+			if err == nil {
+				pendingMux.Lock()
+				pending = append(pending, productUpdateMessage(product))
+				pendingMux.Unlock()
+
+				s.publishProductUpdates(gctx, takePending(publishBatchSize))
 			}
+			if onProduct != nil {
+				onProduct(err)
+			}
+			return nil
+		})
+	}
 
-			// Save the product to the database
-			if err := s.saveProduct(product); err != nil {
-				log.Printf("Error saving product: %v", err)
-				continue
+	_ = g.Wait()
+
+	// The group's context is canceled once Wait returns, so flush with the caller's
+	s.publishProductUpdates(ctx, takePending(1))
+}
+
+// publishProductUpdates publishes a batch of product updates, logging failures
+func (s *Service) publishProductUpdates(ctx context.Context, batch []messaging.Message) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := s.kafka.PublishMessages(ctx, s.config.Kafka.ProductTopic, batch); err != nil {
+		log.Printf("Error publishing %d product updates: %v", len(batch), err)
+	}
+}
+
+// concurrency returns the size of the crawl worker pool
+func (s *Service) concurrency() int {
+	if s.config.Scraper.ConcurrentRequests > 0 {
+		return s.config.Scraper.ConcurrentRequests
+	}
+	return 1
+}
+
+// crawlProduct fetches, saves and publishes a single product, skipping it with
+// errCrawlInFlight if another crawl of the same product is still running
+func (s *Service) crawlProduct(ctx context.Context, productID string) error {
+	product, err := s.fetchProduct(ctx, productID)
+	if err != nil {
+		return err
+	}
+
+	// Publish product to Kafka
+	if err := s.publishProductUpdate(ctx, product); err != nil {
+		log.Printf("Error publishing product update: %v", err)
+	}
+
+	return nil
+}
+
+// fetchProduct fetches and saves a single product, skipping it with
+// errCrawlInFlight if another crawl of the same product is still running
+func (s *Service) fetchProduct(ctx context.Context, productID string) (*models.Product, error) {
+	if !s.acquireCrawl(productID) {
+		return nil, errCrawlInFlight
+	}
+	defer s.releaseCrawl(productID)
+
+	product, err := s.source.GetProductDetails(productID)
+	if err != nil {
+		// A delisted product is deactivated rather than left active with stale data
+		if errors.Is(err, ErrProductNotFound) {
+			deactivated, deactivateErr := s.deactivateProduct(ctx, productID)
+			if errors.Is(deactivateErr, gorm.ErrRecordNotFound) {
+				return nil, err
 			}
+			return deactivated, deactivateErr
+		}
+		log.Printf("Error getting product details for ID %s: %v", productID, err)
+		return nil, err
+	}
+
+	// Products scraped from their page only update the stored product
+	if len(product.ScrapedFields) > 0 {
+		if product, err = s.mergeProductPage(ctx, product); err != nil {
+			log.Printf("Error merging product page for ID %s: %v", productID, err)
+			return nil, err
+		}
+	}
 
-			// Publish product to Kafka
-			if err := s.publishProductUpdate(ctx, product); err != nil {
-				log.Printf("Error publishing product update: %v", err)
+	// Prices the source gave no currency for are in the default currency
+	for i := range product.Variants {
+		if product.Variants[i].Currency == "" {
+			product.Variants[i].Currency = s.config.DefaultCurrency
+		}
+	}
+	for i := range product.Offers {
+		if product.Offers[i].Currency == "" {
+			product.Offers[i].Currency = s.config.DefaultCurrency
+		}
+	}
+	if product.Bundle != nil && product.Bundle.Currency == "" {
+		product.Bundle.Currency = s.config.DefaultCurrency
+	}
+
+	// Reviews are best effort, a product is still saved without them
+	if product.CommentCount > 0 {
+		product.Reviews = s.fetchReviews(productID)
+	}
+
+	// Save the product to the database
+	if err := s.saveProduct(ctx, product); err != nil {
+		log.Printf("Error saving product: %v", err)
+		return nil, err
+	}
+
+	return product, nil
+}
+
+// fetchReviews fetches up to MaxReviewPages pages of reviews for a product, so
+// products with thousands of reviews don't hold up a crawl. Every crawl starts
+// again from the first page, so reviews past the last page fetched are never
+// crawled.
+func (s *Service) fetchReviews(productID string) []models.Review {
+	var reviews []models.Review
+	for page := 1; page <= s.config.Scraper.MaxReviewPages; page++ {
+		pageReviews, err := s.source.GetProductReviews(productID, page)
+		if err != nil {
+			log.Printf("Error getting reviews page %d for product %s: %v", page, productID, err)
+			break
+		}
+
+		reviews = append(reviews, pageReviews...)
+		if len(pageReviews) < reviewsPageSize {
+			break
+		}
+	}
+	return reviews
+}
+
+// acquireCrawl marks a product as being crawled, returning false if it already is
+func (s *Service) acquireCrawl(productID string) bool {
+	s.inFlightMux.Lock()
+	defer s.inFlightMux.Unlock()
+
+	if s.inFlight[productID] {
+		return false
+	}
+	s.inFlight[productID] = true
+	return true
+}
+
+// releaseCrawl marks a product as no longer being crawled
+func (s *Service) releaseCrawl(productID string) {
+	s.inFlightMux.Lock()
+	defer s.inFlightMux.Unlock()
+
+	delete(s.inFlight, productID)
+}
+
+// favoriteProductIDs returns the distinct external IDs of all favorited products
+func (s *Service) favoriteProductIDs() ([]string, error) {
+	var productIDs []string
+	if err := s.db.Model(&models.UserFavorite{}).
+		Joins("JOIN products ON products.id = user_favorites.product_id AND products.deleted_at IS NULL").
+		Distinct().
+		Pluck("products.external_id", &productIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load favorited products: %w", err)
+	}
+	return productIDs, nil
+}
+
+// maxSaveAttempts is the number of times a product save is tried when it
+// conflicts with a concurrent save of the same product
+const maxSaveAttempts = 3
+
+// errStaleProduct is returned when a product was modified by another save
+// after it was read
+var errStaleProduct = errors.New("product was modified concurrently")
+
+// defaultVariantBatchSize is the variant batch size used when none is configured
+const defaultVariantBatchSize = 100
+
+// variantBatchSize returns the number of variants loaded and saved at a time
+func (s *Service) variantBatchSize() int {
+	if s.config.Scraper.VariantBatchSize > 0 {
+		return s.config.Scraper.VariantBatchSize
+	}
+	return defaultVariantBatchSize
+}
+
+// saveProduct saves a product to the database with all related entities.
+// Saves conflicting with a concurrent save of the same product, including two
+// crawls inserting the same new product, are retried and applied as updates.
+func (s *Service) saveProduct(ctx context.Context, product *models.Product) error {
+	var err error
+	for attempt := 1; attempt <= maxSaveAttempts; attempt++ {
+		var (
+			outbox  []models.OutboxMessage
+			created bool
+		)
+		outbox, created, err = s.saveProductOnce(ctx, product)
+		if !errors.Is(err, errStaleProduct) {
+			if err == nil {
+				if created {
+					s.publishProductCreated(ctx, product)
+				}
+				s.publishOutbox(ctx, outbox)
+				s.forgetDiscovered(product.ExternalID)
 			}
+			return err
 		}
+		log.Printf("Product %s was saved concurrently, retrying (attempt %d/%d)", product.ExternalID, attempt, maxSaveAttempts)
 	}
+	return err
 }
 
-// saveProduct saves a product to the database with all related entities
-func (s *Service) saveProduct(product *models.Product) error {
+// saveProductOnce saves a product in a single transaction. The existing row is
+// locked FOR UPDATE so the history comparison can't race with another save of
+// the same product, and its version is bumped only if it is still the one read.
+// It returns the outbox messages of the changes made to an existing product,
+// to publish once committed, and whether the product is new. The transaction
+// is rolled back when ctx is done, so a cancelled crawl stops its save.
+func (s *Service) saveProductOnce(ctx context.Context, product *models.Product) ([]models.OutboxMessage, bool, error) {
 	// Start a transaction
-	tx := s.db.Begin()
+	tx := s.db.WithContext(ctx).Begin()
 	if tx.Error != nil {
-		return tx.Error
+		return nil, false, tx.Error
 	}
 
-	// Check if the product already exists
+	var changes []models.ProductChangeEvent
+	var priceHistories []models.PriceHistory
+	var stockHistories []models.StockHistory
+	var favoriteHistory *models.FavoriteHistory
+	batchSize := s.variantBatchSize()
+
+	// Check if the product already exists, including soft-deleted rows which
+	// still hold the external_id unique index
 	var existingProduct models.Product
-	result := tx.Where("external_id = ?", product.ExternalID).First(&existingProduct)
-	if result.Error == nil {
+	result := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("external_id = ?", product.ExternalID).First(&existingProduct)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		tx.Rollback()
+		return nil, false, fmt.Errorf("failed to fetch existing product: %w", result.Error)
+	}
+	created := result.Error != nil
+	if !created {
+		// Skip data fetched before the stored one, it would overwrite newer prices
+		if !product.LastUpdated.IsZero() && existingProduct.LastUpdated.After(product.LastUpdated) {
+			tx.Rollback()
+			log.Printf("Skipping stale save of product %s, stored data is newer", product.ExternalID)
+			return nil, false, nil
+		}
+
+		// Claim the next version, fails if another save committed since the read
+		update := tx.Unscoped().Model(&models.Product{}).
+			Where("id = ? AND version = ?", existingProduct.ID, existingProduct.Version).
+			Update("version", existingProduct.Version+1)
+		if update.Error != nil {
+			tx.Rollback()
+			return nil, false, fmt.Errorf("failed to update product version: %w", update.Error)
+		}
+		if update.RowsAffected == 0 {
+			tx.Rollback()
+			return nil, false, errStaleProduct
+		}
+
 		// Product exists, check for changes
 		product.ID = existingProduct.ID
 		product.CreatedAt = existingProduct.CreatedAt
+		product.Version = existingProduct.Version + 1
 
-		// Check for price and stock changes
-		var existingVariants []models.Variant
-		if err := tx.Where("product_id = ?", existingProduct.ID).Find(&existingVariants).Error; err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to fetch existing variants: %w", err)
+		// Restore a soft-deleted product that is being re-crawled
+		if existingProduct.DeletedAt.Valid {
+			product.DeletedAt = gorm.DeletedAt{}
+			if err := tx.Unscoped().Model(&models.Variant{}).
+				Where("product_id = ? AND deleted_at IS NOT NULL", existingProduct.ID).
+				Update("deleted_at", nil).Error; err != nil {
+				tx.Rollback()
+				return nil, false, fmt.Errorf("failed to restore variants: %w", err)
+			}
 		}
 
-		// Create a map of existing variants by external ID
+		// Check for price and stock changes, loading the existing variants in batches
+		var batch []models.Variant
 		existingVariantMap := make(map[string]models.Variant)
-		for _, variant := range existingVariants {
-			existingVariantMap[variant.ExternalID] = variant
+		if err := tx.Unscoped().Where("product_id = ?", existingProduct.ID).
+			FindInBatches(&batch, batchSize, func(*gorm.DB, int) error {
+				for _, variant := range batch {
+					existingVariantMap[variant.ExternalID] = variant
+				}
+				return nil
+			}).Error; err != nil {
+			tx.Rollback()
+			return nil, false, fmt.Errorf("failed to fetch existing variants: %w", err)
+		}
+
+		changes = productChanges(&existingProduct, product, existingVariantMap, product.Version, time.Now())
+
+		// Record favorite count changes to track popularity over time
+		if existingProduct.FavoriteCount != product.FavoriteCount {
+			favoriteHistory = &models.FavoriteHistory{
+				ProductID:     existingProduct.ID,
+				PreviousCount: existingProduct.FavoriteCount,
+				NewCount:      product.FavoriteCount,
+				ChangeCount:   product.FavoriteCount - existingProduct.FavoriteCount,
+			}
 		}
 
 		// Compare variants
 		for i, variant := range product.Variants {
 			if existingVariant, exists := existingVariantMap[variant.ExternalID]; exists {
 				// Check for price changes
-				if existingVariant.Price != variant.Price {
-					// Record price change
-					priceHistory := models.PriceHistory{
-						ProductID:     existingProduct.ID,
-						VariantID:     existingVariant.ID,
-						PreviousPrice: existingVariant.Price,
-						NewPrice:      variant.Price,
-						ChangePercent: calculatePercentageChange(existingVariant.Price, variant.Price),
-					}
-					if err := tx.Create(&priceHistory).Error; err != nil {
+				if priceChanged(existingVariant.Price, variant.Price) {
+					// Skip a change already recorded by an overlapping crawl
+					recorded, err := recentPriceChangeExists(tx, existingVariant.ID, variant.Price)
+					if err != nil {
 						tx.Rollback()
-						return fmt.Errorf("failed to create price history: %w", err)
+						return nil, false, err
+					}
+
+					// Record price change
+					if !recorded {
+						priceHistories = append(priceHistories, models.PriceHistory{
+							ProductID:     existingProduct.ID,
+							VariantID:     existingVariant.ID,
+							PreviousPrice: existingVariant.Price,
+							NewPrice:      variant.Price,
+							ChangePercent: calculatePercentageChange(existingVariant.Price, variant.Price),
+							Currency:      variant.Currency,
+						})
 					}
 				}
 
 				// Check for stock changes
 				if existingVariant.StockCount != variant.StockCount {
 					// Record stock change
-					stockHistory := models.StockHistory{
+					stockHistories = append(stockHistories, models.StockHistory{
 						ProductID:      existingProduct.ID,
 						VariantID:      existingVariant.ID,
 						PreviousStock:  existingVariant.StockCount,
 						NewStock:       variant.StockCount,
 						ChangeQuantity: variant.StockCount - existingVariant.StockCount,
-					}
-					if err := tx.Create(&stockHistory).Error; err != nil {
-						tx.Rollback()
-						return fmt.Errorf("failed to create stock history: %w", err)
-					}
+					})
 				}
 
 				// Update variant ID
@@ -326,20 +894,306 @@ func (s *Service) saveProduct(product *models.Product) error {
 		}
 	}
 
-	// Update or create the product
-	if err := tx.Save(product).Error; err != nil {
+	// Record the changes in batches
+	if len(priceHistories) > 0 {
+		if err := tx.CreateInBatches(&priceHistories, batchSize).Error; err != nil {
+			tx.Rollback()
+			return nil, false, fmt.Errorf("failed to create price history: %w", err)
+		}
+	}
+	if len(stockHistories) > 0 {
+		if err := tx.CreateInBatches(&stockHistories, batchSize).Error; err != nil {
+			tx.Rollback()
+			return nil, false, fmt.Errorf("failed to create stock history: %w", err)
+		}
+	}
+	if favoriteHistory != nil {
+		if err := tx.Create(favoriteHistory).Error; err != nil {
+			tx.Rollback()
+			return nil, false, fmt.Errorf("failed to create favorite history: %w", err)
+		}
+	}
+	outbox, err := saveChangeOutbox(tx, s.config.Kafka.ChangeTopic, changes, batchSize)
+	if err != nil {
+		tx.Rollback()
+		return nil, false, err
+	}
+
+	product.LastCrawledAt = time.Now()
+
+	if err := saveReferences(tx, product); err != nil {
+		tx.Rollback()
+		return nil, false, err
+	}
+
+	// Update or create the product, its references were upserted above and
+	// variants, reviews, offers and bundles are upserted separately below
+	if err := tx.Omit("Brand", "Seller", "Category", "Variants", "Reviews", "Offers", "Bundle").Save(product).Error; err != nil {
+		tx.Rollback()
+		// Another save inserted the same product after it was looked up, the
+		// transaction is aborted so retry in a new one, which finds the
+		// product and updates it
+		if db.IsUniqueViolation(err) {
+			return nil, false, errStaleProduct
+		}
+		return nil, false, fmt.Errorf("failed to save product: %w", err)
+	}
+
+	// Upsert variants by external ID in batches, so products with hundreds of
+	// variants don't build a single huge statement
+	if len(product.Variants) > 0 {
+		for i := range product.Variants {
+			product.Variants[i].ProductID = product.ID
+		}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "external_id"}},
+			UpdateAll: true,
+		}).CreateInBatches(&product.Variants, batchSize).Error; err != nil {
+			tx.Rollback()
+			return nil, false, fmt.Errorf("failed to save variants: %w", err)
+		}
+	}
+
+	// Upsert reviews by external ID, as a review may be edited after it was crawled
+	if len(product.Reviews) > 0 {
+		for i := range product.Reviews {
+			product.Reviews[i].ProductID = product.ID
+		}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "external_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"rating", "text", "author", "posted_at", "updated_at"}),
+		}).Create(&product.Reviews).Error; err != nil {
+			tx.Rollback()
+			return nil, false, fmt.Errorf("failed to save reviews: %w", err)
+		}
+	}
+
+	if err := nameAttributeValues(tx, product); err != nil {
 		tx.Rollback()
-		return fmt.Errorf("failed to save product: %w", err)
+		return nil, false, err
+	}
+
+	if err := saveOffers(tx, product); err != nil {
+		tx.Rollback()
+		return nil, false, err
+	}
+
+	if err := saveBundle(tx, product); err != nil {
+		tx.Rollback()
+		return nil, false, err
+	}
+
+	uncrawledRelated, err := saveRelations(tx, product)
+	if err != nil {
+		tx.Rollback()
+		return nil, false, err
 	}
 
 	// Commit the transaction
 	if err := tx.Commit().Error; err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+		return nil, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	// Queued only now the relations are committed
+	s.queueDiscovered(uncrawledRelated)
+
+	return outbox, created, nil
+}
+
+// deactivateProduct marks a saved product the source no longer lists as
+// inactive and records a final stock of 0 for its variants. It returns
+// gorm.ErrRecordNotFound if the product was never saved.
+func (s *Service) deactivateProduct(ctx context.Context, externalID string) (*models.Product, error) {
+	var product models.Product
+	var outbox []models.OutboxMessage
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existingProduct models.Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("external_id = ?", externalID).First(&existingProduct).Error; err != nil {
+			return err
+		}
+		product = existingProduct
+		if !existingProduct.IsActive {
+			return nil
+		}
+
+		var variants []models.Variant
+		if err := tx.Where("product_id = ?", existingProduct.ID).Find(&variants).Error; err != nil {
+			return fmt.Errorf("failed to fetch variants: %w", err)
+		}
+
+		now := time.Now()
+		product.IsActive = false
+		product.Version = existingProduct.Version + 1
+		product.LastUpdated = now
+		product.Variants = make([]models.Variant, len(variants))
+		existingVariantMap := make(map[string]models.Variant, len(variants))
+		for i, variant := range variants {
+			existingVariantMap[variant.ExternalID] = variant
+			variant.StockCount = 0
+			product.Variants[i] = variant
+		}
+		changes := productChanges(&existingProduct, &product, existingVariantMap, product.Version, now)
+
+		for _, variant := range variants {
+			if variant.StockCount == 0 {
+				continue
+			}
+			stockHistory := models.StockHistory{
+				ProductID:      existingProduct.ID,
+				VariantID:      variant.ID,
+				PreviousStock:  variant.StockCount,
+				NewStock:       0,
+				ChangeQuantity: -variant.StockCount,
+			}
+			if err := tx.Create(&stockHistory).Error; err != nil {
+				return fmt.Errorf("failed to create stock history: %w", err)
+			}
+		}
+
+		if err := tx.Model(&models.Variant{}).
+			Where("product_id = ? AND stock_count <> 0", existingProduct.ID).
+			Update("stock_count", 0).Error; err != nil {
+			return fmt.Errorf("failed to clear variant stock: %w", err)
+		}
+		if err := tx.Model(&models.Product{}).Where("id = ?", existingProduct.ID).
+			Updates(map[string]interface{}{
+				"is_active":       false,
+				"version":         product.Version,
+				"last_updated":    now,
+				"last_crawled_at": now,
+			}).Error; err != nil {
+			return fmt.Errorf("failed to deactivate product: %w", err)
+		}
+
+		var err error
+		outbox, err = saveChangeOutbox(tx, s.config.Kafka.ChangeTopic, changes, s.variantBatchSize())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(outbox) > 0 {
+		log.Printf("Product %s is no longer listed, marked inactive", externalID)
+		s.publishOutbox(ctx, outbox)
 	}
+	return &product, nil
+}
 
+// saveReferences upserts the brand, seller and category of a product by
+// external ID and links the product to them. Saved as associations, they would
+// be inserted with ON CONFLICT DO NOTHING, which returns no ID when they already
+// exist, such as when another product of the same brand is saved concurrently.
+func saveReferences(tx *gorm.DB, product *models.Product) error {
+	if product.Brand.ExternalID != "" {
+		brand := product.Brand
+		brand.ID = 0
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "external_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name", "logo_url", "updated_at"}),
+		}).Create(&brand).Error; err != nil {
+			return fmt.Errorf("failed to save brand: %w", err)
+		}
+		product.Brand, product.BrandID = brand, brand.ID
+	}
+
+	if product.Seller.ExternalID != "" {
+		seller := product.Seller
+		seller.ID = 0
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "external_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name", "rating", "positive_ratio", "updated_at"}),
+		}).Create(&seller).Error; err != nil {
+			return fmt.Errorf("failed to save seller: %w", err)
+		}
+		product.Seller, product.SellerID = seller, seller.ID
+	}
+
+	// Categories are stored with their parents by saveCategories, a product's
+	// category only adds those it doesn't know yet
+	if product.Category.ExternalID != "" {
+		category := product.Category
+		category.ID = 0
+		if err := tx.Omit("Parent", "Children").Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "external_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"updated_at"}),
+		}).Create(&category).Error; err != nil {
+			return fmt.Errorf("failed to save category: %w", err)
+		}
+		product.Category, product.CategoryID = category, category.ID
+	}
 	return nil
 }
 
+// saveOffers upserts the seller offers of a saved product and deletes the
+// offers of sellers that no longer list it. Sellers are matched by external ID.
+// Stored offers are left alone when the source didn't list offers at all, as
+// a response missing them says nothing about which sellers still list it.
+func saveOffers(tx *gorm.DB, product *models.Product) error {
+	if product.Offers == nil {
+		return nil
+	}
+
+	sellerIDs := make([]uint, 0, len(product.Offers))
+	for i := range product.Offers {
+		offer := &product.Offers[i]
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "external_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name", "rating", "positive_ratio", "updated_at"}),
+		}).Create(&offer.Seller).Error; err != nil {
+			return fmt.Errorf("failed to save offer seller: %w", err)
+		}
+
+		offer.ProductID = product.ID
+		offer.SellerID = offer.Seller.ID
+		if err := tx.Omit("Seller").Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "product_id"}, {Name: "seller_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"price", "currency", "stock_count", "url", "updated_at", "deleted_at"}),
+		}).Create(offer).Error; err != nil {
+			return fmt.Errorf("failed to save seller offer: %w", err)
+		}
+		sellerIDs = append(sellerIDs, offer.SellerID)
+	}
+
+	stale := tx.Where("product_id = ?", product.ID)
+	if len(sellerIDs) > 0 {
+		stale = stale.Where("seller_id NOT IN ?", sellerIDs)
+	}
+	if err := stale.Delete(&models.SellerOffer{}).Error; err != nil {
+		return fmt.Errorf("failed to delete stale seller offers: %w", err)
+	}
+	return nil
+}
+
+const (
+	// minPriceChange is the smallest difference between two prices recorded as a
+	// change, smaller ones are float rounding noise
+	minPriceChange = 0.001
+	// priceChangeDedupWindow is the time within which a second change of a
+	// variant to the same price is treated as a duplicate
+	priceChangeDedupWindow = 30 * time.Second
+)
+
+// priceChanged reports whether the price differs from the previous one by more than rounding noise
+func priceChanged(previousPrice, newPrice float64) bool {
+	return math.Abs(newPrice-previousPrice) >= minPriceChange
+}
+
+// recentPriceChangeExists reports whether a change of the variant to the price
+// was recorded within the dedup window
+func recentPriceChangeExists(tx *gorm.DB, variantID uint, price float64) (bool, error) {
+	var count int64
+	if err := tx.Model(&models.PriceHistory{}).
+		Where("variant_id = ? AND created_at > ? AND ABS(new_price - ?) < ?",
+			variantID, time.Now().Add(-priceChangeDedupWindow), price, minPriceChange).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check recent price changes: %w", err)
+	}
+	return count > 0, nil
+}
+
 // calculatePercentageChange calculates the percentage change between two prices
 func calculatePercentageChange(oldPrice, newPrice float64) float64 {
 	if oldPrice == 0 {
@@ -350,6 +1204,12 @@ func calculatePercentageChange(oldPrice, newPrice float64) float64 {
 
 // publishProductUpdate publishes a product update to Kafka
 func (s *Service) publishProductUpdate(ctx context.Context, product *models.Product) error {
+	message := productUpdateMessage(product)
+	return s.kafka.PublishMessage(ctx, s.config.Kafka.ProductTopic, message.Key, message.Data)
+}
+
+// productUpdateMessage creates the product update message of a product
+func productUpdateMessage(product *models.Product) messaging.Message {
 	// Create a simplified product for the message
 	productUpdate := struct {
 		ExternalID  string    `json:"external_id"`
@@ -363,20 +1223,20 @@ func (s *Service) publishProductUpdate(ctx context.Context, product *models.Prod
 		LastUpdated: time.Now(),
 	}
 
-	return s.kafka.PublishMessage(ctx, s.config.Kafka.ProductTopic, product.ExternalID, productUpdate)
+	return messaging.Message{Key: product.ExternalID, Data: productUpdate}
 }
 
 // listenForPriorityUpdates listens for priority update requests
 func (s *Service) listenForPriorityUpdates(ctx context.Context) {
 	// Create a consumer for priority updates
-	priorityTopic := "product-priorities"
+	priorityTopic := s.config.Kafka.PriorityTopic
 	if err := s.kafka.CreateConsumer(priorityTopic); err != nil {
 		log.Printf("Error creating consumer for priority updates: %v", err)
 		return
 	}
 
 	// Process priority update messages
-	s.kafka.ConsumeMessages(ctx, priorityTopic, func(message []byte) error {
+	s.kafka.ConsumeMessagesParallel(ctx, priorityTopic, s.config.Kafka.Workers(priorityTopic), func(ctx context.Context, message []byte) error {
 		var update struct {
 			ProductID string `json:"product_id"`
 			Priority  int    `json:"priority"`
@@ -392,4 +1252,79 @@ func (s *Service) listenForPriorityUpdates(ctx context.Context) {
 
 		return nil
 	})
-}
\ No newline at end of file
+}
+
+// productFilter holds the optional filters for listing products
+type productFilter struct {
+	CategoryID uint
+	BrandID    uint
+	SellerID   uint
+	IsActive   *bool
+	Attributes map[string][]string // Attribute values by attribute name, see filterByAttributes
+}
+
+// productsQuery returns a product query with the filter applied, shared by
+// the REST and gRPC product listings
+func (s *Service) productsQuery(ctx context.Context, filter productFilter) *gorm.DB {
+	query := s.db.WithContext(ctx).Model(&models.Product{})
+
+	if filter.CategoryID > 0 {
+		query = query.Where("category_id = ?", filter.CategoryID)
+	}
+
+	if filter.BrandID > 0 {
+		query = query.Where("brand_id = ?", filter.BrandID)
+	}
+
+	if filter.SellerID > 0 {
+		query = query.Where("seller_id = ?", filter.SellerID)
+	}
+
+	if filter.IsActive != nil {
+		query = query.Where("is_active = ?", *filter.IsActive)
+	}
+
+	return filterByAttributes(query, filter.Attributes)
+}
+
+// getProduct fetches a product by external ID with all its associations
+func (s *Service) getProduct(ctx context.Context, externalID string) (*models.Product, error) {
+	var product models.Product
+	if err := s.db.WithContext(ctx).
+		Preload("Category").
+		Preload("Brand").
+		Preload("Seller").
+		Preload("Images").
+		Preload("Videos").
+		Preload("Variants").
+		Preload("Attributes").
+		Preload("RelatedProducts").
+		Where("external_id = ?", externalID).
+		First(&product).Error; err != nil {
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+// setPriority sets the crawl priority of a product
+func (s *Service) setPriority(externalID string, priority int) {
+	s.priorityMux.Lock()
+	s.priorityList[externalID] = priority
+	s.priorityMux.Unlock()
+}
+
+// prioritiesAtLeast returns the priorities of the products whose priority is
+// at least minPriority, by external ID
+func (s *Service) prioritiesAtLeast(minPriority int) map[string]int {
+	s.priorityMux.RLock()
+	defer s.priorityMux.RUnlock()
+
+	priorities := make(map[string]int)
+	for productID, priority := range s.priorityList {
+		if priority >= minPriority {
+			priorities[productID] = priority
+		}
+	}
+	return priorities
+}
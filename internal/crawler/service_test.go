@@ -0,0 +1,311 @@
+package crawler
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/e-commerce/platform/internal/common/config"
+	"github.com/e-commerce/platform/internal/common/db/dbtest"
+	"github.com/e-commerce/platform/internal/common/messaging"
+	"github.com/e-commerce/platform/internal/common/models"
+	"gorm.io/gorm"
+)
+
+// newDBTestService returns a crawler service with a test database, skipping
+// the test when there is none. Its broker refuses connections, so publishing
+// fails at once and changes are left in the outbox.
+func newDBTestService(t *testing.T) *Service {
+	database := dbtest.Open(t)
+	cfg := &config.Config{Kafka: config.KafkaConfig{Brokers: []string{"127.0.0.1:1"}, ChangeTopic: "product-changes"}}
+	kafka := messaging.NewKafkaClient(&cfg.Kafka)
+	t.Cleanup(func() { kafka.Close() })
+	return NewCrawlerService(database, kafka, cfg, nil)
+}
+
+// testProduct returns a crawled product with one variant in stock
+func testProduct(stock int) *models.Product {
+	return &models.Product{
+		ExternalID: "1",
+		Name:       "Product",
+		IsActive:   true,
+		Category:   models.Category{ExternalID: "c1", Name: "Category", Level: 1},
+		Brand:      models.Brand{ExternalID: "b1", Name: "Brand"},
+		Seller:     models.Seller{ExternalID: "s1", Name: "Seller"},
+		Variants:   []models.Variant{{ExternalID: "v1", Price: 100, StockCount: stock}},
+	}
+}
+
+// offer returns an offer of the seller with the given external ID
+func offer(sellerID string, price float64) models.SellerOffer {
+	return models.SellerOffer{Seller: models.Seller{Name: "Seller " + sellerID, ExternalID: sellerID, IsActive: true}, Price: price}
+}
+
+func TestSaveOffers(t *testing.T) {
+	tests := []struct {
+		name   string
+		offers []models.SellerOffer
+		want   []string
+	}{
+		{"not listed", nil, []string{"s1", "s2"}},
+		{"none", []models.SellerOffer{}, nil},
+		{"one left", []models.SellerOffer{offer("s2", 12)}, []string{"s2"}},
+		{"new seller", []models.SellerOffer{offer("s1", 9), offer("s2", 11), offer("s3", 15)}, []string{"s1", "s2", "s3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := dbtest.Open(t)
+			product := &models.Product{Name: "Product", ExternalID: "1"}
+			if err := database.Raw(`INSERT INTO products (external_id, name) VALUES ('1', 'Product') RETURNING id`).Scan(&product.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			// Two sellers list the product
+			product.Offers = []models.SellerOffer{offer("s1", 10), offer("s2", 11)}
+			if err := saveOffers(database.DB, product); err != nil {
+				t.Fatal(err)
+			}
+
+			product.Offers = tt.offers
+			if err := saveOffers(database.DB, product); err != nil {
+				t.Fatal(err)
+			}
+
+			var sellers []string
+			if err := database.Model(&models.SellerOffer{}).
+				Joins("JOIN sellers ON sellers.id = seller_offers.seller_id").
+				Where("seller_offers.product_id = ?", product.ID).
+				Order("sellers.external_id").
+				Pluck("sellers.external_id", &sellers).Error; err != nil {
+				t.Fatal(err)
+			}
+			if len(sellers) != len(tt.want) {
+				t.Fatalf("offers of %v, want %v", sellers, tt.want)
+			}
+			for i := range sellers {
+				if sellers[i] != tt.want[i] {
+					t.Errorf("offers of %v, want %v", sellers, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSaveProductConcurrently(t *testing.T) {
+	tests := []struct {
+		name   string
+		saves  int
+		stored bool
+	}{
+		{"new product", 8, false},
+		{"existing product", 8, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newDBTestService(t)
+			ctx := context.Background()
+
+			version := 0
+			if tt.stored {
+				if err := s.saveProduct(ctx, testProduct(100)); err != nil {
+					t.Fatal(err)
+				}
+				version = 1
+			}
+
+			// Every save has its own stock count, so each update records a change
+			var wg sync.WaitGroup
+			errs := make(chan error, tt.saves)
+			for i := range tt.saves {
+				wg.Add(1)
+				go func(stock int) {
+					defer wg.Done()
+					errs <- s.saveProduct(ctx, testProduct(stock))
+				}(i + 1)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Errorf("save failed: %v", err)
+				}
+			}
+
+			var products []models.Product
+			if err := s.db.Unscoped().Where("external_id = ?", "1").Find(&products).Error; err != nil {
+				t.Fatal(err)
+			}
+			if len(products) != 1 {
+				t.Fatalf("got %d products, want 1", len(products))
+			}
+			// Each save bumps the version once, none was lost
+			if want := version + tt.saves; products[0].Version != want {
+				t.Errorf("version = %d, want %d", products[0].Version, want)
+			}
+
+			var variants, stockChanges int64
+			if err := s.db.Model(&models.Variant{}).Where("product_id = ?", products[0].ID).Count(&variants).Error; err != nil {
+				t.Fatal(err)
+			}
+			if variants != 1 {
+				t.Errorf("got %d variants, want 1", variants)
+			}
+			if err := s.db.Model(&models.StockHistory{}).Where("product_id = ?", products[0].ID).Count(&stockChanges).Error; err != nil {
+				t.Fatal(err)
+			}
+			// Every save after the first one sees the stock of the one before
+			if want := int64(version + tt.saves - 1); stockChanges != want {
+				t.Errorf("got %d stock changes, want %d", stockChanges, want)
+			}
+		})
+	}
+}
+
+func TestSaveReferences(t *testing.T) {
+	tests := []struct {
+		name    string
+		stored  bool // Whether the brand is stored before the save
+		product models.Product
+		brand   string // Name of the stored brand after the save
+	}{
+		{"new", false, *testProduct(1), "Brand"},
+		{"renamed", true, models.Product{Brand: models.Brand{ExternalID: "b1", Name: "New Brand"}}, "New Brand"},
+		{"none", true, models.Product{}, "Brand"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := dbtest.Open(t)
+			if tt.stored {
+				if err := database.Create(&models.Brand{ExternalID: "b1", Name: "Brand"}).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			product := tt.product
+			if err := saveReferences(database.DB, &product); err != nil {
+				t.Fatal(err)
+			}
+
+			var brands []models.Brand
+			if err := database.Find(&brands).Error; err != nil {
+				t.Fatal(err)
+			}
+			if len(brands) != 1 || brands[0].Name != tt.brand {
+				t.Fatalf("brands = %+v, want one named %s", brands, tt.brand)
+			}
+
+			// The product references the stored brand only if it has one
+			wantBrandID := uint(0)
+			if tt.product.Brand.ExternalID != "" {
+				wantBrandID = brands[0].ID
+			}
+			if product.BrandID != wantBrandID {
+				t.Errorf("brand ID = %d, want %d", product.BrandID, wantBrandID)
+			}
+			if (product.CategoryID != 0) != (tt.product.Category.ExternalID != "") ||
+				(product.SellerID != 0) != (tt.product.Seller.ExternalID != "") {
+				t.Errorf("category ID = %d, seller ID = %d", product.CategoryID, product.SellerID)
+			}
+		})
+	}
+}
+
+func TestSaveReferencesConcurrently(t *testing.T) {
+	database := dbtest.Open(t)
+
+	// Products of the same new brand, seller and category saved at once
+	const saves = 8
+	var wg sync.WaitGroup
+	products := make([]*models.Product, saves)
+	errs := make([]error, saves)
+	for i := range saves {
+		products[i] = testProduct(1)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = database.Transaction(func(tx *gorm.DB) error {
+				return saveReferences(tx, products[i])
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("save %d failed: %v", i, err)
+		}
+		if products[i].BrandID != products[0].BrandID || products[i].SellerID != products[0].SellerID ||
+			products[i].CategoryID != products[0].CategoryID {
+			t.Errorf("save %d references %d/%d/%d, want %d/%d/%d", i,
+				products[i].BrandID, products[i].SellerID, products[i].CategoryID,
+				products[0].BrandID, products[0].SellerID, products[0].CategoryID)
+		}
+	}
+
+	for _, model := range []interface{}{&models.Brand{}, &models.Seller{}, &models.Category{}} {
+		var count int64
+		if err := database.Model(model).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		if count != 1 {
+			t.Errorf("%T stored %d times, want once", model, count)
+		}
+	}
+}
+
+func TestSaveProductRestoresDeleted(t *testing.T) {
+	tests := []struct {
+		name     string
+		variants []models.Variant // Variants of the re-crawled product
+		want     int64            // Variants of the product after the save
+	}{
+		{"same variants", []models.Variant{{ExternalID: "v1", Price: 100, StockCount: 5}}, 1},
+		{"new variant", []models.Variant{{ExternalID: "v2", Price: 100, StockCount: 5}}, 2},
+		{"no variants", nil, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newDBTestService(t)
+			ctx := context.Background()
+
+			product := testProduct(5)
+			if err := s.saveProduct(ctx, product); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.db.Where("product_id = ?", product.ID).Delete(&models.Variant{}).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := s.db.Delete(&models.Product{}, product.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			recrawled := testProduct(5)
+			recrawled.Variants = tt.variants
+			if err := s.saveProduct(ctx, recrawled); err != nil {
+				t.Fatal(err)
+			}
+
+			// The product row is reused, not inserted again
+			var restored models.Product
+			if err := s.db.Where("external_id = ?", "1").First(&restored).Error; err != nil {
+				t.Fatalf("product not restored: %v", err)
+			}
+			if restored.ID != product.ID || restored.Version != 2 {
+				t.Errorf("restored product %d version %d, want %d version 2", restored.ID, restored.Version, product.ID)
+			}
+
+			// Variants deleted with the product are restored with it
+			var variants int64
+			if err := s.db.Model(&models.Variant{}).Where("product_id = ?", product.ID).Count(&variants).Error; err != nil {
+				t.Fatal(err)
+			}
+			if variants != tt.want {
+				t.Errorf("got %d variants, want %d", variants, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/e-commerce/platform/internal/common/models"
+)
+
+// Number of similar products returned by default and at most
+const (
+	defaultSimilarLimit = 10
+	maxSimilarLimit     = 50
+)
+
+// similarProduct is a product with the number of attribute values its
+// variants share with the product it is similar to
+type similarProduct struct {
+	productResponse
+	SharedAttributes int `json:"shared_attributes"`
+}
+
+// similarProducts returns up to limit active products in the same category
+// as a product, those sharing the most attribute values first, then the best
+// rated. It returns gorm.ErrRecordNotFound if the product doesn't exist.
+func (s *Service) similarProducts(ctx context.Context, externalID string, limit int) ([]similarProduct, error) {
+	var product models.Product
+	if err := s.db.WithContext(ctx).Where("external_id = ?", externalID).First(&product).Error; err != nil {
+		return nil, err
+	}
+
+	var scores []struct {
+		ID     uint
+		Shared int
+	}
+	if err := s.db.WithContext(ctx).Raw(`
+		WITH product_values AS (
+			SELECT DISTINCT vav.attribute_value_id
+			FROM variants v
+			JOIN variant_attribute_values vav ON vav.variant_id = v.id
+			WHERE v.product_id = ? AND v.deleted_at IS NULL
+		)
+		SELECT p.id, COUNT(DISTINCT pv.attribute_value_id) AS shared
+		FROM products p
+		LEFT JOIN variants v ON v.product_id = p.id AND v.deleted_at IS NULL
+		LEFT JOIN variant_attribute_values vav ON vav.variant_id = v.id
+		LEFT JOIN product_values pv ON pv.attribute_value_id = vav.attribute_value_id
+		WHERE p.category_id = ? AND p.id <> ? AND p.is_active AND p.deleted_at IS NULL
+		GROUP BY p.id, p.rating
+		ORDER BY shared DESC, p.rating DESC, p.id
+		LIMIT ?
+	`, product.ID, product.CategoryID, product.ID, limit).Scan(&scores).Error; err != nil {
+		return nil, fmt.Errorf("failed to rank similar products: %w", err)
+	}
+	if len(scores) == 0 {
+		return []similarProduct{}, nil
+	}
+
+	ids := make([]uint, len(scores))
+	for i, score := range scores {
+		ids[i] = score.ID
+	}
+
+	var products []models.Product
+	if err := s.db.WithContext(ctx).
+		Preload("Category").
+		Preload("Brand").
+		Preload("Variants").
+		Where("id IN ?", ids).
+		Find(&products).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch similar products: %w", err)
+	}
+
+	// Return the products in ranking order
+	productMap := make(map[uint]models.Product, len(products))
+	for _, p := range products {
+		productMap[p.ID] = p
+	}
+	similar := make([]similarProduct, 0, len(scores))
+	for _, score := range scores {
+		if p, exists := productMap[score.ID]; exists {
+			similar = append(similar, similarProduct{
+				productResponse:  newProductResponse(p),
+				SharedAttributes: score.Shared,
+			})
+		}
+	}
+	return similar, nil
+}
@@ -0,0 +1,56 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/e-commerce/platform/internal/common/config"
+	"github.com/e-commerce/platform/internal/common/models"
+)
+
+// ErrProductNotFound is returned by GetProductDetails for products the source
+// no longer lists, as opposed to transient errors
+var ErrProductNotFound = errors.New("product not found")
+
+// ProductListing is a product of a category listing. Listings are cheap to
+// fetch, so their change signals let crawls skip fetching the details of
+// products that didn't change.
+type ProductListing struct {
+	ID           string
+	ContentHash  string    // Hash of the product details, empty if the source provides none
+	LastModified time.Time // Time the product last changed, zero if the source provides none
+}
+
+// ProductSource is a source of product data, such as a marketplace. The
+// Trendyol Scraper is the default implementation.
+type ProductSource interface {
+	// GetCategories fetches all product categories
+	GetCategories() ([]models.Category, error)
+	// GetProductIDsByCategory fetches product IDs for a specific category
+	GetProductIDsByCategory(categoryID string) ([]string, error)
+	// GetProductListings fetches the products of a specific category with
+	// the change signals the source provides, if any
+	GetProductListings(categoryID string) ([]ProductListing, error)
+	// GetProductDetails fetches detailed information for a specific product,
+	// returning ErrProductNotFound if the product is no longer listed
+	GetProductDetails(productID string) (*models.Product, error)
+	// GetProductReviews fetches a page of reviews for a specific product,
+	// returning fewer than reviewsPageSize reviews on the last page
+	GetProductReviews(productID string, page int) ([]models.Review, error)
+}
+
+// Ensure Scraper implements ProductSource
+var _ ProductSource = (*Scraper)(nil)
+
+// NewProductSource creates the product source selected by the scraper mode
+func NewProductSource(cfg *config.ScraperConfig) (ProductSource, error) {
+	switch cfg.Mode {
+	case "", "live":
+		return NewScraper(cfg), nil
+	case "fixture":
+		return NewFixtureSource(cfg.FixtureDir), nil
+	default:
+		return nil, fmt.Errorf("unknown scraper mode: %s", cfg.Mode)
+	}
+}
@@ -0,0 +1,175 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/e-commerce/platform/internal/common/config"
+	"github.com/e-commerce/platform/internal/common/models"
+)
+
+// fakeSource is a ProductSource serving products and reviews from memory
+type fakeSource struct {
+	products    map[string]*models.Product
+	reviews     int   // Reviews every product has
+	reviewsErr  error // Returned for review pages after the first
+	reviewPages []int // Review pages requested
+	mu          sync.Mutex
+}
+
+var _ ProductSource = (*fakeSource)(nil)
+
+func (f *fakeSource) GetCategories() ([]models.Category, error) {
+	return nil, nil
+}
+
+func (f *fakeSource) GetProductIDsByCategory(categoryID string) ([]string, error) {
+	return nil, nil
+}
+
+func (f *fakeSource) GetProductListings(categoryID string) ([]ProductListing, error) {
+	return nil, nil
+}
+
+func (f *fakeSource) GetProductDetails(productID string) (*models.Product, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	product, exists := f.products[productID]
+	if !exists {
+		return nil, ErrProductNotFound
+	}
+	// Crawls modify the product they get
+	copied := *product
+	copied.Variants = append([]models.Variant(nil), product.Variants...)
+	return &copied, nil
+}
+
+func (f *fakeSource) GetProductReviews(productID string, page int) ([]models.Review, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.reviewPages = append(f.reviewPages, page)
+	if page > 1 && f.reviewsErr != nil {
+		return nil, f.reviewsErr
+	}
+
+	var reviews []models.Review
+	for i := (page - 1) * reviewsPageSize; i < min(page*reviewsPageSize, f.reviews); i++ {
+		reviews = append(reviews, models.Review{ExternalID: productID + "-" + strconv.Itoa(i)})
+	}
+	return reviews, nil
+}
+
+func TestFetchReviews(t *testing.T) {
+	tests := []struct {
+		name       string
+		reviews    int
+		maxPages   int
+		reviewsErr error
+		want       int
+		pages      int
+	}{
+		{"no reviews", 0, 5, nil, 0, 1},
+		{"partial page", 10, 5, nil, 10, 1},
+		{"full pages", 2 * reviewsPageSize, 5, nil, 2 * reviewsPageSize, 3},
+		{"capped", 10 * reviewsPageSize, 3, nil, 3 * reviewsPageSize, 3},
+		{"failed page", 10 * reviewsPageSize, 5, errors.New("timeout"), reviewsPageSize, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &fakeSource{reviews: tt.reviews, reviewsErr: tt.reviewsErr}
+			s := NewCrawlerService(nil, nil, &config.Config{Scraper: config.ScraperConfig{MaxReviewPages: tt.maxPages}}, source)
+
+			reviews := s.fetchReviews("1")
+			if len(reviews) != tt.want {
+				t.Errorf("got %d reviews, want %d", len(reviews), tt.want)
+			}
+			if len(source.reviewPages) != tt.pages {
+				t.Errorf("requested pages %v, want %d pages", source.reviewPages, tt.pages)
+			}
+			// Every crawl starts from the first page
+			if len(source.reviewPages) > 0 && source.reviewPages[0] != 1 {
+				t.Errorf("first page requested = %d, want 1", source.reviewPages[0])
+			}
+		})
+	}
+}
+
+func TestFetchProduct(t *testing.T) {
+	tests := []struct {
+		name    string
+		stored  bool // Whether the product was saved by an earlier crawl
+		listed  bool // Whether the source still lists the product
+		wantErr error
+		active  bool
+	}{
+		{"new", false, true, nil, true},
+		{"updated", true, true, nil, true},
+		{"delisted", true, false, nil, false},
+		{"unknown", false, false, ErrProductNotFound, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newDBTestService(t)
+			s.config.DefaultCurrency = "TRY"
+			source := &fakeSource{products: make(map[string]*models.Product)}
+			s.source = source
+			ctx := context.Background()
+
+			if tt.stored {
+				if err := s.saveProduct(ctx, testProduct(5)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.listed {
+				source.products["1"] = testProduct(3)
+			}
+
+			product, err := s.fetchProduct(ctx, "1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if product.IsActive != tt.active {
+				t.Errorf("active = %v, want %v", product.IsActive, tt.active)
+			}
+
+			var stored models.Product
+			if err := s.db.Preload("Variants").Where("external_id = ?", "1").First(&stored).Error; err != nil {
+				t.Fatal(err)
+			}
+			if stored.IsActive != tt.active || len(stored.Variants) != 1 {
+				t.Fatalf("stored %+v, want active = %v with one variant", stored, tt.active)
+			}
+			variant := stored.Variants[0]
+			if tt.listed && (variant.StockCount != 3 || variant.Currency != "TRY") {
+				t.Errorf("variant = %+v, want the source's stock in the default currency", variant)
+			}
+			if !tt.listed && variant.StockCount != 0 {
+				t.Errorf("delisted variant stock = %d, want 0", variant.StockCount)
+			}
+		})
+	}
+}
+
+func TestFetchProductInFlight(t *testing.T) {
+	s := newTestService(config.ScraperConfig{})
+	s.source = &fakeSource{}
+	if !s.acquireCrawl("1") {
+		t.Fatal("crawl not acquired")
+	}
+	defer s.releaseCrawl("1")
+
+	// The source isn't asked for a product already being crawled
+	if _, err := s.fetchProduct(context.Background(), "1"); !errors.Is(err, errCrawlInFlight) {
+		t.Errorf("error = %v, want errCrawlInFlight", err)
+	}
+}
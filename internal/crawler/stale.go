@@ -0,0 +1,67 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/e-commerce/platform/internal/common/models"
+)
+
+// Number of stale products returned by default and at most
+const (
+	defaultStaleLimit = 100
+	maxStaleLimit     = 1000
+)
+
+// staleProduct is a product not crawled within the freshness SLA
+type staleProduct struct {
+	ExternalID    string    `json:"external_id"`
+	Name          string    `json:"name"`
+	Priority      int       `json:"priority"`
+	LastCrawledAt time.Time `json:"last_crawled_at"`
+	AgeSeconds    int64     `json:"age_seconds"`
+}
+
+// staleProducts returns up to limit products last crawled more than maxAge
+// ago, the stalest first. With a positive minPriority, only products with at
+// least that crawl priority are returned.
+func (s *Service) staleProducts(ctx context.Context, maxAge time.Duration, minPriority, limit int) ([]staleProduct, error) {
+	now := time.Now()
+	query := s.db.WithContext(ctx).
+		Select("external_id", "name", "last_crawled_at").
+		Where("last_crawled_at IS NULL OR last_crawled_at < ?", now.Add(-maxAge))
+
+	priorities := s.prioritiesAtLeast(minPriority)
+	if minPriority > 0 {
+		if len(priorities) == 0 {
+			return []staleProduct{}, nil
+		}
+		ids := make([]string, 0, len(priorities))
+		for productID := range priorities {
+			ids = append(ids, productID)
+		}
+		query = query.Where("external_id IN ?", ids)
+	}
+
+	var products []models.Product
+	if err := query.Order("last_crawled_at ASC NULLS FIRST, id ASC").
+		Limit(limit).
+		Find(&products).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch stale products: %w", err)
+	}
+
+	stale := make([]staleProduct, len(products))
+	for i, product := range products {
+		stale[i] = staleProduct{
+			ExternalID:    product.ExternalID,
+			Name:          product.Name,
+			Priority:      priorities[product.ExternalID],
+			LastCrawledAt: product.LastCrawledAt,
+		}
+		if !product.LastCrawledAt.IsZero() {
+			stale[i].AgeSeconds = int64(now.Sub(product.LastCrawledAt).Seconds())
+		}
+	}
+	return stale, nil
+}
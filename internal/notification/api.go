@@ -2,16 +2,31 @@ package notification
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/e-commerce/platform/internal/common/adminauth"
 	"github.com/e-commerce/platform/internal/common/config"
+	"github.com/e-commerce/platform/internal/common/cors"
 	"github.com/e-commerce/platform/internal/common/db"
+	"github.com/e-commerce/platform/internal/common/dbtimeout"
+	"github.com/e-commerce/platform/internal/common/httperror"
 	"github.com/e-commerce/platform/internal/common/models"
+	"github.com/e-commerce/platform/internal/common/ratelimit"
+	"github.com/e-commerce/platform/internal/common/tracing"
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/time/rate"
 	"gorm.io/gorm"
 )
 
@@ -22,16 +37,29 @@ type API struct {
 	config  *config.Config
 	service *Service
 	upgrader websocket.Upgrader
+	connections *connectionLimiter // Open WebSocket connections
 }
 
 // NewAPI creates a new API server
 func NewAPI(db *db.Database, config *config.Config, service *Service) *API {
 	e := echo.New()
+	e.HTTPErrorHandler = httperror.Handler
 
 	// Middleware
+	e.Use(middleware.RequestID())
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
-	e.Use(middleware.CORS())
+	e.Use(tracing.Middleware())
+	e.Use(cors.New(config.Server.AllowedOrigins("notification")))
+	e.Use(middleware.GzipWithConfig(middleware.GzipConfig{
+		// WebSocket connections are hijacked and must not be compressed, and
+		// event streams must reach the client as each event is flushed
+		Skipper: func(c echo.Context) bool {
+			return websocket.IsWebSocketUpgrade(c.Request()) || strings.HasSuffix(c.Path(), "/sse/:user_id")
+		},
+		Level:     config.Server.GzipLevel,
+		MinLength: config.Server.GzipMinLength,
+	}))
 
 	api := &API{
 		echo:    e,
@@ -40,9 +68,14 @@ func NewAPI(db *db.Database, config *config.Config, service *Service) *API {
 		service: service,
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
-				return true // Allow all origins for WebSocket connections
+				return originAllowed(r, config.Notification.WebSocketAllowedOrigins)
 			},
 		},
+		connections: newConnectionLimiter(config.Notification.WebSocketMaxConnections, config.Notification.WebSocketMaxPerUser),
+	}
+
+	if config.Notification.WebSocketTokenSecret == "" {
+		log.Printf("Warning: NOTIFICATION_WS_TOKEN_SECRET is not set, WebSocket connections will be refused")
 	}
 
 	// Routes
@@ -56,17 +89,43 @@ func (api *API) registerRoutes() {
 	// Health check
 	api.echo.GET("/health", api.healthCheck)
 
-	// API group
-	v1 := api.echo.Group("/api/v1/notifications")
+	// Readiness and Prometheus metrics
+	api.echo.GET("/ready", api.readyCheck)
+	api.echo.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+
+	// API group, rate limited per client with stricter limits for expensive endpoints
+	// and with the database queries of each request bounded by the query timeout
+	limits := api.config.RateLimit
+	limiter := ratelimit.New(rate.Limit(limits.RequestsPerSecond), limits.Burst)
+	v1 := api.echo.Group("/api/v1/notifications", limiter, dbtimeout.New(api.config.Database.QueryTimeout))
+	expensive := ratelimit.New(ratelimit.PerMinute(limits.ExpensiveRequestsPerMinute), limits.ExpensiveBurst)
 
 	// Notification routes
 	v1.GET("", api.getNotifications)
 	v1.GET("/unread", api.getUnreadNotifications)
 	v1.PUT("/:id/read", api.markAsRead)
+	v1.PUT("/read", api.markManyAsRead)
 	v1.PUT("/read-all", api.markAllAsRead)
 
+	// Admin routes
+	v1.GET("/by-product/:product_id", api.getProductNotifications, adminauth.New(api.config.AdminToken))
+
+	// Preference routes
+	v1.GET("/preferences", api.getPreferences)
+	v1.PUT("/preferences", api.updatePreferences)
+
+	// Webhook routes
+	v1.POST("/webhooks", api.createWebhook, expensive)
+	v1.GET("/webhooks", api.getWebhooks)
+	v1.DELETE("/webhooks/:id", api.deleteWebhook)
+
 	// WebSocket route for real-time notifications
 	v1.GET("/ws/:user_id", api.handleWebSocket)
+
+	// Server-sent events route for clients that can't use WebSockets, outside
+	// the query timeout as the stream outlives any request
+	streams := api.echo.Group("/api/v1/notifications", limiter)
+	streams.GET("/sse/:user_id", api.handleSSE)
 }
 
 // Start starts the API server
@@ -74,7 +133,8 @@ func (api *API) Start(ctx context.Context) error {
 	// Server
 	go func() {
 		address := ":" + strconv.Itoa(api.config.Services.NotificationServicePort)
-		if err := api.echo.Start(address); err != nil && err != http.ErrServerClosed {
+		srv := api.config.Server.HTTPServer(address, api.echo)
+		if err := api.echo.StartServer(srv); err != nil && err != http.ErrServerClosed {
 			api.echo.Logger.Fatal("shutting down the server")
 		}
 	}()
@@ -89,14 +149,40 @@ func (api *API) Start(ctx context.Context) error {
 	return api.echo.Shutdown(shutdownCtx)
 }
 
-// healthCheck is a health check endpoint
+// requestDB returns the database bound to the request context, so queries are
+// cancelled when the client disconnects or the request times out
+func (api *API) requestDB(c echo.Context) *gorm.DB {
+	return api.db.WithContext(c.Request().Context())
+}
+
+// healthCheck is a liveness check endpoint. Dependencies are checked by
+// readyCheck instead, as restarting the service doesn't fix them.
 func (api *API) healthCheck(c echo.Context) error {
-	return c.JSON(http.StatusOK, map[string]string{
+	return c.JSON(http.StatusOK, map[string]interface{}{
 		"status":  "ok",
 		"service": "notification",
 	})
 }
 
+// readyCheck reports the Kafka consumer failures and lag, responding 503 while
+// a consumer keeps failing or a partition lags more than the configured maximum
+func (api *API) readyCheck(c echo.Context) error {
+	status, code := "ready", http.StatusOK
+	if !api.service.kafka.CaughtUp() {
+		status, code = "lagging", http.StatusServiceUnavailable
+	}
+	if !api.service.kafka.Healthy() {
+		status, code = "degraded", http.StatusServiceUnavailable
+	}
+
+	return c.JSON(code, map[string]interface{}{
+		"status":                  status,
+		"service":                 "notification",
+		"kafka_consumer_failures": api.service.kafka.ConsumerFailures(),
+		"kafka_consumer_lag":      api.service.kafka.ConsumerLag(),
+	})
+}
+
 // getNotifications returns notifications with pagination
 func (api *API) getNotifications(c echo.Context) error {
 	// Parse user ID from query
@@ -127,7 +213,12 @@ func (api *API) getNotifications(c echo.Context) error {
 	var notifications []models.Notification
 	var total int64
 
-	query := api.db.Model(&models.Notification{}).Where("user_id = ?", userID)
+	query := api.requestDB(c).Model(&models.Notification{}).Where("user_id = ?", userID)
+
+	// Archived notifications are only returned on request
+	if c.QueryParam("include_archived") != "true" {
+		query = query.Where("archived = ?", false)
+	}
 
 	// Count total
 	query.Count(&total)
@@ -148,6 +239,75 @@ func (api *API) getNotifications(c echo.Context) error {
 	})
 }
 
+// getProductNotifications returns the notifications of all users about a
+// product, newest first, for support staff investigating deliveries
+func (api *API) getProductNotifications(c echo.Context) error {
+	productID, err := strconv.ParseUint(c.Param("product_id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid product ID")
+	}
+
+	// Pagination
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	if page <= 0 {
+		page = 1
+	}
+
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	offset := (page - 1) * limit
+
+	// Archived notifications are included, they were delivered all the same
+	query := api.requestDB(c).Model(&models.Notification{}).Where("product_id = ?", productID)
+
+	// Optional delivery time window
+	if fromStr := c.QueryParam("from"); fromStr != "" {
+		from, err := time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid from date, expected RFC3339")
+		}
+		query = query.Where("delivered_at >= ?", from)
+	}
+	if toStr := c.QueryParam("to"); toStr != "" {
+		to, err := time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid to date, expected RFC3339")
+		}
+		query = query.Where("delivered_at <= ?", to)
+	}
+
+	// Optional type filter
+	if notificationType := c.QueryParam("type"); notificationType != "" {
+		if notificationType != priceDropType && notificationType != lowStockType && notificationType != digestType {
+			return echo.NewHTTPError(http.StatusBadRequest, "Type must be one of price_drop, low_stock or digest")
+		}
+		query = query.Where("type = ?", notificationType)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to count notifications")
+	}
+
+	var notifications []models.Notification
+	if err := query.Order("delivered_at DESC, id DESC").
+		Limit(limit).Offset(offset).
+		Find(&notifications).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch notifications")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"product_id":    productID,
+		"notifications": notifications,
+		"total":         total,
+		"page":          page,
+		"limit":         limit,
+	})
+}
+
 // getUnreadNotifications returns unread notifications for a user
 func (api *API) getUnreadNotifications(c echo.Context) error {
 	// Parse user ID from query
@@ -173,7 +333,7 @@ func (api *API) getUnreadNotifications(c echo.Context) error {
 	}
 
 	// Get unread notifications
-	notifications, total, err := api.service.GetUnreadNotifications(uint(userID), limit, offset)
+	notifications, total, err := api.service.GetUnreadNotifications(c.Request().Context(), uint(userID), limit, offset)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch unread notifications")
 	}
@@ -187,7 +347,7 @@ func (api *API) getUnreadNotifications(c echo.Context) error {
 	})
 }
 
-// markAsRead marks a notification as read
+// markAsRead marks a notification of the authenticated user as read
 func (api *API) markAsRead(c echo.Context) error {
 	// Parse notification ID from path
 	id := c.Param("id")
@@ -196,17 +356,17 @@ func (api *API) markAsRead(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid notification ID")
 	}
 
-	// Check if notification exists
-	var notification models.Notification
-	if err := api.db.First(&notification, notificationID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return echo.NewHTTPError(http.StatusNotFound, "Notification not found")
-		}
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch notification")
+	// Only the authenticated user's own notifications can be marked as read
+	userID, err := api.authenticatedUser(c)
+	if err != nil {
+		return err
 	}
 
 	// Mark as read
-	if err := api.service.MarkNotificationAsRead(uint(notificationID)); err != nil {
+	if err := api.service.MarkNotificationAsRead(c.Request().Context(), userID, uint(notificationID)); err != nil {
+		if errors.Is(err, errNotificationNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Notification not found")
+		}
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to mark notification as read")
 	}
 
@@ -216,46 +376,275 @@ func (api *API) markAsRead(c echo.Context) error {
 	})
 }
 
-// markAllAsRead marks all notifications as read for a user
+// markAllAsRead marks all notifications of the authenticated user as read
 func (api *API) markAllAsRead(c echo.Context) error {
-	// Parse user ID from body
+	userID, err := api.authenticatedUser(c)
+	if err != nil {
+		return err
+	}
+
+	// Mark all as read
+	if err := api.service.MarkAllNotificationsAsRead(c.Request().Context(), userID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to mark all notifications as read")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "All notifications marked as read",
+	})
+}
+
+// maxMarkReadIDs is the maximum number of notifications marked as read in one request
+const maxMarkReadIDs = 500
+
+// markManyAsRead marks the given notifications of the authenticated user as
+// read, ignoring notifications of other users, and returns how many were marked
+func (api *API) markManyAsRead(c echo.Context) error {
+	userID, err := api.authenticatedUser(c)
+	if err != nil {
+		return err
+	}
+
 	var request struct {
-		UserID uint `json:"user_id" validate:"required"`
+		IDs []uint `json:"ids" validate:"required"`
 	}
 
 	if err := c.Bind(&request); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
 	}
+	if len(request.IDs) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "At least one notification ID is required")
+	}
+	if len(request.IDs) > maxMarkReadIDs {
+		return echo.NewHTTPError(http.StatusBadRequest, "At most "+strconv.Itoa(maxMarkReadIDs)+" notification IDs are allowed")
+	}
 
-	// Mark all as read
-	if err := api.service.MarkAllNotificationsAsRead(request.UserID); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to mark all notifications as read")
+	updated, err := api.service.MarkNotificationsAsRead(c.Request().Context(), userID, request.IDs)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to mark notifications as read")
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"success": true,
-		"message": "All notifications marked as read",
+		"updated": updated,
 	})
 }
 
-// handleWebSocket handles WebSocket connections for real-time notifications
-func (api *API) handleWebSocket(c echo.Context) error {
-	// Parse user ID from path
-	userIDStr := c.Param("user_id")
+// getPreferences returns the notification preferences of a user
+func (api *API) getPreferences(c echo.Context) error {
+	// Parse user ID from query
+	userIDStr := c.QueryParam("user_id")
+	if userIDStr == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "User ID is required")
+	}
+
 	userID, err := strconv.ParseUint(userIDStr, 10, 32)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
 	}
 
+	preferences, err := api.service.GetPreferences(c.Request().Context(), uint(userID))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch preferences")
+	}
+
+	return c.JSON(http.StatusOK, preferences)
+}
+
+// updatePreferences updates the notification preferences of a user
+func (api *API) updatePreferences(c echo.Context) error {
+	var request struct {
+		UserID     uint `json:"user_id" validate:"required"`
+		DigestMode bool `json:"digest_mode"`
+	}
+
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
 	// Check if user exists
 	var user models.User
-	if err := api.db.First(&user, userID).Error; err != nil {
+	if err := api.requestDB(c).First(&user, request.UserID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return echo.NewHTTPError(http.StatusNotFound, "User not found")
 		}
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch user")
 	}
 
+	preferences, err := api.service.UpdatePreferences(c.Request().Context(), request.UserID, request.DigestMode)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update preferences")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"success":     true,
+		"message":     "Preferences updated successfully",
+		"preferences": preferences,
+	})
+}
+
+// createWebhook registers a webhook delivering the notifications of the
+// authenticated user
+func (api *API) createWebhook(c echo.Context) error {
+	var request struct {
+		URL    string `json:"url" validate:"required"`
+		Secret string `json:"secret"`
+	}
+
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	// Webhooks receive the notifications of the user they're registered
+	// for, so only the user themselves may register one
+	userID, err := api.authenticatedUser(c)
+	if err != nil {
+		return err
+	}
+
+	// Validate URL
+	parsedURL, err := url.ParseRequestURI(request.URL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid webhook URL")
+	}
+	if !api.config.Notification.WebhookAllowPrivate {
+		if err := checkWebhookURL(c.Request().Context(), net.DefaultResolver, request.URL); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Webhook URL must resolve to a public address").SetInternal(err)
+		}
+	}
+
+	// Check if user exists
+	var user models.User
+	if err := api.requestDB(c).First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return echo.NewHTTPError(http.StatusNotFound, "User not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch user")
+	}
+
+	webhook, err := api.service.CreateWebhook(c.Request().Context(), userID, request.URL, request.Secret)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create webhook")
+	}
+
+	// The secret is only returned once, on creation
+	return c.JSON(http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"message": "Webhook created successfully",
+		"webhook": webhook,
+		"secret":  webhook.Secret,
+	})
+}
+
+// getWebhooks returns the webhooks registered by the authenticated user
+func (api *API) getWebhooks(c echo.Context) error {
+	userID, err := api.authenticatedUser(c)
+	if err != nil {
+		return err
+	}
+
+	webhooks, err := api.service.GetWebhooks(c.Request().Context(), userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch webhooks")
+	}
+
+	return c.JSON(http.StatusOK, webhooks)
+}
+
+// deleteWebhook deletes a webhook of the authenticated user
+func (api *API) deleteWebhook(c echo.Context) error {
+	// Parse webhook ID from path
+	id := c.Param("id")
+	webhookID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid webhook ID")
+	}
+
+	// Only the authenticated user's own webhooks can be deleted
+	userID, err := api.authenticatedUser(c)
+	if err != nil {
+		return err
+	}
+
+	if err := api.service.DeleteWebhook(c.Request().Context(), userID, uint(webhookID)); err != nil {
+		if errors.Is(err, errWebhookNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, "Webhook not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete webhook")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "Webhook deleted successfully",
+	})
+}
+
+// authenticatedUser returns the user of the signed token of a request, sent
+// as a bearer Authorization header or the token query parameter
+func (api *API) authenticatedUser(c echo.Context) (uint, error) {
+	secret := api.config.Notification.WebSocketTokenSecret
+	if secret == "" {
+		return 0, echo.NewHTTPError(http.StatusServiceUnavailable, "Authentication is not configured")
+	}
+
+	userID, err := parseWebSocketToken(secret, webSocketToken(c.Request()), time.Now())
+	if err != nil {
+		return 0, echo.NewHTTPError(http.StatusUnauthorized, "Invalid or missing token").SetInternal(err)
+	}
+	return userID, nil
+}
+
+// authorizeSubscription checks that a request subscribing to the
+// notifications of the user in the path carries a token for that user and
+// comes from an allowed origin, and returns the user ID
+func (api *API) authorizeSubscription(c echo.Context) (uint, error) {
+	// Parse user ID from path
+	userIDStr := c.Param("user_id")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	// Only the user a token was issued for may subscribe to their notifications
+	secret := api.config.Notification.WebSocketTokenSecret
+	if secret == "" {
+		return 0, echo.NewHTTPError(http.StatusServiceUnavailable, "Subscription authentication is not configured")
+	}
+	if err := verifyWebSocketToken(secret, webSocketToken(c.Request()), uint(userID), time.Now()); err != nil {
+		return 0, echo.NewHTTPError(http.StatusUnauthorized, "Invalid or missing token").SetInternal(err)
+	}
+	if !originAllowed(c.Request(), api.config.Notification.WebSocketAllowedOrigins) {
+		return 0, echo.NewHTTPError(http.StatusForbidden, "Origin not allowed")
+	}
+
+	// Check if user exists
+	var user models.User
+	if err := api.requestDB(c).First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return 0, echo.NewHTTPError(http.StatusNotFound, "User not found")
+		}
+		return 0, echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch user")
+	}
+
+	return uint(userID), nil
+}
+
+// handleWebSocket handles WebSocket connections for real-time notifications
+func (api *API) handleWebSocket(c echo.Context) error {
+	userID, err := api.authorizeSubscription(c)
+	if err != nil {
+		return err
+	}
+
+	// Refuse the connection while the service or the user has too many open
+	if err := api.connections.acquire(userID); err != nil {
+		if errors.Is(err, errTooManyUserConnections) {
+			return echo.NewHTTPError(http.StatusTooManyRequests, "Too many open connections for this user")
+		}
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Too many open connections")
+	}
+	defer api.connections.release(userID)
+
 	// Upgrade to WebSocket connection
 	ws, err := api.upgrader.Upgrade(c.Response(), c.Request(), nil)
 	if err != nil {
@@ -263,13 +652,16 @@ func (api *API) handleWebSocket(c echo.Context) error {
 	}
 	defer ws.Close()
 
+	// The connection outlives the request, so drop the server's read/write deadlines
+	ws.NetConn().SetDeadline(time.Time{})
+
 	// Register channel for notifications
-	notificationCh := api.service.RegisterUserChannel(uint(userID))
-	defer api.service.UnregisterUserChannel(uint(userID))
+	notificationCh := api.service.RegisterUserChannel(userID)
+	defer api.service.UnregisterUserChannel(userID, notificationCh)
 
 	// Send initial unread count
 	var unreadCount int64
-	api.db.Model(&models.Notification{}).
+	api.requestDB(c).Model(&models.Notification{}).
 		Where("user_id = ? AND is_read = ?", userID, false).
 		Count(&unreadCount)
 
@@ -290,14 +682,23 @@ func (api *API) handleWebSocket(c echo.Context) error {
 	ctx, cancel := context.WithCancel(c.Request().Context())
 	defer cancel()
 
-	// Start a goroutine to read messages from the WebSocket
+	// Start a goroutine to read client messages from the WebSocket, replies
+	// are written by the main loop as a connection supports one writer
+	replies := make(chan interface{}, 16)
 	go func() {
 		defer cancel()
 		for {
-			_, _, err := ws.ReadMessage()
+			_, data, err := ws.ReadMessage()
 			if err != nil {
 				break
 			}
+
+			reply := api.handleClientMessage(ctx, userID, data)
+			select {
+			case replies <- reply:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 
@@ -306,16 +707,21 @@ func (api *API) handleWebSocket(c echo.Context) error {
 		select {
 		case <-ctx.Done():
 			return nil
-		case msg, ok := <-notificationCh:
+		case notification, ok := <-notificationCh:
 			if !ok {
 				return nil
 			}
-			notification := map[string]interface{}{
-				"type":    "notification",
-				"message": msg,
-				"time":    time.Now(),
+			message := map[string]interface{}{
+				"type":            "notification",
+				"notification_id": notification.ID,
+				"message":         notification.Message,
+				"time":            time.Now(),
+			}
+			if err := ws.WriteJSON(message); err != nil {
+				return err
 			}
-			if err := ws.WriteJSON(notification); err != nil {
+		case reply := <-replies:
+			if err := ws.WriteJSON(reply); err != nil {
 				return err
 			}
 		case <-pingTicker.C:
@@ -324,4 +730,129 @@ func (api *API) handleWebSocket(c echo.Context) error {
 			}
 		}
 	}
-}
\ No newline at end of file
+}
+
+// sseHeartbeatInterval is how often a comment is sent on idle event streams
+// so proxies don't close them
+const sseHeartbeatInterval = 30 * time.Second
+
+// handleSSE streams a user's notifications as server-sent events, for clients
+// that can't use WebSockets. Events carry the same JSON messages as the
+// WebSocket, notifications with their ID as the event ID.
+func (api *API) handleSSE(c echo.Context) error {
+	userID, err := api.authorizeSubscription(c)
+	if err != nil {
+		return err
+	}
+
+	unreadCount, err := api.service.GetUnreadCount(c.Request().Context(), userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to count notifications")
+	}
+
+	// Register channel for notifications
+	notificationCh := api.service.RegisterUserChannel(userID)
+	defer api.service.UnregisterUserChannel(userID, notificationCh)
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no") // Disable proxy buffering
+
+	// The stream is long-lived, so the server write timeout must not cut it off
+	if err := http.NewResponseController(res).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Failed to clear SSE write deadline: %v", err)
+	}
+	res.WriteHeader(http.StatusOK)
+
+	if err := writeSSEEvent(res, 0, map[string]interface{}{
+		"type":         "init",
+		"unread_count": unreadCount,
+		"connected_at": time.Now(),
+	}); err != nil {
+		return nil
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	// Stream until the client disconnects
+	ctx := c.Request().Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case notification, ok := <-notificationCh:
+			if !ok {
+				return nil
+			}
+			if err := writeSSEEvent(res, notification.ID, map[string]interface{}{
+				"type":            "notification",
+				"notification_id": notification.ID,
+				"message":         notification.Message,
+				"time":            time.Now(),
+			}); err != nil {
+				return nil
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(res, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		}
+	}
+}
+
+// writeSSEEvent writes a JSON message as a server-sent event, with an event ID
+// if id is not zero, and flushes it to the client
+func writeSSEEvent(res *echo.Response, id uint, message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if id > 0 {
+		if _, err := fmt.Fprintf(res, "id: %d\n", id); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(res, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
+
+// clientMessage is a message sent by a client over the notification WebSocket
+type clientMessage struct {
+	Type           string `json:"type"`
+	NotificationID uint   `json:"notification_id"`
+}
+
+// handleClientMessage handles a message from a user's WebSocket client and
+// returns the reply. An ack marks one of the user's notifications as read.
+func (api *API) handleClientMessage(ctx context.Context, userID uint, data []byte) map[string]interface{} {
+	var message clientMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		return map[string]interface{}{"type": "error", "error": "Invalid message"}
+	}
+
+	switch message.Type {
+	case "ack":
+		reply := map[string]interface{}{"type": "ack", "notification_id": message.NotificationID}
+
+		// Only the user's own notifications can be acknowledged
+		if err := api.service.MarkNotificationAsRead(ctx, userID, message.NotificationID); err != nil {
+			if errors.Is(err, errNotificationNotFound) {
+				reply["error"] = "Notification not found"
+			} else {
+				reply["error"] = "Failed to mark notification as read"
+			}
+			return reply
+		}
+		reply["success"] = true
+		return reply
+	default:
+		return map[string]interface{}{"type": "error", "error": "Unknown message type"}
+	}
+}
@@ -0,0 +1,64 @@
+package notification
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/e-commerce/platform/internal/common/config"
+	"github.com/labstack/echo/v4"
+)
+
+func TestMarkAsReadRequiresToken(t *testing.T) {
+	const secret = "test-secret"
+	expired := NewWebSocketToken(secret, 1, time.Now().Add(-time.Minute))
+	forged := NewWebSocketToken("other-secret", 1, time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name   string
+		secret string
+		token  string
+		status int
+	}{
+		{"authentication not configured", "", "", http.StatusServiceUnavailable},
+		{"missing token", secret, "", http.StatusUnauthorized},
+		{"expired token", secret, expired, http.StatusUnauthorized},
+		{"token signed with another secret", secret, forged, http.StatusUnauthorized},
+	}
+
+	// The user ID in the body must not be trusted in place of a token
+	body := `{"user_id": 1, "ids": [1, 2]}`
+	handlers := map[string]func(*API, echo.Context) error{
+		"read":     (*API).markManyAsRead,
+		"read-all": (*API).markAllAsRead,
+	}
+
+	for route, handler := range handlers {
+		for _, tt := range tests {
+			t.Run(route+"/"+tt.name, func(t *testing.T) {
+				cfg := &config.Config{}
+				cfg.Notification.WebSocketTokenSecret = tt.secret
+				api := &API{config: cfg}
+
+				req := httptest.NewRequest(http.MethodPut, "/api/v1/notifications/"+route, strings.NewReader(body))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+				if tt.token != "" {
+					req.Header.Set("Authorization", "Bearer "+tt.token)
+				}
+				c := echo.New().NewContext(req, httptest.NewRecorder())
+
+				err := handler(api, c)
+				var httpErr *echo.HTTPError
+				if !errors.As(err, &httpErr) {
+					t.Fatalf("expected an HTTP error, got %v", err)
+				}
+				if httpErr.Code != tt.status {
+					t.Errorf("status = %d, want %d", httpErr.Code, tt.status)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package notification
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Errors returned when a connection would exceed a limit
+var (
+	errTooManyConnections     = errors.New("too many open connections")
+	errTooManyUserConnections = errors.New("too many open connections for user")
+)
+
+// webSocketConnectionsGauge exports the number of open WebSocket connections
+var webSocketConnectionsGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "notification_websocket_connections",
+	Help: "Open WebSocket connections of the notification service",
+})
+
+// connectionLimiter caps the open connections, in total and per user. A limit
+// of 0 means no limit.
+type connectionLimiter struct {
+	maxTotal   int64
+	maxPerUser int
+	total      atomic.Int64
+	mux        sync.Mutex
+	perUser    map[uint]int
+}
+
+// newConnectionLimiter creates a connection limiter with the given limits
+func newConnectionLimiter(maxTotal, maxPerUser int) *connectionLimiter {
+	return &connectionLimiter{
+		maxTotal:   int64(maxTotal),
+		maxPerUser: maxPerUser,
+		perUser:    make(map[uint]int),
+	}
+}
+
+// acquire claims a connection slot for a user, to be freed with release. It
+// returns errTooManyConnections or errTooManyUserConnections when full.
+func (l *connectionLimiter) acquire(userID uint) error {
+	for {
+		total := l.total.Load()
+		if l.maxTotal > 0 && total >= l.maxTotal {
+			return errTooManyConnections
+		}
+		if l.total.CompareAndSwap(total, total+1) {
+			break
+		}
+	}
+
+	l.mux.Lock()
+	if l.maxPerUser > 0 && l.perUser[userID] >= l.maxPerUser {
+		l.mux.Unlock()
+		l.total.Add(-1)
+		return errTooManyUserConnections
+	}
+	l.perUser[userID]++
+	l.mux.Unlock()
+
+	webSocketConnectionsGauge.Inc()
+	return nil
+}
+
+// release frees a connection slot claimed by acquire
+func (l *connectionLimiter) release(userID uint) {
+	l.mux.Lock()
+	if l.perUser[userID] <= 1 {
+		delete(l.perUser, userID)
+	} else {
+		l.perUser[userID]--
+	}
+	l.mux.Unlock()
+
+	l.total.Add(-1)
+	webSocketConnectionsGauge.Dec()
+}
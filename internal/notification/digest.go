@@ -0,0 +1,157 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/e-commerce/platform/internal/common/models"
+	"github.com/e-commerce/platform/internal/common/money"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// digestInterval is how often a user gets a digest
+	digestInterval = 24 * time.Hour
+	// digestCheckInterval is how often users due a digest are looked for
+	digestCheckInterval = time.Hour
+	// maxDigestLines is the number of drops listed in a digest message, the
+	// rest are summarized as a count
+	maxDigestLines = 10
+)
+
+// periodicDigests sends the daily digests of users in digest mode. Whether a
+// user is due is decided from their last digest in the database, so restarts
+// neither skip nor repeat digests.
+func (s *Service) periodicDigests(ctx context.Context) {
+	ticker := time.NewTicker(digestCheckInterval)
+	defer ticker.Stop()
+
+	s.sendDigests(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sendDigests(ctx)
+		}
+	}
+}
+
+// sendDigests sends a digest of all price drops not included in a digest yet
+// to every user due one: those whose last digest, or oldest pending drop when
+// they never got one, is at least digestInterval old
+func (s *Service) sendDigests(ctx context.Context) {
+	var userIDs []uint
+	if err := s.db.WithContext(ctx).Raw(`
+		SELECT d.user_id FROM digest_items d
+		WHERE d.digested_at IS NULL AND d.deleted_at IS NULL
+		GROUP BY d.user_id
+		HAVING COALESCE((
+			SELECT MAX(n.delivered_at) FROM notifications n
+			WHERE n.user_id = d.user_id AND n.type = ?
+		), MIN(d.created_at)) <= ?
+	`, digestType, time.Now().Add(-digestInterval)).Scan(&userIDs).Error; err != nil {
+		log.Printf("Failed to fetch users due a digest: %v", err)
+		return
+	}
+	if len(userIDs) == 0 {
+		return
+	}
+
+	sent := 0
+	for _, userID := range userIDs {
+		if err := s.sendDigest(ctx, userID); err != nil {
+			log.Printf("Failed to send digest to user %d: %v", userID, err)
+			continue
+		}
+		sent++
+	}
+	log.Printf("Sent %d daily digests", sent)
+}
+
+// sendDigest combines all of a user's pending price drops into a single
+// notification. The drops are locked and marked as digested in the same
+// transaction as the notification is created, so each drop is included in
+// exactly one digest.
+func (s *Service) sendDigest(ctx context.Context, userID uint) error {
+	var notification models.Notification
+	var items []models.DigestItem
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("user_id = ? AND digested_at IS NULL", userID).
+			Order("discount_percent DESC").
+			Find(&items).Error; err != nil {
+			return fmt.Errorf("failed to fetch digest items: %w", err)
+		}
+		if len(items) == 0 {
+			return nil
+		}
+
+		now := time.Now()
+		notification = models.Notification{
+			UserID:      userID,
+			ProductID:   items[0].ProductID,
+			Type:        digestType,
+			Message:     buildDigestMessage(items, s.config.DefaultCurrency),
+			DeliveredAt: now,
+		}
+		if err := tx.Create(&notification).Error; err != nil {
+			return fmt.Errorf("failed to save digest notification: %w", err)
+		}
+
+		ids := make([]uint, len(items))
+		for i, item := range items {
+			ids[i] = item.ID
+			items[i].DigestedAt = &now
+		}
+		if err := tx.Model(&models.DigestItem{}).Where("id IN ?", ids).
+			Update("digested_at", now).Error; err != nil {
+			return fmt.Errorf("failed to mark digest items: %w", err)
+		}
+		return nil
+	})
+	if err != nil || len(items) == 0 {
+		return err
+	}
+
+	payload := digestWebhookPayload{
+		NotificationID: notification.ID,
+		Type:           "price_drop_digest",
+		Message:        notification.Message,
+		DeliveredAt:    notification.DeliveredAt,
+		Drops:          items,
+	}
+	s.run(func() { s.deliverWebhooks(ctx, userID, payload) })
+	s.deliverToChannel(notification)
+
+	return nil
+}
+
+// buildDigestMessage summarizes price drops, which should be ordered by
+// discount, listing the biggest ones. Drops without a currency are in
+// defaultCurrency.
+func buildDigestMessage(items []models.DigestItem, defaultCurrency string) string {
+	var b strings.Builder
+	if len(items) == 1 {
+		b.WriteString("Daily digest: 1 price drop on your products")
+	} else {
+		fmt.Fprintf(&b, "Daily digest: %d price drops on your products", len(items))
+	}
+
+	for i, item := range items {
+		if i == maxDigestLines {
+			fmt.Fprintf(&b, "\n- and %d more", len(items)-maxDigestLines)
+			break
+		}
+		currency := money.Normalize(item.Currency, defaultCurrency)
+		fmt.Fprintf(&b, "\n- %s is now %s (was %s, %.1f%% discount)", item.ProductName,
+			money.Format(item.NewPrice, currency), money.Format(item.PreviousPrice, currency), item.DiscountPercent)
+	}
+
+	return b.String()
+}
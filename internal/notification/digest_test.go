@@ -0,0 +1,51 @@
+package notification
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/e-commerce/platform/internal/common/models"
+)
+
+func TestBuildDigestMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		drops    int
+		header   string
+		lines    int
+		overflow string
+	}{
+		{"single drop", 1, "Daily digest: 1 price drop on your products", 1, ""},
+		{"several drops", 3, "Daily digest: 3 price drops on your products", 3, ""},
+		{"more drops than listed", maxDigestLines + 5, "Daily digest: 15 price drops on your products", maxDigestLines, "- and 5 more"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := make([]models.DigestItem, tt.drops)
+			for i := range items {
+				items[i] = models.DigestItem{ProductName: "Product", PreviousPrice: 200, NewPrice: 150, DiscountPercent: 25}
+			}
+
+			lines := strings.Split(buildDigestMessage(items, "TRY"), "\n")
+			if lines[0] != tt.header {
+				t.Errorf("header = %q, want %q", lines[0], tt.header)
+			}
+			// Every digest message starts like this, migrations tell digests apart by it
+			if !strings.HasPrefix(lines[0], "Daily digest: ") {
+				t.Errorf("header %q doesn't start with the digest prefix", lines[0])
+			}
+
+			listed := lines[1:]
+			if tt.overflow != "" {
+				if last := listed[len(listed)-1]; last != tt.overflow {
+					t.Errorf("last line = %q, want %q", last, tt.overflow)
+				}
+				listed = listed[:len(listed)-1]
+			}
+			if len(listed) != tt.lines {
+				t.Errorf("listed %d drops, want %d", len(listed), tt.lines)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/e-commerce/platform/internal/common/config"
+	pb "github.com/e-commerce/platform/internal/common/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCServer serves notification queries to other services over gRPC
+type GRPCServer struct {
+	pb.UnimplementedNotificationServiceServer
+	server  *grpc.Server
+	config  *config.Config
+	service *Service
+}
+
+// NewGRPCServer creates a new gRPC server for the notification service
+func NewGRPCServer(config *config.Config, service *Service) *GRPCServer {
+	s := &GRPCServer{
+		server:  grpc.NewServer(),
+		config:  config,
+		service: service,
+	}
+
+	pb.RegisterNotificationServiceServer(s.server, s)
+
+	return s
+}
+
+// Start starts the gRPC server and stops it gracefully when ctx is done
+func (s *GRPCServer) Start(ctx context.Context) error {
+	address := ":" + strconv.Itoa(s.config.Services.NotificationGRPCPort)
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		s.server.GracefulStop()
+	}()
+
+	log.Printf("Starting notification gRPC server on %s", address)
+	return s.server.Serve(listener)
+}
+
+// GetUnreadCount returns the number of unread notifications of a user
+func (s *GRPCServer) GetUnreadCount(ctx context.Context, req *pb.UnreadCountRequest) (*pb.UnreadCountResponse, error) {
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user ID is required")
+	}
+
+	count, err := s.service.GetUnreadCount(ctx, uint(req.GetUserId()))
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to count unread notifications")
+	}
+
+	return &pb.UnreadCountResponse{UnreadCount: count}, nil
+}
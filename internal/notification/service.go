@@ -3,8 +3,11 @@ package notification
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
@@ -12,6 +15,8 @@ import (
 	"github.com/e-commerce/platform/internal/common/db"
 	"github.com/e-commerce/platform/internal/common/messaging"
 	"github.com/e-commerce/platform/internal/common/models"
+	"github.com/e-commerce/platform/internal/common/money"
+	"gorm.io/gorm/clause"
 )
 
 // Service represents the notification service
@@ -19,8 +24,81 @@ type Service struct {
 	db            *db.Database
 	kafka         *messaging.KafkaClient
 	config        *config.Config
-	userChannels  map[uint]chan string
+	userChannels  map[uint]map[chan models.Notification]struct{} // Channels of each user's open connections
 	channelsMutex sync.RWMutex
+	webhookClient *http.Client
+	background    sync.WaitGroup // Background goroutines, waited for by Stop
+}
+
+// alertMessage represents a price drop or low stock notification message from
+// Kafka. Messages without a type are price drops.
+type alertMessage struct {
+	Type            string  `json:"type"`
+	UserID          uint    `json:"user_id"`
+	ProductID       uint    `json:"product_id"`
+	VariantID       uint    `json:"variant_id"`
+	PreviousPrice   float64 `json:"previous_price"`
+	NewPrice        float64 `json:"new_price"`
+	DiscountPercent float64 `json:"discount_percent"`
+	Currency        string  `json:"currency"`
+	PreviousStock   int     `json:"previous_stock"`
+	NewStock        int     `json:"new_stock"`
+	StockThreshold  int     `json:"stock_threshold"`
+	ProductName     string  `json:"product_name"`
+	ProductURL      string  `json:"product_url"`
+	HistoryID       uint    `json:"history_id"` // ID of the price or stock change notified, 0 from analyzers that don't send it
+}
+
+// dedupeWindow is the time bucket within which the same alert is only
+// notified once, for messages without the change they notify
+const dedupeWindow = time.Hour
+
+// Types of alert notifications
+const (
+	priceDropType = "price_drop"
+	lowStockType  = "low_stock"
+	digestType    = "digest" // Daily digest of the price drops of a user in digest mode
+)
+
+// dedupeKey identifies the alert a message is for, by its user, variant and
+// the price or stock change it notifies, so a message processed twice, because
+// it was redelivered or published by overlapping analyzers, gets the same key
+// however far apart it is processed. Messages without the change are
+// identified by their new price or stock within the dedupeWindow bucket of now.
+func (m alertMessage) dedupeKey(now time.Time) string {
+	if m.HistoryID > 0 {
+		return fmt.Sprintf("%s:%d:%d:%d:change-%d", m.Type, m.UserID, m.ProductID, m.VariantID, m.HistoryID)
+	}
+
+	value := strconv.FormatFloat(m.NewPrice, 'f', -1, 64)
+	if m.Type == lowStockType {
+		value = strconv.Itoa(m.NewStock)
+	}
+	return fmt.Sprintf("%s:%d:%d:%d:%s:%d", m.Type, m.UserID, m.ProductID, m.VariantID, value,
+		now.Truncate(dedupeWindow).Unix())
+}
+
+// text returns the notification text of the message, with prices in the
+// currency they were crawled in
+func (m alertMessage) text(defaultCurrency string) string {
+	if m.Type == lowStockType {
+		return fmt.Sprintf(
+			"Low stock alert: %s is down to %d in stock (was %d, below your threshold of %d)",
+			m.ProductName,
+			m.NewStock,
+			m.PreviousStock,
+			m.StockThreshold,
+		)
+	}
+
+	currency := money.Normalize(m.Currency, defaultCurrency)
+	return fmt.Sprintf(
+		"Price drop alert: %s is now %s (was %s, %.1f%% discount)",
+		m.ProductName,
+		money.Format(m.NewPrice, currency),
+		money.Format(m.PreviousPrice, currency),
+		m.DiscountPercent,
+	)
 }
 
 // NewNotificationService creates a new notification service
@@ -29,79 +107,200 @@ func NewNotificationService(db *db.Database, kafka *messaging.KafkaClient, cfg *
 		db:           db,
 		kafka:        kafka,
 		config:       cfg,
-		userChannels: make(map[uint]chan string),
+		userChannels: make(map[uint]map[chan models.Notification]struct{}),
+		webhookClient: newWebhookClient(cfg.Notification.WebhookAllowPrivate),
 	}
 }
 
 // Start starts the notification service
 func (s *Service) Start(ctx context.Context) error {
+	// Create the notification topic if the cluster doesn't auto-create it
+	if err := s.kafka.EnsureTopics(ctx, []messaging.TopicSpec{
+		{Name: s.config.Kafka.NotificationTopic},
+	}); err != nil {
+		log.Printf("Warning: failed to ensure Kafka topics: %v", err)
+	}
+
 	// Create Kafka consumer for notifications
 	if err := s.kafka.CreateConsumer(s.config.Kafka.NotificationTopic); err != nil {
 		return fmt.Errorf("failed to create Kafka consumer: %w", err)
 	}
 
 	// Start consuming notifications
-	go s.consumeNotifications(ctx)
+	s.run(func() { s.consumeNotifications(ctx) })
+
+	// Start measuring how far the consumers lag behind their topics
+	s.run(func() { s.kafka.MonitorConsumerLag(ctx, s.config.Kafka.LagCheckInterval) })
 
 	// Start periodic cleanup
-	go s.periodicCleanup(ctx)
+	s.run(func() { s.periodicCleanup(ctx) })
+
+	// Start daily digests for users in digest mode
+	s.run(func() { s.periodicDigests(ctx) })
 
 	return nil
 }
 
+// run runs fn in the background, tracked so Stop waits for it to finish
+func (s *Service) run(fn func()) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		fn()
+	}()
+}
+
+// Stop waits for the service's background work to finish once the context
+// passed to Start is cancelled. Consumers stop reading messages but finish
+// the ones being handled. It returns ctx's error if ctx is done first.
+func (s *Service) Stop(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for background work: %w", ctx.Err())
+	}
+}
+
 // consumeNotifications consumes notification messages from Kafka
 func (s *Service) consumeNotifications(ctx context.Context) {
-	s.kafka.ConsumeMessages(ctx, s.config.Kafka.NotificationTopic, func(message []byte) error {
+	topic := s.config.Kafka.NotificationTopic
+	serviceCtx := ctx
+	s.kafka.ConsumeMessagesParallel(ctx, topic, s.config.Kafka.Workers(topic), func(ctx context.Context, message []byte) error {
 		// Parse notification message
-		var notification struct {
-			UserID          uint    `json:"user_id"`
-			ProductID       uint    `json:"product_id"`
-			VariantID       uint    `json:"variant_id"`
-			PreviousPrice   float64 `json:"previous_price"`
-			NewPrice        float64 `json:"new_price"`
-			DiscountPercent float64 `json:"discount_percent"`
-			ProductName     string  `json:"product_name"`
-			ProductURL      string  `json:"product_url"`
-		}
+		var notification alertMessage
 		if err := json.Unmarshal(message, &notification); err != nil {
 			return fmt.Errorf("failed to unmarshal notification: %w", err)
 		}
+		if notification.Type == "" {
+			notification.Type = priceDropType
+		}
 
 		// Create notification message
-		notificationMsg := fmt.Sprintf(
-			"Price drop alert: %s is now %.2f (was %.2f, %.1f%% discount)",
-			notification.ProductName,
-			notification.NewPrice,
-			notification.PreviousPrice,
-			notification.DiscountPercent,
-		)
+		notificationMsg := notification.text(s.config.DefaultCurrency)
 
-		// Save notification to database
+		// Save notification to database, once per alert
+		now := time.Now()
+		dedupeKey := notification.dedupeKey(now)
 		dbNotification := models.Notification{
 			UserID:      notification.UserID,
 			ProductID:   notification.ProductID,
+			Type:        notification.Type,
 			Message:     notificationMsg,
-			DeliveredAt: time.Now(),
+			DeliveredAt: now,
+			DedupeKey:   &dedupeKey,
 		}
-		if err := s.db.Create(&dbNotification).Error; err != nil {
-			log.Printf("Failed to save notification: %v", err)
+		if err := s.saveNotification(ctx, &dbNotification); err != nil {
+			if db.IsUniqueViolation(err) {
+				log.Printf("Skipped duplicate notification %s (request_id=%s)", dedupeKey, messaging.RequestID(ctx))
+				return nil
+			}
+			// Nothing is delivered for a notification that wasn't saved
+			return fmt.Errorf("failed to save notification: %w", err)
 		}
 
+		// Deliver to any registered webhooks in the background, cancelled
+		// and waited for when the service stops
+		payload := webhookPayload{
+			NotificationID: dbNotification.ID,
+			Type:           notification.Type,
+			Message:        dbNotification.Message,
+			DeliveredAt:    dbNotification.DeliveredAt,
+			alertMessage:   notification,
+		}
+		s.run(func() { s.deliverWebhooks(serviceCtx, notification.UserID, payload) })
+
 		// Try to deliver notification to user if they have an active channel
-		s.channelsMutex.RLock()
-		channel, exists := s.userChannels[notification.UserID]
-		s.channelsMutex.RUnlock()
-		if exists {
+		s.deliverToChannel(dbNotification)
+
+		return nil
+	})
+}
+
+// Save attempts of a notification and the delay before retrying, doubled
+// after each attempt. Failed messages aren't redelivered by the consumer, so
+// transient database errors are retried here.
+const (
+	saveAttempts = 3
+	saveBackoff  = 500 * time.Millisecond
+)
+
+// saveNotification creates a notification, retrying with backoff on errors
+// other than a unique violation, which means it was already saved
+func (s *Service) saveNotification(ctx context.Context, notification *models.Notification) error {
+	backoff := saveBackoff
+	var err error
+	for attempt := 1; attempt <= saveAttempts; attempt++ {
+		if err = s.db.WithContext(ctx).Create(notification).Error; err == nil || db.IsUniqueViolation(err) {
+			return err
+		}
+		if attempt < saveAttempts {
+			log.Printf("Failed to save notification (attempt %d/%d, request_id=%s), retrying in %v: %v",
+				attempt, saveAttempts, messaging.RequestID(ctx), backoff, err)
 			select {
-			case channel <- notificationMsg:
-				log.Printf("Delivered notification to user %d", notification.UserID)
-			default:
-				log.Printf("Failed to deliver notification to user %d, channel full or closed", notification.UserID)
+			case <-ctx.Done():
+				return err
+			case <-time.After(backoff):
 			}
+			backoff *= 2
 		}
+	}
+	return err
+}
 
-		return nil
-	})
+// deliverToChannel sends a notification to the channel of each of its user's
+// open connections. When a channel is full, the overflow policy decides
+// whether the notification or the oldest buffered one is dropped. Deliveries
+// hold the channels lock, so evictions don't interleave and channels aren't
+// closed while being sent to.
+func (s *Service) deliverToChannel(notification models.Notification) {
+	userID := notification.UserID
+	s.channelsMutex.Lock()
+	defer s.channelsMutex.Unlock()
+
+	for channel := range s.userChannels[userID] {
+		if sendOrEvict(channel, notification, s.config.Notification.OverflowPolicy) {
+			log.Printf("Delivered notification to user %d", userID)
+		} else {
+			log.Printf("Failed to deliver notification to user %d, channel full", userID)
+		}
+	}
+}
+
+// sendOrEvict sends a notification to a channel without blocking. With the
+// drop-oldest policy a full channel's oldest notification is evicted to make
+// room, otherwise the notification is dropped. It reports whether the
+// notification was queued. Callers must be the channel's only sender.
+func sendOrEvict(channel chan models.Notification, notification models.Notification, policy string) bool {
+	select {
+	case channel <- notification:
+		return true
+	default:
+	}
+
+	if policy != config.OverflowDropOldest {
+		return false
+	}
+
+	select {
+	case evicted := <-channel:
+		log.Printf("Evicted notification %d of user %d from a full channel", evicted.ID, evicted.UserID)
+	default:
+		// The reader emptied the channel meanwhile
+	}
+
+	select {
+	case channel <- notification:
+		return true
+	default:
+		return false
+	}
 }
 
 // periodicCleanup performs periodic cleanup of old notifications
@@ -120,10 +319,23 @@ func (s *Service) periodicCleanup(ctx context.Context) {
 	}
 }
 
-// cleanupOldNotifications removes old notifications
+// cleanupOldNotifications deletes or, when configured, archives notifications
+// older than the retention period
 func (s *Service) cleanupOldNotifications() {
-	// Remove notifications older than 30 days
-	cutoff := time.Now().AddDate(0, 0, -30)
+	cutoff := time.Now().AddDate(0, 0, -s.config.Notification.RetentionDays)
+
+	if s.config.Notification.ArchiveOld {
+		result := s.db.Model(&models.Notification{}).
+			Where("delivered_at < ? AND archived = ?", cutoff, false).
+			Update("archived", true)
+		if result.Error != nil {
+			log.Printf("Failed to archive old notifications: %v", result.Error)
+			return
+		}
+		log.Printf("Archived %d old notifications", result.RowsAffected)
+		return
+	}
+
 	result := s.db.Where("delivered_at < ?", cutoff).Delete(&models.Notification{})
 	if result.Error != nil {
 		log.Printf("Failed to cleanup old notifications: %v", result.Error)
@@ -138,51 +350,57 @@ func (s *Service) cleanupInactiveChannels() {
 	defer s.channelsMutex.Unlock()
 
 	// Simply log the number of active channels - actual cleanup is done when user disconnects
-	log.Printf("Currently %d active user channels", len(s.userChannels))
+	channels := 0
+	for _, userChannels := range s.userChannels {
+		channels += len(userChannels)
+	}
+	log.Printf("Currently %d active channels of %d users", channels, len(s.userChannels))
 }
 
-// RegisterUserChannel registers a new user channel for notifications
-func (s *Service) RegisterUserChannel(userID uint) chan string {
+// RegisterUserChannel registers a new channel for notifications to a user,
+// one per connection, so a user's connections each get every notification
+func (s *Service) RegisterUserChannel(userID uint) chan models.Notification {
 	s.channelsMutex.Lock()
 	defer s.channelsMutex.Unlock()
 
-	// Close existing channel if any
-	if channel, exists := s.userChannels[userID]; exists {
-		close(channel)
+	channel := make(chan models.Notification, s.config.Notification.ChannelBufferSize)
+	if s.userChannels[userID] == nil {
+		s.userChannels[userID] = make(map[chan models.Notification]struct{})
 	}
-
-	// Create a new channel for the user
-	channel := make(chan string, 100) // Buffer for up to 100 notifications
-	s.userChannels[userID] = channel
+	s.userChannels[userID][channel] = struct{}{}
 
 	return channel
 }
 
-// UnregisterUserChannel unregisters a user channel
-func (s *Service) UnregisterUserChannel(userID uint) {
+// UnregisterUserChannel unregisters and closes a channel registered for a
+// user, leaving the channels of the user's other connections open
+func (s *Service) UnregisterUserChannel(userID uint, channel chan models.Notification) {
 	s.channelsMutex.Lock()
 	defer s.channelsMutex.Unlock()
 
-	if channel, exists := s.userChannels[userID]; exists {
-		close(channel)
+	userChannels := s.userChannels[userID]
+	if _, exists := userChannels[channel]; !exists {
+		return
+	}
+	close(channel)
+	delete(userChannels, channel)
+	if len(userChannels) == 0 {
 		delete(s.userChannels, userID)
 	}
 }
 
 // GetUnreadNotifications gets unread notifications for a user
-func (s *Service) GetUnreadNotifications(userID uint, limit, offset int) ([]models.Notification, int64, error) {
+func (s *Service) GetUnreadNotifications(ctx context.Context, userID uint, limit, offset int) ([]models.Notification, int64, error) {
 	var notifications []models.Notification
-	var total int64
 
 	// Count total unread notifications
-	if err := s.db.Model(&models.Notification{}).
-		Where("user_id = ? AND is_read = ?", userID, false).
-		Count(&total).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to count notifications: %w", err)
+	total, err := s.GetUnreadCount(ctx, userID)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	// Get paginated unread notifications
-	if err := s.db.Where("user_id = ? AND is_read = ?", userID, false).
+	if err := s.db.WithContext(ctx).Where("user_id = ? AND is_read = ? AND archived = ?", userID, false, false).
 		Order("delivered_at DESC").
 		Limit(limit).
 		Offset(offset).
@@ -193,22 +411,78 @@ func (s *Service) GetUnreadNotifications(userID uint, limit, offset int) ([]mode
 	return notifications, total, nil
 }
 
-// MarkNotificationAsRead marks a notification as read
-func (s *Service) MarkNotificationAsRead(notificationID uint) error {
-	if err := s.db.Model(&models.Notification{}).
-		Where("id = ?", notificationID).
-		Update("is_read", true).Error; err != nil {
-		return fmt.Errorf("failed to mark notification as read: %w", err)
+// GetUnreadCount counts the unread notifications of a user
+func (s *Service) GetUnreadCount(ctx context.Context, userID uint) (int64, error) {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.Notification{}).
+		Where("user_id = ? AND is_read = ? AND archived = ?", userID, false, false).
+		Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count notifications: %w", err)
+	}
+	return count, nil
+}
+
+// errNotificationNotFound is returned when a user has no notification with an ID
+var errNotificationNotFound = errors.New("notification not found")
+
+// MarkNotificationAsRead marks a notification of a user as read, returning
+// errNotificationNotFound if the notification doesn't exist or belongs to
+// another user
+func (s *Service) MarkNotificationAsRead(ctx context.Context, userID, notificationID uint) error {
+	result := s.db.WithContext(ctx).Model(&models.Notification{}).
+		Where("id = ? AND user_id = ?", notificationID, userID).
+		Update("is_read", true)
+	if result.Error != nil {
+		return fmt.Errorf("failed to mark notification as read: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errNotificationNotFound
 	}
 	return nil
 }
 
 // MarkAllNotificationsAsRead marks all notifications as read for a user
-func (s *Service) MarkAllNotificationsAsRead(userID uint) error {
-	if err := s.db.Model(&models.Notification{}).
+func (s *Service) MarkAllNotificationsAsRead(ctx context.Context, userID uint) error {
+	if err := s.db.WithContext(ctx).Model(&models.Notification{}).
 		Where("user_id = ? AND is_read = ?", userID, false).
 		Update("is_read", true).Error; err != nil {
 		return fmt.Errorf("failed to mark all notifications as read: %w", err)
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// MarkNotificationsAsRead marks the unread notifications of a user among
+// notificationIDs as read, ignoring IDs of other users' notifications, and
+// returns how many were marked
+func (s *Service) MarkNotificationsAsRead(ctx context.Context, userID uint, notificationIDs []uint) (int64, error) {
+	result := s.db.WithContext(ctx).Model(&models.Notification{}).
+		Where("id IN ? AND user_id = ? AND is_read = ?", notificationIDs, userID, false).
+		Update("is_read", true)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to mark notifications as read: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// GetPreferences gets the notification preferences of a user, the defaults if they have none
+func (s *Service) GetPreferences(ctx context.Context, userID uint) (*models.NotificationPreference, error) {
+	preferences := &models.NotificationPreference{UserID: userID}
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).
+		Limit(1).
+		Find(preferences).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch notification preferences: %w", err)
+	}
+	return preferences, nil
+}
+
+// UpdatePreferences creates or updates the notification preferences of a user
+func (s *Service) UpdatePreferences(ctx context.Context, userID uint, digestMode bool) (*models.NotificationPreference, error) {
+	preferences := &models.NotificationPreference{UserID: userID, DigestMode: digestMode}
+	if err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"digest_mode", "updated_at"}),
+	}).Create(preferences).Error; err != nil {
+		return nil, fmt.Errorf("failed to update notification preferences: %w", err)
+	}
+	return preferences, nil
+}
@@ -0,0 +1,132 @@
+package notification
+
+import (
+	"testing"
+	"time"
+
+	"github.com/e-commerce/platform/internal/common/config"
+	"github.com/e-commerce/platform/internal/common/models"
+)
+
+// newTestService creates a service without database or Kafka, for testing
+// channel delivery
+func newTestService(bufferSize int, policy string) *Service {
+	cfg := &config.Config{}
+	cfg.Notification.ChannelBufferSize = bufferSize
+	cfg.Notification.OverflowPolicy = policy
+	return NewNotificationService(nil, nil, cfg)
+}
+
+// receive returns the notification waiting on a channel, if any
+func receive(channel chan models.Notification) (models.Notification, bool) {
+	select {
+	case notification, ok := <-channel:
+		return notification, ok
+	default:
+		return models.Notification{}, false
+	}
+}
+
+func TestUserChannelsPerConnection(t *testing.T) {
+	s := newTestService(10, config.OverflowDropNewest)
+
+	first := s.RegisterUserChannel(1)
+	second := s.RegisterUserChannel(1)
+	other := s.RegisterUserChannel(2)
+
+	s.deliverToChannel(models.Notification{Model: models.Model{ID: 1}, UserID: 1})
+	for name, channel := range map[string]chan models.Notification{"first": first, "second": second} {
+		if notification, ok := receive(channel); !ok || notification.ID != 1 {
+			t.Errorf("%s connection didn't receive the notification", name)
+		}
+	}
+	if _, ok := receive(other); ok {
+		t.Error("another user's connection received the notification")
+	}
+
+	// Closing the first connection leaves the second one registered and open
+	s.UnregisterUserChannel(1, first)
+	if _, ok := <-first; ok {
+		t.Error("unregistered channel is still open")
+	}
+	s.deliverToChannel(models.Notification{Model: models.Model{ID: 2}, UserID: 1})
+	if notification, ok := receive(second); !ok || notification.ID != 2 {
+		t.Error("second connection didn't receive the notification after the first closed")
+	}
+
+	// Unregistering twice is a no-op
+	s.UnregisterUserChannel(1, first)
+
+	s.UnregisterUserChannel(1, second)
+	s.UnregisterUserChannel(2, other)
+	if len(s.userChannels) != 0 {
+		t.Errorf("%d users still have channels after all disconnected", len(s.userChannels))
+	}
+}
+
+func TestSendOrEvict(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    string
+		queued    bool
+		remaining []uint
+	}{
+		{"drop newest", config.OverflowDropNewest, false, []uint{1, 2}},
+		{"drop oldest", config.OverflowDropOldest, true, []uint{2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := make(chan models.Notification, 2)
+			channel <- models.Notification{Model: models.Model{ID: 1}}
+			channel <- models.Notification{Model: models.Model{ID: 2}}
+
+			if queued := sendOrEvict(channel, models.Notification{Model: models.Model{ID: 3}}, tt.policy); queued != tt.queued {
+				t.Errorf("queued = %v, want %v", queued, tt.queued)
+			}
+			for _, want := range tt.remaining {
+				if notification := <-channel; notification.ID != want {
+					t.Errorf("got notification %d, want %d", notification.ID, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAlertMessageDedupeKey(t *testing.T) {
+	drop := alertMessage{Type: priceDropType, UserID: 1, ProductID: 2, VariantID: 3, NewPrice: 90, HistoryID: 7}
+	bucket := time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC)
+	before, after := bucket.Add(-time.Second), bucket.Add(time.Second)
+
+	otherChange := drop
+	otherChange.HistoryID = 8
+	otherUser := drop
+	otherUser.UserID = 4
+	lowStock := alertMessage{Type: lowStockType, UserID: 1, ProductID: 2, VariantID: 3, NewStock: 2, HistoryID: 7}
+	legacy := drop
+	legacy.HistoryID = 0
+
+	tests := []struct {
+		name   string
+		a, b   alertMessage
+		at, bt time.Time
+		same   bool
+	}{
+		{"redelivered across a bucket boundary", drop, drop, before, after, true},
+		{"redelivered a day later", drop, drop, before, before.Add(24 * time.Hour), true},
+		{"another change", drop, otherChange, before, before, false},
+		{"another user", drop, otherUser, before, before, false},
+		{"low stock of the same change ID", drop, lowStock, before, before, false},
+		{"without the change, same bucket", legacy, legacy, after, after.Add(time.Minute), true},
+		{"without the change, next bucket", legacy, legacy, before, after, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := tt.a.dedupeKey(tt.at), tt.b.dedupeKey(tt.bt)
+			if (a == b) != tt.same {
+				t.Errorf("keys %q and %q, want same = %v", a, b, tt.same)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/e-commerce/platform/internal/common/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// webhookTimeout is the timeout for a single webhook request
+	webhookTimeout = 10 * time.Second
+	// webhookAttempts is the number of delivery attempts per notification
+	webhookAttempts = 3
+	// webhookBackoff is the initial delay between delivery attempts, doubled after each attempt
+	webhookBackoff = 2 * time.Second
+	// maxWebhookFailures is the number of consecutive failed deliveries after which a webhook is disabled
+	maxWebhookFailures = 5
+	// webhookSignatureHeader carries the HMAC-SHA256 signature of the request body
+	webhookSignatureHeader = "X-Signature-256"
+)
+
+// webhookPayload is the body posted to webhook URLs
+type webhookPayload struct {
+	NotificationID uint      `json:"notification_id"`
+	Type           string    `json:"type"`
+	Message        string    `json:"message"`
+	DeliveredAt    time.Time `json:"delivered_at"`
+	alertMessage
+}
+
+// digestWebhookPayload is the body posted to webhook URLs for a daily digest
+type digestWebhookPayload struct {
+	NotificationID uint                `json:"notification_id"`
+	Type           string              `json:"type"`
+	Message        string              `json:"message"`
+	DeliveredAt    time.Time           `json:"delivered_at"`
+	Drops          []models.DigestItem `json:"drops"`
+}
+
+// errWebhookAddress is returned for webhook URLs that don't resolve to public addresses
+var errWebhookAddress = errors.New("webhook URL must resolve to a public address")
+
+// publicAddress reports whether ip is a public unicast address, so webhooks
+// can't be pointed at the services next to the notification service
+func publicAddress(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// checkWebhookURL checks that a webhook URL is an http or https URL whose
+// host resolves to public addresses only
+func checkWebhookURL(ctx context.Context, resolver *net.Resolver, rawURL string) error {
+	parsedURL, err := url.ParseRequestURI(rawURL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Hostname() == "" {
+		return fmt.Errorf("invalid webhook URL %q", rawURL)
+	}
+
+	addrs, err := resolver.LookupIPAddr(ctx, parsedURL.Hostname())
+	if err != nil {
+		return fmt.Errorf("failed to resolve webhook host: %w", err)
+	}
+	for _, addr := range addrs {
+		if !publicAddress(addr.IP) {
+			return errWebhookAddress
+		}
+	}
+	return nil
+}
+
+// dialPublicOnly refuses connections to addresses that aren't public. It runs
+// on the resolved address of every connection, so hosts re-resolving to
+// internal addresses after registration and redirects to them are refused.
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicAddress(ip) {
+		return errWebhookAddress
+	}
+	return nil
+}
+
+// newWebhookClient creates the HTTP client webhooks are delivered with, which
+// only connects to public addresses unless allowPrivate is set
+func newWebhookClient(allowPrivate bool) *http.Client {
+	client := &http.Client{Timeout: webhookTimeout}
+	if allowPrivate {
+		return client
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // A proxy would make the connection on our behalf, unchecked
+	transport.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   dialPublicOnly,
+	}).DialContext
+	client.Transport = transport
+	return client
+}
+
+// deliverWebhooks posts a notification payload to all active webhooks of a user
+func (s *Service) deliverWebhooks(ctx context.Context, userID uint, payload interface{}) {
+	var webhooks []models.Webhook
+	if err := s.db.WithContext(ctx).Where("user_id = ? AND active = ?", userID, true).Find(&webhooks).Error; err != nil {
+		log.Printf("Failed to fetch webhooks for user %d: %v", userID, err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Failed to marshal webhook payload: %v", err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		if err := s.sendWebhook(ctx, webhook, body); err != nil {
+			log.Printf("Failed to deliver notification to webhook %d: %v", webhook.ID, err)
+			s.recordWebhookFailure(webhook)
+			continue
+		}
+
+		if webhook.ConsecutiveFailures > 0 {
+			if err := s.db.Model(&webhook).Update("consecutive_failures", 0).Error; err != nil {
+				log.Printf("Failed to reset webhook failures: %v", err)
+			}
+		}
+	}
+}
+
+// sendWebhook posts a signed body to a webhook, retrying with backoff on failure
+func (s *Service) sendWebhook(ctx context.Context, webhook models.Webhook, body []byte) error {
+	signature := signWebhookBody(webhook.Secret, body)
+	backoff := webhookBackoff
+
+	var lastErr error
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(webhookSignatureHeader, signature)
+
+		resp, err := s.webhookClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				return nil
+			}
+			lastErr = fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		} else {
+			lastErr = fmt.Errorf("failed to send request: %w", err)
+		}
+
+		if attempt < webhookAttempts {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+	}
+
+	return lastErr
+}
+
+// recordWebhookFailure increments a webhook's failure count and disables it
+// after too many consecutive failures
+func (s *Service) recordWebhookFailure(webhook models.Webhook) {
+	failures := webhook.ConsecutiveFailures + 1
+	updates := map[string]interface{}{
+		"consecutive_failures": gorm.Expr("consecutive_failures + 1"),
+	}
+	if failures >= maxWebhookFailures {
+		updates["active"] = false
+		log.Printf("Disabling webhook %d after %d consecutive failures", webhook.ID, failures)
+	}
+
+	if err := s.db.Model(&webhook).Updates(updates).Error; err != nil {
+		log.Printf("Failed to record webhook failure: %v", err)
+	}
+}
+
+// signWebhookBody returns the HMAC-SHA256 signature header value for a body
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// generateWebhookSecret generates a random secret for signing webhook bodies
+func generateWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// CreateWebhook registers a webhook for a user, generating a secret if none is given
+func (s *Service) CreateWebhook(ctx context.Context, userID uint, url, secret string) (*models.Webhook, error) {
+	if secret == "" {
+		generated, err := generateWebhookSecret()
+		if err != nil {
+			return nil, err
+		}
+		secret = generated
+	}
+
+	webhook := &models.Webhook{
+		UserID: userID,
+		URL:    url,
+		Secret: secret,
+		Active: true,
+	}
+	if err := s.db.WithContext(ctx).Create(webhook).Error; err != nil {
+		return nil, fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	return webhook, nil
+}
+
+// GetWebhooks gets the webhooks registered by a user
+func (s *Service) GetWebhooks(ctx context.Context, userID uint) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&webhooks).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// errWebhookNotFound is returned when a user has no webhook with an ID
+var errWebhookNotFound = errors.New("webhook not found")
+
+// DeleteWebhook deletes a webhook of a user, returning errWebhookNotFound if
+// the user has no webhook with that ID
+func (s *Service) DeleteWebhook(ctx context.Context, userID, webhookID uint) error {
+	result := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", webhookID, userID).Delete(&models.Webhook{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete webhook: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errWebhookNotFound
+	}
+	return nil
+}
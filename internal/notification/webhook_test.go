@@ -0,0 +1,264 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/e-commerce/platform/internal/common/config"
+	"github.com/e-commerce/platform/internal/common/db/dbtest"
+	"github.com/e-commerce/platform/internal/common/models"
+	"github.com/labstack/echo/v4"
+)
+
+func TestPublicAddress(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.0.0.1", false},
+		{"172.16.5.4", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false}, // Cloud metadata service
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"::ffff:127.0.0.1", false},
+		{"224.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if public := publicAddress(net.ParseIP(tt.ip)); public != tt.public {
+				t.Errorf("publicAddress(%s) = %v, want %v", tt.ip, public, tt.public)
+			}
+		})
+	}
+}
+
+func TestCheckWebhookURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr error
+	}{
+		{"https://93.184.216.34/hook", nil},
+		{"http://127.0.0.1:8080/hook", errWebhookAddress},
+		{"http://[::1]/hook", errWebhookAddress},
+		{"http://169.254.169.254/latest/meta-data", errWebhookAddress},
+		{"http://10.1.2.3/hook", errWebhookAddress},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := checkWebhookURL(context.Background(), net.DefaultResolver, tt.url)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkWebhookURL(%s) = %v, want %v", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"ftp://93.184.216.34/hook", "not a url", "http:///hook"} {
+		if err := checkWebhookURL(context.Background(), net.DefaultResolver, invalid); err == nil {
+			t.Errorf("checkWebhookURL(%s) accepted an invalid URL", invalid)
+		}
+	}
+}
+
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		allowPrivate bool
+		wantErr      bool
+	}{
+		{"restricted", false, true},
+		{"private allowed", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := newWebhookClient(tt.allowPrivate).Post(server.URL, "application/json", strings.NewReader("{}"))
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, errWebhookAddress) {
+				t.Errorf("error = %v, want %v", err, errWebhookAddress)
+			}
+		})
+	}
+}
+
+func TestSignWebhookBody(t *testing.T) {
+	body := []byte(`{"notification_id":1}`)
+	signature := signWebhookBody("secret", body)
+
+	if !strings.HasPrefix(signature, "sha256=") || len(signature) != len("sha256=")+64 {
+		t.Fatalf("unexpected signature format %q", signature)
+	}
+	if signWebhookBody("secret", body) != signature {
+		t.Error("signature isn't deterministic")
+	}
+	if signWebhookBody("other", body) == signature {
+		t.Error("signature doesn't depend on the secret")
+	}
+}
+
+// webhookRequest returns an echo context for a webhook request with a bearer token
+func webhookRequest(method, id, body, token string) (echo.Context, *httptest.ResponseRecorder) {
+	target := "/api/v1/notifications/webhooks"
+	if id != "" {
+		target += "/" + id
+	}
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	if id != "" {
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+	}
+	return c, rec
+}
+
+func TestWebhooksRequireToken(t *testing.T) {
+	const secret = "test-secret"
+	expired := NewWebSocketToken(secret, 1, time.Now().Add(-time.Minute))
+	forged := NewWebSocketToken("other-secret", 1, time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name   string
+		secret string
+		token  string
+		status int
+	}{
+		{"authentication not configured", "", "", http.StatusServiceUnavailable},
+		{"missing token", secret, "", http.StatusUnauthorized},
+		{"expired token", secret, expired, http.StatusUnauthorized},
+		{"token signed with another secret", secret, forged, http.StatusUnauthorized},
+	}
+
+	// The user ID in the body or query must not be trusted in place of a token
+	routes := []struct {
+		name    string
+		method  string
+		id      string
+		body    string
+		handler func(*API, echo.Context) error
+	}{
+		{"create", http.MethodPost, "", `{"user_id": 1, "url": "https://example.com/hook"}`, (*API).createWebhook},
+		{"list", http.MethodGet, "", "", (*API).getWebhooks},
+		{"delete", http.MethodDelete, "1", "", (*API).deleteWebhook},
+	}
+
+	for _, route := range routes {
+		for _, tt := range tests {
+			t.Run(route.name+"/"+tt.name, func(t *testing.T) {
+				cfg := &config.Config{}
+				cfg.Notification.WebSocketTokenSecret = tt.secret
+				api := &API{config: cfg}
+
+				c, _ := webhookRequest(route.method, route.id, route.body, tt.token)
+				c.QueryParams().Set("user_id", "1")
+
+				err := route.handler(api, c)
+				var httpErr *echo.HTTPError
+				if !errors.As(err, &httpErr) {
+					t.Fatalf("expected an HTTP error, got %v", err)
+				}
+				if httpErr.Code != tt.status {
+					t.Errorf("status = %d, want %d", httpErr.Code, tt.status)
+				}
+			})
+		}
+	}
+}
+
+func TestWebhooksOfOtherUser(t *testing.T) {
+	const secret = "test-secret"
+	database := dbtest.Open(t)
+	cfg := &config.Config{}
+	cfg.Notification.WebSocketTokenSecret = secret
+	api := &API{db: database, config: cfg, service: NewNotificationService(database, nil, cfg)}
+
+	// Users 1 and 2 each have a webhook
+	webhooks := []models.Webhook{
+		{UserID: 1, URL: "https://example.com/one", Secret: "one", Active: true},
+		{UserID: 2, URL: "https://example.com/two", Secret: "two", Active: true},
+	}
+	if err := database.Create(&webhooks).Error; err != nil {
+		t.Fatal(err)
+	}
+	token := NewWebSocketToken(secret, 1, time.Now().Add(time.Hour))
+
+	// Listing returns only the caller's webhooks, whatever user is asked for
+	c, rec := webhookRequest(http.MethodGet, "", "", token)
+	c.QueryParams().Set("user_id", "2")
+	if err := api.getWebhooks(c); err != nil {
+		t.Fatal(err)
+	}
+	var listed []models.Webhook
+	if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].ID != webhooks[0].ID {
+		t.Errorf("listed %+v, want only the webhook of user 1", listed)
+	}
+
+	tests := []struct {
+		name    string
+		webhook uint
+		status  int
+	}{
+		{"other user's webhook", webhooks[1].ID, http.StatusNotFound},
+		{"own webhook", webhooks[0].ID, http.StatusOK},
+		{"already deleted", webhooks[0].ID, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := webhookRequest(http.MethodDelete, strconv.FormatUint(uint64(tt.webhook), 10), "", token)
+
+			status := http.StatusOK
+			if err := api.deleteWebhook(c); err != nil {
+				var httpErr *echo.HTTPError
+				if !errors.As(err, &httpErr) {
+					t.Fatalf("expected an HTTP error, got %v", err)
+				}
+				status = httpErr.Code
+			}
+			if status != tt.status {
+				t.Errorf("status = %d, want %d", status, tt.status)
+			}
+		})
+	}
+
+	// The other user's webhook still delivers their notifications
+	var count int64
+	if err := database.Model(&models.Webhook{}).Where("id = ?", webhooks[1].ID).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Error("webhook of user 2 was deleted by user 1")
+	}
+}
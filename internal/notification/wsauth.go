@@ -0,0 +1,111 @@
+package notification
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WebSocket token errors
+var (
+	errMissingToken = errors.New("missing token")
+	errInvalidToken = errors.New("invalid token")
+	errExpiredToken = errors.New("token expired")
+	errTokenUser    = errors.New("token was issued for another user")
+)
+
+// NewWebSocketToken creates a token authorizing a user to subscribe to their
+// notifications, and to mark them as read, until expiresAt. Tokens have the form
+// <user_id>.<expiry unix seconds>.<hex HMAC-SHA256 of "<user_id>.<expiry>">
+// and are signed with the NOTIFICATION_WS_TOKEN_SECRET shared with the
+// service issuing them.
+func NewWebSocketToken(secret string, userID uint, expiresAt time.Time) string {
+	payload := fmt.Sprintf("%d.%d", userID, expiresAt.Unix())
+	return payload + "." + signWebSocketToken(secret, payload)
+}
+
+// signWebSocketToken returns the hex HMAC-SHA256 signature of a token payload
+func signWebSocketToken(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyWebSocketToken checks that a token is correctly signed, unexpired at
+// now and issued for userID
+func verifyWebSocketToken(secret, token string, userID uint, now time.Time) error {
+	tokenUserID, err := parseWebSocketToken(secret, token, now)
+	if err != nil {
+		return err
+	}
+	if tokenUserID != userID {
+		return errTokenUser
+	}
+	return nil
+}
+
+// parseWebSocketToken checks that a token is correctly signed and unexpired
+// at now, and returns the user it was issued for
+func parseWebSocketToken(secret, token string, now time.Time) (uint, error) {
+	if token == "" {
+		return 0, errMissingToken
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, errInvalidToken
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(signWebSocketToken(secret, payload))) {
+		return 0, errInvalidToken
+	}
+
+	userID, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return 0, errInvalidToken
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, errInvalidToken
+	}
+
+	if !now.Before(time.Unix(expiry, 0)) {
+		return 0, errExpiredToken
+	}
+	return uint(userID), nil
+}
+
+// webSocketToken returns the token of a WebSocket upgrade request, from the
+// token query parameter, as browsers can't set headers on WebSocket requests,
+// or a bearer Authorization header
+func webSocketToken(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return ""
+}
+
+// originAllowed reports whether a WebSocket request may be upgraded from its
+// Origin. Requests without an Origin don't come from browsers and are allowed,
+// browser origins must be in allowed, where "*" allows any origin.
+func originAllowed(r *http.Request, allowed []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, candidate := range allowed {
+		if candidate == "*" || strings.EqualFold(candidate, origin) {
+			return true
+		}
+	}
+	return false
+}
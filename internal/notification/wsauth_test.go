@@ -0,0 +1,148 @@
+package notification
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/e-commerce/platform/internal/common/config"
+	"github.com/labstack/echo/v4"
+)
+
+func TestVerifyWebSocketToken(t *testing.T) {
+	const secret = "test-secret"
+	now := time.Unix(1700000000, 0)
+	valid := NewWebSocketToken(secret, 1, now.Add(time.Hour))
+	parts := strings.Split(valid, ".")
+
+	tests := []struct {
+		name   string
+		token  string
+		userID uint
+		want   error
+	}{
+		{"valid", valid, 1, nil},
+		{"missing", "", 1, errMissingToken},
+		{"other user", valid, 2, errTokenUser},
+		{"expired", NewWebSocketToken(secret, 1, now.Add(-time.Second)), 1, errExpiredToken},
+		{"expires now", NewWebSocketToken(secret, 1, now), 1, errExpiredToken},
+		{"other secret", NewWebSocketToken("other-secret", 1, now.Add(time.Hour)), 1, errInvalidToken},
+		{"malformed", "1." + parts[1], 1, errInvalidToken},
+		{"extra part", valid + ".x", 1, errInvalidToken},
+		{"user changed", "2." + parts[1] + "." + parts[2], 2, errInvalidToken},
+		{"expiry extended", parts[0] + "." + strconv.FormatInt(now.Add(24*time.Hour).Unix(), 10) + "." + parts[2], 1, errInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyWebSocketToken(secret, tt.token, tt.userID, now); !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebSocketToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		header string
+		want   string
+	}{
+		{"query", "token=a", "", "a"},
+		{"bearer header", "", "Bearer b", "b"},
+		{"query preferred", "token=a", "Bearer b", "a"},
+		{"other scheme", "", "Basic b", ""},
+		{"none", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ws/1?"+tt.query, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			if got := webSocketToken(req); got != tt.want {
+				t.Errorf("token = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOriginAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		origin  string
+		allowed []string
+		want    bool
+	}{
+		{"no origin", "", nil, true},
+		{"listed", "https://shop.example.com", []string{"https://shop.example.com"}, true},
+		{"case insensitive", "https://Shop.Example.com", []string{"https://shop.example.com"}, true},
+		{"wildcard", "https://evil.example.com", []string{"*"}, true},
+		{"not listed", "https://evil.example.com", []string{"https://shop.example.com"}, false},
+		{"none allowed", "https://shop.example.com", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ws/1", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if got := originAllowed(req, tt.allowed); got != tt.want {
+				t.Errorf("originAllowed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeSubscription(t *testing.T) {
+	const secret = "test-secret"
+	token := NewWebSocketToken(secret, 1, time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name   string
+		secret string
+		userID string
+		token  string
+		origin string
+		status int
+	}{
+		{"invalid user ID", secret, "abc", token, "", http.StatusBadRequest},
+		{"authentication not configured", "", "1", token, "", http.StatusServiceUnavailable},
+		{"missing token", secret, "1", "", "", http.StatusUnauthorized},
+		{"token for another user", secret, "2", token, "", http.StatusUnauthorized},
+		{"origin not allowed", secret, "1", token, "https://evil.example.com", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Notification.WebSocketTokenSecret = tt.secret
+			cfg.Notification.WebSocketAllowedOrigins = []string{"https://shop.example.com"}
+			api := &API{config: cfg}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/notifications/ws/"+tt.userID+"?token="+tt.token, nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+			c.SetParamNames("user_id")
+			c.SetParamValues(tt.userID)
+
+			_, err := api.authorizeSubscription(c)
+			var httpErr *echo.HTTPError
+			if !errors.As(err, &httpErr) {
+				t.Fatalf("expected an HTTP error, got %v", err)
+			}
+			if httpErr.Code != tt.status {
+				t.Errorf("status = %d, want %d", httpErr.Code, tt.status)
+			}
+		})
+	}
+}
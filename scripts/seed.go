@@ -1,15 +1,101 @@
 package main
 
 import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/e-commerce/platform/internal/common/config"
 	"github.com/e-commerce/platform/internal/common/db"
 	"github.com/e-commerce/platform/internal/common/models"
+	"gorm.io/gorm"
 )
 
+// seededTables are the tables truncated by -reset, children first
+var seededTables = []string{
+	"price_histories", "user_favorites", "users", "variants", "products", "sellers", "brands", "categories",
+}
+
+// seeder creates rows that don't exist yet, or only reports them in dry-run mode
+type seeder struct {
+	db          *gorm.DB
+	dryRun      bool
+	assumeEmpty bool // Set by a dry-run reset, as the tables would be empty
+}
+
+// ensure loads the row matching query into value, or creates value if there is
+// none. Either way value's ID is set, so later rows can reference it instead of
+// assuming insertion order. It reports whether value was (or in dry-run mode
+// would be) created.
+func (s *seeder) ensure(kind, name string, value interface{}, query string, args ...interface{}) (bool, error) {
+	if !s.assumeEmpty {
+		err := s.db.Where(query, args...).First(value).Error
+		if err == nil {
+			return false, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, fmt.Errorf("failed to look up %s %s: %w", kind, name, err)
+		}
+	}
+
+	if s.dryRun {
+		log.Printf("Would create %s %s", kind, name)
+		return true, nil
+	}
+
+	if err := s.db.Create(value).Error; err != nil {
+		return false, fmt.Errorf("failed to create %s %s: %w", kind, name, err)
+	}
+	return true, nil
+}
+
+// seedCounter counts created and existing rows of one kind
+type seedCounter struct {
+	kind     string
+	created  int
+	existing int
+}
+
+// add records the outcome of seeder.ensure, logging errors
+func (c *seedCounter) add(created bool, err error) {
+	switch {
+	case err != nil:
+		log.Printf("Error seeding %s: %v", c.kind, err)
+	case created:
+		c.created++
+	default:
+		c.existing++
+	}
+}
+
+// report logs the counts
+func (c *seedCounter) report(dryRun bool) {
+	verb := "Created"
+	if dryRun {
+		verb = "Would create"
+	}
+	log.Printf("%s %d %s, %d already existed", verb, c.created, c.kind, c.existing)
+}
+
+// confirmReset asks for confirmation on stdin before truncating the seeded tables
+func confirmReset() bool {
+	fmt.Printf("This deletes all rows of %s and the rows referencing them.\nType 'yes' to continue: ",
+		strings.Join(seededTables, ", "))
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(answer) == "yes"
+}
+
 func main() {
+	dryRun := flag.Bool("dry-run", false, "print what would be created without writing")
+	reset := flag.Bool("reset", false, "truncate the seeded tables before seeding")
+	force := flag.Bool("force", false, "skip the confirmation of -reset")
+	flag.Parse()
+
 	// Load configuration
 	cfg, err := config.LoadConfig()
 	if err != nil {
@@ -22,7 +108,24 @@ func main() {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
-	// Seed database with sample data
+	seed := &seeder{db: database.DB, dryRun: *dryRun}
+
+	if *reset {
+		if *dryRun {
+			log.Printf("Would truncate %s", strings.Join(seededTables, ", "))
+			seed.assumeEmpty = true
+		} else {
+			if !*force && !confirmReset() {
+				log.Fatal("Reset not confirmed, aborting")
+			}
+			if err := database.Exec("TRUNCATE TABLE " + strings.Join(seededTables, ", ") + " RESTART IDENTITY CASCADE").Error; err != nil {
+				log.Fatalf("Failed to truncate tables: %v", err)
+			}
+			log.Printf("Truncated %s", strings.Join(seededTables, ", "))
+		}
+	}
+
+	// Seed database with sample data, skipping rows that already exist
 	log.Println("Starting database seeding...")
 
 	// Create sample categories
@@ -47,16 +150,16 @@ func main() {
 		},
 	}
 
-	for i, _ := range categories {
+	categoryCount := seedCounter{kind: "categories"}
+	for i := range categories {
 		if i > 0 {
-			parentID := uint(1) // Set Electronics as parent
+			parentID := categories[0].ID // Set Electronics as parent
 			categories[i].ParentID = &parentID
 		}
-		if err := database.Create(&categories[i]).Error; err != nil {
-			log.Printf("Error creating category: %v", err)
-		}
+		categoryCount.add(seed.ensure("category", categories[i].Name, &categories[i],
+			"external_id = ?", categories[i].ExternalID))
 	}
-	log.Printf("Created %d categories", len(categories))
+	categoryCount.report(*dryRun)
 
 	// Create sample brands
 	brands := []models.Brand{
@@ -80,12 +183,11 @@ func main() {
 		},
 	}
 
-	for _, brand := range brands {
-		if err := database.Create(&brand).Error; err != nil {
-			log.Printf("Error creating brand: %v", err)
-		}
+	brandCount := seedCounter{kind: "brands"}
+	for i := range brands {
+		brandCount.add(seed.ensure("brand", brands[i].Name, &brands[i], "external_id = ?", brands[i].ExternalID))
 	}
-	log.Printf("Created %d brands", len(brands))
+	brandCount.report(*dryRun)
 
 	// Create sample sellers
 	sellers := []models.Seller{
@@ -105,12 +207,11 @@ func main() {
 		},
 	}
 
-	for _, seller := range sellers {
-		if err := database.Create(&seller).Error; err != nil {
-			log.Printf("Error creating seller: %v", err)
-		}
+	sellerCount := seedCounter{kind: "sellers"}
+	for i := range sellers {
+		sellerCount.add(seed.ensure("seller", sellers[i].Name, &sellers[i], "external_id = ?", sellers[i].ExternalID))
 	}
-	log.Printf("Created %d sellers", len(sellers))
+	sellerCount.report(*dryRun)
 
 	// Create sample products
 	products := []models.Product{
@@ -120,9 +221,9 @@ func main() {
 			Description:   "Apple's latest flagship smartphone with the A17 Pro chip.",
 			URL:           "https://example.com/iphone-15-pro",
 			IsActive:      true,
-			CategoryID:    2,
-			BrandID:       1,
-			SellerID:      1,
+			CategoryID:    categories[1].ID,
+			BrandID:       brands[0].ID,
+			SellerID:      sellers[0].ID,
 			Rating:        4.8,
 			RatingCount:   352,
 			FavoriteCount: 1200,
@@ -135,9 +236,9 @@ func main() {
 			Description:   "Samsung's premium smartphone with an advanced camera system.",
 			URL:           "https://example.com/samsung-s23-ultra",
 			IsActive:      true,
-			CategoryID:    2,
-			BrandID:       2,
-			SellerID:      1,
+			CategoryID:    categories[1].ID,
+			BrandID:       brands[1].ID,
+			SellerID:      sellers[0].ID,
 			Rating:        4.7,
 			RatingCount:   423,
 			FavoriteCount: 980,
@@ -150,9 +251,9 @@ func main() {
 			Description:   "High-performance laptop with a stunning display.",
 			URL:           "https://example.com/dell-xps-15",
 			IsActive:      true,
-			CategoryID:    3,
-			BrandID:       3,
-			SellerID:      2,
+			CategoryID:    categories[2].ID,
+			BrandID:       brands[2].ID,
+			SellerID:      sellers[1].ID,
 			Rating:        4.6,
 			RatingCount:   187,
 			FavoriteCount: 450,
@@ -161,17 +262,17 @@ func main() {
 		},
 	}
 
-	for _, product := range products {
-		if err := database.Create(&product).Error; err != nil {
-			log.Printf("Error creating product: %v", err)
-		}
+	productCount := seedCounter{kind: "products"}
+	for i := range products {
+		productCount.add(seed.ensure("product", products[i].Name, &products[i],
+			"external_id = ?", products[i].ExternalID))
 	}
-	log.Printf("Created %d products", len(products))
+	productCount.report(*dryRun)
 
 	// Create sample variants
 	variants := []models.Variant{
 		{
-			ProductID:     1,
+			ProductID:     products[0].ID,
 			ExternalID:    "50001",
 			Price:         1299.99,
 			OriginalPrice: 1399.99,
@@ -185,7 +286,7 @@ func main() {
 			},
 		},
 		{
-			ProductID:     1,
+			ProductID:     products[0].ID,
 			ExternalID:    "50002",
 			Price:         1499.99,
 			OriginalPrice: 1599.99,
@@ -199,7 +300,7 @@ func main() {
 			},
 		},
 		{
-			ProductID:     2,
+			ProductID:     products[1].ID,
 			ExternalID:    "50003",
 			Price:         1199.99,
 			OriginalPrice: 1299.99,
@@ -213,7 +314,7 @@ func main() {
 			},
 		},
 		{
-			ProductID:     3,
+			ProductID:     products[2].ID,
 			ExternalID:    "50004",
 			Price:         1799.99,
 			OriginalPrice: 1899.99,
@@ -228,12 +329,12 @@ func main() {
 		},
 	}
 
-	for _, variant := range variants {
-		if err := database.Create(&variant).Error; err != nil {
-			log.Printf("Error creating variant: %v", err)
-		}
+	variantCount := seedCounter{kind: "variants"}
+	for i := range variants {
+		variantCount.add(seed.ensure("variant", variants[i].ExternalID, &variants[i],
+			"external_id = ?", variants[i].ExternalID))
 	}
-	log.Printf("Created %d variants", len(variants))
+	variantCount.report(*dryRun)
 
 	// Create sample users
 	users := []models.User{
@@ -245,60 +346,67 @@ func main() {
 		},
 	}
 
-	for _, user := range users {
-		if err := database.Create(&user).Error; err != nil {
-			log.Printf("Error creating user: %v", err)
-		}
+	userCount := seedCounter{kind: "users"}
+	for i := range users {
+		userCount.add(seed.ensure("user", users[i].Email, &users[i], "email = ?", users[i].Email))
 	}
-	log.Printf("Created %d users", len(users))
+	userCount.report(*dryRun)
 
 	// Create sample favorites
 	favorites := []models.UserFavorite{
 		{
-			UserID:    1,
-			ProductID: 1,
+			UserID:    users[0].ID,
+			ProductID: products[0].ID,
 		},
 		{
-			UserID:    1,
-			ProductID: 3,
+			UserID:    users[0].ID,
+			ProductID: products[2].ID,
 		},
 		{
-			UserID:    2,
-			ProductID: 2,
+			UserID:    users[1].ID,
+			ProductID: products[1].ID,
 		},
 	}
 
-	for _, favorite := range favorites {
-		if err := database.Create(&favorite).Error; err != nil {
-			log.Printf("Error creating user favorite: %v", err)
-		}
+	favoriteCount := seedCounter{kind: "user favorites"}
+	for i := range favorites {
+		name := fmt.Sprintf("of user %d for product %d", favorites[i].UserID, favorites[i].ProductID)
+		favoriteCount.add(seed.ensure("user favorite", name, &favorites[i],
+			"user_id = ? AND product_id = ?", favorites[i].UserID, favorites[i].ProductID))
 	}
-	log.Printf("Created %d user favorites", len(favorites))
+	favoriteCount.report(*dryRun)
 
 	// Create sample price histories
 	priceHistories := []models.PriceHistory{
 		{
-			ProductID:     1,
-			VariantID:     1,
+			ProductID:     products[0].ID,
+			VariantID:     variants[0].ID,
 			PreviousPrice: 1399.99,
 			NewPrice:      1299.99,
 			ChangePercent: -7.14,
 		},
 		{
-			ProductID:     2,
-			VariantID:     3,
+			ProductID:     products[1].ID,
+			VariantID:     variants[2].ID,
 			PreviousPrice: 1299.99,
 			NewPrice:      1199.99,
 			ChangePercent: -7.69,
 		},
 	}
 
-	for _, history := range priceHistories {
-		if err := database.Create(&history).Error; err != nil {
-			log.Printf("Error creating price history: %v", err)
-		}
+	historyCount := seedCounter{kind: "price histories"}
+	for i := range priceHistories {
+		name := fmt.Sprintf("of variant %d from %.2f to %.2f", priceHistories[i].VariantID,
+			priceHistories[i].PreviousPrice, priceHistories[i].NewPrice)
+		historyCount.add(seed.ensure("price history", name, &priceHistories[i],
+			"variant_id = ? AND previous_price = ? AND new_price = ?",
+			priceHistories[i].VariantID, priceHistories[i].PreviousPrice, priceHistories[i].NewPrice))
 	}
-	log.Printf("Created %d price histories", len(priceHistories))
+	historyCount.report(*dryRun)
 
+	if *dryRun {
+		log.Println("Dry run completed, nothing was written")
+		return
+	}
 	log.Println("Database seeding completed successfully")
 }